@@ -3,9 +3,13 @@ package main
 import (
 	clientapi "blackbox/internal/client/clientAPI"
 	libre "blackbox/internal/client/libre"
+	hashchain "blackbox/internal/server/hashChain"
+	"blackbox/internal/server/seal"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 	"time"
 
@@ -44,7 +48,10 @@ func menu() {
 		fmt.Println("---------------------------")
 		fmt.Println("1: Вывод информации сервера")
 		fmt.Println("2: Запросить данные сервера")
-		fmt.Println("3: Завершение работы")
+		fmt.Println("3: Запросить печать архива")
+		fmt.Println("4: Проверить печать архива")
+		fmt.Println("5: Диагностика обмена с устройствами")
+		fmt.Println("6: Завершение работы")
 		fmt.Print("->")
 		_, err := fmt.Scanln(&str)
 		if err != nil {
@@ -77,6 +84,50 @@ func menu() {
 			continue
 
 		case "3":
+			fmt.Println()
+			fmt.Print("Введите дату печати (YYYY-MM-DD): ")
+			fmt.Scanln(&str)
+
+			fileName, err := saveSeal(str)
+			if err != nil {
+				fmt.Printf("Ошибка запроса печати архива: {%v}\n", err)
+				fmt.Println()
+				continue
+			}
+			fmt.Printf("Печать сохранена в файл {%s}\n", fileName)
+			fmt.Println()
+			continue
+
+		case "4":
+			var fileXlsx, fileSeal, fileKey string
+
+			fmt.Println()
+			fmt.Print("Введите имя xlsx файла данных: ")
+			fmt.Scanln(&fileXlsx)
+			fmt.Print("Введите имя файла печати: ")
+			fmt.Scanln(&fileSeal)
+			fmt.Print("Введите имя файла открытого ключа: ")
+			fmt.Scanln(&fileKey)
+
+			err := verifySeal(fileXlsx, fileSeal, fileKey)
+			if err != nil {
+				fmt.Printf("Печать НЕ подтверждена: {%v}\n", err)
+				fmt.Println()
+				continue
+			}
+			fmt.Println("Печать подтверждена: данные соответствуют подписи устройства")
+			fmt.Println()
+			continue
+
+		case "5":
+			err := showDiagnostics()
+			if err != nil {
+				fmt.Printf("Ошибка запроса диагностики: {%v}\n", err)
+				fmt.Println()
+			}
+			continue
+
+		case "6":
 			return
 
 		default:
@@ -116,6 +167,46 @@ func showStatusServer() error {
 		fmt.Printf("Интерфейс Modbus-TCP {%d}\n", i+1)
 		fmt.Println("Имя :", v.ConName)
 		fmt.Println("Порт:", v.Con)
+		fmt.Printf("Состояние: %s с %s, переподключений: %d\n", v.State, v.Since, v.Reconnects)
+		if v.LastErr != "" {
+			fmt.Println("Последняя ошибка:", v.LastErr)
+		}
+	}
+	fmt.Println()
+
+	fmt.Println("Рабочих Go рутин:", len(statusSrv.Workers))
+	for _, v := range statusSrv.Workers {
+		fmt.Printf("%s: %s с %s, перезапусков: %d\n", v.Name, v.State, v.Since, v.Restarts)
+		if v.LastErr != "" {
+			fmt.Printf("Последний сбой: %s (%s)\n", v.LastErr, v.LastErrTime)
+		}
+	}
+	fmt.Println()
+
+	fmt.Println("Групп опроса:", len(statusSrv.Poll))
+	for _, v := range statusSrv.Poll {
+		fmt.Printf("%s: период {%d} мс, смещение {%d} мс, циклов {%d}, перегрузок {%d}, пропущено {%d}, запаздывание {%.1f} мс (наибольшее {%.1f} мс)\n",
+			v.Name, v.PeriodMs, v.OffsetMs, v.Cycles, v.Overruns, v.Skipped, v.LastLateMs, v.MaxLateMs)
+	}
+	fmt.Println()
+
+	fmt.Printf("Сигнал активности: %s с %s, значение {%s}\n", statusSrv.Heartbeat.State, statusSrv.Heartbeat.Since, statusSrv.Heartbeat.Value)
+	if statusSrv.Heartbeat.Reason != "" {
+		fmt.Println("Причина остановки:", statusSrv.Heartbeat.Reason)
+	}
+	fmt.Printf("Буфер архива: строк {%d}, объём {%d} байт, в карантине {%d}\n",
+		statusSrv.Buffer.Records, statusSrv.Buffer.Bytes, statusSrv.Buffer.Dead)
+	fmt.Printf("Запись архива: строк {%d}, пачек {%d}, средняя пачка {%.1f}, скорость {%.1f} строк/с\n",
+		statusSrv.Writer.Rows, statusSrv.Writer.Batches, statusSrv.Writer.AvgBatch, statusSrv.Writer.RowsPerSec)
+	fmt.Printf("Время записи пачки: среднее {%.1f} мс, последней {%.1f} мс (%s)\n",
+		statusSrv.Writer.AvgFlushMs, statusSrv.Writer.LastFlushMs, statusSrv.Writer.LastFlush)
+	fmt.Println()
+
+	fmt.Printf("Шлюз Modbus-TCP: %s с %s, адрес {%s}, тэгов {%d}, клиентов {%d}, запросов {%d}, исключений {%d}\n",
+		statusSrv.Gateway.State, statusSrv.Gateway.Since, statusSrv.Gateway.Address, statusSrv.Gateway.Tags,
+		statusSrv.Gateway.Clients, statusSrv.Gateway.Requests, statusSrv.Gateway.Exceptions)
+	if statusSrv.Gateway.LastErr != "" {
+		fmt.Println("Последняя ошибка шлюза:", statusSrv.Gateway.LastErr)
 	}
 	fmt.Println()
 
@@ -127,6 +218,38 @@ func showStatusServer() error {
 	return nil
 }
 
+// Запрос диагностики обмена с устройствами и вывод в терминал. Функция возвращает ошибку.
+func showDiagnostics() error {
+
+	diag := clientapi.RxDiagnostics{}
+
+	err := diag.ReqDiagnostics()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if len(diag.Devs) == 0 {
+		fmt.Println("Опрос устройств ещё не выполнялся")
+		fmt.Println()
+		return nil
+	}
+
+	for _, v := range diag.Devs {
+		fmt.Println("Устройство:", v.Dev)
+		fmt.Printf("Запросов: %d, успешных: %d, среднее время ответа: %.1f мс\n", v.Requests, v.Successes, v.AvgResponseMs)
+		fmt.Printf("Таймаут: %d, CRC: %d, исключение: %d, декодирование: %d, связь: %d, устаревших: %d\n",
+			v.Timeouts, v.CRCErrors, v.Exceptions, v.DecodeErrors, v.CommErrors, v.Stale)
+		fmt.Printf("Последнее качество: %#04x\n", v.LastQual)
+		if v.LastErr != "" {
+			fmt.Printf("Последняя ошибка: %s (%s)\n", v.LastErr, v.LastErrTime)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
 // Функция создаёт xlsx файл и сохраняет туда принятые данные от сервера. Возвращает ошибку.
 func savePartDataXlsx(rxData []clientapi.DataEl, startDate string) (err error) {
 
@@ -149,7 +272,7 @@ func savePartDataXlsx(rxData []clientapi.DataEl, startDate string) (err error) {
 	nameSheet := "DataDB"
 
 	// Формирование заголовков
-	// Name:	Value:	Quality:	TimeStamp:
+	// Name:	Value:	Quality:	TimeStamp:	Dev:	Hash:	Unit:
 	err = file.SetCellValue(nameSheet, "A1", "Name:")
 	if err != nil {
 		return errors.New("ошибка при добавлении заголовка столбца Name")
@@ -166,6 +289,18 @@ func savePartDataXlsx(rxData []clientapi.DataEl, startDate string) (err error) {
 	if err != nil {
 		return errors.New("ошибка при добавлении заголовка столбца TimeStamp")
 	}
+	err = file.SetCellValue(nameSheet, "E1", "Dev:")
+	if err != nil {
+		return errors.New("ошибка при добавлении заголовка столбца Dev")
+	}
+	err = file.SetCellValue(nameSheet, "F1", "Hash:")
+	if err != nil {
+		return errors.New("ошибка при добавлении заголовка столбца Hash")
+	}
+	err = file.SetCellValue(nameSheet, "G1", "Unit:")
+	if err != nil {
+		return errors.New("ошибка при добавлении заголовка столбца Unit")
+	}
 
 	// Перенос данных
 	for i, str := range rxData {
@@ -191,6 +326,21 @@ func savePartDataXlsx(rxData []clientapi.DataEl, startDate string) (err error) {
 		if err != nil {
 			return fmt.Errorf("ошибка {%v} добавления значения {%s} в ячейку {D%d}", err, str.TimeStamp, i)
 		}
+
+		err = file.SetCellValue(nameSheet, fmt.Sprintf("E%d", i), str.Dev)
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} добавления значения {%s} в ячейку {E%d}", err, str.Dev, i)
+		}
+
+		err = file.SetCellValue(nameSheet, fmt.Sprintf("F%d", i), str.Hash)
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} добавления значения {%s} в ячейку {F%d}", err, str.Hash, i)
+		}
+
+		err = file.SetCellValue(nameSheet, fmt.Sprintf("G%d", i), str.Unit)
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} добавления значения {%s} в ячейку {G%d}", err, str.Unit, i)
+		}
 	}
 
 	// Сохрангение
@@ -232,7 +382,7 @@ func partDataDB(startDate string) error {
 	if err != nil {
 		return fmt.Errorf("ошибка преобразования значения количества строк из типа string {%s}, в int", dataDB.CntStr)
 	}
-	iter := cntStr / 100
+	iter := (cntStr + 99) / 100 // с учётом неполного последнего запроса
 
 	collectRxDataDB := make([]clientapi.PartDataDB, 0)
 
@@ -279,3 +429,99 @@ func partDataDB(startDate string) error {
 
 	return nil
 }
+
+// Функция запрашивает печать архива по дате и сохраняет её в файл. Возвращает имя файла и ошибку.
+//
+// Параметры:
+//
+// date - дата печати
+func saveSeal(date string) (fileName string, err error) {
+
+	rx := clientapi.RxSeal{Date: date}
+
+	err = rx.ReqSeal()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(rx, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации печати: {%v}", err)
+	}
+
+	fileName = "./seal_" + date + ".json"
+
+	err = os.WriteFile(fileName, b, 0644)
+	if err != nil {
+		return "", fmt.Errorf("ошибка записи файла печати {%s}: {%v}", fileName, err)
+	}
+
+	return fileName, nil
+}
+
+// Функция проверяет печать архива без обращения к серверу. Возвращает ошибку, если печать не подтверждена.
+//
+// Параметры:
+//
+// fileXlsx - xlsx файл данных, сохранённый клиентом за дату печати
+// fileSeal - файл печати
+// fileKey - файл открытого ключа устройства, полученный из доверенного источника
+func verifySeal(fileXlsx, fileSeal, fileKey string) error {
+
+	pub, err := seal.LoadPublicKey(fileKey)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(fileSeal)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла печати {%s}: {%v}", fileSeal, err)
+	}
+
+	var s seal.SealT
+
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора файла печати {%s}: {%v}", fileSeal, err)
+	}
+
+	// Чтение строк архива из xlsx
+	file, err := excelize.OpenFile(fileXlsx)
+	if err != nil {
+		return fmt.Errorf("ошибка при открытии файла: {%v}", fileXlsx)
+	}
+	defer file.Close()
+
+	xRows, err := file.GetRows("DataDB")
+	if err != nil {
+		return fmt.Errorf("ошибка чтения вкладки DataDB: {%v}", err)
+	}
+	if len(xRows) == 0 || len(xRows[0]) < 5 || xRows[0][4] != "Dev:" {
+		return errors.New("в файле нет столбца Dev, файл выгружен до появления печатей")
+	}
+
+	rows := make([]hashchain.RowT, 0, len(xRows))
+
+	for i, x := range xRows[1:] {
+
+		// Дополнение пустых ячеек в конце строки
+		for len(x) < 6 {
+			x = append(x, "")
+		}
+
+		ts, err := seal.ParseTimeStamp(x[3])
+		if err != nil {
+			return fmt.Errorf("строка {%d}: %v", i+2, err)
+		}
+
+		rows = append(rows, hashchain.RowT{
+			Name:      x[0],
+			Value:     x[1],
+			Qual:      x[2],
+			TimeStamp: ts,
+			Dev:       x[4],
+		})
+	}
+
+	return seal.Verify(pub, s, rows)
+}
@@ -1,27 +1,53 @@
 package main
 
 import (
+	"blackbox/internal/server/coalesce"
+	"blackbox/internal/server/codec"
 	"blackbox/internal/server/database"
+	dbbuffer "blackbox/internal/server/dbBuffer"
+	"blackbox/internal/server/deadband"
+	"blackbox/internal/server/diagnostics"
+	"blackbox/internal/server/gateway"
+	hashchain "blackbox/internal/server/hashChain"
+	"blackbox/internal/server/heartbeat"
 	"blackbox/internal/server/libre"
 	loger "blackbox/internal/server/loger"
 	modbusrtumaster "blackbox/internal/server/modbusRTUmaster"
 	modbustcpmaster "blackbox/internal/server/modbusTCPmaster"
+	"blackbox/internal/server/mtls"
+	"blackbox/internal/server/password"
+	"blackbox/internal/server/quality"
+	"blackbox/internal/server/role"
+	"blackbox/internal/server/scaling"
+	"blackbox/internal/server/scheduler"
+	"blackbox/internal/server/seal"
+	"blackbox/internal/server/security"
 	serverAPI "blackbox/internal/server/serverAPI"
+	"blackbox/internal/server/session"
+	"blackbox/internal/server/supervisor"
+	"blackbox/internal/server/throughput"
 	"blackbox/internal/server/users"
 	"context"
+	"crypto/ed25519"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
+	"github.com/lib/pq"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -46,15 +72,28 @@ type (
 		lgr  loger.Log_Object
 		chRx chan []database.StoreType
 		wg   *sync.WaitGroup
+		conf dbWriterConfT
+	}
+	// настройки записи архива
+	dbWriterConfT struct {
+		batchSize  int                       // размер пачки записи архива
+		flushEvery time.Duration             // интервал записи архива
+		archive    map[string]deadband.ConfT // настройки архивирования тэгов по ключу deadband.Key
+	}
+	// строка архива, отклонённая БД
+	rejectedRowT struct {
+		rec dbbuffer.RecordT
+		err error
 	}
 	// Go  - набор данных для запуска потока очереди запросов
 	iGoQueue struct {
 		name   string
 		ctx    context.Context
 		lgr    loger.Log_Object
-		chTxDr chan []libre.ChConfExt_Export
+		chTxDr chan pollReqT
 		wg     *sync.WaitGroup
 		cnf    libre.ConfXLSX_Export
+		poll   pollConfT
 	}
 
 	// Go - набор данных для запуска драйвера Modbus-TCP
@@ -63,8 +102,9 @@ type (
 		ctx    context.Context
 		lgr    loger.Log_Object
 		con    modbustcpmaster.Connect
-		chRxDr chan []libre.ChConfExt_Export
+		chRxDr chan pollReqT
 		chTxDB chan []database.StoreType
+		chWr   chan writeReqT
 		wg     *sync.WaitGroup
 	}
 	// Go - набор данных для запуска драйвера Modbus-RTU
@@ -73,10 +113,38 @@ type (
 		ctx    context.Context
 		lgr    loger.Log_Object
 		con    modbusrtumaster.Connect
-		chRxDr chan []libre.ChConfExt_Export
+		chRxDr chan pollReqT
 		chTxDB chan []database.StoreType
+		chWr   chan writeReqT
 		wg     *sync.WaitGroup
 	}
+
+	// запрос записи значения тэга в драйвер
+	writeReqT struct {
+		tag   libre.ChConfExt_Export // тэг записи
+		value string                 // записываемое значение
+		chRes chan error             // результат записи
+	}
+
+	// настройки опроса
+	pollConfT struct {
+		blocks    coalesce.ConfT // объединение тэгов в блоки чтения
+		phaseStep time.Duration  // смещение фазы между группами времени опроса коннекта
+		jitter    time.Duration  // наибольшее случайное смещение фазы группы
+	}
+
+	// запрос опроса тэгов группы времени опроса в драйвер
+	pollReqT struct {
+		tags   []libre.ChConfExt_Export // тэги опроса
+		scale  []scaling.ConfT          // масштабирование тэгов, по индексам tags
+		blocks []coalesce.BlockT        // блоки чтения, индексы тэгов блоков - в tags
+	}
+
+	// маршруты записи значений тэгов
+	writeRouteT struct {
+		chDev map[string]chan writeReqT                    // канал драйвера по имени устройства
+		tags  map[string]map[string]libre.ChConfExt_Export // тэги записи по имени устройства и тэга
+	}
 )
 
 var (
@@ -86,11 +154,36 @@ var (
 	cmdArgs      map[string][]string
 	srvInfo      serverAPI.StatusServerT
 	hostConnects connects
+	wrRoute      writeRouteT
+	diag         = diagnostics.New()
+	workers      = supervisor.New(logWorkerChange)
+	pollSched    = scheduler.NewSet()
+	dbBuf        *dbbuffer.BufferT
+	dbMeter      throughput.MeterT
+	dbAlive      atomic.Int64 // время последней записи накопленных строк архива (UnixNano)
+	replayStuck  atomic.Int64 // начало безуспешного воспроизведения буфера при доступной БД (UnixNano), 0 - нет
+	hbeat        *heartbeat.HeartbeatT
+	gw           *gateway.GatewayT
 )
 
 const (
 	maxEthernetDev = 2 // Ограничение на количество устройств Ethernet у хоста
 	maxCOMDev      = 4 // Ограничение на количество устройств COM у хоста
+
+	writeTimeout = 10 * time.Second // Ожидание выполнения записи драйвером
+
+	dbWriteTimeout = 5 * time.Second // Ожидание записи пачки строк архива в БД, после которого данные сохраняются в буфер
+	replayPeriod   = time.Second     // Период попыток воспроизведения буфера в БД
+	replayBatches  = 50              // Наибольшее количество транзакций воспроизведения за период
+
+	defBatchSize  = 500         // Размер пачки записи архива по умолчанию
+	defFlushEvery = time.Second // Интервал записи архива по умолчанию
+
+	defHeartbeatPeriod  = time.Second      // Период сигнала активности по умолчанию
+	defHeartbeatDiskMin = 100              // Наименьшее свободное место для буфера архива по умолчанию, МБ
+	dbStallAfter        = 30 * time.Second // Отсутствие записи архива, после которого сигнал активности останавливается
+
+	sealGrace = 10 * time.Minute // Запас после полуночи сверх интервала записи, до которого прошедшие сутки не запечатываются
 )
 
 // Точка входа
@@ -139,11 +232,36 @@ func prepare() {
 	}
 	lgr.I.Println("подключение к БД выполнено")
 
+	// Колонки и таблицы архива, добавленные в последующих версиях (для БД, созданной ранее)
+	err = db.UpgradeArchiveTables()
+	if err != nil {
+		lgr.E.Println("ошибка при обновлении таблиц архива: ", err)
+		os.Exit(1)
+	}
+
+	// Колонка хэша пароля для хэшей argon2id (таблица пользователей, созданная ранее)
+	err = db.UpgradeUsersTable()
+	if err != nil {
+		lgr.W.Println("хэши паролей не будут обновлены при входе: ", err)
+	}
+
+	// Таблица сессий пользователей HTTPS сервера (для БД, созданной ранее)
+	err = db.CreateTableSessions()
+	if err != nil {
+		lgr.W.Println("вход пользователей на HTTPS сервер недоступен: ", err)
+	}
+
+	// Таблицы защиты входа (для БД, созданной ранее)
+	err = db.CreateTablesSecurity()
+	if err != nil {
+		lgr.W.Println("вход пользователей на HTTPS сервер недоступен: ", err)
+	}
+
 	// Заполнение мапы аргументов командной строки
 	// Проверка набора аргументов командной строки
 	cmdArgs = make(map[string][]string)
 	cmdArgs["--run"] = []string{}
-	cmdArgs["--do"] = []string{"DB-check", "DB-create", "DB-import", "DB-export", "DB-erase", "USERS", "Xlsx-show"}
+	cmdArgs["--do"] = []string{"DB-check", "DB-create", "DB-import", "DB-export", "DB-erase", "DB-verify", "USERS", "Xlsx-show", "TLS-init"}
 
 	err = checkArgs(os.Args)
 	if err != nil {
@@ -227,12 +345,18 @@ func run() {
 		case "DB-erase":
 			doEraseDB() // очистка конфигурационных таблиц БД
 
+		case "DB-verify":
+			doDBverify() // проверка цепочки хэшей архива
+
 		case "USERS":
 			doUsers() // взаимодействие с учётными данными пользователей
 
 		case "Xlsx-show":
 			doXlsxShow() // вывод содержимого конфигурационного файла в терминал
 
+		case "TLS-init":
+			doTLSinit() // выпуск сертификатов mTLS HTTPS сервера для пусконаладки
+
 		default:
 			lgr.E.Printf("нет соответствия во втором аргументе командной строки {%s}, при запуске приложения", slArg[1])
 			os.Exit(1)
@@ -346,6 +470,24 @@ func fullRun() {
 		return
 	}
 
+	// Открытие буфера архива на диске (для периодов недоступности БД)
+	//
+	dbBuf, err = dbbuffer.Open(os.Getenv("BUFFER_DIR"), dbbuffer.SegmentMax)
+	if err != nil {
+		lgr.E.Println("ошибка открытия буфера архива: ", err)
+		fmt.Println("Работа прервана.")
+		return
+	}
+	defer func() {
+		err := dbBuf.Close()
+		if err != nil {
+			lgr.E.Println("ошибка закрытия буфера архива: ", err)
+		}
+	}()
+	if n := dbBuf.Len(); n > 0 {
+		lgr.I.Printf("в буфере архива {%d} строк, ожидающих записи в БД", n)
+	}
+
 	// Подготовка данных для запуска Go рутин
 	//
 	goWait := sync.WaitGroup{}
@@ -358,19 +500,65 @@ func fullRun() {
 		return
 	}
 
+	// Сигнал активности для оборудования (настройки проверяются до запуска Go рутин)
+	//
+	hbeat, err = buildHeartbeat()
+	if err != nil {
+		lgr.E.Println("ошибка в настройках сигнала активности: ", err)
+		fmt.Println("работа прервана.")
+		return
+	}
+
+	// Шлюз Modbus-TCP (создаётся до запуска записи архива, которая передаёт ему значения)
+	//
+	gw, err = buildGateway(cnfExport)
+	if err != nil {
+		lgr.E.Println("ошибка в настройках шлюза: ", err)
+		fmt.Println("работа прервана.")
+		return
+	}
+	if gw != nil {
+		for _, e := range gw.Map() {
+			lgr.I.Printf("шлюз: тэг {%s/%s}: значение {%d}, качество {%d}, возраст {%d}, бит {%d}", e.Dev, e.Name, e.Value, e.Quality, e.Age, e.Bit)
+		}
+		workers.Go(ctxStop, &goWait, "Gateway", gw.Run)
+	}
+
 	// Запуск Go рутин
 	//
 	err = goStart(&dataGo)
 	if err != nil {
 		lgr.E.Println("ошибка при запуске Go рутин: ", err)
 		fmt.Println("работа прервана.")
+		cancel()      // остановка запущенных Go рутин
+		goWait.Wait() // с записью накопленных строк архива
 		return
 	}
 
+	// Запуск создания печатей архива (ключ устройства создаётся, если отсутствует)
+	//
+	sealKey, err := loadSealKey()
+	if err != nil {
+		lgr.E.Println("печати архива не создаются: ", err)
+	} else {
+		workers.Go(ctxStop, &goWait, "Seal", func(ctx context.Context) error {
+			return goSealArchive(ctx, sealKey)
+		})
+	}
+
+	// Запуск сигнала активности для оборудования
+	//
+	if hbeat != nil {
+		workers.Go(ctxStop, &goWait, "Heartbeat", func(ctx context.Context) error {
+			hbeat.Run(ctx)
+			return nil
+		})
+	}
+
 	// Запуск https сервера (для внешнего клиента)
 	//
 	if os.Getenv("HTTPS_SERVER_USE") == "true" {
-		go goHttpsServer()
+		workers.Go(ctxStop, &goWait, "HTTPS", goHttpsServer)
 	}
 
 	// Запуск http сервера (для локального клиента)
@@ -437,11 +625,34 @@ func doDBcreate() {
 		return
 	}
 
+	// Генерация ключа устройства для печатей архива (существующий ключ сохраняется)
+	_, err = loadSealKey()
+	if err != nil {
+		lgr.E.Println("ошибка генерации ключа печатей архива:", err)
+		fmt.Println("bad")
+		return
+	}
+
 	lgr.I.Println("Таблицы БД созданы")
 	lgr.I.Println("добавлен пользователь admin, установлен пароль")
 	fmt.Println("ok")
 }
 
+// Функция чтения ключа устройства для печатей архива. При отсутствии ключ создаётся.
+// Возвращается закрытый ключ и ошибка.
+func loadSealKey() (ed25519.PrivateKey, error) {
+
+	created, err := seal.GenerateKeyFiles(os.Getenv("SEAL_KEY_PRIVATE"), os.Getenv("SEAL_KEY_PUBLIC"))
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		lgr.I.Printf("создан ключ печатей архива, открытый ключ: {%s}", os.Getenv("SEAL_KEY_PUBLIC"))
+	}
+
+	return seal.LoadPrivateKey(os.Getenv("SEAL_KEY_PRIVATE"))
+}
+
 // Функция для импорта конфигурации в БД.
 func doDBimport() {
 
@@ -501,6 +712,75 @@ func doXlsxShow() {
 
 }
 
+// Функция выпуска сертификатов mTLS HTTPS сервера для пусконаладки: локальный удостоверяющий центр,
+// сертификат сервера и сертификаты клиентов. Выпущенные ранее файлы не перезаписываются.
+func doTLSinit() {
+
+	dir := os.Getenv("TLS_DIR")
+	if dir == "" {
+		dir = "./configs/tls/"
+	}
+
+	var str string
+
+	fmt.Println()
+	fmt.Print("Введите имена пользователей для сертификатов клиентов через ';' (пусто - без клиентов): ")
+	fmt.Scanln(&str)
+
+	clients := make([]string, 0)
+	for _, name := range strings.Split(str, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			clients = append(clients, name)
+		}
+	}
+
+	// Сертификат клиента сопоставляется пользователю по имени
+	usr := users.UsersT{DB: db.Ptr, Users: make([]users.UserT, 0)}
+	err := usr.ReqDataUsersDB()
+	if err != nil {
+		lgr.W.Println("имена пользователей сертификатов клиентов не проверены:", err)
+	} else {
+		for _, name := range clients {
+			if !slices.ContainsFunc(usr.Users, func(u users.UserT) bool { return u.Name == name }) {
+				lgr.W.Printf("пользователя {%s} нет в БД, сертификат клиента будет отклонён до его добавления", name)
+			}
+		}
+	}
+
+	ca, srv, cl, err := mtls.Init(dir, []string{os.Getenv("HTTPS_SERVER_IP")}, clients)
+	if err != nil {
+		lgr.E.Println("ошибка выпуска сертификатов mTLS:", err)
+		fmt.Println("bad")
+		return
+	}
+
+	show := func(title string, f mtls.FilesT) {
+		state := "выпущен ранее"
+		if f.New {
+			state = "выпущен"
+		}
+		fmt.Printf("%-32s %-14s %s, %s\n", title, state, f.Cert, f.Key)
+		if f.New {
+			lgr.I.Printf("TLS-init -> %s выпущен: {%s}", title, f.Cert)
+		}
+	}
+
+	show("удостоверяющий центр", ca)
+	show("сертификат сервера", srv)
+	for i, f := range cl {
+		show("сертификат клиента "+clients[i], f)
+	}
+
+	fmt.Println()
+	fmt.Println("Переменные окружения HTTPS сервера:")
+	fmt.Printf("HTTPS_SERVER_KEY_PUBLIC=%q\n", srv.Cert)
+	fmt.Printf("HTTPS_SERVER_KEY_PRIVATE=%q\n", srv.Key)
+	fmt.Printf("HTTPS_CLIENT_CA=%q\n", ca.Cert)
+	fmt.Printf("HTTPS_CLIENT_AUTH=%q\n", mtls.ModeCertToken)
+	fmt.Println("Закрытый ключ удостоверяющего центра храните отдельно от сервера после выпуска сертификатов.")
+	fmt.Println("ok")
+}
+
 // Функция очистки конфигурационных таблиц в БД
 func doEraseDB() {
 
@@ -513,6 +793,41 @@ func doEraseDB() {
 	fmt.Println("ok")
 }
 
+// Функция проверки цепочки хэшей архива за период
+func doDBverify() {
+
+	var dateStart, dateEnd string
+
+	fmt.Println()
+	fmt.Print("Введите начальную дату (YYYY-MM-DD): ")
+	fmt.Scanln(&dateStart)
+	fmt.Print("Введите конечную дату (YYYY-MM-DD): ")
+	fmt.Scanln(&dateEnd)
+
+	res, err := hashchain.VerifyDB(db.Ptr, dateStart, dateEnd)
+	if err != nil {
+		lgr.E.Println("ошибка при проверке цепочки хэшей архива: ", err)
+		fmt.Println("bad")
+		return
+	}
+
+	fmt.Printf("Проверено строк: %d\n", res.CntRows)
+	if res.Legacy > 0 {
+		fmt.Printf("Строк без хэша до начала цепочки (не проверяются): %d\n", res.Legacy)
+	}
+
+	if !res.Ok {
+		lgr.W.Printf("проверка цепочки хэшей архива с {%s} по {%s} -> разрыв в строке id:{%d} время:{%s} причина:{%s}",
+			res.DateStart, res.DateEnd, res.BrokenId, res.BrokenTimeStamp, res.Reason)
+		fmt.Printf("Разрыв цепочки в строке id:{%d} время:{%s}: %s\n", res.BrokenId, res.BrokenTimeStamp, res.Reason)
+		fmt.Println("bad")
+		return
+	}
+
+	lgr.I.Printf("проверка цепочки хэшей архива с {%s} по {%s} -> строк:{%d}, до начала цепочки:{%d}, нарушений нет", res.DateStart, res.DateEnd, res.CntRows, res.Legacy)
+	fmt.Println("ok")
+}
+
 // Функция взаимодействия с учётными данными пользователей
 func doUsers() {
 
@@ -600,6 +915,17 @@ func doUsers() {
 				continue
 			}
 
+			// Ввод роли
+			var userRole string
+			fmt.Printf("Введите роль пользователя (%s): ", strings.Join(role.List(), ", "))
+			fmt.Scanln(&userRole)
+			userRole, err = role.Parse(userRole)
+			if err != nil {
+				lgr.W.Printf("создание нового пользователя -> ошибка: {%v}", err)
+				fmt.Println("Ошибка при вводе роли. Пользователь не создан.")
+				continue
+			}
+
 			// Вычисление хэша пароля
 			fmt.Println()
 			fmt.Println("Данные приняты")
@@ -611,7 +937,7 @@ func doUsers() {
 			}
 
 			// Добавление в БД
-			err = users.AddUserDB(userName, hashPwd)
+			err = users.AddUserDB(userName, hashPwd, userRole)
 			if err != nil {
 				lgr.E.Printf("добавление пользователя в БД -> ошибка: {%v}", err)
 				fmt.Println("Ошибка")
@@ -619,8 +945,8 @@ func doUsers() {
 			}
 
 			fmt.Println()
-			fmt.Printf("Пользоваатель: {%s}, добавлен успешно.\n", userName)
-			lgr.I.Printf("Пользоваатель: {%s}, добавлен успешно.\n", userName)
+			fmt.Printf("Пользоваатель: {%s}, роль {%s}, добавлен успешно.\n", userName, userRole)
+			lgr.I.Printf("Пользоваатель: {%s}, роль {%s}, добавлен успешно.\n", userName, userRole)
 
 			// Запрос повторного вывода меню
 			repeat, err := users.RepeatMenu()
@@ -822,15 +1148,15 @@ func doUsers() {
 					continue
 				}
 				fmt.Println()
-				hashPwd, err := users.CalcHashPassword(pwdExist)
+				ok, _, err := password.Verify(pwdExist, hashPwdExist)
 				if err != nil {
-					lgr.E.Printf("вычисление хэша пароля нового пользователя -> ошибка: {%v}", err)
+					lgr.E.Printf("проверка действующего пароля -> ошибка: {%v}", err)
 					fmt.Println("Ошибка")
 					continue
 				}
 				fmt.Println()
 
-				if hashPwdExist != hashPwd {
+				if !ok {
 					lgr.W.Printf("изменение пароля для пользователя:{%s} -> действующий пароль не подтверждён", userName)
 					fmt.Println("Ошибка")
 					continue
@@ -848,6 +1174,16 @@ func doUsers() {
 			fmt.Printf("Пароль пользователя с id:{%d}, изменен\n", userId)
 			lgr.I.Printf("Пароль пользователя с id:{%d}, изменен\n", userId)
 
+			// Сессии, открытые с прежним паролем, отзываются
+			n, err := users.RevokeSessionsDB(userName, 0)
+			if err != nil {
+				lgr.E.Printf("отзыв сессий пользователя {%s} после изменения пароля -> ошибка: {%v}", userName, err)
+				fmt.Println("Ошибка при отзыве сессий пользователя")
+			} else if n > 0 {
+				fmt.Printf("Отозвано сессий пользователя: %d\n", n)
+				lgr.I.Printf("после изменения пароля отозвано сессий пользователя {%s}: %d", userName, n)
+			}
+
 			// Запрос повторного вывода меню
 			repeat, err := users.RepeatMenu()
 			if err != nil {
@@ -860,78 +1196,307 @@ func doUsers() {
 			}
 			return
 
-		case 6: // Завершение работы
+		case 6: // Просмотр сессий пользователя
+
 			fmt.Println()
-			fmt.Println("Работа с пользователями, завершена")
+			fmt.Println("====================================")
+			fmt.Println("=== Просмотр сессий пользователя ===")
+			fmt.Println("====================================")
 			fmt.Println()
-			return
 
-		default:
-			fmt.Println("Ошибка при вводе. Работа завершена")
-			os.Exit(1)
-		}
-	}
+			var strId string
+			fmt.Print("Введите id пользователя: ")
+			fmt.Scanln(&strId)
+			userId, err := strconv.Atoi(strId)
+			if err != nil {
+				lgr.E.Printf("просмотр сессий пользователя по его id -> ошибка распознавания номера: {%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-}
+			userName, err := users.UserNameByIdDB(userId)
+			if err != nil {
+				lgr.W.Printf("просмотр сессий пользователя -> ошибка: {%v}", err)
+				fmt.Println("Ошибка. Работа прервана")
+				continue
+			}
 
-// Функция для экспорта конфигурации из БД.
-func doDBexport() {
+			err = users.ShowSessionsDB(userName)
+			if err != nil {
+				lgr.E.Printf("просмотр сессий пользователя {%s} -> ошибка: {%v}", userName, err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-	// Чтение конфигурационных таблиц БД
-	conf, err := rdConfDataDB()
-	if err != nil {
-		lgr.E.Println("ошибка чтения данных конфигурации из БД: ", err)
-		os.Exit(1)
-	}
+			lgr.I.Printf("запрошены сессии пользователя {%s}", userName)
 
-	// Создание нового файла xlsx для сохранения данных экспорта
-	tn := time.Now().Format("02.01.2006-15:04:05")
+			// Запрос повторного вывода меню
+			repeat, err := users.RepeatMenu()
+			if err != nil {
+				lgr.E.Printf("вывод информации о пользователях -> ошибка:{%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+			if repeat {
+				continue
+			}
+			return
 
-	fileExport, err := conf.CreateXlsxConfig(os.Getenv("EXPORT_FILE_PATH"), os.Getenv("EXPORT_FILE_NAME"), tn, os.Getenv("EXPORT_FILE_TYPE"))
-	if err != nil {
-		lgr.E.Println("ошибка при создании файла экспорта: ", err)
-		os.Exit(1)
-	}
+		case 7: // Отзыв сессий пользователя
 
-	// Заполнение файла экспорта
-	err = fillFileExport(fileExport, conf)
-	if err != nil {
-		lgr.E.Println("ошибка при заполнении файла экспорта: ", err)
-		os.Exit(1)
-	}
+			fmt.Println()
+			fmt.Println("=================================")
+			fmt.Println("=== Отзыв сессий пользователя ===")
+			fmt.Println("=================================")
+			fmt.Println()
 
-	lgr.I.Println("чтение конфигурации из БД выполнено успешно")
-	fmt.Println("ok")
+			var strId string
+			fmt.Print("Введите id пользователя: ")
+			fmt.Scanln(&strId)
+			userId, err := strconv.Atoi(strId)
+			if err != nil {
+				lgr.E.Printf("отзыв сессий пользователя по его id -> ошибка распознавания номера: {%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-}
+			userName, err := users.UserNameByIdDB(userId)
+			if err != nil {
+				lgr.W.Printf("отзыв сессий пользователя -> ошибка: {%v}", err)
+				fmt.Println("Ошибка. Работа прервана")
+				continue
+			}
 
-// Передача конфигурационных данных в таблицы БД. Функция возвращает ошибку.
-func wrConfDataDB() error {
+			var strSes string
+			fmt.Print("Введите id сессии (0 - все сессии пользователя): ")
+			fmt.Scanln(&strSes)
+			sesId, err := strconv.Atoi(strSes)
+			if err != nil {
+				lgr.E.Printf("отзыв сессий пользователя -> ошибка распознавания номера сессии: {%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-	// Запись конфигурации хоста
-	for _, el := range cnfImport.SheetMain_Header {
+			n, err := users.RevokeSessionsDB(userName, sesId)
+			if err != nil {
+				lgr.E.Printf("отзыв сессий пользователя {%s} -> ошибка: {%v}", userName, err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-		q := fmt.Sprintf("INSERT INTO %s.%s (host, contype, address, port, baudrate, databits, parity, stopbits) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-			os.Getenv("TABLE_SCHEMA"),
-			os.Getenv("TABLE_HOST"))
+			fmt.Println()
+			fmt.Printf("Отозвано сессий пользователя {%s}: %d\n", userName, n)
+			lgr.I.Printf("администратором отозвано сессий пользователя {%s}: %d (id сессии: %d)", userName, n, sesId)
 
-		_, err := db.Ptr.Exec(q, el.Host, el.ConType, el.Address, el.Port, el.BaudRate, el.DataBits, el.Parity, el.StopBits)
-		if err != nil {
-			lgr.E.Printf("ошибка {%v} при записи строки конфигурации хоста {%v}\n", err, el)
-			return err
-		}
+			// Запрос повторного вывода меню
+			repeat, err := users.RepeatMenu()
+			if err != nil {
+				lgr.E.Printf("вывод информации о пользователях -> ошибка:{%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+			if repeat {
+				continue
+			}
+			return
 
-		lgr.I.Println("в БД добавлена строка конфигурации хоста: ", el)
-	}
+		case 8: // Изменение роли пользователя
 
-	// Запись настроек подключений
-	for _, el := range cnfImport.SheetMain_Dev {
+			fmt.Println()
+			fmt.Println("===================================")
+			fmt.Println("=== Изменение роли пользователя ===")
+			fmt.Println("===================================")
+			fmt.Println()
 
-		q := fmt.Sprintf("INSERT INTO %s.%s (device, comment, host, type, address, ip, port) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-			os.Getenv("TABLE_SCHEMA"),
-			os.Getenv("TABLE_DEVICES"))
+			var strId string
+			fmt.Print("Введите id пользователя: ")
+			fmt.Scanln(&strId)
+			userId, err := strconv.Atoi(strId)
+			if err != nil {
+				lgr.E.Printf("изменение роли пользователя по его id -> ошибка распознавания номера: {%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
 
-		_, err := db.Ptr.Exec(q, el.Device, el.Comment, el.Host, el.Type_, el.Address, el.IP, el.Port)
+			// Проверка, что пользователь - admin
+			userName, err := users.UserNameByIdDB(userId)
+			if err != nil {
+				lgr.W.Printf("изменение роли пользователя -> ошибка: {%v}", err)
+				fmt.Println("Ошибка. Работа прервана")
+				continue
+			}
+
+			if userName == "admin" {
+				fmt.Printf("Пользователю с именем: {%s}, запрещено изменять роль\n", userName)
+				continue
+			}
+
+			var userRole string
+			fmt.Printf("Введите роль пользователя (%s): ", strings.Join(role.List(), ", "))
+			fmt.Scanln(&userRole)
+
+			err = users.ChgUserRoleDB(userId, userRole)
+			if err != nil {
+				lgr.E.Printf("изменение роли пользователя по id:{%d} -> ошибка: {%v}", userId, err)
+				fmt.Println("Ошибка")
+				continue
+			}
+
+			fmt.Printf("Роль пользователя {%s} изменена на {%s}\n", userName, userRole)
+			lgr.I.Printf("роль пользователя {%s} изменена на {%s}", userName, userRole)
+
+			// Запрос повторного вывода меню
+			repeat, err := users.RepeatMenu()
+			if err != nil {
+				lgr.E.Printf("вывод информации о пользователях -> ошибка:{%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+			if repeat {
+				continue
+			}
+			return
+
+		case 9: // Просмотр блокировок входа
+
+			fmt.Println()
+			fmt.Println("=================================")
+			fmt.Println("=== Просмотр блокировок входа ===")
+			fmt.Println("=================================")
+
+			err := users.ShowLockoutsDB()
+			if err != nil {
+				lgr.E.Printf("просмотр блокировок входа -> ошибка: {%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+
+			lgr.I.Println("запрошены блокировки входа")
+
+			// Запрос повторного вывода меню
+			repeat, err := users.RepeatMenu()
+			if err != nil {
+				lgr.E.Printf("вывод информации о пользователях -> ошибка:{%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+			if repeat {
+				continue
+			}
+			return
+
+		case 10: // Снятие блокировки входа
+
+			fmt.Println()
+			fmt.Println("===============================")
+			fmt.Println("=== Снятие блокировки входа ===")
+			fmt.Println("===============================")
+			fmt.Println()
+
+			var kind, subject string
+			fmt.Printf("Введите вид блокировки (%s, %s): ", security.KindUser, security.KindIP)
+			fmt.Scanln(&kind)
+			fmt.Print("Введите имя пользователя или IP: ")
+			fmt.Scanln(&subject)
+
+			err := users.ClearLockoutDB(kind, subject)
+			if errors.Is(err, security.ErrNoLock) {
+				fmt.Printf("Блокировки {%s/%s} нет\n", kind, subject)
+				continue
+			}
+			if err != nil {
+				lgr.E.Printf("снятие блокировки входа {%s/%s} -> ошибка: {%v}", kind, subject, err)
+				fmt.Println("Ошибка")
+				continue
+			}
+
+			fmt.Printf("Блокировка входа {%s/%s} снята\n", kind, subject)
+			lgr.I.Printf("блокировка входа {%s/%s} снята из командной строки", kind, subject)
+
+			// Запрос повторного вывода меню
+			repeat, err := users.RepeatMenu()
+			if err != nil {
+				lgr.E.Printf("вывод информации о пользователях -> ошибка:{%v}", err)
+				fmt.Println("Ошибка")
+				continue
+			}
+			if repeat {
+				continue
+			}
+			return
+
+		case 11: // Завершение работы
+			fmt.Println()
+			fmt.Println("Работа с пользователями, завершена")
+			fmt.Println()
+			return
+
+		default:
+			fmt.Println("Ошибка при вводе. Работа завершена")
+			os.Exit(1)
+		}
+	}
+
+}
+
+// Функция для экспорта конфигурации из БД.
+func doDBexport() {
+
+	// Чтение конфигурационных таблиц БД
+	conf, err := rdConfDataDB()
+	if err != nil {
+		lgr.E.Println("ошибка чтения данных конфигурации из БД: ", err)
+		os.Exit(1)
+	}
+
+	// Создание нового файла xlsx для сохранения данных экспорта
+	tn := time.Now().Format("02.01.2006-15:04:05")
+
+	fileExport, err := conf.CreateXlsxConfig(os.Getenv("EXPORT_FILE_PATH"), os.Getenv("EXPORT_FILE_NAME"), tn, os.Getenv("EXPORT_FILE_TYPE"))
+	if err != nil {
+		lgr.E.Println("ошибка при создании файла экспорта: ", err)
+		os.Exit(1)
+	}
+
+	// Заполнение файла экспорта
+	err = fillFileExport(fileExport, conf)
+	if err != nil {
+		lgr.E.Println("ошибка при заполнении файла экспорта: ", err)
+		os.Exit(1)
+	}
+
+	lgr.I.Println("чтение конфигурации из БД выполнено успешно")
+	fmt.Println("ok")
+
+}
+
+// Передача конфигурационных данных в таблицы БД. Функция возвращает ошибку.
+func wrConfDataDB() error {
+
+	// Запись конфигурации хоста
+	for _, el := range cnfImport.SheetMain_Header {
+
+		q := fmt.Sprintf("INSERT INTO %s.%s (host, contype, address, port, baudrate, databits, parity, stopbits) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			os.Getenv("TABLE_SCHEMA"),
+			os.Getenv("TABLE_HOST"))
+
+		_, err := db.Ptr.Exec(q, el.Host, el.ConType, el.Address, el.Port, el.BaudRate, el.DataBits, el.Parity, el.StopBits)
+		if err != nil {
+			lgr.E.Printf("ошибка {%v} при записи строки конфигурации хоста {%v}\n", err, el)
+			return err
+		}
+
+		lgr.I.Println("в БД добавлена строка конфигурации хоста: ", el)
+	}
+
+	// Запись настроек подключений
+	for _, el := range cnfImport.SheetMain_Dev {
+
+		q := fmt.Sprintf("INSERT INTO %s.%s (device, comment, host, type, address, ip, port) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			os.Getenv("TABLE_SCHEMA"),
+			os.Getenv("TABLE_DEVICES"))
+
+		_, err := db.Ptr.Exec(q, el.Device, el.Comment, el.Host, el.Type_, el.Address, el.IP, el.Port)
 		if err != nil {
 			lgr.E.Printf("ошибка {%v} при записи строки конфигурации подключения устройства {%v}\n", err, el)
 			return err
@@ -948,11 +1513,13 @@ func wrConfDataDB() error {
 		// Проход по настройкам конфигурации каналов устройства
 		for _, ch := range d.Conf {
 
-			q := fmt.Sprintf("INSERT INTO %s.%s (device, address, datatype, comment, timescan, functype, format ) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			q := fmt.Sprintf("INSERT INTO %s.%s (device, address, datatype, comment, timescan, functype, format, deadband, deadbandpct, minarchive, maxarchive, onchange, rawmin, rawmax, engmin, engmax, scalegain, scaleoffset, clamp, unit) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)",
 				os.Getenv("TABLE_SCHEMA"),
 				os.Getenv("TABLE_TAGS"))
 
-			_, err := db.Ptr.Exec(q, d.Name, ch.Address, ch.DataType, ch.Comment, ch.TimeScan, ch.FuncType, ch.Format)
+			_, err := db.Ptr.Exec(q, d.Name, ch.Address, ch.DataType, ch.Comment, ch.TimeScan, ch.FuncType, ch.Format,
+				ch.Deadband, ch.DeadbandPct, ch.MinArchive, ch.MaxArchive, ch.OnChange,
+				ch.RawMin, ch.RawMax, ch.EngMin, ch.EngMax, ch.Gain, ch.Offset, ch.Clamp, ch.Unit)
 			if err != nil {
 				lgr.E.Printf("ошибка {%v} при записи строки конфигурации канала {%v}\n", err, ch)
 				return err
@@ -964,6 +1531,35 @@ func wrConfDataDB() error {
 		lgr.I.Println("в БД добавлена конфигурация каналов для устройства: ", d.Name)
 	}
 
+	// Запись настроек шлюза Modbus-TCP
+	if len(cnfImport.Gateway) > 0 {
+
+		if os.Getenv("TABLE_GATEWAY") == "" {
+			return errors.New("в файле импорта есть вкладка шлюза, но не задана переменная окружения TABLE_GATEWAY")
+		}
+
+		// таблица создаётся и для БД, созданной до появления шлюза
+		err := db.CreateTableGateway()
+		if err != nil {
+			return err
+		}
+
+		for _, el := range cnfImport.Gateway {
+
+			q := fmt.Sprintf("INSERT INTO %s.%s (address, port, unitid, datatype, format) VALUES ($1, $2, $3, $4, $5)",
+				os.Getenv("TABLE_SCHEMA"),
+				os.Getenv("TABLE_GATEWAY"))
+
+			_, err := db.Ptr.Exec(q, el.Address, el.Port, el.UnitID, el.DataType, el.Format)
+			if err != nil {
+				lgr.E.Printf("ошибка {%v} при записи строки настроек шлюза {%v}\n", err, el)
+				return err
+			}
+
+			lgr.I.Println("в БД добавлена строка настроек шлюза: ", el)
+		}
+	}
+
 	return nil
 }
 
@@ -1023,7 +1619,7 @@ func rdConfDataDB() (conf libre.ConfXLSX_Export, err error) {
 	}
 
 	// Чтение конфигурации каналов
-	q = fmt.Sprintf("SELECT device, address, datatype, comment, timescan, functype, format FROM %s.%s",
+	q = fmt.Sprintf("SELECT device, address, datatype, comment, timescan, functype, format, deadband, deadbandpct, minarchive, maxarchive, onchange, rawmin, rawmax, engmin, engmax, scalegain, scaleoffset, clamp, unit FROM %s.%s ORDER BY id",
 		os.Getenv("TABLE_SCHEMA"),
 		os.Getenv("TABLE_TAGS"))
 
@@ -1037,7 +1633,9 @@ func rdConfDataDB() (conf libre.ConfXLSX_Export, err error) {
 
 		var str libre.ChConf_Export
 
-		err = rows.Scan(&str.Device, &str.Address, &str.DataType, &str.Comment, &str.TimeScan, &str.FuncType, &str.Format)
+		err = rows.Scan(&str.Device, &str.Address, &str.DataType, &str.Comment, &str.TimeScan, &str.FuncType, &str.Format,
+			&str.Deadband, &str.DeadbandPct, &str.MinArchive, &str.MaxArchive, &str.OnChange,
+			&str.RawMin, &str.RawMax, &str.EngMin, &str.EngMax, &str.Gain, &str.Offset, &str.Clamp, &str.Unit)
 		if err != nil {
 			return libre.ConfXLSX_Export{}, errors.New(err.Error())
 		}
@@ -1049,6 +1647,39 @@ func rdConfDataDB() (conf libre.ConfXLSX_Export, err error) {
 		return libre.ConfXLSX_Export{}, errors.New(err.Error())
 	}
 
+	// Чтение настроек шлюза (таблица необязательна)
+	exist, err := db.GatewayTableExists()
+	if err != nil {
+		return libre.ConfXLSX_Export{}, err
+	}
+	if exist {
+		q = fmt.Sprintf("SELECT address, port, unitid, datatype, format FROM %s.%s ORDER BY id",
+			os.Getenv("TABLE_SCHEMA"),
+			os.Getenv("TABLE_GATEWAY"))
+
+		rows, err = db.Ptr.Query(q)
+		if err != nil {
+			lgr.E.Println("ошибка при чтении таблицы шлюза: ", err)
+			return libre.ConfXLSX_Export{}, err
+		}
+
+		for rows.Next() {
+
+			var str libre.SheetGateway
+
+			err = rows.Scan(&str.Address, &str.Port, &str.UnitID, &str.DataType, &str.Format)
+			if err != nil {
+				return libre.ConfXLSX_Export{}, errors.New(err.Error())
+			}
+
+			conf.Gateway = append(conf.Gateway, str)
+		}
+
+		if err = rows.Err(); err != nil {
+			return libre.ConfXLSX_Export{}, errors.New(err.Error())
+		}
+	}
+
 	conf.ConfDataReady = true // установка признака, что экспорт данных выполнен успешно
 	return conf, nil
 }
@@ -1063,7 +1694,8 @@ func rdChanByDevNameAndTimeScanDB(name string, timeScan int) (ch []libre.ChConf_
 	// Чтение конфигурации каналов
 	ts := fmt.Sprintf("'%d'", timeScan)
 
-	Q := fmt.Sprintf("SELECT device, address, datatype, comment, timescan, functype, format FROM %[1]s.%[2]s WHERE timescan=%[3]s AND device='%[4]s'",
+	// тэги записи не опрашиваются
+	Q := fmt.Sprintf("SELECT device, address, datatype, comment, timescan, functype, format, deadband, deadbandpct, minarchive, maxarchive, onchange, rawmin, rawmax, engmin, engmax, scalegain, scaleoffset, clamp, unit FROM %[1]s.%[2]s WHERE timescan=%[3]s AND device='%[4]s' AND functype NOT LIKE 'Write%%'",
 		os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_TAGS"), ts, name)
 
 	rows, err := db.Ptr.Query(Q)
@@ -1076,7 +1708,9 @@ func rdChanByDevNameAndTimeScanDB(name string, timeScan int) (ch []libre.ChConf_
 
 		var str libre.ChConf_Export
 
-		err = rows.Scan(&str.Device, &str.Address, &str.DataType, &str.Comment, &str.TimeScan, &str.FuncType, &str.Format)
+		err = rows.Scan(&str.Device, &str.Address, &str.DataType, &str.Comment, &str.TimeScan, &str.FuncType, &str.Format,
+			&str.Deadband, &str.DeadbandPct, &str.MinArchive, &str.MaxArchive, &str.OnChange,
+			&str.RawMin, &str.RawMax, &str.EngMin, &str.EngMax, &str.Gain, &str.Offset, &str.Clamp, &str.Unit)
 		if err != nil {
 			lgr.E.Println("ошибка при сканировании строки ответа БД: ", err)
 			return []libre.ChConf_Export{}, err
@@ -1123,6 +1757,21 @@ func eraseTablesDB() error {
 		return err
 	}
 
+	// Очистка содержимого таблицы шлюза (таблица необязательна)
+	exist, err := db.GatewayTableExists()
+	if err != nil {
+		return err
+	}
+	if exist {
+		Q = fmt.Sprintf("TRUNCATE TABLE %s.%s", os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_GATEWAY"))
+
+		_, err = db.Ptr.Exec(Q)
+		if err != nil {
+			lgr.E.Printf("ошибка {%v} при очистки таблицы gateway\n", err)
+			return err
+		}
+	}
+
 	return nil
 
 }
@@ -1347,6 +1996,71 @@ func fillFileExport(fileName string, conf libre.ConfXLSX_Export) error {
 		return err
 	}
 
+	err = file.SetCellValue("Channels", fmt.Sprintf("H%d", cntRow), "Deadband:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("I%d", cntRow), "DeadbandPct:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("J%d", cntRow), "MinArchive:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("K%d", cntRow), "MaxArchive:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("L%d", cntRow), "OnChange:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("M%d", cntRow), "RawMin:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("N%d", cntRow), "RawMax:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("O%d", cntRow), "EngMin:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("P%d", cntRow), "EngMax:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("Q%d", cntRow), "Gain:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("R%d", cntRow), "Offset:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("S%d", cntRow), "Clamp:")
+	if err != nil {
+		return err
+	}
+
+	err = file.SetCellValue("Channels", fmt.Sprintf("T%d", cntRow), "Unit:")
+	if err != nil {
+		return err
+	}
+
 	cntRow++
 
 	// Перенос содержимого настроек каналов
@@ -1387,18 +2101,157 @@ func fillFileExport(fileName string, conf libre.ConfXLSX_Export) error {
 			return err
 		}
 
-		cntRow++
-	}
+		err = file.SetCellValue("Channels", fmt.Sprintf("H%d", cntRow), str.Deadband)
+		if err != nil {
+			return err
+		}
 
-	// Сохрангение
-	err = file.Save()
-	if err != nil {
-		return err
-	}
+		err = file.SetCellValue("Channels", fmt.Sprintf("I%d", cntRow), str.DeadbandPct)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("J%d", cntRow), str.MinArchive)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("K%d", cntRow), str.MaxArchive)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("L%d", cntRow), str.OnChange)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("M%d", cntRow), str.RawMin)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("N%d", cntRow), str.RawMax)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("O%d", cntRow), str.EngMin)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("P%d", cntRow), str.EngMax)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("Q%d", cntRow), str.Gain)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("R%d", cntRow), str.Offset)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("S%d", cntRow), str.Clamp)
+		if err != nil {
+			return err
+		}
+
+		err = file.SetCellValue("Channels", fmt.Sprintf("T%d", cntRow), str.Unit)
+		if err != nil {
+			return err
+		}
+
+		cntRow++
+	}
+
+	// Перенос настроек и карты регистров шлюза
+	if len(conf.Gateway) > 0 {
+		err = fillGatewayExport(file, conf)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Сохрангение
+	err = file.Save()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Заполнение вкладки шлюза файла экспорта: настройки и карта регистров. Возвращается ошибка.
+//
+// Параметры:
+//
+// file - файл экспорта
+// conf - конфигурация
+func fillGatewayExport(file *excelize.File, conf libre.ConfXLSX_Export) error {
+
+	g, err := buildGateway(conf)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]interface{}{{"Address:", "Port:", "UnitID:", "DataType:", "Format:"}}
+	for _, el := range conf.Gateway {
+		rows = append(rows, []interface{}{el.Address, el.Port, el.UnitID, el.DataType, el.Format})
+	}
+
+	// карта регистров (при импорте не читается)
+	rows = append(rows, nil, []interface{}{"Device:", "Tag:", "Value:", "Quality:", "Age:", "Bit:"})
+	for _, e := range g.Map() {
+		rows = append(rows, []interface{}{e.Dev, e.Name, e.Value, e.Quality, e.Age, e.Bit})
+	}
+
+	for i, row := range rows {
+		if row == nil {
+			continue
+		}
+		err = file.SetSheetRow("Gateway", fmt.Sprintf("A%d", i+1), &row)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// Создание шлюза Modbus-TCP по конфигурации. Карта регистров строится из тэгов чтения в порядке
+// таблицы тэгов. Функция возвращает шлюз (nil, если шлюз не настроен) и ошибку.
+//
+// Параметры:
+//
+// conf - конфигурация
+func buildGateway(conf libre.ConfXLSX_Export) (*gateway.GatewayT, error) {
+
+	if len(conf.Gateway) == 0 {
+		return nil, nil
+	}
+
+	el := conf.Gateway[0]
+	gwConf, err := gateway.ParseConf(el.Address, el.Port, el.UnitID, el.DataType, el.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]gateway.TagT, 0, len(conf.SheetChan))
+	for _, v := range conf.SheetChan {
+		if strings.HasPrefix(v.FuncType, "Write") {
+			continue
+		}
+		tags = append(tags, gateway.TagT{Dev: v.Device, Name: v.Comment})
+	}
+
+	return gateway.New(gwConf, tags)
+}
+
 // Создание коннектов хоста. Возвращается коннект и ошибка.
 //
 // Параметры:
@@ -1417,26 +2270,25 @@ func createHostModbusTCPConn(conf libre.ConfXLSX_Export) (con []modbustcpmaster.
 
 		if c.ConType == "TCP" {
 
-			// присвоение параметров подключения (скорость передачи, биты и т.д.)
+			// присвоение параметров подключения к каждому удалённому устройству хоста
 			varCon, err := buildConfDataSlaveModbusTCP(conf, c.Host)
 			if err != nil {
 				return []modbustcpmaster.Connect{}, fmt.Errorf("ошибка параметрирования коннекта {%v}", err)
 			}
 
-			// добавление параметрироанного подключения к общему списку коннектов
-			con = append(con, varCon)
+			// добавление параметрироанных подключений к общему списку коннектов
+			con = append(con, varCon...)
 		}
 	}
 
 	// подключение всех параметрированных коннектов
-	for i, c := range con {
-		_ = c
+	// недоступный слейв не прерывает запуск, переподключение выполняет супервизор
+	for i := range con {
 
 		err = con[i].Connect()
 		if err != nil {
-			return []modbustcpmaster.Connect{}, fmt.Errorf("ошибка при подключении: {%s} по COM: %v", con[i].Name, err)
+			lgr.W.Printf("нет подключения: {%s} по TCP: {%v}, переподключение выполнит супервизор", con[i].Name, err)
 		}
-		con[i].IsRun = true
 	}
 
 	return con, nil
@@ -1454,12 +2306,12 @@ func createHostModbusRTUConn(conf libre.ConfXLSX_Export) (con []modbusrtumaster.
 		return []modbusrtumaster.Connect{}, fmt.Errorf("нет конфигурационных данных для создания Modbus-RTU коннекта")
 	}
 
-	// поисх в заголовках соединения с типом COM
+	// поисх в заголовках соединения с типом COM, RTU-TCP и UDP
 	// добавление подключения в массив СОМ подключений
 	for _, c := range conf.SheetMain_Header {
 
-		if c.ConType == "COM" {
-
+		switch c.ConType {
+		case "COM":
 			// присвоение параметров подключения (скорость передачи, биты и т.д.)
 			varCon, err := buildConfDataSlaveModbusRTU(conf, c.Host)
 			if err != nil {
@@ -1468,16 +2320,25 @@ func createHostModbusRTUConn(conf libre.ConfXLSX_Export) (con []modbusrtumaster.
 
 			// добавление параметрироанного подключения к общему списку коннектов
 			con = append(con, varCon)
+
+		case "RTU-TCP", "UDP":
+			// подключение через сетевой шлюз: адрес и порт хоста
+			con = append(con, modbusrtumaster.Connect{
+				Name:      c.Host,
+				ConType:   c.ConType,
+				Address:   net.JoinHostPort(c.Address, c.Port),
+				SlaveAddr: 1,
+			})
 		}
 	}
 
 	// подключение всех параметрированных коннектов
-	for i, c := range con {
-		_ = c
+	// сетевой шлюз подключается при первом запросе, его недоступность не прерывает запуск
+	for i := range con {
 
 		err = con[i].Connect()
 		if err != nil {
-			return []modbusrtumaster.Connect{}, fmt.Errorf("ошибка при подключении: {%s} по COM: %v", con[i].Name, err)
+			return []modbusrtumaster.Connect{}, fmt.Errorf("ошибка при подключении: {%s} по %s: %v", con[i].Name, con[i].ConType, err)
 		}
 		con[i].IsRun = true
 	}
@@ -1523,26 +2384,96 @@ func createConnect(cnf libre.ConfXLSX_Export) (hostCon connects, err error) {
 func buildGoData(ctxStop context.Context, cnf libre.ConfXLSX_Export, hostConnects *connects, wg *sync.WaitGroup, lgr loger.Log_Object) (inst goInst, err error) {
 
 	// DB
+	var dbConf dbWriterConfT
+
+	dbConf.batchSize, dbConf.flushEvery, err = readBatchConf()
+	if err != nil {
+		return goInst{}, err
+	}
+
+	pollConf, err := readPollConf()
+	if err != nil {
+		return goInst{}, err
+	}
+
+	dbConf.archive = make(map[string]deadband.ConfT)
+	for _, ch := range cnf.SheetChan {
+		arch, err := deadband.ParseConf(ch.Deadband, ch.DeadbandPct, ch.MinArchive, ch.MaxArchive, ch.OnChange)
+		if err != nil {
+			return goInst{}, fmt.Errorf("ошибка в настройках архивирования тэга {%s} устройства {%s}: {%v}", ch.Comment, ch.Device, err)
+		}
+		if !arch.IsZero() {
+			dbConf.archive[deadband.Key(ch.Device, ch.Comment)] = arch
+		}
+	}
+
 	iGoDB := iGoDB{
 		name: "DB:Main",
 		ctx:  ctxStop,
 		lgr:  lgr,
 		chRx: make(chan []database.StoreType, 10),
 		wg:   wg,
+		conf: dbConf,
 	}
 	inst.db = append(inst.db, iGoDB)
 
 	// Queue
 	for _, v := range cnf.SheetMain_Header {
-		iGoQueue := iGoQueue{
-			name:   "Queue:" + v.Host + ":" + v.ConType,
-			ctx:    ctxStop,
-			lgr:    lgr,
-			chTxDr: make(chan []libre.ChConfExt_Export, 10),
-			wg:     wg,
-			cnf:    cnf,
+
+		// очередь Modbus-TCP формируется на каждый коннект к удалённому устройству
+		names := []string{v.Host}
+		if v.ConType == "TCP" {
+			names = names[:0]
+			for _, con := range hostConnects.mbTCPmaster {
+				if strings.HasPrefix(con.Name, v.Host+"@") {
+					names = append(names, con.Name)
+				}
+			}
+		}
+
+		for _, name := range names {
+			iGoQueue := iGoQueue{
+				name:   "Queue:" + name + ":" + v.ConType,
+				ctx:    ctxStop,
+				lgr:    lgr,
+				chTxDr: make(chan pollReqT),
+				wg:     wg,
+				cnf:    cnf,
+				poll:   pollConf,
+			}
+			inst.queue = append(inst.queue, iGoQueue)
+		}
+	}
+
+	// Маршруты записи
+	wrRoute = writeRouteT{
+		chDev: make(map[string]chan writeReqT),
+		tags:  make(map[string]map[string]libre.ChConfExt_Export),
+	}
+
+	devAddr := make(map[string]string)
+	for _, v := range cnf.SheetMain_Dev {
+		devAddr[v.Device] = v.Address
+	}
+
+	for _, v := range cnf.SheetChan {
+
+		if !strings.HasPrefix(v.FuncType, "Write") {
+			continue
+		}
+		if _, ok := wrRoute.tags[v.Device]; !ok {
+			wrRoute.tags[v.Device] = make(map[string]libre.ChConfExt_Export)
+		}
+		wrRoute.tags[v.Device][v.Comment] = libre.ChConfExt_Export{
+			DeviceName: v.Device,
+			DeviceAddr: devAddr[v.Device],
+			Address:    v.Address,
+			DataType:   v.DataType,
+			Comment:    v.Comment,
+			TimeScan:   v.TimeScan,
+			FuncType:   v.FuncType,
+			Format:     v.Format,
 		}
-		inst.queue = append(inst.queue, iGoQueue)
 	}
 
 	// Driver
@@ -1568,6 +2499,14 @@ func buildGoData(ctxStop context.Context, cnf libre.ConfXLSX_Export, hostConnect
 				return goInst{}, fmt.Errorf("нет присвоения коннекта ТСР: {%s}", v.name)
 			}
 
+			// канал записи для устройств коннекта
+			chWr := make(chan writeReqT)
+			for _, dev := range cnf.SheetMain_Dev {
+				if nameConTCP(dev.Host, dev.IP, dev.Port) == sl[1] {
+					wrRoute.chDev[dev.Device] = chWr
+				}
+			}
+
 			// сборка и добавление
 			iGoDrModbusTCP := iGoDrModbusTCP{
 				name:   "DriverModbusTCP:" + sl[1] + ":" + sl[2],
@@ -1576,11 +2515,12 @@ func buildGoData(ctxStop context.Context, cnf libre.ConfXLSX_Export, hostConnect
 				con:    conn,
 				chRxDr: v.chTxDr,
 				chTxDB: inst.db[0].chRx,
+				chWr:   chWr,
 				wg:     wg,
 			}
 			inst.drMbTCP = append(inst.drMbTCP, iGoDrModbusTCP)
 
-		case "COM":
+		case "COM", "RTU-TCP", "UDP":
 			// определение коннекта их списка хост коннектов по номеру коннекта
 			conn := modbusrtumaster.Connect{}
 			ok := false
@@ -1591,7 +2531,15 @@ func buildGoData(ctxStop context.Context, cnf libre.ConfXLSX_Export, hostConnect
 				}
 			}
 			if !ok {
-				return goInst{}, fmt.Errorf("нет присвоения коннекта COM: {%s}", v.name)
+				return goInst{}, fmt.Errorf("нет присвоения коннекта %s: {%s}", sl[2], v.name)
+			}
+
+			// канал записи для устройств коннекта
+			chWr := make(chan writeReqT)
+			for _, dev := range cnf.SheetMain_Dev {
+				if dev.Host == sl[1] {
+					wrRoute.chDev[dev.Device] = chWr
+				}
 			}
 
 			// сборка и добавление
@@ -1602,6 +2550,7 @@ func buildGoData(ctxStop context.Context, cnf libre.ConfXLSX_Export, hostConnect
 				con:    conn,
 				chRxDr: v.chTxDr,
 				chTxDB: inst.db[0].chRx,
+				chWr:   chWr,
 				wg:     wg,
 			}
 			inst.drMbRTU = append(inst.drMbRTU, iGoDrModbusRTU)
@@ -1623,7 +2572,14 @@ func goStart(data *goInst) error {
 
 	// БД
 	for _, v := range data.db {
-		go goDriverDB(v.ctx, v.chRx, v.wg)
+		workers.Go(v.ctx, v.wg, v.name, func(ctx context.Context) error {
+			return goDriverDB(ctx, v.chRx, dbBuf, v.conf)
+		})
+	}
+
+	// Супервизоры подключений Modbus-TCP
+	for _, v := range data.drMbTCP {
+		go goSuperviseModbusTCP(v.ctx, v.lgr, v.con, v.wg)
 	}
 
 	// goDriverModbusTCP
@@ -1636,7 +2592,9 @@ func goStart(data *goInst) error {
 
 		switch sl[0] {
 		case "DriverModbusTCP":
-			go goDriverModbusTCP(v.ctx, v.lgr, v.con, v.chRxDr, v.chTxDB, v.wg)
+			workers.Go(v.ctx, v.wg, v.name, func(ctx context.Context) error {
+				return goDriverModbusTCP(ctx, v.lgr, v.con, v.chRxDr, v.chTxDB, v.chWr)
+			})
 
 		default:
 			return fmt.Errorf("нет распознанного наименования (код 1): {%s} ", sl[0])
@@ -1654,7 +2612,9 @@ func goStart(data *goInst) error {
 		switch sl[0] {
 
 		case "DriverModbusRTU":
-			go goDriverModbusRTU(v.ctx, v.lgr, v.con, v.chRxDr, v.chTxDB, v.wg)
+			workers.Go(v.ctx, v.wg, v.name, func(ctx context.Context) error {
+				return goDriverModbusRTU(ctx, v.lgr, v.con, v.chRxDr, v.chTxDB, v.chWr)
+			})
 
 		default:
 			return fmt.Errorf("нет распознанного наименования (код 2): {%s} ", sl[0])
@@ -1672,10 +2632,14 @@ func goStart(data *goInst) error {
 
 		switch sl[2] {
 		case "TCP":
-			go goQueueForModbusTCP(v.ctx, v.cnf, v.chTxDr, v.wg)
+			workers.Go(v.ctx, v.wg, v.name, func(ctx context.Context) error {
+				return goQueueForModbusTCP(ctx, v.name, v.cnf, v.poll, v.chTxDr)
+			})
 
-		case "COM":
-			go goQueueForModbusRTU(v.ctx, v.name, v.cnf, v.chTxDr, v.wg)
+		case "COM", "RTU-TCP", "UDP":
+			workers.Go(v.ctx, v.wg, v.name, func(ctx context.Context) error {
+				return goQueueForModbusRTU(ctx, v.name, v.cnf, v.poll, v.chTxDr)
+			})
 
 		default:
 			return fmt.Errorf("нет распознанного наименования (код 2): {%s} ", sl[0])
@@ -1695,6 +2659,7 @@ func goStart(data *goInst) error {
 func buildConfDataSlaveModbusRTU(conf libre.ConfXLSX_Export, nameCon string) (mbRTUcon modbusrtumaster.Connect, err error) {
 
 	mbRTUcon.Name = nameCon
+	mbRTUcon.ConType = "COM"
 
 	for _, dev := range conf.SheetMain_Header {
 
@@ -1755,301 +2720,802 @@ func buildConfDataSlaveModbusRTU(conf libre.ConfXLSX_Export, nameCon string) (mb
 	return mbRTUcon, nil
 }
 
-// Подготовка конфигурационных параметров слейва Modbus-TCP, перед коннектом. Возвращается TCP коннект и ошибка.
+// Подготовка конфигурационных параметров слейвов Modbus-TCP, перед коннектом. На каждый удалённый
+// IP/порт устройств хост коннекта создаётся отдельный коннект. Возвращаются TCP коннекты и ошибка.
 //
 // Параметры:
 //
 // conf - конфигурация
-// nameCon - имя коннекта
-func buildConfDataSlaveModbusTCP(conf libre.ConfXLSX_Export, nameCon string) (mbTCPcon modbustcpmaster.Connect, err error) {
+// nameCon - имя хост коннекта
+func buildConfDataSlaveModbusTCP(conf libre.ConfXLSX_Export, nameCon string) (mbTCPcon []modbustcpmaster.Connect, err error) {
 
-	mbTCPcon.Name = nameCon
-
-	var cnt = 0
 	// получение данных хоста
+	var host libre.SheetMain_Head
+	ok := false
 	for _, con := range conf.SheetMain_Header {
 		if con.Host == nameCon {
-			mbTCPcon.HostIP = con.Address
-			mbTCPcon.HostPort = con.Port
-			cnt++
+			host = con
+			ok = true
 		}
 	}
+	if !ok {
+		return nil, fmt.Errorf("не найден хост коннект {%s}", nameCon)
+	}
 
-	// получение данных устройства
-	for _, con := range conf.SheetMain_Dev {
-		if con.Host == nameCon {
-			mbTCPcon.SlaveIP = con.IP
-			mbTCPcon.SlavePort = con.Port
-			cnt++
+	// получение данных устройств, устройства с одинаковым IP/портом используют общий коннект
+	for _, dev := range conf.SheetMain_Dev {
+		if dev.Host != nameCon {
+			continue
+		}
+		if dev.IP == "" || dev.Port == "" {
+			return nil, fmt.Errorf("у устройства {%s} не указаны IP и Port для TCP коннекта", dev.Device)
+		}
+
+		name := nameConTCP(dev.Host, dev.IP, dev.Port)
+		if slices.ContainsFunc(mbTCPcon, func(c modbustcpmaster.Connect) bool { return c.Name == name }) {
+			continue
 		}
+
+		mbTCPcon = append(mbTCPcon, modbustcpmaster.Connect{
+			Name:      name,
+			HostIP:    host.Address,
+			HostPort:  host.Port,
+			SlaveIP:   dev.IP,
+			SlavePort: dev.Port,
+		})
 	}
 
 	// проверка результата выборки данных
-	if cnt != 2 {
-		return modbustcpmaster.Connect{}, fmt.Errorf("ошибка считывания данных IP и Port перед установкой TCP коннекта")
+	if len(mbTCPcon) == 0 {
+		return nil, fmt.Errorf("ошибка считывания данных IP и Port перед установкой TCP коннекта: нет устройств у {%s}", nameCon)
 	}
 	return mbTCPcon, nil
 }
 
-// Go. Сохранение данных в БД
+// Имя коннекта Modbus-TCP к удалённому устройству. Возвращается имя вида "Host@IP/Port".
 //
 // Параметры:
 //
-// ctx - контекст для завершения работы
-// chStore - канал приёма данных для сохранения в БД
-// wg - WaitGroup для отслеживания завершения Go рутины
-func goDriverDB(ctx context.Context, chStore <-chan []database.StoreType, wg *sync.WaitGroup) {
-
-	wg.Add(1)
+// host - имя хост коннекта
+// ip - IP адрес устройства
+// port - порт устройства
+func nameConTCP(host, ip, port string) string {
+	return host + "@" + ip + "/" + port
+}
 
-	defer func() {
-		wg.Done()
-	}()
+// Создание сигнала активности по переменным окружения. Функция возвращает сигнал (nil, если тэги
+// не заданы) и ошибку.
+func buildHeartbeat() (*heartbeat.HeartbeatT, error) {
 
-	for {
-		select {
-		// Завершение работы Go рутины
-		case <-ctx.Done():
-			return
-		// Приём очередных данных
-		case newReq, ok := <-chStore:
+	tags, err := heartbeat.ParseTags(os.Getenv("HEARTBEAT_TAGS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
 
-			if ok {
-				// Запись конфигурации хоста
-				for _, el := range newReq {
+	mode := os.Getenv("HEARTBEAT_MODE")
+	switch mode {
+	case "":
+		mode = heartbeat.ModeToggle
+	case heartbeat.ModeToggle, heartbeat.ModeCounter:
+	default:
+		return nil, fmt.Errorf("недопустимый режим HEARTBEAT_MODE {%s}", mode)
+	}
 
-					Q := fmt.Sprintf("INSERT INTO %s.%s (dev, name, value, qual) VALUES ($1, $2, $3, $4)",
-						os.Getenv("TABLE_SCHEMA"),
-						os.Getenv("TABLE_DATA"))
+	// Тэги должны быть настроены как тэги записи
+	for _, t := range tags {
+		tag, ok := wrRoute.tags[t.Dev][t.Tag]
+		if !ok {
+			return nil, fmt.Errorf("у устройства {%s} нет тэга записи {%s}", t.Dev, t.Tag)
+		}
+		if mode == heartbeat.ModeCounter && tag.DataType == "Bool" {
+			return nil, fmt.Errorf("режим {%s} не применяется к тэгу {%s/%s} типа Bool", mode, t.Dev, t.Tag)
+		}
+	}
 
-					_, err := db.Ptr.Exec(Q, el.Dev, el.Name, el.Value, el.Qual)
-					if err != nil {
-						lgr.E.Printf("goDriverDB. ошибка [%v] записи данных [%v] в БД \n", err, el)
-						os.Exit(1)
-					}
-				}
+	period := defHeartbeatPeriod
+	if v := os.Getenv("HEARTBEAT_PERIOD_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("недопустимое значение HEARTBEAT_PERIOD_MS {%s}", v)
+		}
+		period = time.Duration(ms) * time.Millisecond
+	}
 
-			} else {
-				lgr.E.Println("goDriverDB. закрыт канал чтения запросов")
-				os.Exit(1)
-			}
-		// Нет событий
-		default:
-			time.Sleep(100 * time.Microsecond)
+	diskMin := uint64(defHeartbeatDiskMin)
+	if v := os.Getenv("HEARTBEAT_DISK_MIN_MB"); v != "" {
+		diskMin, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("недопустимое значение HEARTBEAT_DISK_MIN_MB {%s}", v)
 		}
 	}
 
+	return &heartbeat.HeartbeatT{
+		Tags:   tags,
+		Period: period,
+		Mode:   mode,
+		Write:  writeTag,
+		Check: func() error {
+			return checkArchiving(diskMin << 20)
+		},
+		Log: lgr.W.Printf,
+	}, nil
 }
 
-// Go. Опрос устройств по Modbus-TCP
+// Проверка исправности архивирования. Функция возвращает причину неисправности, или nil.
 //
 // Параметры:
 //
-// ctx - контекст для завершения работы
-// lgr - логер
-// con - коннект
-// chForModbusTCP - канал приёма запросов на опрос
-// chForDB - канал передачи данных на архивирование в Go БД
-func goDriverModbusTCP(ctx context.Context, lgr loger.Log_Object, con modbustcpmaster.Connect, chForModbusTCP <-chan []libre.ChConfExt_Export, chForDB chan<- []database.StoreType, wg *sync.WaitGroup) {
+// diskMin - наименьшее свободное место для буфера архива, байт
+func checkArchiving(diskMin uint64) error {
 
-	wg.Add(1)
+	for _, w := range workers.Health() {
+		if w.Name == "DB:Main" && w.State != supervisor.StateRunning {
+			return fmt.Errorf("запись архива в состоянии {%s}: {%s}", w.State, w.LastErr)
+		}
+	}
 
-	defer func() {
-		wg.Done()
-	}()
+	if t := replayStuck.Load(); t != 0 {
+		if d := time.Since(time.Unix(0, t)); d > dbStallAfter {
+			return fmt.Errorf("воспроизведение буфера архива не выполняется {%v} при доступной БД", d.Truncate(time.Second))
+		}
+	}
 
-	if con.Client == nil {
-		lgr.E.Println("Modbus-TCP драйвер. отсутствует подключение по:", con.Name)
-		os.Exit(1)
+	last := dbAlive.Load()
+	if last == 0 {
+		return errors.New("запись архива ещё не выполнялась")
+	}
+	if d := time.Since(time.Unix(0, last)); d > dbStallAfter {
+		return fmt.Errorf("запись архива не выполняется {%v}", d.Truncate(time.Second))
 	}
 
-	// ожидание поступления новых данных в канал
-	//
-	for {
-		select {
+	free, err := heartbeat.FreeBytes(os.Getenv("BUFFER_DIR"))
+	if err != nil {
+		return err
+	}
+	if free < diskMin {
+		return fmt.Errorf("свободного места для буфера архива {%d} МБ, меньше {%d} МБ", free>>20, diskMin>>20)
+	}
 
-		//Завершение работы по контексту
-		case <-ctx.Done():
-			return
+	return nil
+}
 
-		case newReq, ok := <-chForModbusTCP: // приём новых данных для запроса
-			if !ok {
-				lgr.E.Println("GoDriverModbusTCP. Закрыт канал чтения запросов.")
-				os.Exit(1)
-			}
+// Журналирование смены состояния рабочей Go рутины.
+//
+// Параметры:
+//
+// info - состояние рабочей Go рутины
+func logWorkerChange(info supervisor.HealthInfoT) {
 
-			slRx := make([]database.StoreType, 0)
+	switch info.State {
+	case supervisor.StateRunning:
+		if info.Restarts > 0 {
+			lgr.I.Printf("Go рутина {%s} -> перезапущена, перезапусков: {%d}", info.Name, info.Restarts)
+		}
+	case supervisor.StateRestarting:
+		lgr.E.Printf("Go рутина {%s} -> сбой, будет перезапущена: {%s}", info.Name, info.LastErr)
+	case supervisor.StateStopped:
+		lgr.I.Printf("Go рутина {%s} -> завершена", info.Name)
+	}
+}
 
-			for _, v := range newReq {
+// Go. Сохранение данных в БД
+//
+// Параметры:
+//
+// ctx - контекст для завершения работы
+// chStore - канал приёма данных для сохранения в БД
+// buf - буфер на диске для данных, не записанных в БД
+// conf - настройки записи архива: размер пачки, интервал записи, настройки архивирования тэгов
+//
+// Функция возвращает nil при завершении по контексту, иначе - причину сбоя.
+func goDriverDB(ctx context.Context, chStore <-chan []database.StoreType, buf *dbbuffer.BufferT, conf dbWriterConfT) error {
 
-				// подготовка данных для запроса
-				slaveID, address, quantity, err := prepareDataClientModbusTCP(v)
-				if err != nil {
-					lgr.E.Printf("ошибка [%v] в преобразовании входных данных [%v]\n", err, v)
-					os.Exit(1)
-				}
+	// Хэш последней строки архива, от которого продолжается цепочка. При недоступности БД
+	// данные сохраняются в буфер, а хэш читается повторно перед воспроизведением буфера.
+	// Первые строки буфера могли быть уже записаны (потерян ответ БД), поэтому после чтения
+	// хэша они сверяются с последними строками БД (checkHead).
+	prevHash, err := hashchain.LastHashDB(db.Ptr)
+	chainOK := err == nil
+	dbDown := !chainOK
+	checkHead := true
+	if dbDown {
+		lgr.W.Printf("goDriverDB. БД недоступна {%v}, данные сохраняются в буфер", err)
+	}
 
-				rx := database.StoreType{}
+	// Строки, накопленные для записи одной пачкой
+	pending := make([]dbbuffer.RecordT, 0, conf.batchSize)
 
-				// запрос
-				rxUint16, rxByte, err := selectFuncMbTCPDo(con, v.FuncType, slaveID, address, quantity)
-				// повтор запроса из-за ошибки
-				if err != nil {
-					rxUint16, rxByte, err = selectFuncMbTCPDo(con, v.FuncType, slaveID, address, quantity)
-				}
+	// Фильтр архивирования по зоне нечувствительности и интервалам
+	filter := deadband.New(conf.archive)
 
-				// Обработка результата запроса
-				switch v.FuncType {
-				case "ReadHoldingRegisters", "ReadInputRegisters":
-					if err != nil {
-						lgr.W.Printf("ошибка {%v} при запросе Modbus-TCP: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d} ", err, slaveID, v.FuncType, address, quantity)
-						rx.Value = 0
-						rx.Qual = 0
-					} else {
-						val, err := buildValFromUint16(rxUint16, v.DataType, v.Format)
-						if err != nil {
-							lgr.E.Println("ошибка в обработке принятых данных Modbus-TCP (код 1): ", err)
-							os.Exit(1)
-						}
-						rx.Value = val
-						rx.Qual = 1
-					}
-					rx.Dev = v.DeviceName
-					rx.Name = v.Comment
-					slRx = append(slRx, rx)
+	// Запись накопленной пачки: в БД, или в буфер, если БД недоступна или буфер не пуст (сохранение порядка строк)
+	flush := func() error {
 
-				case "ReadDiscreteInputs", "ReadCoil":
-					if err != nil {
-						lgr.W.Printf("ошибка {%v} при запросе Modbus-TCP: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d} ", err, slaveID, v.FuncType, address, quantity)
-						rx.Value = 0
-						rx.Qual = 0
-					} else {
-						val, err := buildValFromByte(rxByte, v.DataType, v.Format)
-						if err != nil {
-							lgr.E.Println("ошибка в обработке принятых данных Modbus-TCP (код 2): ", err)
-							os.Exit(1)
-						}
-						rx.Value = val
-						rx.Qual = 1
-					}
-					rx.Dev = v.DeviceName
-					rx.Name = v.Comment
-					slRx = append(slRx, rx)
+		if len(pending) == 0 {
+			return nil
+		}
 
-				default:
-					lgr.E.Println("ошибка распознавания функции: ", v.FuncType)
-					os.Exit(1)
-				}
+		// Пачки не больше пачки воспроизведения, чтобы пачка с неизвестным исходом записи
+		// целиком проверялась при воспроизведении
+		done := 0
+		for !dbDown && buf.Len() == 0 && done < len(pending) {
+			n := min(len(pending)-done, conf.batchSize)
+			prevHash, err = storeRowsDB(prevHash, pending[done:done+n], buf)
+			if err != nil {
+				dbDown, chainOK = true, false
+				lgr.W.Printf("goDriverDB. ошибка {%v} записи в БД, данные сохраняются в буфер", err)
+				break
+			}
+			done += n
+		}
 
+		if done < len(pending) {
+			err = buf.Append(pending[done:])
+			if err != nil {
+				return fmt.Errorf("ошибка {%v} записи данных в буфер", err)
 			}
+		}
+		pending = pending[:0]
+		return nil
+	}
 
-			// передача сформированного слайса в канал
-			chForDB <- slRx
+	tFlush := time.NewTicker(conf.flushEvery)
+	defer tFlush.Stop()
 
-		// ведение опроса слева
-		default:
-			time.Sleep(time.Microsecond * 1)
+	tReplay := time.NewTicker(replayPeriod)
+	defer tReplay.Stop()
+
+	for {
+		select {
+		// Завершение работы Go рутины (накопленные строки сохраняются)
+		case <-ctx.Done():
+			return flush()
+
+		// Приём очередных данных
+		case newReq, ok := <-chStore:
+
+			if !ok {
+				return errors.New("закрыт канал чтения запросов")
+			}
+
+			// Строки архива с моментом получения значения драйвером
+			for _, el := range newReq {
+				ts := el.TimeStamp
+				if ts.IsZero() {
+					ts = time.Now()
+				}
+				// последнее значение для шлюза, независимо от фильтра архивирования
+				gw.Update(el.Dev, el.Name, el.Value, el.Qual, ts)
+
+				_, isText := el.Value.(string)
+				rec := dbbuffer.RecordT{
+					Dev:       el.Dev,
+					Name:      el.Name,
+					Value:     hashchain.FormatValue(el.Value),
+					Text:      isText,
+					Qual:      hashchain.FormatValue(el.Qual),
+					TimeStamp: hashchain.TruncTime(ts),
+				}
+
+				// значения в зоне нечувствительности не архивируются
+				if !filter.Pass(deadband.Key(rec.Dev, rec.Name), rec.Value, rec.Qual, rec.TimeStamp) {
+					continue
+				}
+				pending = append(pending, rec)
+			}
+
+			if len(pending) >= conf.batchSize {
+				err = flush()
+				if err != nil {
+					return err
+				}
+			}
+
+		// Запись накопленных строк по интервалу
+		case <-tFlush.C:
+			err = flush()
+			if err != nil {
+				return err
+			}
+			dbAlive.Store(time.Now().UnixNano())
+
+		// Воспроизведение буфера
+		case <-tReplay.C:
+
+			if !dbDown && buf.Len() == 0 {
+				continue
+			}
+
+			if !chainOK {
+				prevHash, err = hashchain.LastHashDB(db.Ptr)
+				if err != nil {
+					continue
+				}
+				chainOK, checkHead = true, true
+			}
+
+			replayed := 0
+			for i := 0; i < replayBatches && buf.Len() > 0; i++ {
+				var n int
+				n, err = buf.Replay(conf.batchSize, func(recs []dbbuffer.RecordT) error {
+					if checkHead {
+						done, err := committedRowsDB(prevHash, recs)
+						if err != nil {
+							return err
+						}
+						if done > 0 {
+							lgr.W.Printf("goDriverDB. первые {%d} строк буфера уже записаны в БД, пропускаются", done)
+						}
+						recs = recs[done:]
+						if len(recs) == 0 {
+							checkHead = false
+							return nil
+						}
+					}
+					hash, err := storeRowsDB(prevHash, recs, buf)
+					if err != nil {
+						return err
+					}
+					prevHash, checkHead = hash, false
+					return nil
+				})
+				if err != nil {
+					break
+				}
+				replayed += n
+			}
+			if err != nil {
+				// исход записи неизвестен: хэш читается повторно, первые строки буфера сверяются с БД
+				chainOK = false
+				if replayed == 0 {
+					checkReplayStuck(err)
+				} else {
+					replayStuck.Store(0)
+				}
+				continue
+			}
+			replayStuck.Store(0)
+
+			if buf.Len() == 0 {
+				dbDown = false
+				lgr.I.Println("goDriverDB. БД доступна, буфер воспроизведён")
+			}
 		}
 	}
 
 }
 
-// Go. Опрос устройств по Modbus-RTU
+// Учёт безуспешного воспроизведения буфера. Недоступность БД - ожидаемое накопление строк в буфере;
+// при доступной БД воспроизведение отмечается как остановившееся (см. checkArchiving).
 //
 // Параметры:
 //
-// ctx - контекст для завершения работы
-// lgr - логер
-// con - коннект
-// chForModbusRTU - канал приёма запросов на опрос
-// chForDB - канал передачи данных на архивирование в Go БД
-func goDriverModbusRTU(ctx context.Context, lgr loger.Log_Object, con modbusrtumaster.Connect, chForModbusRTU <-chan []libre.ChConfExt_Export, chForDB chan<- []database.StoreType, wg *sync.WaitGroup) {
+// err - ошибка воспроизведения
+func checkReplayStuck(err error) {
 
-	wg.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), dbWriteTimeout)
+	defer cancel()
+
+	if db.Ptr.PingContext(ctx) != nil {
+		replayStuck.Store(0)
+		return
+	}
+
+	if replayStuck.CompareAndSwap(0, time.Now().UnixNano()) {
+		lgr.E.Printf("goDriverDB. воспроизведение буфера не выполняется при доступной БД: {%v}", err)
+	}
+}
+
+// Запись строк архива в БД одной транзакцией через COPY, с продолжением цепочки хэшей. Функция возвращает
+// хэш последней записанной строки и ошибку. При ошибке цепочка не продолжается.
+//
+// Параметры:
+//
+// prevHash - хэш последней строки архива в БД
+// recs - строки архива
+func insertRowsDB(prevHash string, recs []dbbuffer.RecordT) (string, error) {
+
+	tStart := time.Now()
 
+	ctx, cancel := context.WithTimeout(context.Background(), dbWriteTimeout)
+	defer cancel()
+
+	tx, err := db.Ptr.BeginTx(ctx, nil)
+	if err != nil {
+		return prevHash, fmt.Errorf("ошибка {%w} начала транзакции", err)
+	}
 	defer func() {
-		wg.Done()
+		_ = tx.Rollback()
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"),
+		"dev", "name", "value", "valuetext", "qual", "timestamp", "hash"))
+	if err != nil {
+		return prevHash, fmt.Errorf("ошибка {%w} подготовки COPY", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	hash := prevHash
+	for _, r := range recs {
+
+		row, args := archiveRow(hash, r)
+
+		_, err = stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return prevHash, fmt.Errorf("ошибка {%w} записи данных {%v} в БД", err, r)
+		}
+		hash = row.Hash
+	}
+
+	// Завершение COPY
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return prevHash, fmt.Errorf("ошибка {%w} завершения COPY", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return prevHash, fmt.Errorf("ошибка {%w} фиксации транзакции", err)
+	}
+
+	dbMeter.Add(len(recs), time.Since(tStart))
+
+	return hash, nil
+}
+
+// Запись строк архива в БД с карантином строк, которые БД не примет при повторе. Пачка, отклонённая
+// постоянной ошибкой (данные, ограничения, схема), записывается построчно: отклонённые строки журналируются
+// и помещаются в карантин буфера, остальные записываются. Функция возвращает хэш последней записанной строки
+// и ошибку (временная ошибка БД, строки не записаны).
+//
+// Параметры:
+//
+// prevHash - хэш последней строки архива в БД
+// recs - строки архива
+// buf - буфер архива (карантин)
+func storeRowsDB(prevHash string, recs []dbbuffer.RecordT, buf *dbbuffer.BufferT) (string, error) {
+
+	hash, err := insertRowsDB(prevHash, recs)
+	if err == nil || !permanentDBErr(err) {
+		return hash, err
+	}
+	lgr.E.Printf("goDriverDB. пачка из {%d} строк отклонена БД {%v}, запись построчно", len(recs), err)
+
+	hash, rejected, err := insertEachRowDB(prevHash, recs)
+	if err != nil {
+		return prevHash, err
+	}
+
+	for _, rj := range rejected {
+		lgr.E.Printf("goDriverDB. строка архива {%+v} отклонена БД {%v}, помещена в карантин", rj.rec, rj.err)
+		err = buf.Quarantine([]dbbuffer.RecordT{rj.rec}, rj.err.Error())
+		if err != nil {
+			lgr.E.Printf("goDriverDB. строка архива {%+v} не помещена в карантин: {%v}", rj.rec, err)
+		}
+	}
+
+	return hash, nil
+}
+
+// Количество первых строк архива recs, уже записанных в БД: транзакция могла быть зафиксирована, когда
+// ответ БД был потерян. Строки recs[:n] считаются записанными, если последняя строка БД совпадает с recs[n-1],
+// а цепочка хэшей recs[:n] от строки БД, предшествующей им, сходится к хэшу последней строки lastHash.
+// Функция возвращает количество записанных строк и ошибку.
+//
+// Параметры:
+//
+// lastHash - хэш последней строки архива в БД
+// recs - строки архива
+func committedRowsDB(lastHash string, recs []dbbuffer.RecordT) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbWriteTimeout)
+	defer cancel()
+
+	schema, table := os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA")
+
+	var last hashchain.RowT
+
+	q := fmt.Sprintf(`SELECT dev, name, COALESCE(valuetext, value::text), qual::text, timestamp
+	FROM %s.%s ORDER BY id DESC LIMIT 1`, schema, table)
+
+	err := db.Ptr.QueryRowContext(ctx, q).Scan(&last.Dev, &last.Name, &last.Value, &last.Qual, &last.TimeStamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка {%w} чтения последней строки архива", err)
+	}
+	lastRow := hashchain.Canonical(last)
+
+	q = fmt.Sprintf("SELECT COALESCE(hash, '') FROM %s.%s ORDER BY id DESC LIMIT 1 OFFSET $1", schema, table)
+
+	for n := len(recs); n > 0; n-- {
+
+		if row, _ := archiveRow("", recs[n-1]); hashchain.Canonical(row) != lastRow {
+			continue
+		}
+
+		// Хэш строки БД, предшествующей recs[:n]
+		prev := hashchain.Genesis
+		err = db.Ptr.QueryRowContext(ctx, q, n).Scan(&prev)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("ошибка {%w} чтения хэша строки архива", err)
+		}
+
+		for _, r := range recs[:n] {
+			row, _ := archiveRow(prev, r)
+			prev = row.Hash
+		}
+		if prev == lastHash {
+			return n, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// Построчная запись строк архива в БД одной транзакцией. Строка с постоянной ошибкой отменяется до точки
+// сохранения и пропускается, цепочка хэшей продолжается от последней записанной строки. Функция возвращает
+// хэш последней записанной строки, отклонённые строки и ошибку. При ошибке ничего не записывается.
+//
+// Параметры:
+//
+// prevHash - хэш последней строки архива в БД
+// recs - строки архива
+func insertEachRowDB(prevHash string, recs []dbbuffer.RecordT) (string, []rejectedRowT, error) {
+
+	tStart := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbWriteTimeout)
+	defer cancel()
+
+	tx, err := db.Ptr.BeginTx(ctx, nil)
+	if err != nil {
+		return prevHash, nil, fmt.Errorf("ошибка {%w} начала транзакции", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
 	}()
 
+	q := fmt.Sprintf("INSERT INTO %s.%s (dev, name, value, valuetext, qual, timestamp, hash) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_DATA"))
+
+	hash := prevHash
+	rejected := make([]rejectedRowT, 0)
+
+	for _, r := range recs {
+
+		row, args := archiveRow(hash, r)
+
+		_, err = tx.ExecContext(ctx, "SAVEPOINT archive_row")
+		if err != nil {
+			return prevHash, nil, fmt.Errorf("ошибка {%w} точки сохранения", err)
+		}
+
+		_, err = tx.ExecContext(ctx, q, args...)
+		if err != nil {
+			if !permanentDBErr(err) {
+				return prevHash, nil, fmt.Errorf("ошибка {%w} записи данных {%v} в БД", err, r)
+			}
+			rejected = append(rejected, rejectedRowT{rec: r, err: err})
+
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT archive_row")
+			if err != nil {
+				return prevHash, nil, fmt.Errorf("ошибка {%w} отмены до точки сохранения", err)
+			}
+			continue
+		}
+		hash = row.Hash
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return prevHash, nil, fmt.Errorf("ошибка {%w} фиксации транзакции", err)
+	}
+
+	dbMeter.Add(len(recs)-len(rejected), time.Since(tStart))
+
+	return hash, rejected, nil
+}
+
+// Строка архива с хэшем, связывающим её с предыдущей, и значения колонок для записи в БД
+// (dev, name, value, valuetext, qual, timestamp, hash). Функция возвращает строку и значения колонок.
+//
+// Параметры:
+//
+// prevHash - хэш предыдущей строки архива
+// r - строка архива
+func archiveRow(prevHash string, r dbbuffer.RecordT) (hashchain.RowT, []any) {
+
+	row := hashchain.RowT{
+		Dev:       r.Dev,
+		Name:      r.Name,
+		Value:     r.Value,
+		Qual:      r.Qual,
+		TimeStamp: hashchain.TruncTime(r.TimeStamp),
+	}
+	row.Hash = hashchain.CalcHash(prevHash, row)
+
+	// строковое значение хранится в отдельной колонке, т.к. value числовая
+	var value, text interface{} = row.Value, nil
+	if r.Text {
+		value, text = "0", row.Value
+	}
+
+	return row, []any{row.Dev, row.Name, value, text, row.Qual, row.TimeStamp, row.Hash}
+}
+
+// Проверка постоянной ошибки БД: строку не примут и при повторе (классы SQLSTATE 22 - данные,
+// 23 - ограничения, 42 - синтаксис и схема). Возвращается true для постоянной ошибки.
+//
+// Параметры:
+//
+// err - ошибка записи в БД
+func permanentDBErr(err error) bool {
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code.Class() {
+	case "22", "23", "42":
+		return true
+	}
+
+	return false
+}
+
+// Чтение параметров записи архива пачками. Функция возвращает размер пачки, интервал записи и ошибку.
+//
+// Незаданные параметры принимают значения по умолчанию.
+func readBatchConf() (batchSize int, flushEvery time.Duration, err error) {
+
+	batchSize = defBatchSize
+	flushEvery = defFlushEvery
+
+	if v := os.Getenv("DB_BATCH_SIZE"); v != "" {
+		batchSize, err = strconv.Atoi(v)
+		if err != nil || batchSize <= 0 {
+			return 0, 0, fmt.Errorf("недопустимое значение DB_BATCH_SIZE {%s}", v)
+		}
+	}
+
+	if v := os.Getenv("DB_FLUSH_INTERVAL_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return 0, 0, fmt.Errorf("недопустимое значение DB_FLUSH_INTERVAL_MS {%s}", v)
+		}
+		flushEvery = time.Duration(ms) * time.Millisecond
+	}
+
+	return batchSize, flushEvery, nil
+}
+
+// Чтение настроек опроса из переменных окружения. Функция возвращает настройки и ошибку.
+func readPollConf() (conf pollConfT, err error) {
+
+	conf.blocks = coalesce.ConfT{
+		MaxRegs: coalesce.MaxRegisters,
+		MaxBits: coalesce.MaxBits,
+	}
+
+	for _, el := range []struct {
+		env      string
+		min, max uint64
+		val      *uint16
+	}{
+		{"POLL_MAX_REGS", 1, coalesce.MaxRegisters, &conf.blocks.MaxRegs},
+		{"POLL_MAX_BITS", 1, coalesce.MaxBits, &conf.blocks.MaxBits},
+		{"POLL_MAX_GAP", 0, math.MaxUint16, &conf.blocks.MaxGap},
+	} {
+		v := os.Getenv(el.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || n < el.min || n > el.max {
+			return pollConfT{}, fmt.Errorf("недопустимое значение %s {%s}", el.env, v)
+		}
+		*el.val = uint16(n)
+	}
+
+	for _, el := range []struct {
+		env string
+		val *time.Duration
+	}{
+		{"POLL_PHASE_MS", &conf.phaseStep},
+		{"POLL_JITTER_MS", &conf.jitter},
+	} {
+		v := os.Getenv(el.env)
+		if v == "" {
+			continue
+		}
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return pollConfT{}, fmt.Errorf("недопустимое значение %s {%s}", el.env, v)
+		}
+		*el.val = time.Duration(ms) * time.Millisecond
+	}
+
+	return conf, nil
+}
+
+// Go. Опрос устройств по Modbus-TCP
+//
+// Параметры:
+//
+// ctx - контекст для завершения работы
+// lgr - логер
+// con - коннект
+// chForModbusTCP - канал приёма запросов на опрос
+// chForDB - канал передачи данных на архивирование в Go БД
+// chWrite - канал приёма запросов на запись
+//
+// Функция возвращает nil при завершении по контексту, иначе - причину сбоя.
+func goDriverModbusTCP(ctx context.Context, lgr loger.Log_Object, con modbustcpmaster.Connect, chForModbusTCP <-chan pollReqT, chForDB chan<- []database.StoreType, chWrite <-chan writeReqT) error {
+
 	if con.Client == nil {
-		lgr.E.Println("Modbus-RTU драйвер. отсутствует подключение по:", con.Name)
-		os.Exit(1)
+		return fmt.Errorf("отсутствует подключение по {%s}", con.Name)
 	}
 
+	// последние достоверные значения тэгов, архивируемые при недостоверном результате опроса
+	last := make(map[string]interface{})
+
 	// ожидание поступления новых данных в канал
 	//
 	for {
 		select {
 
-		// Завершение работы по контексту
+		//Завершение работы по контексту
 		case <-ctx.Done():
-			return
+			return nil
 
-		case newReq, ok := <-chForModbusRTU: // приём новых данных для запроса
-			if !ok {
-				lgr.E.Println("GoDriverModbusTCP. Закрыт канал чтения запросов.")
-				os.Exit(1)
+		case wr := <-chWrite: // запрос записи значения тэга
+			err := writeFuncMbTCPDo(con, wr.tag, wr.value)
+			if err != nil {
+				lgr.W.Printf("ошибка {%v} записи Modbus-TCP: устройство {%s}, тэг {%s}, значение {%s}", err, wr.tag.DeviceName, wr.tag.Comment, wr.value)
 			}
+			wr.chRes <- err
 
-			slRx := make([]database.StoreType, 0)
-
-			// Выполнение запросов согласно принятым данным
-			for _, v := range newReq {
-
-				// подготовка данных для запроса
-				slaveID, address, quantity, err := prepareDataClientModbusRTU(v)
-				if err != nil {
-					lgr.E.Printf("ошибка [%v] в преобразовании входных данных [%v]\n", err, v)
-					os.Exit(1)
-				}
+		case req, ok := <-chForModbusTCP: // приём новых данных для запроса
+			if !ok {
+				return errors.New("закрыт канал чтения запросов")
+			}
 
-				rx := database.StoreType{}
+			slRx := make([]database.StoreType, 0, len(req.tags))
 
-				// запрос
-				rxByte, err := selectFuncMbRTUDo(con, v.FuncType, slaveID, address, quantity)
-				if err != nil {
-					// повтор запроса из-за ошибки
-					rxByte, err = selectFuncMbRTUDo(con, v.FuncType, slaveID, address, quantity)
-					if err != nil {
-						lgr.W.Printf("ошибка {%v} повторного запроса Modbus-RTU: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d} ", err, slaveID, v.FuncType, address, quantity)
-						rx.Value = 0
-						rx.Qual = 0
-					}
-				}
-
-				if err == nil {
-					val, err := buildValFromByte(rxByte, v.DataType, v.Format)
-					if err != nil {
-						lgr.E.Println("ошибка в обработке принятых данных Modbus-RTU: ", err)
-						os.Exit(1)
-					}
-					rx.Value = val
-					rx.Qual = 1
-				}
-				rx.Dev = v.DeviceName
-				rx.Name = v.Comment
-				slRx = append(slRx, rx)
+			// Выполнение запросов по блокам чтения
+			for _, b := range req.blocks {
+				slRx = append(slRx, pollBlockTCP(lgr, con, req, b, last)...)
 			}
 
-			// передача сформированного слайса в канал
-			chForDB <- slRx
-
-		// ведение опроса слева
-		default:
-			time.Sleep(time.Microsecond * 1)
+			// передача сформированного слайса в канал (без ожидания при завершении работы)
+			select {
+			case chForDB <- slRx:
+			case <-ctx.Done():
+				return nil
+			}
 		}
 	}
+
 }
 
-// Go. Формирование очериди опроса для драйвера Modbus-TCP
+// Go. Супервизор подключения Modbus-TCP. Восстанавливает потерянное подключение.
 //
 // Параметры:
 //
-// ctx - контекст, для завершения работы
-// cnf - конфигурация, для формирования запросов
-// forModbusTCP - канал, для передачи запросов в драйвер Modbus-TCP
-// wg - учёт Go
-func goQueueForModbusTCP(ctx context.Context, cnf libre.ConfXLSX_Export, forModbusTCP chan<- []libre.ChConfExt_Export, wg *sync.WaitGroup) {
+// ctx - контекст для завершения работы
+// lgr - логер
+// con - коннект
+// wg - WaitGroup для отслеживания завершения Go рутины
+func goSuperviseModbusTCP(ctx context.Context, lgr loger.Log_Object, con modbustcpmaster.Connect, wg *sync.WaitGroup) {
 
 	wg.Add(1)
 
@@ -2057,119 +3523,327 @@ func goQueueForModbusTCP(ctx context.Context, cnf libre.ConfXLSX_Export, forModb
 		wg.Done()
 	}()
 
-	// Определение перечня разных временных меток опроса
-	//
-	listTimeScan := make(map[string]int)
-	listChByTimeScan := make(map[int][]libre.ChConf_Export)
-	listChByTimeScanExt := make(map[int][]libre.ChConfExt_Export)
+	con.Supervise(ctx, func(info modbustcpmaster.HealthInfoT) {
+		switch info.State {
+		case modbustcpmaster.StateConnected:
+			lgr.I.Printf("Modbus-TCP {%s} -> подключение восстановлено, переподключений: {%d}", con.Name, info.Reconnects)
+		default:
+			lgr.W.Printf("Modbus-TCP {%s} -> состояние {%s}, ошибка: {%s}", con.Name, info.State, info.LastErr)
+		}
+	})
+}
 
-	_ = listChByTimeScanExt // переменная используется, но выдаётся сообщение, что нет (сделано обращение)
+// Go. Опрос устройств по Modbus-RTU
+//
+// Параметры:
+//
+// ctx - контекст для завершения работы
+// lgr - логер
+// con - коннект
+// chForModbusRTU - канал приёма запросов на опрос
+// chForDB - канал передачи данных на архивирование в Go БД
+// chWrite - канал приёма запросов на запись
+//
+// Функция возвращает nil при завершении по контексту, иначе - причину сбоя.
+func goDriverModbusRTU(ctx context.Context, lgr loger.Log_Object, con modbusrtumaster.Connect, chForModbusRTU <-chan pollReqT, chForDB chan<- []database.StoreType, chWrite <-chan writeReqT) error {
 
-	// фиксация первой в списке записи временной метки опроса
-	t, err := strconv.Atoi(cnf.SheetChan[0].TimeScan)
-	if err != nil {
-		lgr.E.Println("ошибка 1 в преобразовании строки в число: ", cnf.SheetChan[0].TimeScan)
-		os.Exit(1)
+	if con.Client == nil {
+		return fmt.Errorf("отсутствует подключение по {%s}", con.Name)
 	}
 
-	listTimeScan[cnf.SheetChan[0].TimeScan] = t
+	// последние достоверные значения тэгов, архивируемые при недостоверном результате опроса
+	last := make(map[string]interface{})
 
-	// поиск временных меток отличных от списка
-	for _, v := range cnf.SheetChan {
+	// ожидание поступления новых данных в канал
+	//
+	for {
+		select {
 
-		if _, ok := listTimeScan[v.TimeScan]; !ok {
+		// Завершение работы по контексту
+		case <-ctx.Done():
+			return nil
 
-			t, err := strconv.Atoi(v.TimeScan)
+		case wr := <-chWrite: // запрос записи значения тэга
+			err := writeFuncMbRTUDo(con, wr.tag, wr.value)
 			if err != nil {
-				lgr.E.Println("ошибка 2 в преобразовании строки в число: ", v.TimeScan)
-				os.Exit(1)
+				lgr.W.Printf("ошибка {%v} записи Modbus-RTU: устройство {%s}, тэг {%s}, значение {%s}", err, wr.tag.DeviceName, wr.tag.Comment, wr.value)
+			}
+			wr.chRes <- err
+
+		case req, ok := <-chForModbusRTU: // приём новых данных для запроса
+			if !ok {
+				return errors.New("закрыт канал чтения запросов")
+			}
+
+			slRx := make([]database.StoreType, 0, len(req.tags))
+
+			// Выполнение запросов по блокам чтения
+			for _, b := range req.blocks {
+				slRx = append(slRx, pollBlockRTU(lgr, con, req, b, last)...)
+			}
+
+			// передача сформированного слайса в канал (без ожидания при завершении работы)
+			select {
+			case chForDB <- slRx:
+			case <-ctx.Done():
+				return nil
 			}
-			listTimeScan[v.TimeScan] = t
 		}
 	}
+}
 
-	// Запросы к БД. Получение спосков каналов с привязкой ко времени опроса
-	//
-	for k, v := range listTimeScan {
-
-		resp, err := rdChanByDevNameAndTimeScanDB("Dev1", v) //=========== измени привязку имени в аргументах (сейчас заглушка)
+// Опрос блока чтения Modbus-TCP. Исключение устройства на блок из нескольких тэгов может быть вызвано
+// пропуском между тэгами, поэтому тэги такого блока опрашиваются отдельными запросами.
+// Возвращаются результаты опроса тэгов блока.
+//
+// Параметры:
+//
+// lgr - логер
+// con - коннект
+// req - запрос опроса: тэги и их масштабирование
+// b - блок чтения
+// last - последние достоверные значения тэгов драйвера
+func pollBlockTCP(lgr loger.Log_Object, con modbustcpmaster.Connect, req pollReqT, b coalesce.BlockT, last map[string]interface{}) []database.StoreType {
+
+	var rxUint16 []uint16
+	var rxByte []byte
+	var dur time.Duration
+	var err error
+
+	noConn := !con.IsConnected()
+
+	if noConn {
+		// подключение восстанавливает супервизор, запрос не выполняется (состояние фиксирует супервизор)
+		err = fmt.Errorf("нет подключения {%s}", con.Name)
+	} else {
+		// запрос
+		tStart := time.Now()
+		rxUint16, rxByte, err = selectFuncMbTCPDo(con, b.Func, b.Slave, b.Address, b.Quantity)
 		if err != nil {
-			lgr.E.Println("работа Go рутины goQueueModbusTCP завершена из-за ошибки: ", err)
-			os.Exit(1)
+			con.MarkLost(err)
+			// повтор запроса из-за ошибки, если подключение не потеряно
+			if con.IsConnected() {
+				rxUint16, rxByte, err = selectFuncMbTCPDo(con, b.Func, b.Slave, b.Address, b.Quantity)
+				con.MarkLost(err)
+			}
 		}
+		dur = time.Since(tStart)
+	}
+	timeStamp := time.Now()
 
-		kInt, err := strconv.Atoi(k)
-		if err != nil {
-			lgr.E.Println("работа Go рутины goQueueModbusTCP завершена из-за ошибки преобразовании: ", err)
-			os.Exit(1)
+	qual := quality.Good
+
+	switch {
+	case noConn:
+		qual = quality.Stale
+
+	case err != nil:
+		qual = quality.Classify(err)
+
+		if len(b.Items) > 1 && quality.Class(qual) == quality.ClassException {
+			lgr.W.Printf("исключение {%v} на блок Modbus-TCP: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d}, тэги опрашиваются отдельно", err, b.Slave, b.Func, b.Address, b.Quantity)
+
+			slRx := make([]database.StoreType, 0, len(b.Items))
+			for _, bb := range b.Split() {
+				slRx = append(slRx, pollBlockTCP(lgr, con, req, bb, last)...)
+			}
+			return slRx
 		}
 
-		// добавление записи в мапу по ключу времени сканирования
-		listChByTimeScan[kInt] = resp
+		lgr.W.Printf("ошибка {%v} при запросе Modbus-TCP: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d}, качество {%#04x}", err, b.Slave, b.Func, b.Address, b.Quantity, qual)
 	}
 
-	// В полученных списках, замена имён устройств на их адреса
-	//
+	// Разделение ответа блока на значения тэгов
+	slRx := make([]database.StoreType, 0, len(b.Items))
 
-	// получение соответствий имен к их адресам
-	nameAddr := make(map[string]string)
+	for _, it := range b.Items {
 
-	for _, v := range cnf.SheetMain_Dev {
+		v := req.tags[it.Index]
+		rx := database.StoreType{
+			Dev:       v.DeviceName,
+			Name:      v.Comment,
+			Qual:      qual,
+			TimeStamp: timeStamp,
+		}
 
-		if _, ok := nameAddr[v.Device]; !ok {
-			nameAddr[v.Device] = v.Address
+		errTag := err
+		if err == nil {
+			switch v.FuncType {
+			case "ReadHoldingRegisters", "ReadInputRegisters":
+				var regs []uint16
+				regs, errTag = b.Registers(rxUint16, it)
+				if errTag == nil {
+					rx.Value, errTag = codec.Decode(codec.Bytes(regs), v.DataType, v.Format)
+				}
+			case "ReadDiscreteInputs", "ReadCoil":
+				var bits []byte
+				bits, errTag = b.Bytes(rxByte, it)
+				if errTag == nil {
+					rx.Value, errTag = codec.Decode(bits, v.DataType, v.Format)
+				}
+			default:
+				errTag = fmt.Errorf("ошибка распознавания функции {%s}", v.FuncType)
+			}
+			if errTag == nil {
+				rx.Value, errTag = req.scale[it.Index].Apply(rx.Value)
+			}
+			if errTag != nil {
+				rx.Qual = quality.BadDecode
+				lgr.W.Printf("ошибка {%v} в обработке принятых данных Modbus-TCP: устройство {%s}, тэг {%s}", errTag, v.DeviceName, v.Comment)
+			}
+		}
+
+		rx.Value = keepLastValue(last, rx)
+		diag.Add(v.DeviceName, rx.Qual, dur, errTag)
+		slRx = append(slRx, rx)
+	}
+
+	return slRx
+}
+
+// Опрос блока чтения Modbus-RTU. Исключение устройства на блок из нескольких тэгов может быть вызвано
+// пропуском между тэгами, поэтому тэги такого блока опрашиваются отдельными запросами.
+// Возвращаются результаты опроса тэгов блока.
+//
+// Параметры:
+//
+// lgr - логер
+// con - коннект
+// req - запрос опроса: тэги и их масштабирование
+// b - блок чтения
+// last - последние достоверные значения тэгов драйвера
+func pollBlockRTU(lgr loger.Log_Object, con modbusrtumaster.Connect, req pollReqT, b coalesce.BlockT, last map[string]interface{}) []database.StoreType {
+
+	// запрос
+	tStart := time.Now()
+	rxByte, err := selectFuncMbRTUDo(con, b.Func, b.Slave, b.Address, b.Quantity)
+	if err != nil {
+		// повтор запроса из-за ошибки
+		rxByte, err = selectFuncMbRTUDo(con, b.Func, b.Slave, b.Address, b.Quantity)
+	}
+	dur := time.Since(tStart)
+	timeStamp := time.Now()
+
+	qual := quality.Good
+
+	if err != nil {
+		qual = quality.Classify(err)
+
+		if len(b.Items) > 1 && quality.Class(qual) == quality.ClassException {
+			lgr.W.Printf("исключение {%v} на блок Modbus-RTU: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d}, тэги опрашиваются отдельно", err, b.Slave, b.Func, b.Address, b.Quantity)
+
+			slRx := make([]database.StoreType, 0, len(b.Items))
+			for _, bb := range b.Split() {
+				slRx = append(slRx, pollBlockRTU(lgr, con, req, bb, last)...)
+			}
+			return slRx
 		}
+
+		lgr.W.Printf("ошибка {%v} повторного запроса Modbus-RTU: слейв {%d}, функция {%s}, адрес регистра {%d}, количество регистров {%d}, качество {%#04x}", err, b.Slave, b.Func, b.Address, b.Quantity, qual)
 	}
 
-	// перенос данных полученных мап в расширенную
-	listChByTimeScanExt = moveToExt(listChByTimeScan)
+	// Разделение ответа блока на значения тэгов
+	slRx := make([]database.StoreType, 0, len(b.Items))
 
-	// замена в подготовленных списках имени устройста на его сетевой адрес
-	for k, v := range listChByTimeScanExt {
+	for _, it := range b.Items {
 
-		for kk, vv := range v {
+		v := req.tags[it.Index]
+		rx := database.StoreType{
+			Dev:       v.DeviceName,
+			Name:      v.Comment,
+			Qual:      qual,
+			TimeStamp: timeStamp,
+		}
 
-			listChByTimeScanExt[k][kk].DeviceAddr = nameAddr[vv.DeviceName]
+		errTag := err
+		if err == nil {
+			var data []byte
+			data, errTag = b.Bytes(rxByte, it)
+			if errTag == nil {
+				rx.Value, errTag = codec.Decode(data, v.DataType, codec.RTUFormat(v.Format))
+			}
+			if errTag == nil {
+				rx.Value, errTag = req.scale[it.Index].Apply(rx.Value)
+			}
+			if errTag != nil {
+				rx.Qual = quality.BadDecode
+				lgr.W.Printf("ошибка {%v} в обработке принятых данных Modbus-RTU: устройство {%s}, тэг {%s}", errTag, v.DeviceName, v.Comment)
+			}
 		}
+
+		rx.Value = keepLastValue(last, rx)
+		diag.Add(v.DeviceName, rx.Qual, dur, errTag)
+		slRx = append(slRx, rx)
 	}
 
-	// Создание таймер-тиков, для формирования тиков передачи данных в канал
-	//
+	return slRx
+}
+
+// Значение тэга для архивирования. При хорошем качестве значение запоминается, иначе возвращается
+// последнее достоверное значение тэга (0, если его не было). Возвращается значение.
+//
+// Параметры:
+//
+// last - последние достоверные значения тэгов драйвера
+// rx - результат опроса тэга
+func keepLastValue(last map[string]interface{}, rx database.StoreType) interface{} {
 
-	// подготовка слайса для создания таймер-тикеров
-	slTime := make([]int, 0)
+	key := rx.Dev + "/" + rx.Name
 
-	for _, v := range listTimeScan {
-		slTime = append(slTime, v)
+	if quality.IsGood(rx.Qual) {
+		last[key] = rx.Value
+		return rx.Value
 	}
 
-	// Создание таймер-тикеров
-	slTicker := createTickers(slTime)
+	if val, ok := last[key]; ok {
+		return val
+	}
+	return 0
+}
 
-	// Запуск Go рутин для каждого таймер-тика
-	for i, ticker := range slTicker {
+// Go. Формирование очериди опроса для драйвера Modbus-TCP
+//
+// Параметры:
+//
+// ctx - контекст, для завершения работы
+// name - имя очереди вида "Queue:Host@IP/Port:TCP"
+// cnf - конфигурация, для формирования запросов
+// poll - настройки опроса
+// forModbusTCP - канал, для передачи запросов в драйвер Modbus-TCP
+//
+// Функция возвращает nil при завершении по контексту, иначе - причину сбоя.
+func goQueueForModbusTCP(ctx context.Context, name string, cnf libre.ConfXLSX_Export, poll pollConfT, forModbusTCP chan<- pollReqT) error {
 
-		wg.Add(1)
+	// Определение наименований устройств, по коннекту к удалённому IP/порту
+	//
+	// выделение имени коннекта
+	n := strings.Split(name, ":")
+	if len(n) != 3 {
+		return fmt.Errorf("нет соответствия в длинне имени: {%s}", name)
+	}
+	if n[1] == "" {
+		return fmt.Errorf("имя коннекта пустое: {%s}", name)
+	}
+	con := n[1]
 
-		go func(ctx context.Context, wg *sync.WaitGroup, t *time.Ticker, data []libre.ChConfExt_Export) {
+	// определение наименований устройств сконфигурированных на этот коннект
+	listDev := make([]string, 0)
+	for _, v := range cnf.SheetMain_Dev {
+		if con == nameConTCP(v.Host, v.IP, v.Port) {
+			listDev = append(listDev, v.Device)
+		}
+	}
 
-			for {
-				select {
-				case <-t.C:
-					forModbusTCP <- data // передача данных в канал
-				case <-ctx.Done():
-					wg.Done()
-					return
-				default:
-					time.Sleep(time.Microsecond * 1)
-				}
-			}
-		}(ctx, wg, ticker, listChByTimeScanExt[slTime[i]])
+	// Списки каналов устройств с привязкой ко времени опроса
+	listChByTimeScanExt, err := buildScanLists(cnf, listDev)
+	if err != nil {
+		return err
 	}
 
-	// генерация запущена
-	// данные передаются в драйвер Modbus-TCP
+	// Опрос по группам времени опроса до завершения работы
+	runPollWheel(ctx, name, listChByTimeScanExt, poll, prepareDataClientModbusTCP, forModbusTCP)
 
+	return nil
 }
 
 // Go. Формирование очериди опроса для драйвера Modbus-RTU
@@ -2177,28 +3851,23 @@ func goQueueForModbusTCP(ctx context.Context, cnf libre.ConfXLSX_Export, forModb
 // Параметры:
 //
 // ctx - контекст, для завершения работы
+// name - имя очереди вида "Queue:Host:COM"
 // cnf - конфигурация, для формирования запросов
+// poll - настройки опроса
 // forModbusRTU - канал, для передачи запросов в драйвер Modbus-RTU
-// wg - учёт Go
-func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Export, forModbusRTU chan []libre.ChConfExt_Export, wg *sync.WaitGroup) {
-
-	wg.Add(1)
-
-	defer func() {
-		wg.Done()
-	}()
+//
+// Функция возвращает nil при завершении по контексту, иначе - причину сбоя.
+func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Export, poll pollConfT, forModbusRTU chan<- pollReqT) error {
 
 	// Определение наименований устройств, по типу коннекта
 	//
 	// выделение имени хост коннекта
 	n := strings.Split(name, ":")
 	if len(n) != 3 {
-		lgr.E.Println("ошибка при запуске goQueueForModbusRTU -> нет соответствия в длинне имени:", name)
-		return
+		return fmt.Errorf("нет соответствия в длинне имени: {%s}", name)
 	}
 	if n[1] == "" {
-		lgr.E.Println("ошибка при запуске goQueueForModbusRTU -> имя коннекта пустое:", name)
-		return
+		return fmt.Errorf("имя коннекта пустое: {%s}", name)
 	}
 	hostCon := n[1]
 
@@ -2210,19 +3879,36 @@ func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Ex
 		}
 	}
 
+	// Списки каналов устройств с привязкой ко времени опроса
+	listChByTimeScanExt, err := buildScanLists(cnf, listDev)
+	if err != nil {
+		return err
+	}
+
+	// Опрос по группам времени опроса до завершения работы
+	runPollWheel(ctx, name, listChByTimeScanExt, poll, prepareDataClientModbusRTU, forModbusRTU)
+
+	return nil
+}
+
+// Формирование списков каналов устройств по времени опроса, с сетевыми адресами устройств.
+// Возвращаются списки по времени опроса и ошибка.
+//
+// Параметры:
+//
+// cnf - конфигурация
+// listDev - наименования опрашиваемых устройств
+func buildScanLists(cnf libre.ConfXLSX_Export, listDev []string) (map[int][]libre.ChConfExt_Export, error) {
+
 	// Определение перечня разных временных меток опроса
 	//
 	listTimeScan := make(map[string]int)
 	listChByTimeScan := make(map[int][]libre.ChConf_Export)
-	listChByTimeScanExt := make(map[int][]libre.ChConfExt_Export)
-
-	_ = listChByTimeScanExt // переменная используется, но выдаётся сообщение, что нет (сделано дополнительное обращение)
 
 	// фиксация первой в списке записи временной метки опроса
 	t, err := strconv.Atoi(cnf.SheetChan[0].TimeScan)
 	if err != nil {
-		lgr.E.Println("ошибка 1 в преобразовании строки в число: ", cnf.SheetChan[0].TimeScan)
-		os.Exit(1)
+		return nil, fmt.Errorf("ошибка 1 в преобразовании строки в число: {%s}", cnf.SheetChan[0].TimeScan)
 	}
 
 	listTimeScan[cnf.SheetChan[0].TimeScan] = t
@@ -2234,8 +3920,7 @@ func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Ex
 
 			t, err := strconv.Atoi(v.TimeScan)
 			if err != nil {
-				lgr.E.Println("ошибка 2 в преобразовании строки в число: ", v.TimeScan)
-				os.Exit(1)
+				return nil, fmt.Errorf("ошибка 2 в преобразовании строки в число: {%s}", v.TimeScan)
 			}
 			listTimeScan[v.TimeScan] = t
 		}
@@ -2245,22 +3930,15 @@ func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Ex
 	// Учитываются все устройства настроенные на данный коннект
 	for _, nameD := range listDev {
 
-		for k, v := range listTimeScan {
+		for _, v := range listTimeScan {
 
 			resp, err := rdChanByDevNameAndTimeScanDB(nameD, v)
 			if err != nil {
-				lgr.E.Println("работа Go рутины goQueueModbusTCP завершена из-за ошибки в запросе к БД: ", err)
-				os.Exit(1)
-			}
-
-			kInt, err := strconv.Atoi(k)
-			if err != nil {
-				lgr.E.Println("работа Go рутины goQueueModbusTCP завершена из-за ошибки преобразовании: ", err)
-				os.Exit(1)
+				return nil, fmt.Errorf("ошибка запроса каналов из БД: {%v}", err)
 			}
 
 			// добавление записи в мапу по ключу времени сканирования
-			listChByTimeScan[kInt] = append(listChByTimeScan[kInt], resp...)
+			listChByTimeScan[v] = append(listChByTimeScan[v], resp...)
 		}
 	}
 
@@ -2278,7 +3956,7 @@ func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Ex
 	}
 
 	// перенос данных полученных мап в расширенную
-	listChByTimeScanExt = moveToExt(listChByTimeScan)
+	listChByTimeScanExt := moveToExt(listChByTimeScan)
 
 	// замена в подготовленных списках имени устройста на его сетевой адрес
 	for k, v := range listChByTimeScanExt {
@@ -2289,61 +3967,120 @@ func goQueueForModbusRTU(ctx context.Context, name string, cnf libre.ConfXLSX_Ex
 		}
 	}
 
-	// Создание таймер-тиков, для формирования тиков передачи данных в канал
-	//
-
-	// подготовка слайса для создания таймер-тикеров
-	slTime := make([]int, 0)
+	return listChByTimeScanExt, nil
+}
 
-	for _, v := range listTimeScan {
-		slTime = append(slTime, v)
-	}
+// Формирование запроса опроса: тэги группы времени опроса объединяются в блоки чтения смежных регистров
+// устройства, для тэгов разбираются настройки масштабирования. Тэги с ошибкой конфигурации не опрашиваются.
+// Возвращается запрос.
+//
+// Параметры:
+//
+// tags - тэги группы времени опроса
+// poll - настройки объединения тэгов в блоки чтения
+// prepare - подготовка данных запроса тэга для клиента Modbus
+func buildPollReq(tags []libre.ChConfExt_Export, poll coalesce.ConfT, prepare func(libre.ChConfExt_Export) (byte, uint16, uint16, error)) pollReqT {
 
-	// Создание таймер-тикеров
-	slTicker := createTickers(slTime)
+	items := make([]coalesce.ItemT, 0, len(tags))
+	scale := make([]scaling.ConfT, len(tags))
 
-	// Запуск Go рутин для каждого таймер-тика
-	for i, ticker := range slTicker {
+	for i, v := range tags {
 
-		wg.Add(1)
+		// настройки масштабирования (проверены при импорте конфигурации)
+		conf, err := scaling.ParseConf(v.RawMin, v.RawMax, v.EngMin, v.EngMax, v.Gain, v.Offset, v.Clamp, v.Unit)
+		if err != nil {
+			lgr.E.Printf("ошибка {%v} в настройках масштабирования {%v}, тэг не опрашивается", err, v)
+			continue
+		}
+		scale[i] = conf
 
-		go func(ctx context.Context, wg *sync.WaitGroup, t *time.Ticker, data []libre.ChConfExt_Export) {
+		// подготовка данных для запроса
+		slaveID, address, quantity, err := prepare(v)
+		if err != nil {
+			lgr.E.Printf("ошибка {%v} в преобразовании входных данных {%v}, тэг не опрашивается", err, v)
+			continue
+		}
 
-			for {
-				select {
-				case <-t.C:
-					forModbusRTU <- data // передача данных в канал
-				case <-ctx.Done():
-					wg.Done()
-					return
-				default:
-					time.Sleep(time.Microsecond * 1)
-				}
-			}
-		}(ctx, wg, ticker, listChByTimeScanExt[slTime[i]])
+		items = append(items, coalesce.ItemT{
+			Index:    i,
+			Slave:    slaveID,
+			Func:     v.FuncType,
+			Address:  address,
+			Quantity: quantity,
+		})
 	}
 
-	// генерация запущена
-	// данные передаются в драйвер Modbus-TCP
-
+	return pollReqT{
+		tags:   tags,
+		scale:  scale,
+		blocks: coalesce.Build(items, poll),
+	}
 }
 
-// Создание таймер-тикеров. Для передачи данных в драйвер. Возвращается массив таймер-тикеров.
+// Опрос групп времени опроса коннекта по планировщику до завершения контекста. Запрос передаётся
+// драйверу, только если драйвер принял его до срока следующего цикла группы, иначе цикл пропускается.
 //
 // Параметры:
 //
-// intervals - массив интервалов, под которые создаются тамер-тики
-func createTickers(intervals []int) []*time.Ticker {
+// ctx - контекст, для завершения работы
+// name - имя очереди
+// lists - списки тэгов по времени опроса, мс
+// poll - настройки опроса
+// prepare - подготовка данных запроса тэга для клиента Modbus
+// out - канал, для передачи запросов в драйвер
+func runPollWheel(ctx context.Context, name string, lists map[int][]libre.ChConfExt_Export, poll pollConfT, prepare func(libre.ChConfExt_Export) (byte, uint16, uint16, error), out chan<- pollReqT) {
+
+	// группы по возрастанию времени опроса, смещение фазы разносит их запуск
+	slTime := make([]int, 0, len(lists))
+	for v := range lists {
+		slTime = append(slTime, v)
+	}
+	slices.Sort(slTime)
+
+	groups := make([]scheduler.GroupT, 0, len(slTime))
+	reqs := make([]pollReqT, 0, len(slTime))
 
-	// Создание слайса тикеров
-	tickers := make([]*time.Ticker, len(intervals))
+	for i, v := range slTime {
 
-	// Инициализация для каждого интервала
-	for i, interval := range intervals {
-		tickers[i] = time.NewTicker(time.Duration(interval) * time.Millisecond)
+		offset := time.Duration(i) * poll.phaseStep
+		if poll.jitter > 0 {
+			offset += rand.N(poll.jitter)
+		}
+
+		groups = append(groups, scheduler.GroupT{
+			Period: time.Duration(v) * time.Millisecond,
+			Offset: offset,
+		})
+		reqs = append(reqs, buildPollReq(lists[v], poll.blocks, prepare))
 	}
 
-	return tickers
+	wheel := scheduler.New(name, groups, logPollOverrun)
+	pollSched.Put(wheel)
+
+	wheel.Run(ctx, func(i int, deadline time.Time) bool {
+
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+
+		// передача данных в канал (драйвер может быть занят предыдущим циклом или перезапускаться)
+		select {
+		case out <- reqs[i]:
+			return true
+		case <-t.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// Журналирование перегрузки опроса.
+//
+// Параметры:
+//
+// info - состояние группы опроса
+func logPollOverrun(info scheduler.InfoT) {
+	lgr.W.Printf("очередь {%s} -> опрос с периодом {%d} мс не успевает, пропущено циклов: {%d}, перегрузок: {%d}", info.Name, info.PeriodMs, info.Skipped, info.Overruns)
 }
 
 // Подготовка данных для клиента Modbus-TCP. Возвращается адрес слева, адрес регистра, количество регистров и ошибка.
@@ -2368,17 +4105,9 @@ func prepareDataClientModbusTCP(srcData libre.ChConfExt_Export) (slaveID byte, a
 	address = uint16(local_address)
 
 	// формирование количества регистров на опрос
-	numbReg := 0
-
-	switch srcData.DataType {
-	case "Word", "ShortInt", "Bool":
-		numbReg = 1
-	case "Integer", "DWord", "Float":
-		numbReg = 2
-	case "Int64", "Double":
-		numbReg = 4
-	default:
-		return 0, 0, 0, fmt.Errorf("ошибка формирования количества регистров по входным данным: %v", srcData.DataType)
+	numbReg, err := codec.Regs(srcData.DataType)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("ошибка формирования количества регистров по входным данным: %v", err)
 	}
 
 	quantity = uint16(numbReg)
@@ -2411,17 +4140,9 @@ func prepareDataClientModbusRTU(srcData libre.ChConfExt_Export) (slaveID byte, a
 	address = uint16(local_address)
 
 	// формирование количества регистров на опрос
-	numbReg := 0
-
-	switch srcData.DataType {
-	case "Word", "ShortInt", "Bool":
-		numbReg = 1
-	case "Integer", "DWord", "Float":
-		numbReg = 2
-	case "Int64", "Double":
-		numbReg = 4
-	default:
-		return 0, 0, 0, fmt.Errorf("ошибка формирования количества регистров по входным данным: %v", srcData.DataType)
+	numbReg, err := codec.Regs(srcData.DataType)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("ошибка формирования количества регистров по входным данным: %v", err)
 	}
 
 	quantity = uint16(numbReg)
@@ -2457,6 +4178,19 @@ func moveToExt(srcMap map[int][]libre.ChConf_Export) (targMap map[int][]libre.Ch
 			el.TimeScan = vv.TimeScan
 			el.FuncType = vv.FuncType
 			el.Format = vv.Format
+			el.Deadband = vv.Deadband
+			el.DeadbandPct = vv.DeadbandPct
+			el.MinArchive = vv.MinArchive
+			el.MaxArchive = vv.MaxArchive
+			el.OnChange = vv.OnChange
+			el.RawMin = vv.RawMin
+			el.RawMax = vv.RawMax
+			el.EngMin = vv.EngMin
+			el.EngMax = vv.EngMax
+			el.Gain = vv.Gain
+			el.Offset = vv.Offset
+			el.Clamp = vv.Clamp
+			el.Unit = vv.Unit
 
 			sl = append(sl, el)
 
@@ -2508,13 +4242,6 @@ func selectFuncMbTCPDo(con modbustcpmaster.Connect, function string, slaveID byt
 		}
 		return []uint16{}, resByte, nil
 
-	case "WriteSingleRegister":
-		err = con.Client.WriteSingleRegister(slaveID, address, quantity)
-		if err != nil {
-			return []uint16{}, []byte{}, err
-		}
-		return []uint16{}, []byte{}, nil
-
 	default:
 		return []uint16{}, []byte{}, fmt.Errorf("ошибка при выборе функции Modbus: %v ", function)
 	}
@@ -2565,351 +4292,210 @@ func selectFuncMbRTUDo(con modbusrtumaster.Connect, function string, slaveID byt
 		}
 		return resByte, nil
 
-	case "WriteSingleRegister":
-		resByte, err := con.Client.WriteSingleRegister(address, 111)
-		if err != nil {
-			return []byte{}, err
-		}
-		return resByte, nil
-
 	default:
 		return []byte{}, fmt.Errorf("ошибка при выборе функции Modbus: %v ", function)
 	}
 }
 
-// Приведение принятых данных к типу. Функция возвращает значение интерфесом и ошибку.
+// Выполнение записи значения тэга по Modbus-TCP. Возвращается ошибка.
 //
 // Параметры:
 //
-// srcData - исходные данные.
-// dataType - запрашиваемый тип данных.
-// format - формат данных (чередование байт).
-func buildValFromUint16(srcData []uint16, dataType string, format string) (value interface{}, err error) {
+// con - соединение хоста.
+// tag - тэг записи.
+// value - значение в виде строки.
+func writeFuncMbTCPDo(con modbustcpmaster.Connect, tag libre.ChConfExt_Export, value string) (err error) {
 
-	if len(srcData) == 0 || dataType == "" || format == "" {
-		return nil, fmt.Errorf("ошибка в содержимом аргументов функции преобразования типа: [%v] [%v] [%v]", srcData, dataType, format)
+	if !con.IsConnected() {
+		return fmt.Errorf("нет подключения {%s}", con.Name)
 	}
 
-	// Формирование слайса байт из принятого слайса uint16
-	slByte := make([]byte, 0)
-
-	for _, v := range srcData {
-		slByte = append(slByte, byte(v))
-		slByte = append(slByte, byte(v>>8))
+	slaveID, address, quantity, err := prepareDataClientModbusTCP(tag)
+	if err != nil {
+		return err
 	}
 
-	// Формирование слайса из принятого формата (чередования байт)
-	strNumb := strings.Split(format, "_")
+	defer func() {
+		con.MarkLost(err)
+	}()
+
+	switch tag.FuncType {
+	case "WriteSingleRegister":
+		b, err := codec.Encode(value, tag.DataType, tag.Format)
+		if err != nil {
+			return err
+		}
+		return con.Client.WriteSingleRegister(slaveID, address, codec.Registers(b)[0])
 
-	intNumb := make(map[int]int)
+	case "WriteMultipleRegisters":
+		b, err := codec.Encode(value, tag.DataType, tag.Format)
+		if err != nil {
+			return err
+		}
+		return con.Client.WriteMultipleRegisters(slaveID, address, quantity, codec.Registers(b))
 
-	for i, v := range strNumb {
-		_ = i
-		vv, err := strconv.Atoi(v)
-		if err != nil {
-			return 0, fmt.Errorf("ошибка при преобразовании символа [%v] в число", v)
-		}
-		intNumb[i] = vv
-	}
-
-	// Формирование значения нужного типа по указанной очерёдности байт
-	switch dataType {
+	case "WriteSingleCoil":
+		b, err := codec.Encode(value, "Bool", "")
+		if err != nil {
+			return err
+		}
+		return con.Client.WriteSingleCoil(slaveID, address, b[0] == 1)
 
-	case "Word":
-		var val uint16 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= uint16(slByte[i]) << 8
-			case 1:
-				val |= uint16(slByte[i])
-			}
-		}
-		return val, nil
-
-	case "ShortInt":
-		var val int16 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= int16(slByte[i]) << 8
-			case 1:
-				val |= int16(slByte[i])
-			}
-		}
-		return val, nil
-
-	case "Integer":
-		var valBuf uint32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint32(slByte[i]) << 8
-			case 1:
-				valBuf |= uint32(slByte[i])
-			case 2:
-				valBuf |= uint32(slByte[i]) << 24
-			case 3:
-				valBuf |= uint32(slByte[i]) << 16
-			}
-		}
-		return int32(valBuf), nil
-
-	case "DWord":
-		var val uint32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= uint32(slByte[i]) << 8
-			case 1:
-				val |= uint32(slByte[i])
-			case 2:
-				val |= uint32(slByte[i]) << 24
-			case 3:
-				val |= uint32(slByte[i]) << 16
-			}
-		}
-		return val, nil
-
-	case "Float":
-		var valBuf uint32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint32(slByte[i]) << 8
-			case 1:
-				valBuf |= uint32(slByte[i])
-			case 2:
-				valBuf |= uint32(slByte[i]) << 24
-			case 3:
-				valBuf |= uint32(slByte[i]) << 16
-			}
-		}
-		floatValue := math.Float32frombits(valBuf)
-		return floatValue, nil
-
-	case "Int64":
-		var valBuf uint64 = 0
-
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint64(slByte[i]) << 8
-			case 1:
-				valBuf |= uint64(slByte[i])
-			case 2:
-				valBuf |= uint64(slByte[i]) << 24
-			case 3:
-				valBuf |= uint64(slByte[i]) << 16
-			case 4:
-				valBuf |= uint64(slByte[i]) << 40
-			case 5:
-				valBuf |= uint64(slByte[i]) << 32
-			case 6:
-				valBuf |= uint64(slByte[i]) << 56
-			case 7:
-				valBuf |= uint64(slByte[i]) << 48
-			}
-		}
-		return int64(valBuf), nil
-
-	case "Double":
-		var valBuf uint64 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint64(slByte[i]) << 8
-			case 1:
-				valBuf |= uint64(slByte[i])
-			case 2:
-				valBuf |= uint64(slByte[i]) << 24
-			case 3:
-				valBuf |= uint64(slByte[i]) << 16
-			case 4:
-				valBuf |= uint64(slByte[i]) << 40
-			case 5:
-				valBuf |= uint64(slByte[i]) << 32
-			case 6:
-				valBuf |= uint64(slByte[i]) << 56
-			case 7:
-				valBuf |= uint64(slByte[i]) << 48
-			}
-		}
-		floatValue := math.Float64frombits(valBuf)
-		return floatValue, nil
+	case "WriteMultipleCoils":
+		b, err := codec.Encode(value, "Bool", "")
+		if err != nil {
+			return err
+		}
+		return con.Client.WriteMultipleCoils(slaveID, address, 1, b)
 
 	default:
-		return nil, fmt.Errorf("неподдерживаемый тип данных: %s", dataType)
+		return fmt.Errorf("ошибка при выборе функции записи Modbus: %v ", tag.FuncType)
 	}
 }
 
-// Приведение принятых данных к типу. Функция возвращает значение интерфесом и ошибку.
+// Выполнение записи значения тэга по Modbus-RTU. Возвращается ошибка.
 //
 // Параметры:
 //
-// srcData - исходные данные.
-// dataType - запрашиваемый тип данных.
-// format - формат данных (чередование байт).
-func buildValFromByte(srcData []byte, dataType string, format string) (value interface{}, err error) {
+// con - соединение хоста.
+// tag - тэг записи.
+// value - значение в виде строки.
+func writeFuncMbRTUDo(con modbusrtumaster.Connect, tag libre.ChConfExt_Export, value string) error {
 
-	if len(srcData) == 0 || dataType == "" || format == "" {
-		return nil, fmt.Errorf("ошибка в содержимом аргументов функции преобразования типа: [%v] [%v] [%v]", srcData, dataType, format)
+	slaveID, address, quantity, err := prepareDataClientModbusRTU(tag)
+	if err != nil {
+		return err
 	}
 
-	slByte := srcData
+	// установка адреса ведомого устройства
+	con.ChangeSlaveID(slaveID)
+
+	switch tag.FuncType {
+	case "WriteSingleRegister":
+		b, err := codec.Encode(value, tag.DataType, codec.RTUFormat(tag.Format))
+		if err != nil {
+			return err
+		}
+		_, err = con.Client.WriteSingleRegister(address, uint16(b[0])<<8|uint16(b[1]))
+		return err
 
-	// Формирование слайса из принятого формата (чередования байт)
-	strNumb := strings.Split(format, "_")
+	case "WriteMultipleRegisters":
+		b, err := codec.Encode(value, tag.DataType, codec.RTUFormat(tag.Format))
+		if err != nil {
+			return err
+		}
+		_, err = con.Client.WriteMultipleRegisters(address, quantity, b)
+		return err
 
-	intNumb := make(map[int]int)
+	case "WriteSingleCoil":
+		b, err := codec.Encode(value, "Bool", "")
+		if err != nil {
+			return err
+		}
+		var v uint16 = 0x0000
+		if b[0] == 1 {
+			v = 0xFF00
+		}
+		_, err = con.Client.WriteSingleCoil(address, v)
+		return err
 
-	for i, v := range strNumb {
-		_ = i
-		vv, err := strconv.Atoi(v)
+	case "WriteMultipleCoils":
+		b, err := codec.Encode(value, "Bool", "")
 		if err != nil {
-			return 0, fmt.Errorf("ошибка при преобразовании символа [%v] в число", v)
+			return err
 		}
-		intNumb[i] = vv
+		_, err = con.Client.WriteMultipleCoils(address, 1, b)
+		return err
+
+	default:
+		return fmt.Errorf("ошибка при выборе функции записи Modbus: %v ", tag.FuncType)
 	}
+}
 
-	// Формирование значения нужного типа по указанной очерёдности байт
-	switch dataType {
+// Передача запроса записи значения тэга в драйвер устройства и ожидание результата. Возвращается ошибка.
+//
+// Параметры:
+//
+// dev - имя устройства
+// tag - имя тэга
+// value - значение в виде строки
+func writeTag(dev, tag, value string) error {
 
-	case "Word":
-		var val uint16 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= uint16(slByte[i]) << 8
-			case 1:
-				val |= uint16(slByte[i])
-			}
-		}
-		return val, nil
+	t, ok := wrRoute.tags[dev][tag]
+	if !ok {
+		return fmt.Errorf("%w: у устройства {%s} нет тэга записи {%s}", serverAPI.ErrWriteReq, dev, tag)
+	}
 
-	case "ShortInt":
+	// Проверка значения до передачи в драйвер
+	_, err := codec.Encode(value, t.DataType, t.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", serverAPI.ErrWriteReq, err)
+	}
 
-		var val int16 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= int16(slByte[i]) << 8
-			case 1:
-				val |= int16(slByte[i])
-			}
-		}
-
-		return val, nil
-
-	case "Integer":
-		var valBuf int32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= int32(slByte[i]) << 24
-			case 1:
-				valBuf |= int32(slByte[i]) << 16
-			case 2:
-				valBuf |= int32(slByte[i]) << 8
-			case 3:
-				valBuf |= int32(slByte[i])
-			}
-		}
+	ch, ok := wrRoute.chDev[dev]
+	if !ok {
+		return fmt.Errorf("%w: нет драйвера для устройства {%s}", serverAPI.ErrWriteReq, dev)
+	}
 
-		return valBuf, nil
+	req := writeReqT{
+		tag:   t,
+		value: value,
+		chRes: make(chan error, 1),
+	}
 
-	case "DWord":
-		var val uint32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				val |= uint32(slByte[i]) << 24
-			case 1:
-				val |= uint32(slByte[i]) << 16
-			case 2:
-				val |= uint32(slByte[i]) << 8
-			case 3:
-				val |= uint32(slByte[i])
-			}
-		}
-		return val, nil
+	// Передача в драйвер
+	select {
+	case ch <- req:
+	case <-time.After(writeTimeout):
+		return fmt.Errorf("драйвер устройства {%s} не принял запрос записи", dev)
+	}
 
-	case "Float":
-		var valBuf uint32 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint32(slByte[i]) << 24
-			case 1:
-				valBuf |= uint32(slByte[i]) << 16
-			case 2:
-				valBuf |= uint32(slByte[i]) << 8
-			case 3:
-				valBuf |= uint32(slByte[i])
-			}
-		}
-
-		floatValue := math.Float32frombits(valBuf)
-		return floatValue, nil
+	// Ожидание результата
+	select {
+	case err := <-req.chRes:
+		return err
+	case <-time.After(writeTimeout):
+		return fmt.Errorf("драйвер устройства {%s} не выполнил запись", dev)
+	}
+}
+
+// Go рутина создания печатей архива за прошедшие даты. Сутки запечатываются не ранее запаса sealGrace
+// (с интервалом записи и ожиданием записи в БД) после полуночи.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+// key - закрытый ключ устройства
+func goSealArchive(ctx context.Context, key ed25519.PrivateKey) error {
 
-	case "Int64":
-		var valBuf int64 = 0
+	// Строки конца суток могут ещё находиться в каналах и пачке записи после полуночи
+	_, flushEvery, _ := readBatchConf()
+	grace := sealGrace + flushEvery + dbWriteTimeout
 
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= int64(slByte[i]) << 56
-			case 1:
-				valBuf |= int64(slByte[i]) << 48
-			case 2:
-				valBuf |= int64(slByte[i]) << 40
-			case 3:
-				valBuf |= int64(slByte[i]) << 32
-			case 4:
-				valBuf |= int64(slByte[i]) << 24
-			case 5:
-				valBuf |= int64(slByte[i]) << 16
-			case 6:
-				valBuf |= int64(slByte[i]) << 8
-			case 7:
-				valBuf |= int64(slByte[i])
-			}
-		}
-		return valBuf, nil
-
-	case "Double":
-		var valBuf uint64 = 0
-		for i, v := range intNumb {
-			switch v {
-			case 0:
-				valBuf |= uint64(slByte[i]) << 56
-			case 1:
-				valBuf |= uint64(slByte[i]) << 48
-			case 2:
-				valBuf |= uint64(slByte[i]) << 40
-			case 3:
-				valBuf |= uint64(slByte[i]) << 32
-			case 4:
-				valBuf |= uint64(slByte[i]) << 24
-			case 5:
-				valBuf |= uint64(slByte[i]) << 16
-			case 6:
-				valBuf |= uint64(slByte[i]) << 8
-			case 7:
-				valBuf |= uint64(slByte[i])
-			}
-		}
-		floatValue := math.Float64frombits(valBuf)
-		return floatValue, nil
-
-	case "Bool":
-		var valBuf byte
-		valBuf = slByte[0]
-
-		return valBuf, nil
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
 
-	default:
-		return nil, fmt.Errorf("неподдерживаемый тип данных: %s", dataType)
+	for {
+		// Пока буфер не воспроизведён, в БД могут отсутствовать строки прошедших дат
+		if dbBuf != nil && dbBuf.Len() > 0 {
+			lgr.W.Println("goSealArchive. печати архива отложены до воспроизведения буфера")
+		} else {
+			dates, err := seal.SealPendingDB(db.Ptr, key, grace)
+			if err != nil {
+				lgr.E.Printf("goSealArchive. ошибка создания печати архива: {%v}", err)
+			}
+			for _, d := range dates {
+				lgr.I.Printf("goSealArchive. создана печать архива на {%s}", d)
+			}
+		}
+
+		select {
+		// Завершение работы Go рутины
+		case <-ctx.Done():
+			return nil
+		// Очередная проверка
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -2936,6 +4522,12 @@ func httpServer() {
 		srvInfo.Lgr = lgr
 		srvInfo.MbRTU = collectData.MbRTU
 		srvInfo.MbTCP = collectData.MbTCP
+		srvInfo.Workers = collectData.Workers
+		srvInfo.Poll = collectData.Poll
+		srvInfo.Buffer = collectData.Buffer
+		srvInfo.Writer = collectData.Writer
+		srvInfo.Heartbeat = collectData.Heartbeat
+		srvInfo.Gateway = collectData.Gateway
 		srvInfo.HandlHttpStatusSrv(w, r)
 	})
 
@@ -2955,6 +4547,22 @@ func httpServer() {
 		partData.HandlHttpPartDataDB(w, r)
 	})
 
+	r.Get("/seal", func(w http.ResponseWriter, r *http.Request) {
+		// запрос печати архива по дате
+		var sealDate serverAPI.SealByDateT
+		sealDate.DB = db.Ptr
+		sealDate.Lgr = lgr
+		sealDate.HandlHttpSeal(w, r)
+	})
+
+	r.Get("/diagnostics", func(w http.ResponseWriter, r *http.Request) {
+		// диагностика обмена с устройствами
+		var diagInfo serverAPI.DiagnosticsT
+		diagInfo.Lgr = lgr
+		diagInfo.Snapshot = diag.Snapshot
+		diagInfo.HandlHttpDiagnostics(w, r)
+	})
+
 	// Запуск HTTP сервера
 	err := http.ListenAndServe(os.Getenv("HTTP_SERVER_IP")+":"+os.Getenv("HTTP_SERVER_PORT"), r)
 	if err != nil {
@@ -2963,15 +4571,49 @@ func httpServer() {
 	}
 }
 
-// HTTPS сервер (для внешних клиентов)
-func goHttpsServer() {
+// HTTPS сервер (для внешних клиентов). Работает под надзором до завершения контекста.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+func goHttpsServer(ctx context.Context) error {
 
 	fmt.Println("Запуск HTTPS сервера.")
 
+	// Время жизни сессий пользователей
+	ttl, err := session.ParseTTL(os.Getenv("SESSION_TTL_MIN"))
+	if err != nil {
+		return fmt.Errorf("ошибка запуска HTTPS сервера: {%v}", err)
+	}
+
+	// Защита входа от подбора пароля
+	guard, err := security.ParseConf(
+		os.Getenv("LOGIN_MAX_FAILURES_USER"),
+		os.Getenv("LOGIN_MAX_FAILURES_IP"),
+		os.Getenv("LOGIN_WINDOW_MIN"),
+		os.Getenv("LOGIN_LOCK_MIN"),
+		os.Getenv("LOGIN_DELAY_MS"))
+	if err != nil {
+		return fmt.Errorf("ошибка запуска HTTPS сервера: {%v}", err)
+	}
+
+	// Аутентификация клиентов по сертификатам (mTLS)
+	mode, err := mtls.ParseMode(os.Getenv("HTTPS_CLIENT_AUTH"))
+	if err != nil {
+		return fmt.Errorf("ошибка запуска HTTPS сервера: {%v}", err)
+	}
+
+	tlsConf, err := mtls.ServerConfig(mode, os.Getenv("HTTPS_CLIENT_CA"))
+	if err != nil {
+		return fmt.Errorf("ошибка запуска HTTPS сервера: {%v}", err)
+	}
+	lgr.I.Printf("HTTPS сервер: аутентификация клиентов {%s}", mode)
+
 	// Ручки HTTP сервера
 	r := chi.NewRouter()
+	r.Use(serverAPI.ClientCert(db.Ptr, lgr, mode))
 
-	r.Post("/status", func(w http.ResponseWriter, r *http.Request) {
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermStatus)).Post("/status", func(w http.ResponseWriter, r *http.Request) {
 
 		// предоставляет сводные данные состояние сервера
 		srvData, err := collectServInfo()
@@ -2993,10 +4635,29 @@ func goHttpsServer() {
 		var user serverAPI.LoginUserT
 		user.DB = db.Ptr
 		user.Lgr = lgr
+		user.TTL = ttl
+		user.Guard = guard
 		user.HandlHttpsRegistration(w, r)
 	})
 
-	r.Post("/cntstr", func(w http.ResponseWriter, r *http.Request) {
+	r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		// продление сессии: замена токена
+		var user serverAPI.SessionUserT
+		user.DB = db.Ptr
+		user.Lgr = lgr
+		user.TTL = ttl
+		user.HandlHttpsRefresh(w, r)
+	})
+
+	r.Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		// выход пользователя: отзыв сессии
+		var user serverAPI.SessionUserT
+		user.DB = db.Ptr
+		user.Lgr = lgr
+		user.HandlHttpsLogout(w, r)
+	})
+
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermArchive)).Post("/cntstr", func(w http.ResponseWriter, r *http.Request) {
 		// определется количество строк в БД по указанной дате
 		var cntStr serverAPI.CntStrByDateT
 		cntStr.DB = db.Ptr
@@ -3004,7 +4665,7 @@ func goHttpsServer() {
 		cntStr.HandlHttpsCntStrByDate(w, r)
 	})
 
-	r.Post("/partdatadb", func(w http.ResponseWriter, r *http.Request) {
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermArchive)).Post("/partdatadb", func(w http.ResponseWriter, r *http.Request) {
 		// запрос данных БД
 		var partData serverAPI.PartDataT
 		partData.DB = db.Ptr
@@ -3012,17 +4673,69 @@ func goHttpsServer() {
 		partData.HandlHttpsPartDataDB(w, r)
 	})
 
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermArchive)).Post("/verify", func(w http.ResponseWriter, r *http.Request) {
+		// проверка цепочки хэшей архива за период
+		var verify serverAPI.VerifyChainT
+		verify.DB = db.Ptr
+		verify.Lgr = lgr
+		verify.HandlHttpsVerifyChain(w, r)
+	})
+
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermWrite)).Post("/write", func(w http.ResponseWriter, r *http.Request) {
+		// запись значения тэга в устройство
+		var wrTag serverAPI.WriteTagT
+		wrTag.DB = db.Ptr
+		wrTag.Lgr = lgr
+		wrTag.Write = writeTag
+		wrTag.HandlHttpsWriteTag(w, r)
+	})
+
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermUsers)).Post("/lockouts", func(w http.ResponseWriter, r *http.Request) {
+		// блокировки и счётчики неудачных попыток входа
+		var sec serverAPI.SecurityT
+		sec.DB = db.Ptr
+		sec.Lgr = lgr
+		sec.HandlHttpsLockouts(w, r)
+	})
+
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermUsers)).Post("/lockouts/clear", func(w http.ResponseWriter, r *http.Request) {
+		// снятие блокировки входа
+		var sec serverAPI.SecurityT
+		sec.DB = db.Ptr
+		sec.Lgr = lgr
+		sec.HandlHttpsLockoutClear(w, r)
+	})
+
+	r.With(serverAPI.Access(db.Ptr, lgr, role.PermLogs)).Post("/events", func(w http.ResponseWriter, r *http.Request) {
+		// события безопасности за период
+		var sec serverAPI.SecurityT
+		sec.DB = db.Ptr
+		sec.Lgr = lgr
+		sec.HandlHttpsEvents(w, r)
+	})
+
 	// Запуск HTTPS сервера
-	err := http.ListenAndServeTLS(
-		os.Getenv("HTTPS_SERVER_IP")+":"+os.Getenv("HTTPS_SERVER_PORT"),
+	srv := &http.Server{
+		Addr:      os.Getenv("HTTPS_SERVER_IP") + ":" + os.Getenv("HTTPS_SERVER_PORT"),
+		Handler:   r,
+		TLSConfig: tlsConf,
+	}
+
+	// Остановка сервера по завершению контекста
+	stop := context.AfterFunc(ctx, func() {
+		_ = srv.Close()
+	})
+	defer stop()
+
+	err = srv.ListenAndServeTLS(
 		os.Getenv("HTTPS_SERVER_KEY_PUBLIC"),
-		os.Getenv("HTTPS_SERVER_KEY_PRIVATE"),
-		r)
+		os.Getenv("HTTPS_SERVER_KEY_PRIVATE"))
 
-	if err != nil {
-		lgr.E.Println("ошибка запуска HTTPS сервера:", err)
-		log.Fatalf("ошибка запуска HTTPS сервера: %v", err)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+
+	return fmt.Errorf("ошибка работы HTTPS сервера: {%v}", err)
 }
 
 // Функция выполняет сбор данных состояния сервера.
@@ -3041,6 +4754,10 @@ func collectServInfo() (info serverAPI.StatusServerT, err error) {
 		mbRTU := serverAPI.InfoModbusRTUT{}
 		mbRTU.ConName = v.Name
 		mbRTU.Con = v.Port
+		if v.Address != "" {
+			// сетевой шлюз RTU-TCP или UDP
+			mbRTU.Con = v.ConType + " " + v.Address
+		}
 		mbRTU.ConParams.BaudRate = v.ParamsConn.BaudRate
 		mbRTU.ConParams.DataBits = v.ParamsConn.DataBits
 		mbRTU.ConParams.Parity = v.ParamsConn.Parity
@@ -3055,9 +4772,43 @@ func collectServInfo() (info serverAPI.StatusServerT, err error) {
 		mbTCP.ConName = v.Name
 		mbTCP.Con = v.HostIP
 
+		if v.Health != nil {
+			h := v.Health.Info()
+			mbTCP.State = h.State
+			mbTCP.LastErr = h.LastErr
+			mbTCP.Reconnects = h.Reconnects
+			mbTCP.Since = h.Since
+		}
+
 		collect.MbTCP = append(collect.MbTCP, mbTCP)
 	}
 
+	// Сбор информации по рабочим Go рутинам
+	collect.Workers = make([]serverAPI.InfoWorkerT, 0)
+	for _, v := range workers.Health() {
+		collect.Workers = append(collect.Workers, serverAPI.InfoWorkerT(v))
+	}
+
+	// Сбор информации по планировщикам опроса
+	collect.Poll = make([]serverAPI.InfoPollT, 0)
+	for _, v := range pollSched.Info() {
+		collect.Poll = append(collect.Poll, serverAPI.InfoPollT(v))
+	}
+
+	// Сбор информации по буферу архива
+	if dbBuf != nil {
+		collect.Buffer = serverAPI.InfoBufferT(dbBuf.Info())
+	}
+
+	// Сбор информации по записи архива
+	collect.Writer = serverAPI.InfoWriterT(dbMeter.Info())
+
+	// Сбор информации по сигналу активности
+	collect.Heartbeat = serverAPI.InfoHeartbeatT(hbeat.Info())
+
+	// Сбор информации по шлюзу
+	collect.Gateway = serverAPI.InfoGatewayT(gw.Info())
+
 	// Получение информации о размерности файлов логера
 	collect.SizeF.I, collect.SizeF.W, collect.SizeF.E, err = lgr.SizeFiles()
 	if err != nil {
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"blackbox/internal/server/libre"
+	"blackbox/internal/server/simulator"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Точка входа. Симулятор слейвов Modbus по файлу импорта для пусконаладки и проверки без оборудования.
+func main() {
+
+	log.SetOutput(os.Stdout)
+
+	err := godotenv.Load("./configs/.env")
+	if err != nil {
+		log.Fatal("ошибка чтения переменных окружения:", err)
+	}
+
+	conf, err := readConf()
+	if err != nil {
+		log.Fatal("ошибка в настройках симулятора: ", err)
+	}
+
+	// Чтение конфигурационного файла xlsx
+	var cnf libre.ConfXLSX_Import
+	err = cnf.ReadImport()
+	if err != nil {
+		log.Fatal("ошибка при чтении файла конфигурации: ", err)
+	}
+
+	sim, err := simulator.New(cnf, conf)
+	if err != nil {
+		log.Fatal("ошибка создания симулятора: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = sim.Start(ctx)
+	if err != nil {
+		log.Fatal("ошибка запуска симулятора: ", err)
+	}
+	log.Println("симулятор запущен, завершение - Ctrl+C")
+
+	<-ctx.Done()
+	log.Println("симулятор остановлен")
+}
+
+// Чтение настроек симулятора из переменных окружения. Возвращаются настройки и ошибка.
+func readConf() (conf simulator.ConfT, err error) {
+
+	conf.Gen = os.Getenv("SIM_GENERATOR")
+	conf.ComPath = os.Getenv("COM_PORT_PATH")
+
+	conf.Tags, err = readPairs("SIM_TAGS")
+	if err != nil {
+		return conf, err
+	}
+	conf.Faults, err = readPairs("SIM_FAULTS")
+	if err != nil {
+		return conf, err
+	}
+	for dev, fault := range conf.Faults {
+		if fault != "timeout" && fault != "exception" {
+			return conf, fmt.Errorf("SIM_FAULTS: неисправность {%s} устройства {%s}, ожидается timeout или exception", fault, dev)
+		}
+	}
+
+	for name, v := range map[string]*float64{"SIM_FAULT_TIMEOUT_PCT": &conf.TimeoutPct, "SIM_FAULT_EXCEPTION_PCT": &conf.ExceptionPct} {
+		s := os.Getenv(name)
+		if s == "" {
+			continue
+		}
+		*v, err = strconv.ParseFloat(s, 64)
+		if err != nil || *v < 0 || *v > 100 {
+			return conf, fmt.Errorf("%s: {%s} не число 0..100", name, s)
+		}
+	}
+
+	if s := os.Getenv("SIM_LISTEN_ANY"); s != "" {
+		conf.ListenAny, err = strconv.ParseBool(s)
+		if err != nil {
+			return conf, fmt.Errorf("SIM_LISTEN_ANY: {%s} не true/false", s)
+		}
+	}
+
+	if s := os.Getenv("SIM_TICK_MS"); s != "" {
+		ms, err := strconv.Atoi(s)
+		if err != nil || ms <= 0 {
+			return conf, fmt.Errorf("SIM_TICK_MS: {%s} не положительное число", s)
+		}
+		conf.Tick = time.Duration(ms) * time.Millisecond
+	}
+
+	return conf, nil
+}
+
+// Чтение переменной окружения вида "ключ=значение;ключ=значение". Возвращается мапа и ошибка.
+//
+// Параметры:
+//
+// name - имя переменной окружения
+func readPairs(name string) (map[string]string, error) {
+
+	res := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(name), ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: ожидается ключ=значение, получено {%s}", name, pair)
+		}
+		res[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return res, nil
+}
@@ -24,6 +24,12 @@ type (
 		TimeStart string          `json:"timeStart"`
 		MbRTU     []InfoModbusRTU `json:"mbRTU"`
 		MbTCP     []InfoModbusTCP `json:"mbTCP"`
+		Workers   []InfoWorker    `json:"workers"`
+		Poll      []InfoPoll      `json:"poll"`
+		Buffer    InfoBuffer      `json:"buffer"`
+		Writer    InfoWriter      `json:"writer"`
+		Heartbeat InfoHeartbeat   `json:"heartbeat"`
+		Gateway   InfoGateway     `json:"gateway"`
 		SizeF     SizeFiles       `json:"sizeFiles"`
 	}
 	InfoModbusRTU struct {
@@ -37,8 +43,60 @@ type (
 		}
 	}
 	InfoModbusTCP struct {
-		ConName string
-		Con     string
+		ConName    string
+		Con        string
+		State      string
+		LastErr    string
+		Reconnects int
+		Since      string
+	}
+	InfoWorker struct {
+		Name        string
+		State       string
+		Restarts    int
+		LastErr     string
+		LastErrTime string
+		Since       string
+	}
+	InfoPoll struct {
+		Name       string
+		PeriodMs   int64
+		OffsetMs   int64
+		Cycles     uint64
+		Overruns   uint64
+		Skipped    uint64
+		LastLateMs float64
+		MaxLateMs  float64
+	}
+	InfoBuffer struct {
+		Records int64
+		Bytes   int64
+		Dead    int64
+	}
+	InfoWriter struct {
+		Rows        uint64
+		Batches     uint64
+		AvgBatch    float64
+		AvgFlushMs  float64
+		LastFlushMs float64
+		LastFlush   string
+		RowsPerSec  float64
+	}
+	InfoHeartbeat struct {
+		State  string
+		Reason string
+		Value  string
+		Since  string
+	}
+	InfoGateway struct {
+		State      string
+		Address    string
+		Tags       int
+		Clients    int
+		Requests   uint64
+		Exceptions uint64
+		LastErr    string
+		Since      string
 	}
 	SizeFiles struct {
 		I int64
@@ -53,10 +111,13 @@ type (
 		Data      []DataEl `json:"datadb"`
 	}
 	DataEl struct {
+		Dev       string
 		Name      string
 		Value     string
 		Qual      string
 		TimeStamp string
+		Hash      string
+		Unit      string
 	}
 
 	// Для хранения всех запрошенных частей
@@ -67,6 +128,36 @@ type (
 		NumbReq int      `json:"numbreq"`
 		Data    []DataEl `json:"data"`
 	}
+
+	// JSON для приёма печати архива
+	RxSeal struct {
+		Date      string `json:"date"`
+		CntRows   int    `json:"cntrows"`
+		Digest    string `json:"digest"`
+		Signature string `json:"signature"`
+		PublicKey string `json:"publickey"`
+		TimeStamp string `json:"timestamp"`
+	}
+
+	// JSON для приёма диагностики обмена с устройствами
+	RxDiagnostics struct {
+		Devs []DiagnosticsEl
+	}
+	DiagnosticsEl struct {
+		Dev           string  `json:"dev"`
+		Requests      uint64  `json:"requests"`
+		Successes     uint64  `json:"successes"`
+		Timeouts      uint64  `json:"timeouts"`
+		CRCErrors     uint64  `json:"crcerrors"`
+		Exceptions    uint64  `json:"exceptions"`
+		DecodeErrors  uint64  `json:"decodeerrors"`
+		CommErrors    uint64  `json:"commerrors"`
+		Stale         uint64  `json:"stale"`
+		AvgResponseMs float64 `json:"avgresponsems"`
+		LastQual      uint16  `json:"lastqual"`
+		LastErr       string  `json:"lasterr"`
+		LastErrTime   string  `json:"lasterrtime"`
+	}
 )
 
 // Получение статуса сервера. Возвращается ошибка.
@@ -355,3 +446,94 @@ func ReqPartDataDB(numbReg, strLimit, strOffSet int, dateDB string) (data PartDa
 
 	return data, nil
 }
+
+// Получение печати архива по дате. Возвращается ошибка.
+func (rx *RxSeal) ReqSeal() error {
+
+	_, err := time.Parse("2006-01-02", rx.Date)
+	if err != nil {
+		return fmt.Errorf("req-seal -> значение даты {%s}, не дата", rx.Date)
+	}
+
+	u := fmt.Sprintf("http://%s:%s/seal", os.Getenv("HTTP_SERVER_IP"), os.Getenv("HTTP_SERVER_PORT"))
+
+	parseU, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("req-seal -> ошибка парсинга URL {%v}", err)
+	}
+
+	qP := url.Values{}
+	qP.Set("date", rx.Date)
+
+	parseU.RawQuery = qP.Encode()
+
+	// Формирование запроса
+	req, err := http.NewRequest(http.MethodGet, parseU.String(), nil)
+	if err != nil {
+		return fmt.Errorf("req-seal -> ошибка {%v} при создании запроса", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("req-seal -> ошибка {%v} запроса", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Проверка кода ответа
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("req-seal -> на сервере нет печати архива на {%s}", rx.Date)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("req-seal -> сервер вернул код {%d}", resp.StatusCode)
+	}
+
+	// Чтение тела ответа
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New("req-seal -> ошибка чтения тела ответа")
+	}
+
+	err = json.Unmarshal(body, rx)
+	if err != nil {
+		return fmt.Errorf("req-seal -> ошибка десиреализации тела ответа:{%v}", err)
+	}
+
+	return nil
+}
+
+// Получение диагностики обмена с устройствами. Возвращается ошибка.
+func (rx *RxDiagnostics) ReqDiagnostics() error {
+
+	u := "http://" + os.Getenv("HTTP_SERVER_IP") + ":" + os.Getenv("HTTP_SERVER_PORT") + "/diagnostics"
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("req-diagnostics -> ошибка {%v} при создании запроса", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("req-diagnostics -> ошибка {%v} запроса", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("req-diagnostics -> сервер вернул код {%d}", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.New("req-diagnostics -> ошибка чтения тела ответа")
+	}
+
+	err = json.Unmarshal(body, &rx.Devs)
+	if err != nil {
+		return fmt.Errorf("req-diagnostics -> ошибка {%v} обработки данных ответа", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package coalesce
+
+import (
+	"blackbox/internal/server/codec"
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// Ограничения протокола Modbus на количество в одном запросе чтения
+const (
+	MaxRegisters = codec.MaxRegisters // регистров
+	MaxBits      = 2000               // дискретных входов и катушек
+)
+
+type (
+	// Настройки объединения тэгов в блоки чтения
+	ConfT struct {
+		MaxRegs uint16 // наибольшее количество регистров в запросе
+		MaxBits uint16 // наибольшее количество бит в запросе
+		MaxGap  uint16 // наибольший пропуск неопрашиваемых регистров (бит) между тэгами блока
+	}
+
+	// Тэг запроса чтения
+	ItemT struct {
+		Index    int    // индекс тэга в списке опроса
+		Slave    byte   // адрес устройства
+		Func     string // функция Modbus
+		Address  uint16 // адрес первого регистра (бита)
+		Quantity uint16 // количество регистров (бит)
+	}
+
+	// Блок чтения смежных регистров (бит) одного устройства и функции
+	BlockT struct {
+		Slave    byte
+		Func     string
+		Address  uint16
+		Quantity uint16
+		Items    []ItemT // тэги блока
+	}
+)
+
+// Проверка функции чтения бит. Возвращает true для дискретных входов и катушек.
+//
+// Параметры:
+//
+// function - функция Modbus
+func IsBits(function string) bool {
+	return function == "ReadDiscreteInputs" || function == "ReadCoil"
+}
+
+// Объединение тэгов в блоки чтения. Тэги группируются по устройству и функции, упорядочиваются по адресу
+// и объединяются, пока пропуск между ними не превышает MaxGap, а размер блока - наибольшего количества.
+// Тэг больше наибольшего количества опрашивается отдельным блоком. Возвращаются блоки.
+//
+// Параметры:
+//
+// items - тэги запроса
+// conf - настройки объединения
+func Build(items []ItemT, conf ConfT) []BlockT {
+
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b ItemT) int {
+		return cmp.Or(
+			cmp.Compare(a.Slave, b.Slave),
+			cmp.Compare(a.Func, b.Func),
+			cmp.Compare(a.Address, b.Address),
+		)
+	})
+
+	blocks := make([]BlockT, 0)
+
+	for _, it := range sorted {
+
+		if n := len(blocks); n > 0 {
+			b := &blocks[n-1]
+
+			end := uint32(b.Address) + uint32(b.Quantity)
+			newEnd := max(end, uint32(it.Address)+uint32(it.Quantity))
+
+			if b.Slave == it.Slave && b.Func == it.Func &&
+				uint32(it.Address) <= end+uint32(conf.MaxGap) &&
+				newEnd-uint32(b.Address) <= uint32(conf.limit(it.Func)) {
+
+				b.Quantity = uint16(newEnd - uint32(b.Address))
+				b.Items = append(b.Items, it)
+				continue
+			}
+		}
+
+		blocks = append(blocks, BlockT{
+			Slave:    it.Slave,
+			Func:     it.Func,
+			Address:  it.Address,
+			Quantity: it.Quantity,
+			Items:    []ItemT{it},
+		})
+	}
+
+	return blocks
+}
+
+// Наибольшее количество в запросе для функции, с учётом ограничения протокола.
+func (c ConfT) limit(function string) uint16 {
+
+	if IsBits(function) {
+		if c.MaxBits == 0 || c.MaxBits > MaxBits {
+			return MaxBits
+		}
+		return c.MaxBits
+	}
+
+	if c.MaxRegs == 0 || c.MaxRegs > MaxRegisters {
+		return MaxRegisters
+	}
+	return c.MaxRegs
+}
+
+// Разделение блока на блоки из одного тэга. Возвращаются блоки.
+func (b BlockT) Split() []BlockT {
+
+	blocks := make([]BlockT, 0, len(b.Items))
+
+	for _, it := range b.Items {
+		blocks = append(blocks, BlockT{
+			Slave:    it.Slave,
+			Func:     it.Func,
+			Address:  it.Address,
+			Quantity: it.Quantity,
+			Items:    []ItemT{it},
+		})
+	}
+
+	return blocks
+}
+
+// Регистры тэга из ответа блока в виде слайса uint16. Возвращаются регистры и ошибка.
+//
+// Параметры:
+//
+// res - ответ на запрос блока
+// it - тэг блока
+func (b BlockT) Registers(res []uint16, it ItemT) ([]uint16, error) {
+
+	off := int(it.Address) - int(b.Address)
+	end := off + int(it.Quantity)
+	if off < 0 || end > len(res) {
+		return nil, fmt.Errorf("ответ блока {%d} регистров не содержит регистры {%d..%d}", len(res), it.Address, int(it.Address)+int(it.Quantity)-1)
+	}
+
+	return res[off:end], nil
+}
+
+// Данные тэга из ответа блока в виде слайса байт: для регистров - по 2 байта на регистр, для бит -
+// биты, упакованные с младшего бита первого байта, как в ответе на отдельный запрос тэга.
+// Возвращаются данные и ошибка.
+//
+// Параметры:
+//
+// res - ответ на запрос блока
+// it - тэг блока
+func (b BlockT) Bytes(res []byte, it ItemT) ([]byte, error) {
+
+	off := int(it.Address) - int(b.Address)
+	n := int(it.Quantity)
+
+	if !IsBits(b.Func) {
+		if off < 0 || 2*(off+n) > len(res) {
+			return nil, fmt.Errorf("ответ блока {%d} байт не содержит регистры {%d..%d}", len(res), it.Address, int(it.Address)+n-1)
+		}
+		return res[2*off : 2*(off+n)], nil
+	}
+
+	if off < 0 || off+n > 8*len(res) {
+		return nil, fmt.Errorf("ответ блока {%d} байт не содержит биты {%d..%d}", len(res), it.Address, int(it.Address)+n-1)
+	}
+
+	bits := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		src := off + i
+		if res[src/8]&(1<<(src%8)) != 0 {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return bits, nil
+}
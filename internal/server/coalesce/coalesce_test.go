@@ -0,0 +1,100 @@
+package coalesce
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+
+	items := []ItemT{
+		{Index: 0, Slave: 1, Func: "ReadHoldingRegisters", Address: 10, Quantity: 2},
+		{Index: 1, Slave: 1, Func: "ReadHoldingRegisters", Address: 0, Quantity: 1},
+		{Index: 2, Slave: 1, Func: "ReadHoldingRegisters", Address: 1, Quantity: 2},
+		{Index: 3, Slave: 1, Func: "ReadHoldingRegisters", Address: 5, Quantity: 1}, // пропуск 2 регистра
+		{Index: 4, Slave: 2, Func: "ReadHoldingRegisters", Address: 3, Quantity: 1}, // другое устройство
+		{Index: 5, Slave: 1, Func: "ReadCoil", Address: 3, Quantity: 1},             // другая функция
+	}
+
+	blocks := Build(items, ConfT{MaxRegs: 8, MaxGap: 2})
+
+	want := []struct {
+		address, quantity uint16
+		index             []int
+	}{
+		{3, 1, []int{5}},
+		{0, 6, []int{1, 2, 3}},
+		{10, 2, []int{0}}, // не помещается в 8 регистров
+		{3, 1, []int{4}},
+	}
+
+	if len(blocks) != len(want) {
+		t.Fatalf("ожидалось блоков {%d}, получено {%d}: %+v", len(want), len(blocks), blocks)
+	}
+	for i, w := range want {
+		b := blocks[i]
+		index := make([]int, 0)
+		for _, it := range b.Items {
+			index = append(index, it.Index)
+		}
+		if b.Address != w.address || b.Quantity != w.quantity || !slices.Equal(index, w.index) {
+			t.Fatalf("блок {%d}: ожидалось %v, получено %+v", i, w, b)
+		}
+	}
+}
+
+func TestBuild_NoGap(t *testing.T) {
+
+	items := []ItemT{
+		{Func: "ReadInputRegisters", Address: 0, Quantity: 1},
+		{Func: "ReadInputRegisters", Address: 2, Quantity: 1},
+	}
+
+	if blocks := Build(items, ConfT{}); len(blocks) != 2 {
+		t.Fatalf("без пропуска ожидалось 2 блока, получено {%d}", len(blocks))
+	}
+}
+
+func TestBlock_Split(t *testing.T) {
+
+	regs := Build([]ItemT{
+		{Func: "ReadHoldingRegisters", Address: 4, Quantity: 1},
+		{Func: "ReadHoldingRegisters", Address: 5, Quantity: 2},
+	}, ConfT{})[0]
+
+	res := []uint16{0x0102, 0x0304, 0x0506}
+
+	got, err := regs.Registers(res, regs.Items[1])
+	if err != nil || !slices.Equal(got, []uint16{0x0304, 0x0506}) {
+		t.Fatalf("регистры тэга: %v, %v", got, err)
+	}
+
+	raw, err := regs.Bytes([]byte{1, 2, 3, 4, 5, 6}, regs.Items[1])
+	if err != nil || !bytes.Equal(raw, []byte{3, 4, 5, 6}) {
+		t.Fatalf("байты регистров тэга: %v, %v", raw, err)
+	}
+
+	if _, err = regs.Registers(res[:2], regs.Items[1]); err == nil {
+		t.Fatal("ожидалась ошибка короткого ответа")
+	}
+
+	coils := Build([]ItemT{
+		{Func: "ReadCoil", Address: 0, Quantity: 1},
+		{Func: "ReadCoil", Address: 7, Quantity: 1},
+		{Func: "ReadCoil", Address: 8, Quantity: 3},
+	}, ConfT{MaxGap: 8})[0]
+
+	packed := []byte{0b1000_0000, 0b0000_0101}
+
+	for i, want := range [][]byte{{0}, {1}, {0b101}} {
+		got, err := coils.Bytes(packed, coils.Items[i])
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("биты тэга {%d}: ожидалось %v, получено %v, %v", i, want, got, err)
+		}
+	}
+
+	if n := len(coils.Split()); n != 3 {
+		t.Fatalf("ожидалось 3 блока после разделения, получено {%d}", n)
+	}
+}
@@ -0,0 +1,516 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Ограничение протокола Modbus на количество регистров в одном запросе
+const MaxRegisters = 125
+
+var (
+	// количество байт значения базового типа, для которых задаётся формат (у String - на регистр)
+	sizes = map[string]int{
+		"Bool":     2,
+		"Word":     2,
+		"ShortInt": 2,
+		"Integer":  4,
+		"DWord":    4,
+		"Float":    4,
+		"Int64":    8,
+		"Double":   8,
+		"UInt64":   8,
+		"UInt8Hi":  2,
+		"UInt8Lo":  2,
+		"Int8Hi":   2,
+		"Int8Lo":   2,
+		"BCD16":    2,
+		"BCD32":    4,
+		"Bit":      2,
+		"String":   2,
+	}
+
+	// псевдонимы формата: перестановка байт внутри регистра и обратный порядок регистров
+	aliases = map[string]struct{ byteSwap, wordSwap bool }{
+		"ABCD": {false, false},
+		"CDAB": {false, true},
+		"BADC": {true, false},
+		"DCBA": {true, true},
+	}
+)
+
+// Разбор типа данных тэга. Параметр типа указывается через точку: Bit.N - бит N (0..15) регистра,
+// String.N - строка из N регистров (по 2 символа в регистре). Остальные типы указываются без параметра.
+// Функция возвращает базовый тип, параметр и ошибку.
+//
+// Параметры:
+//
+// dataType - тип данных тэга
+func SplitType(dataType string) (base string, param int, err error) {
+
+	base, strParam, found := strings.Cut(dataType, ".")
+
+	switch base {
+	case "Bit", "String":
+		if !found {
+			return "", 0, fmt.Errorf("для типа {%s} не указан параметр: %s.N", dataType, base)
+		}
+		param, err = strconv.Atoi(strParam)
+		if err != nil {
+			return "", 0, fmt.Errorf("параметр типа {%s} не число", dataType)
+		}
+	default:
+		if found {
+			return "", 0, fmt.Errorf("тип {%s} указывается без параметра", dataType)
+		}
+		if _, ok := sizes[base]; !ok {
+			return "", 0, fmt.Errorf("неподдерживаемый тип данных: %s", dataType)
+		}
+		return base, 0, nil
+	}
+
+	switch {
+	case base == "Bit" && (param < 0 || param > 15):
+		return "", 0, fmt.Errorf("номер бита типа {%s} вне диапазона 0..15", dataType)
+	case base == "String" && (param < 1 || param > MaxRegisters):
+		return "", 0, fmt.Errorf("количество регистров типа {%s} вне диапазона 1..%d", dataType, MaxRegisters)
+	}
+
+	return base, param, nil
+}
+
+// Количество байт, для которых задаётся формат типа данных (у String - на один регистр).
+// Функция возвращает количество байт и ошибку.
+//
+// Параметры:
+//
+// dataType - тип данных тэга
+func FormatSize(dataType string) (int, error) {
+
+	base, _, err := SplitType(dataType)
+	if err != nil {
+		return 0, err
+	}
+
+	return sizes[base], nil
+}
+
+// Количество регистров значения тэга. Функция возвращает количество регистров и ошибку.
+//
+// Параметры:
+//
+// dataType - тип данных тэга
+func Regs(dataType string) (int, error) {
+
+	base, param, err := SplitType(dataType)
+	if err != nil {
+		return 0, err
+	}
+
+	if base == "String" {
+		return param, nil
+	}
+
+	return sizes[base] / 2, nil
+}
+
+// Разбор формата (порядка байт). Формат задаётся номерами байт значения через "_" для каждого байта
+// в порядке передачи (0 - младший байт значения), либо псевдонимом ABCD, CDAB, BADC, DCBA.
+// Функция возвращает номера байт значения по позициям в порядке передачи и ошибку.
+//
+// Параметры:
+//
+// format - формат данных
+// size - количество байт значения
+func ParseFormat(format string, size int) (order []int, err error) {
+
+	format = strings.TrimSpace(format)
+
+	if a, ok := aliases[strings.ToUpper(format)]; ok {
+		order = make([]int, size)
+		for p := range order {
+			// старший байт регистра передаётся первым, старший регистр - первым
+			reg, byteNum := p/2, 1-p%2
+			if a.byteSwap {
+				byteNum = p % 2
+			}
+			if !a.wordSwap {
+				reg = size/2 - 1 - reg
+			}
+			order[p] = 2*reg + byteNum
+		}
+		return order, nil
+	}
+
+	strNumb := strings.Split(format, "_")
+	if len(strNumb) != size {
+		return nil, fmt.Errorf("формат {%s} не соответствует количеству байт {%d}", format, size)
+	}
+
+	used := make([]bool, size)
+	for _, v := range strNumb {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n >= size {
+			return nil, fmt.Errorf("ошибка в формате {%s}: номер байта {%s} вне диапазона 0..%d", format, v, size-1)
+		}
+		if used[n] {
+			return nil, fmt.Errorf("ошибка в формате {%s}: повторяемость {%s}", format, v)
+		}
+		used[n] = true
+		order = append(order, n)
+	}
+
+	return order, nil
+}
+
+// Приведение формата тэга драйвера Modbus-RTU (COM, RTU-TCP, UDP) к смыслу ParseFormat. В формате тэга
+// Modbus-RTU номера байт отсчитываются от старшего байта значения (Word 0_1 - старший байт первым), номер N
+// заменяется на (количество байт - 1 - N). Псевдонимы и пустой формат не меняются, ошибочный формат
+// возвращается без изменений (ошибка - при разборе). Функция возвращает формат.
+//
+// Параметры:
+//
+// format - формат тэга Modbus-RTU
+func RTUFormat(format string) string {
+
+	format = strings.TrimSpace(format)
+	if format == "" {
+		return format
+	}
+	if _, ok := aliases[strings.ToUpper(format)]; ok {
+		return format
+	}
+
+	strNumb := strings.Split(format, "_")
+	res := make([]string, 0, len(strNumb))
+	used := make([]bool, len(strNumb))
+	for _, v := range strNumb {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n >= len(strNumb) || used[n] {
+			return format
+		}
+		used[n] = true
+		res = append(res, strconv.Itoa(len(strNumb)-1-n))
+	}
+
+	return strings.Join(res, "_")
+}
+
+// Приведение регистров к байтам в порядке передачи (старший байт регистра первым). Возвращаются байты.
+//
+// Параметры:
+//
+// regs - регистры
+func Bytes(regs []uint16) []byte {
+
+	res := make([]byte, 0, 2*len(regs))
+	for _, v := range regs {
+		res = append(res, byte(v>>8), byte(v))
+	}
+
+	return res
+}
+
+// Приведение байт в порядке передачи к регистрам. Обратное преобразование для Bytes. Возвращаются регистры.
+//
+// Параметры:
+//
+// data - байты, чётное количество
+func Registers(data []byte) []uint16 {
+
+	res := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		res = append(res, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+
+	return res
+}
+
+// Декодирование значения тэга. Функция возвращает значение интерфейсом и ошибку.
+//
+// Параметры:
+//
+// data - байты в порядке передачи (у Bool - значение дискрета)
+// dataType - тип данных тэга
+// format - формат данных (порядок байт)
+func Decode(data []byte, dataType string, format string) (value interface{}, err error) {
+
+	base, param, err := SplitType(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	// значение дискрета не зависит от формата
+	if base == "Bool" {
+		if len(data) == 0 {
+			return nil, fmt.Errorf("нет данных для типа %s", dataType)
+		}
+		return data[0], nil
+	}
+
+	size := sizes[base]
+	order, err := ParseFormat(format, size)
+	if err != nil {
+		return nil, err
+	}
+
+	need := size
+	if base == "String" {
+		need = 2 * param
+	}
+	if len(data) < need {
+		return nil, fmt.Errorf("для типа %s требуется байт {%d}, принято {%d}", dataType, need, len(data))
+	}
+
+	bits := decodeBits(data[:size], order)
+
+	switch base {
+
+	case "Word":
+		return uint16(bits), nil
+	case "ShortInt":
+		return int16(bits), nil
+	case "Integer":
+		return int32(bits), nil
+	case "DWord":
+		return uint32(bits), nil
+	case "Float":
+		return math.Float32frombits(uint32(bits)), nil
+	case "Int64":
+		return int64(bits), nil
+	case "UInt64":
+		return bits, nil
+	case "Double":
+		return math.Float64frombits(bits), nil
+
+	// половины регистра возвращаются 16-битными, т.к. byte зарезервирован за дискретными значениями
+	case "UInt8Hi":
+		return uint16(bits >> 8 & 0xFF), nil
+	case "UInt8Lo":
+		return uint16(bits & 0xFF), nil
+	case "Int8Hi":
+		return int16(int8(bits >> 8)), nil
+	case "Int8Lo":
+		return int16(int8(bits)), nil
+
+	case "Bit":
+		return byte(bits>>param) & 1, nil
+
+	case "BCD16":
+		d, err := decodeBCD(bits, 4)
+		if err != nil {
+			return nil, err
+		}
+		return uint16(d), nil
+
+	case "BCD32":
+		d, err := decodeBCD(bits, 8)
+		if err != nil {
+			return nil, err
+		}
+		return uint32(d), nil
+
+	case "String":
+		// старший байт регистра - первый символ пары
+		b := make([]byte, 0, 2*param)
+		for i := range param {
+			w := decodeBits(data[2*i:2*i+2], order)
+			b = append(b, byte(w>>8), byte(w))
+		}
+
+		// строка завершается первым нулевым байтом, недопустимые для UTF-8 байты заменяются
+		if n := bytes.IndexByte(b, 0); n >= 0 {
+			b = b[:n]
+		}
+		return strings.ToValidUTF8(strings.TrimRight(string(b), " "), "?"), nil
+
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип данных: %s", dataType)
+	}
+}
+
+// Кодирование значения тэга из строки. Функция возвращает байты в порядке передачи (у Bool - значение
+// дискрета 0 или 1) и ошибку.
+//
+// Типы Bit, UInt8Hi, UInt8Lo, Int8Hi и Int8Lo только декодируются: запись части регистра изменила бы
+// остальные биты регистра. Строка String.N дополняется нулевыми байтами до N регистров.
+//
+// Параметры:
+//
+// value - значение в виде строки
+// dataType - тип данных тэга
+// format - формат данных (порядок байт)
+func Encode(value string, dataType string, format string) (res []byte, err error) {
+
+	base, param, err := SplitType(dataType)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == "String" {
+		return encodeString(value, param, format)
+	}
+
+	bits, err := encodeBits(value, base)
+	if err != nil {
+		return nil, err
+	}
+
+	if base == "Bool" {
+		return []byte{byte(bits)}, nil
+	}
+
+	order, err := ParseFormat(format, sizes[base])
+	if err != nil {
+		return nil, err
+	}
+
+	res = make([]byte, len(order))
+	for p, n := range order {
+		res[p] = byte(bits >> (8 * n))
+	}
+
+	return res, nil
+}
+
+// Кодирование строки в param регистров: старший байт регистра - первый символ пары, недостающие байты
+// нулевые. Функция возвращает байты в порядке передачи и ошибку.
+func encodeString(value string, param int, format string) ([]byte, error) {
+
+	if len(value) > 2*param {
+		return nil, fmt.Errorf("строка {%s} длиннее %d байт типа String.%d", value, 2*param, param)
+	}
+
+	order, err := ParseFormat(format, sizes["String"])
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 2*param)
+	copy(b, value)
+
+	res := make([]byte, 2*param)
+	for i := range param {
+		w := uint64(b[2*i])<<8 | uint64(b[2*i+1])
+		for p, n := range order {
+			res[2*i+p] = byte(w >> (8 * n))
+		}
+	}
+
+	return res, nil
+}
+
+// Сборка значения из байт по номерам байт значения. Возвращается значение.
+func decodeBits(data []byte, order []int) (bits uint64) {
+
+	for p, n := range order {
+		bits |= uint64(data[p]) << (8 * n)
+	}
+
+	return bits
+}
+
+// Приведение значения из строки к битовому представлению типа. Возвращается значение и ошибка.
+func encodeBits(value string, base string) (bits uint64, err error) {
+
+	errType := fmt.Errorf("значение {%s} не соответствует типу %s", value, base)
+
+	switch base {
+
+	case "Word":
+		bits, err = strconv.ParseUint(value, 10, 16)
+
+	case "ShortInt":
+		var v int64
+		v, err = strconv.ParseInt(value, 10, 16)
+		bits = uint64(uint16(v))
+
+	case "Integer":
+		var v int64
+		v, err = strconv.ParseInt(value, 10, 32)
+		bits = uint64(uint32(v))
+
+	case "DWord":
+		bits, err = strconv.ParseUint(value, 10, 32)
+
+	case "Float":
+		var v float64
+		v, err = strconv.ParseFloat(value, 32)
+		bits = uint64(math.Float32bits(float32(v)))
+
+	case "Int64":
+		var v int64
+		v, err = strconv.ParseInt(value, 10, 64)
+		bits = uint64(v)
+
+	case "UInt64":
+		bits, err = strconv.ParseUint(value, 10, 64)
+
+	case "Double":
+		var v float64
+		v, err = strconv.ParseFloat(value, 64)
+		bits = math.Float64bits(v)
+
+	case "BCD16", "BCD32":
+		digits := 2 * sizes[base]
+		var v uint64
+		v, err = strconv.ParseUint(value, 10, 32)
+		if err == nil {
+			bits, err = encodeBCD(v, digits)
+			if err != nil {
+				return 0, fmt.Errorf("%v: %v", errType, err)
+			}
+		}
+
+	case "Bool":
+		var v bool
+		v, err = strconv.ParseBool(value)
+		if v {
+			bits = 1
+		}
+
+	case "Bit", "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo":
+		return 0, fmt.Errorf("тип %s только для чтения: запись части регистра не поддерживается", base)
+
+	default:
+		return 0, fmt.Errorf("запись типа %s не поддерживается", base)
+	}
+
+	if err != nil {
+		return 0, errType
+	}
+
+	return bits, nil
+}
+
+// Декодирование двоично-десятичного значения. Функция возвращает число и ошибку, если тетрада больше 9.
+func decodeBCD(v uint64, digits int) (res uint64, err error) {
+
+	for i := digits - 1; i >= 0; i-- {
+		d := (v >> (4 * i)) & 0xF
+		if d > 9 {
+			return 0, fmt.Errorf("значение {%#x} не является двоично-десятичным", v)
+		}
+		res = res*10 + d
+	}
+
+	return res, nil
+}
+
+// Кодирование числа в двоично-десятичное значение. Функция возвращает значение и ошибку, если число не
+// помещается в указанное количество разрядов.
+func encodeBCD(v uint64, digits int) (res uint64, err error) {
+
+	for i := 0; i < digits; i++ {
+		res |= (v % 10) << (4 * i)
+		v /= 10
+	}
+	if v != 0 {
+		return 0, fmt.Errorf("значение не помещается в %d десятичных разрядов", digits)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,274 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Значения в порядке передачи, снятые с ПЛК: 123.456 = 0x42F6E979, 1.0 = 0x3FF0000000000000
+var vectors = []struct {
+	dataType string
+	format   string
+	data     []byte
+	want     interface{}
+}{
+	{"Float", "ABCD", []byte{0x42, 0xF6, 0xE9, 0x79}, float32(123.456)},
+	{"Float", "CDAB", []byte{0xE9, 0x79, 0x42, 0xF6}, float32(123.456)},
+	{"Float", "BADC", []byte{0xF6, 0x42, 0x79, 0xE9}, float32(123.456)},
+	{"Float", "DCBA", []byte{0x79, 0xE9, 0xF6, 0x42}, float32(123.456)},
+	{"Float", "3_2_1_0", []byte{0x42, 0xF6, 0xE9, 0x79}, float32(123.456)},
+	{"Float", "1_0_3_2", []byte{0xE9, 0x79, 0x42, 0xF6}, float32(123.456)},
+	{"Float", "2_3_0_1", []byte{0xF6, 0x42, 0x79, 0xE9}, float32(123.456)},
+	{"Float", "0_1_2_3", []byte{0x79, 0xE9, 0xF6, 0x42}, float32(123.456)},
+	{"Double", "ABCD", []byte{0x3F, 0xF0, 0, 0, 0, 0, 0, 0}, 1.0},
+	{"Double", "1_0_3_2_5_4_7_6", []byte{0, 0, 0, 0, 0, 0, 0x3F, 0xF0}, 1.0},
+	{"Double", "dcba", []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}, 1.0},
+	{"Word", "1_0", []byte{0x12, 0x34}, uint16(0x1234)},
+	{"Word", "0_1", []byte{0x34, 0x12}, uint16(0x1234)},
+	{"Word", "CDAB", []byte{0x12, 0x34}, uint16(0x1234)},
+	{"ShortInt", "1_0", []byte{0xFB, 0x2E}, int16(-1234)},
+	{"Integer", "CDAB", []byte{0xFF, 0xFE, 0xFF, 0xFF}, int32(-2)},
+	{"DWord", "ABCD", []byte{0x00, 0x01, 0x86, 0xA0}, uint32(100000)},
+	{"Int64", "ABCD", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}, int64(-2)},
+	{"UInt64", "ABCD", []byte{1, 2, 3, 4, 5, 6, 7, 8}, uint64(0x0102030405060708)},
+	{"UInt64", "CDAB", []byte{7, 8, 5, 6, 3, 4, 1, 2}, uint64(0x0102030405060708)},
+	{"BCD16", "1_0", []byte{0x12, 0x34}, uint16(1234)},
+	{"BCD32", "ABCD", []byte{0x12, 0x34, 0x56, 0x78}, uint32(12345678)},
+	{"BCD32", "CDAB", []byte{0x56, 0x78, 0x12, 0x34}, uint32(12345678)},
+	{"UInt8Hi", "1_0", []byte{0xFE, 0x01}, uint16(0xFE)},
+	{"UInt8Lo", "1_0", []byte{0xFE, 0x01}, uint16(1)},
+	{"Int8Hi", "1_0", []byte{0xFE, 0x01}, int16(-2)},
+	{"Int8Lo", "0_1", []byte{0xFE, 0x01}, int16(-2)},
+	{"Bit.0", "1_0", []byte{0x80, 0x01}, byte(1)},
+	{"Bit.1", "1_0", []byte{0x80, 0x01}, byte(0)},
+	{"Bit.15", "1_0", []byte{0x80, 0x01}, byte(1)},
+	{"String.3", "1_0", []byte{'A', 'B', 'C', 0, 'x', 'x'}, "ABC"},
+	{"String.2", "BADC", []byte{'B', 'A', ' ', 'C'}, "ABC"},
+	{"Bool", "1_0", []byte{1}, byte(1)},
+}
+
+func TestDecode_Vectors(t *testing.T) {
+
+	for _, v := range vectors {
+		got, err := Decode(v.data, v.dataType, v.format)
+		if err != nil {
+			t.Fatalf("%s %s % x: %v", v.dataType, v.format, v.data, err)
+		}
+		if got != v.want {
+			t.Fatalf("%s %s % x: ожидалось {%#v}, получено {%#v}", v.dataType, v.format, v.data, v.want, got)
+		}
+	}
+}
+
+func TestEncode_Vectors(t *testing.T) {
+
+	for _, v := range vectors {
+		base, _, _ := SplitType(v.dataType)
+		switch base {
+		case "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo", "Bit", "String", "Bool":
+			continue
+		}
+
+		got, err := Encode(fmt.Sprint(v.want), v.dataType, v.format)
+		if err != nil {
+			t.Fatalf("%s %s {%v}: %v", v.dataType, v.format, v.want, err)
+		}
+		if !bytes.Equal(got, v.data) {
+			t.Fatalf("%s %s {%v}: ожидалось % x, получено % x", v.dataType, v.format, v.want, v.data, got)
+		}
+	}
+}
+
+func TestEncode_String(t *testing.T) {
+
+	tests := []struct {
+		value, dataType, format string
+		want                    []byte
+	}{
+		{"ABC", "String.3", "1_0", []byte{'A', 'B', 'C', 0, 0, 0}},
+		{"ABC", "String.2", "BADC", []byte{'B', 'A', 0, 'C'}},
+		{"ABCD", "String.2", "0_1", []byte{'B', 'A', 'D', 'C'}},
+		{"", "String.1", "1_0", []byte{0, 0}},
+	}
+
+	for _, tt := range tests {
+		got, err := Encode(tt.value, tt.dataType, tt.format)
+		if err != nil {
+			t.Fatalf("%s %s {%s}: %v", tt.dataType, tt.format, tt.value, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Fatalf("%s %s {%s}: ожидалось % x, получено % x", tt.dataType, tt.format, tt.value, tt.want, got)
+		}
+
+		// Обратное декодирование
+		back, err := Decode(got, tt.dataType, tt.format)
+		if err != nil || back != tt.value {
+			t.Fatalf("%s %s {%s}: декодировано {%v}, %v", tt.dataType, tt.format, tt.value, back, err)
+		}
+	}
+}
+
+func TestDecode_Error(t *testing.T) {
+
+	tests := []struct {
+		dataType, format string
+		data             []byte
+	}{
+		{"BCD16", "1_0", []byte{0x1A, 0x34}}, // тетрада больше 9
+		{"DWord", "1_0_3_2", []byte{1, 2}},   // короткие данные
+		{"String.2", "1_0", []byte{'A', 'B'}},
+		{"Word", "1_1", []byte{1, 2}}, // повторяемость
+		{"Word", "0_2", []byte{1, 2}}, // номер вне диапазона
+		{"Word", "1_0_3_2", []byte{1, 2}},
+		{"Bit.16", "1_0", []byte{1, 2}},
+		{"String", "1_0", []byte{1, 2}},
+		{"Word.1", "1_0", []byte{1, 2}},
+		{"Char", "1_0", []byte{1, 2}},
+	}
+
+	for _, tt := range tests {
+		if _, err := Decode(tt.data, tt.dataType, tt.format); err == nil {
+			t.Fatalf("%s %s % x: ожидалась ошибка", tt.dataType, tt.format, tt.data)
+		}
+	}
+
+	for _, v := range [][2]string{{"12345", "BCD16"}, {"70000", "Word"}, {"ABCDE", "String.2"}, {"yes", "Bool"},
+		{"1", "Bit.0"}, {"1", "UInt8Hi"}, {"1", "UInt8Lo"}, {"-1", "Int8Hi"}, {"-1", "Int8Lo"}} {
+		if _, err := Encode(v[0], v[1], "1_0"); err == nil {
+			t.Fatalf("%s {%s}: ожидалась ошибка кодирования", v[1], v[0])
+		}
+	}
+}
+
+// Перестановки номеров 0..n-1
+func permutations(n int) [][]int {
+
+	if n == 1 {
+		return [][]int{{0}}
+	}
+
+	res := make([][]int, 0)
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := append(append(append([]int{}, p[:i]...), n-1), p[i:]...)
+			res = append(res, q)
+		}
+	}
+
+	return res
+}
+
+func TestRTUFormat(t *testing.T) {
+
+	// прежний смысл форматов Modbus-RTU: номера от старшего байта значения
+	for _, c := range []struct {
+		dataType string
+		format   string
+		data     []byte
+		want     interface{}
+	}{
+		{"DWord", "0_1_2_3", []byte{0x11, 0x22, 0x33, 0x44}, uint32(0x11223344)},
+		{"DWord", "2_3_0_1", []byte{0x33, 0x44, 0x11, 0x22}, uint32(0x11223344)},
+		{"Word", "0_1", []byte{0x12, 0x34}, uint16(0x1234)},
+		{"Word", "1_0", []byte{0x34, 0x12}, uint16(0x1234)},
+		{"Float", "CDAB", []byte{0xE9, 0x79, 0x42, 0xF6}, float32(123.456)},
+	} {
+		got, err := Decode(c.data, c.dataType, RTUFormat(c.format))
+		if err != nil || got != c.want {
+			t.Fatalf("%s %s: ожидалось {%v}, получено {%v}, %v", c.dataType, c.format, c.want, got, err)
+		}
+	}
+
+	for in, want := range map[string]string{"": "", " abcd ": "abcd", "0_1_2_3": "3_2_1_0", "1_0": "0_1", "0_0": "0_0", "x_1": "x_1"} {
+		if got := RTUFormat(in); got != want {
+			t.Fatalf("%q: ожидалось %q, получено %q", in, want, got)
+		}
+	}
+}
+
+func TestPermutations(t *testing.T) {
+
+	for _, c := range []struct {
+		dataType string
+		value    uint64
+	}{
+		{"Word", 0x0201},
+		{"DWord", 0x04030201},
+		{"UInt64", 0x0807060504030201},
+	} {
+		size, _ := FormatSize(c.dataType)
+		perms := permutations(size)
+
+		for _, p := range perms {
+			parts := make([]string, 0, size)
+			for _, n := range p {
+				parts = append(parts, strconv.Itoa(n))
+			}
+			format := strings.Join(parts, "_")
+
+			// байт значения с номером n равен n+1
+			data, err := Encode(strconv.FormatUint(c.value, 10), c.dataType, format)
+			if err != nil {
+				t.Fatalf("%s %s: %v", c.dataType, format, err)
+			}
+			for i, n := range p {
+				if data[i] != byte(n+1) {
+					t.Fatalf("%s %s: байт {%d} ожидался {%d}, получено % x", c.dataType, format, i, n+1, data)
+				}
+			}
+
+			got, err := Decode(data, c.dataType, format)
+			if err != nil || fmt.Sprint(got) != strconv.FormatUint(c.value, 10) {
+				t.Fatalf("%s %s: ожидалось {%d}, получено {%v}, %v", c.dataType, format, c.value, got, err)
+			}
+		}
+
+		if want := map[int]int{2: 2, 4: 24, 8: 40320}[size]; len(perms) != want {
+			t.Fatalf("ожидалось перестановок {%d}, получено {%d}", want, len(perms))
+		}
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+
+	for _, v := range vectors {
+		f.Add(v.data, v.dataType, v.format)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, dataType string, format string) {
+
+		// декодирование произвольных данных не должно приводить к панике
+		v, err := Decode(data, dataType, format)
+		if err != nil {
+			return
+		}
+
+		base, _, _ := SplitType(dataType)
+		switch base {
+		case "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo", "Bit", "String", "Bool":
+			return
+		case "Float":
+			if math.IsNaN(float64(v.(float32))) {
+				return
+			}
+		case "Double":
+			if math.IsNaN(v.(float64)) {
+				return
+			}
+		}
+
+		// обратное кодирование восстанавливает исходные байты
+		size, _ := FormatSize(dataType)
+		enc, err := Encode(fmt.Sprint(v), dataType, format)
+		if err != nil {
+			t.Fatalf("%s %s {%v}: %v", dataType, format, v, err)
+		}
+		if !bytes.Equal(enc, data[:size]) {
+			t.Fatalf("%s %s: ожидалось % x, получено % x", dataType, format, data[:size], enc)
+		}
+	})
+}
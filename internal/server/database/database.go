@@ -1,14 +1,14 @@
 package database
 
 import (
+	"blackbox/internal/server/password"
+	"blackbox/internal/server/role"
 	"blackbox/internal/server/serverAPI"
-	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"os"
 	"time"
-	"unicode/utf8"
 
 	_ "github.com/lib/pq"
 )
@@ -27,7 +27,9 @@ type (
 		Dev   string      // наименование устройства предоставившего данные
 		Name  string      // наименование переменной
 		Value interface{} // значение переменной
-		Qual  byte        // значение качества переменной
+		Qual  uint16      // код качества переменной (quality)
+
+		TimeStamp time.Time // момент получения значения от устройства
 	}
 )
 
@@ -119,18 +121,36 @@ func (db *DB_Object) CreateTables() error {
 	CREATE TABLE IF NOT EXISTS %s.%s (
 		id SERIAL PRIMARY KEY NOT NULL,
 		name VARCHAR(50) UNIQUE NOT NULL,
-		password VARCHAR(64),
-		token VARCHAR(64),
+		password VARCHAR(255),
+		role VARCHAR(20) NOT NULL DEFAULT '%s',
 		timestamp TIMESTAMPTZ DEFAULT NOW()
 	);
 	`, os.Getenv("TABLE_SCHEMA"),
-		os.Getenv("TABLE_USERS"))
+		os.Getenv("TABLE_USERS"),
+		role.Default)
 
 	_, err := db.Ptr.Exec(Q)
 	if err != nil {
 		return fmt.Errorf("ошибка при создании таблицы: %s", err)
 	}
 
+	err = db.UpgradeUsersTable()
+	if err != nil {
+		return err
+	}
+
+	// Создание таблицы - сессии пользователей
+	err = db.CreateTableSessions()
+	if err != nil {
+		return err
+	}
+
+	// Создание таблиц - блокировки входа и события безопасности
+	err = db.CreateTablesSecurity()
+	if err != nil {
+		return err
+	}
+
 	// Создание таблицы - настройки хоста
 	Q = fmt.Sprintf(`
 	CREATE TABLE IF NOT EXISTS %s.%s (
@@ -185,6 +205,19 @@ func (db *DB_Object) CreateTables() error {
 		timeScan VARCHAR(30) NOT NULL,
 		functype VARCHAR(30) NOT NULL,
 		format VARCHAR(30) NOT NULL,
+		deadband VARCHAR(30) NOT NULL DEFAULT '',
+		deadbandpct VARCHAR(30) NOT NULL DEFAULT '',
+		minarchive VARCHAR(30) NOT NULL DEFAULT '',
+		maxarchive VARCHAR(30) NOT NULL DEFAULT '',
+		onchange VARCHAR(30) NOT NULL DEFAULT '',
+		rawmin VARCHAR(30) NOT NULL DEFAULT '',
+		rawmax VARCHAR(30) NOT NULL DEFAULT '',
+		engmin VARCHAR(30) NOT NULL DEFAULT '',
+		engmax VARCHAR(30) NOT NULL DEFAULT '',
+		scalegain VARCHAR(30) NOT NULL DEFAULT '',
+		scaleoffset VARCHAR(30) NOT NULL DEFAULT '',
+		clamp VARCHAR(30) NOT NULL DEFAULT '',
+		unit VARCHAR(30) NOT NULL DEFAULT '',
 		timestamp TIMESTAMPTZ DEFAULT NOW()
 	);
 	`, os.Getenv("TABLE_SCHEMA"),
@@ -200,10 +233,12 @@ func (db *DB_Object) CreateTables() error {
 	CREATE TABLE IF NOT EXISTS %s.%s (
 		id SERIAL PRIMARY KEY NOT NULL,
 		dev VARCHAR(50) NOT NULL,
-		name VARCHAR(50) NOT NULL,
+		name VARCHAR(100) NOT NULL,
 		value NUMERIC NOT NULL,
+		valuetext TEXT,
 		qual NUMERIC NOT NULL,
-		timestamp TIMESTAMPTZ DEFAULT NOW()
+		timestamp TIMESTAMPTZ DEFAULT NOW(),
+		hash VARCHAR(64)
 	);
 	`, os.Getenv("TABLE_SCHEMA"),
 		os.Getenv("TABLE_DATA"))
@@ -213,6 +248,18 @@ func (db *DB_Object) CreateTables() error {
 		return fmt.Errorf("ошибка при создании таблицы: %s", err)
 	}
 
+	// Колонки и таблицы, добавленные в последующих версиях
+	err = db.UpgradeArchiveTables()
+	if err != nil {
+		return err
+	}
+
+	// Создание таблицы - настройки шлюза
+	err = db.CreateTableGateway()
+	if err != nil {
+		return err
+	}
+
 	// Проверка присутствия созданных таблиц
 	_, err = db.CheckTablesExist()
 	if err != nil {
@@ -222,6 +269,194 @@ func (db *DB_Object) CreateTables() error {
 	return nil
 }
 
+// Обновление таблиц архива, созданных ранее: колонки и таблицы, добавленные в последующих версиях
+// (настройки архивирования и масштабирования тэгов, хэш и строковые значения архива, время записи строки,
+// печати архива, журнал записи значений) и ширина колонок имени тэга. Выполняется при каждом запуске,
+// повторное выполнение ничего не меняет. Без таблицы архива (БД ещё не создана) функция ничего не делает.
+// Функция возвращает ошибку.
+func (db *DB_Object) UpgradeArchiveTables() error {
+
+	exist, err := tableExists(db, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"))
+	if err != nil || !exist {
+		return err
+	}
+
+	var Q string
+
+	// Колонки настроек архивирования тэгов: зоны нечувствительности, интервалы, только при изменении
+	err = db.addTagColumns("deadband", "deadbandpct", "minarchive", "maxarchive", "onchange")
+	if err != nil {
+		return err
+	}
+
+	// Колонки масштабирования тэгов
+	err = db.addTagColumns("rawmin", "rawmax", "engmin", "engmax", "scalegain", "scaleoffset", "clamp", "unit")
+	if err != nil {
+		return err
+	}
+
+	// Имя тэга архива - комментарий тэга (колонка comment таблицы тэгов, до 100 символов).
+	// Одно длинное имя отклоняет всю пачку COPY.
+	err = widenColumn(db, os.Getenv("TABLE_DATA"), "name", 100)
+	if err != nil {
+		return fmt.Errorf("ошибка при расширении колонки имени тэга архива: %s", err)
+	}
+
+	// Колонка хэша архива
+	Q = fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS hash VARCHAR(64)",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_DATA"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении колонки хэша: %s", err)
+	}
+
+	// Колонка строковых значений (тип String). У числовых значений - NULL.
+	Q = fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS valuetext TEXT",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_DATA"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении колонки строковых значений: %s", err)
+	}
+
+	err = db.upgradeInsertTime()
+	if err != nil {
+		return err
+	}
+
+	// Создание таблицы - печати архива
+	Q = fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		date DATE PRIMARY KEY NOT NULL,
+		cntrows INTEGER NOT NULL,
+		digest VARCHAR(64) NOT NULL,
+		signature TEXT NOT NULL,
+		publickey TEXT NOT NULL,
+		timestamp TIMESTAMPTZ DEFAULT NOW()
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_SEALS"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	// Создание таблицы - журнал записи значений в устройства
+	Q = fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		id SERIAL PRIMARY KEY NOT NULL,
+		username VARCHAR(50) NOT NULL,
+		dev VARCHAR(50) NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		value TEXT NOT NULL,
+		result TEXT NOT NULL,
+		timestamp TIMESTAMPTZ DEFAULT NOW()
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_WRITES"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	// Имя тэга журнала - комментарий тэга (колонка comment таблицы тэгов, до 100 символов)
+	err = widenColumn(db, os.Getenv("TABLE_WRITES"), "name", 100)
+	if err != nil {
+		return fmt.Errorf("ошибка при расширении колонки имени тэга журнала записи: %s", err)
+	}
+
+	return nil
+}
+
+// Внутренняя функция. Добавление текстовых колонок настроек в таблицу тэгов, созданную ранее.
+// Без таблицы тэгов функция ничего не делает. Функция возвращает ошибку.
+func (db *DB_Object) addTagColumns(cols ...string) error {
+
+	exist, err := tableExists(db, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_TAGS"))
+	if err != nil || !exist {
+		return err
+	}
+
+	for _, col := range cols {
+		Q := fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS %s VARCHAR(30) NOT NULL DEFAULT ''",
+			os.Getenv("TABLE_SCHEMA"),
+			os.Getenv("TABLE_TAGS"),
+			col)
+
+		_, err = db.Ptr.Exec(Q)
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении колонки {%s}: %s", col, err)
+		}
+	}
+
+	return nil
+}
+
+// Внутренняя функция. Колонка времени записи строки в БД (по настройке DB_INSERT_TIME), в дополнение
+// ко времени получения значения драйвером. Функция возвращает ошибку.
+func (db *DB_Object) upgradeInsertTime() error {
+
+	if os.Getenv("DB_INSERT_TIME") != "true" {
+		return nil
+	}
+
+	Q := fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS inserttime TIMESTAMPTZ DEFAULT NOW()",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_DATA"))
+
+	_, err := db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении колонки времени записи: %s", err)
+	}
+
+	return nil
+}
+
+// Создание таблицы настроек шлюза Modbus-TCP, если задано её имя (TABLE_GATEWAY). Таблица необязательна:
+// создаётся также при импорте конфигурации со вкладкой шлюза. Функция возвращает ошибку.
+func (db *DB_Object) CreateTableGateway() error {
+
+	if os.Getenv("TABLE_GATEWAY") == "" {
+		return nil
+	}
+
+	Q := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		id SERIAL PRIMARY KEY NOT NULL,
+		address VARCHAR(50) NOT NULL,
+		port VARCHAR(5) NOT NULL,
+		unitid VARCHAR(3) NOT NULL,
+		datatype VARCHAR(30) NOT NULL,
+		format VARCHAR(30) NOT NULL,
+		timestamp TIMESTAMPTZ DEFAULT NOW()
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_GATEWAY"))
+
+	_, err := db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	return nil
+}
+
+// Проверка присутствия таблицы настроек шлюза. Функция возвращает false, если имя таблицы не задано
+// или таблицы нет.
+func (db *DB_Object) GatewayTableExists() (bool, error) {
+
+	if os.Getenv("TABLE_GATEWAY") == "" {
+		return false, nil
+	}
+
+	return tableExists(db, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_GATEWAY"))
+}
+
 // Внутренняя функция. Проверка присутствия таблицы по её имени.
 func tableExists(db *DB_Object, schema, tableName string) (bool, error) {
 
@@ -245,15 +480,183 @@ func tableExists(db *DB_Object, schema, tableName string) (bool, error) {
 	return true, nil
 }
 
+// Внутренняя функция. Расширение колонки VARCHAR таблицы схемы TABLE_SCHEMA до width символов, если по
+// information_schema она уже. Изменение типа блокирует таблицу, поэтому выполняется только при необходимости.
+// Функция возвращает ошибку.
+func widenColumn(db *DB_Object, tableName, column string, width int) error {
+
+	var size sql.NullInt64
+
+	err := db.Ptr.QueryRow(`SELECT character_maximum_length FROM information_schema.columns
+	WHERE table_schema = $1 AND table_name = $2 AND column_name = $3`,
+		os.Getenv("TABLE_SCHEMA"), tableName, column).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении ширины колонки {%s}: %v", column, err)
+	}
+	if !size.Valid || size.Int64 >= int64(width) {
+		return nil
+	}
+
+	Q := fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s TYPE VARCHAR(%d)",
+		os.Getenv("TABLE_SCHEMA"),
+		tableName,
+		column,
+		width)
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при выполнении запроса: %v", err)
+	}
+
+	return nil
+}
+
+// Обновление таблицы пользователей, созданной ранее: расширение колонки хэша пароля (хэш SHA-256 -
+// 64 символа, хэш argon2id - около 100 символов) и добавление колонки роли. Пользователи получают
+// роль viewer, пользователь admin - роль admin. Функция возвращает ошибку.
+func (db *DB_Object) UpgradeUsersTable() error {
+
+	exist, err := tableExists(db, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_USERS"))
+	if err != nil || !exist {
+		return err
+	}
+
+	Q := fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN password TYPE VARCHAR(255)",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при расширении колонки пароля таблицы пользователей: %s", err)
+	}
+
+	var hasRole bool
+
+	err = db.Ptr.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = 'role')",
+		os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_USERS")).Scan(&hasRole)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке колонки роли таблицы пользователей: %s", err)
+	}
+	if hasRole {
+		return nil
+	}
+
+	Q = fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT '%s'",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"),
+		role.Default)
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении колонки роли таблицы пользователей: %s", err)
+	}
+
+	Q = fmt.Sprintf("UPDATE %s.%s SET role = $1 WHERE name = 'admin'",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"))
+
+	_, err = db.Ptr.Exec(Q, role.Admin)
+	if err != nil {
+		return fmt.Errorf("ошибка при назначении роли пользователю admin: %s", err)
+	}
+
+	return nil
+}
+
+// Создание таблицы сессий пользователей HTTPS сервера (TABLE_SESSIONS), если есть таблица пользователей.
+// Сессии удаляются вместе с пользователем и следуют за изменением его имени. Функция возвращает ошибку.
+func (db *DB_Object) CreateTableSessions() error {
+
+	if os.Getenv("TABLE_SESSIONS") == "" {
+		return errors.New("не задано имя таблицы сессий пользователей TABLE_SESSIONS")
+	}
+
+	exist, err := tableExists(db, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_USERS"))
+	if err != nil || !exist {
+		return err
+	}
+
+	Q := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		id SERIAL PRIMARY KEY NOT NULL,
+		name VARCHAR(50) NOT NULL REFERENCES %s.%s (name) ON UPDATE CASCADE ON DELETE CASCADE,
+		tokenhash VARCHAR(64) UNIQUE NOT NULL,
+		created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires TIMESTAMPTZ NOT NULL,
+		lastused TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		lastip VARCHAR(64) NOT NULL DEFAULT '',
+		revoked BOOLEAN NOT NULL DEFAULT false
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_SESSIONS"),
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	return nil
+}
+
+// Создание таблиц счётчиков неудачных попыток входа (TABLE_LOCKOUTS) и событий безопасности (TABLE_SECURITY).
+// Функция возвращает ошибку.
+func (db *DB_Object) CreateTablesSecurity() error {
+
+	if os.Getenv("TABLE_LOCKOUTS") == "" || os.Getenv("TABLE_SECURITY") == "" {
+		return errors.New("не заданы имена таблиц блокировок входа TABLE_LOCKOUTS и событий безопасности TABLE_SECURITY")
+	}
+
+	Q := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		kind VARCHAR(4) NOT NULL,
+		subject VARCHAR(64) NOT NULL,
+		failures INTEGER NOT NULL DEFAULT 0,
+		lastfail TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		lockeduntil TIMESTAMPTZ,
+		PRIMARY KEY (kind, subject)
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_LOCKOUTS"))
+
+	_, err := db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	Q = fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s.%s (
+		id SERIAL PRIMARY KEY NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		event VARCHAR(30) NOT NULL,
+		username VARCHAR(50) NOT NULL,
+		ip VARCHAR(64) NOT NULL,
+		detail TEXT NOT NULL
+	);
+	`, os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_SECURITY"))
+
+	_, err = db.Ptr.Exec(Q)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы: %s", err)
+	}
+
+	return nil
+}
+
 // Функция создаёт пользователя admin, в таблице пользователей. Возвращается ошибка.
 func (db *DB_Object) AddUserTableDB(name string) error {
 
 	// Добавление пользователя admin
-	Q := fmt.Sprintf("INSERT INTO %s.%s (name, password) VALUES ($1, $2)",
+	Q := fmt.Sprintf("INSERT INTO %s.%s (name, password, role) VALUES ($1, $2, $3)",
 		os.Getenv("TABLE_SCHEMA"),
 		os.Getenv("TABLE_USERS"))
 
-	_, err := db.Ptr.Exec(Q, name, "")
+	_, err := db.Ptr.Exec(Q, name, "", role.Admin)
 	if err != nil {
 		return fmt.Errorf("ошибка добавления пользователя admin: {%v}", err)
 	}
@@ -269,7 +672,7 @@ func (db *DB_Object) CheckSetUserPassword(name string) error {
 		return fmt.Errorf("%v", err)
 	}
 
-	if utf8.RuneCountInString(psw) == 64 {
+	if psw != "" {
 		return nil
 	}
 
@@ -321,18 +724,21 @@ func (db *DB_Object) SetPswUser(name string) error {
 			continue
 		}
 
-		pswHash = fmt.Sprintf("%x", sha256.Sum256([]byte(psw1)))
+		var err error
+		pswHash, err = password.Hash(psw1)
+		if err != nil {
+			fmt.Println("Ошибка при вводе пароля. Повторите попытку.")
+			continue
+		}
 		break
 	}
 	fmt.Println("---")
 
-	q := fmt.Sprintf("UPDATE %s.%s SET password = '%s' WHERE name = '%s'",
+	q := fmt.Sprintf("UPDATE %s.%s SET password = $1 WHERE name = $2",
 		os.Getenv("TABLE_SCHEMA"),
-		os.Getenv("TABLE_USERS"),
-		pswHash,
-		name)
+		os.Getenv("TABLE_USERS"))
 
-	_, err := db.Ptr.Exec(q)
+	_, err := db.Ptr.Exec(q, pswHash, name)
 	if err != nil {
 		return fmt.Errorf("ошибка {%v} при обновлении пароля у пользователя: {%s}", err, name)
 	}
@@ -432,10 +838,10 @@ func ReadDataDBReq(data *serverAPI.DataDBCallT, limit, offset int) (size int, er
 	reqDate := rxDate.Format("2006-01-02")
 
 	q := fmt.Sprintf(`
-	 SELECT name, value, qual, timestamp
+	 SELECT dev, name, COALESCE(valuetext, value::text), qual, timestamp, COALESCE(hash, '')
      FROM %s.%s
      WHERE date(timestamp) = '%v'
-	 ORDER By timestamp ASC
+	 ORDER By timestamp ASC, id ASC
 	 LIMIT %d OFFSET %d
 	 ;              
 	`, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"), reqDate, limit, offset)
@@ -454,7 +860,7 @@ func ReadDataDBReq(data *serverAPI.DataDBCallT, limit, offset int) (size int, er
 	for rows.Next() {
 		var str serverAPI.DataElT
 
-		err = rows.Scan(&str.Name, &str.Value, &str.Qual, &str.TimeStamp)
+		err = rows.Scan(&str.Dev, &str.Name, &str.Value, &str.Qual, &str.TimeStamp, &str.Hash)
 		if err != nil {
 			return 0, err
 		}
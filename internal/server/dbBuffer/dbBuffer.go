@@ -0,0 +1,567 @@
+package dbbuffer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segExt     = ".seg"             // расширение файла сегмента
+	cursorFile = "cursor"           // файл позиции воспроизведения
+	deadFile   = "deadletter.jsonl" // файл карантина: строки, отклонённые БД
+	SegmentMax = 4 * 1024 * 1024    // размер сегмента, после которого запись продолжается в новый сегмент
+)
+
+type (
+	// Строка архива в буфере
+	RecordT struct {
+		Dev       string    `json:"dev"`
+		Name      string    `json:"name"`
+		Value     string    `json:"value"`
+		Text      bool      `json:"text,omitempty"` // строковое значение (тип String)
+		Qual      string    `json:"qual"`
+		TimeStamp time.Time `json:"ts"`
+	}
+
+	// Строка карантина: строка архива, отклонённая БД, с причиной
+	DeadT struct {
+		RecordT
+		Raw    string    `json:"raw,omitempty"` // строка сегмента, которую не удалось разобрать
+		Reason string    `json:"reason"`
+		Time   time.Time `json:"time"` // время помещения в карантин
+	}
+
+	// Буфер строк архива на диске. Строки дописываются в конец сегментов и воспроизводятся в порядке записи.
+	BufferT struct {
+		mu      sync.Mutex
+		dir     string
+		segMax  int64
+		wr      *os.File   // сегмент записи
+		wrSeq   uint64     // номер сегмента записи
+		wrSize  int64      // размер сегмента записи
+		rdSeq   uint64     // номер сегмента воспроизведения
+		rdOff   int64      // смещение воспроизведения в сегменте
+		records int64      // количество невоспроизведённых строк
+		bytes   int64      // объём невоспроизведённых строк
+		deadMu  sync.Mutex // карантин (помещение в карантин возможно при воспроизведении)
+		dead    int64      // количество строк в карантине
+	}
+
+	// Снимок состояния буфера
+	InfoT struct {
+		Records int64 // строк ожидают записи в БД
+		Bytes   int64 // объём строк, ожидающих записи в БД
+		Dead    int64 // строк в карантине (отклонены БД)
+	}
+)
+
+// Открытие буфера. Функция возвращает указатель на буфер и ошибку.
+//
+// Незавершённая запись в конце последнего сегмента (аварийное завершение) отбрасывается.
+//
+// Параметры:
+//
+// dir - директория сегментов
+// segMax - размер сегмента, байт
+func Open(dir string, segMax int64) (*BufferT, error) {
+
+	if dir == "" {
+		return nil, errors.New("не указана директория буфера")
+	}
+	if segMax <= 0 {
+		return nil, fmt.Errorf("недопустимый размер сегмента {%d}", segMax)
+	}
+
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка {%v} создания директории буфера", err)
+	}
+
+	b := &BufferT{
+		dir:    dir,
+		segMax: segMax,
+	}
+
+	segs, err := b.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	// Позиция воспроизведения
+	b.rdSeq, b.rdOff, err = b.readCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	// Удаление воспроизведённых сегментов
+	for len(segs) > 0 && segs[0] < b.rdSeq {
+		err = os.Remove(b.segPath(segs[0]))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка {%v} удаления воспроизведённого сегмента", err)
+		}
+		segs = segs[1:]
+	}
+
+	if len(segs) == 0 {
+		b.wrSeq = b.rdSeq
+		if b.wrSeq == 0 {
+			b.wrSeq = 1
+		}
+		b.rdSeq, b.rdOff = b.wrSeq, 0
+	} else {
+		b.wrSeq = segs[len(segs)-1]
+		if segs[0] > b.rdSeq {
+			b.rdSeq, b.rdOff = segs[0], 0
+		}
+	}
+
+	// Отбрасывание незавершённой записи
+	err = b.repairTail()
+	if err != nil {
+		return nil, err
+	}
+
+	// Подсчёт невоспроизведённых строк
+	for _, seq := range segs {
+		off := int64(0)
+		if seq == b.rdSeq {
+			off = b.rdOff
+		}
+		cnt, size, err := b.count(seq, off)
+		if err != nil {
+			return nil, err
+		}
+		b.records += cnt
+		b.bytes += size
+	}
+
+	// Подсчёт строк карантина
+	data, err := os.ReadFile(filepath.Join(dir, deadFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("ошибка {%v} чтения карантина", err)
+	}
+	b.dead = int64(bytes.Count(data, []byte{'\n'}))
+
+	b.wr, err = os.OpenFile(b.segPath(b.wrSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка {%v} открытия сегмента записи", err)
+	}
+	st, err := b.wr.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка {%v} чтения размера сегмента записи", err)
+	}
+	b.wrSize = st.Size()
+
+	return b, nil
+}
+
+// Закрытие буфера. Функция возвращает ошибку.
+func (b *BufferT) Close() error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.wr == nil {
+		return nil
+	}
+	err := b.wr.Close()
+	b.wr = nil
+	return err
+}
+
+// Дописывание строк в конец буфера. Функция возвращает ошибку.
+//
+// Параметры:
+//
+// recs - строки архива
+func (b *BufferT) Append(recs []RecordT) error {
+
+	if len(recs) == 0 {
+		return nil
+	}
+
+	var data bytes.Buffer
+	for _, r := range recs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} сериализации строки архива", err)
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.wr == nil {
+		return errors.New("буфер закрыт")
+	}
+
+	// Переход к новому сегменту
+	if b.wrSize >= b.segMax {
+		err := b.nextSegment()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := b.wr.Write(data.Bytes())
+	if err == nil {
+		err = b.wr.Sync()
+	}
+	if err != nil {
+		// Неполная запись (нет места, ошибка ввода-вывода) отбрасывается, чтобы в сегменте
+		// не осталось незавершённой строки. При неудаче запись продолжается в новый сегмент.
+		if n > 0 && b.wr.Truncate(b.wrSize) != nil {
+			_ = b.nextSegment()
+		}
+		return fmt.Errorf("ошибка {%v} записи в сегмент", err)
+	}
+
+	b.wrSize += int64(n)
+	b.records += int64(len(recs))
+	b.bytes += int64(n)
+
+	return nil
+}
+
+// Помещение строк в карантин: строки, отклонённые БД (ошибка данных или схемы), не воспроизводятся,
+// а сохраняются с причиной в отдельный файл директории буфера для разбора. Функция возвращает ошибку.
+//
+// Параметры:
+//
+// recs - строки архива
+// reason - причина
+func (b *BufferT) Quarantine(recs []RecordT, reason string) error {
+
+	if len(recs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	var data bytes.Buffer
+	for _, r := range recs {
+		line, err := json.Marshal(DeadT{RecordT: r, Reason: reason, Time: now})
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} сериализации строки карантина", err)
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	b.deadMu.Lock()
+	defer b.deadMu.Unlock()
+
+	err := b.writeDead(data.Bytes())
+	if err != nil {
+		return err
+	}
+	b.dead += int64(len(recs))
+
+	return nil
+}
+
+// Воспроизведение строк буфера в порядке записи. Позиция воспроизведения сдвигается, только если
+// функция обработки не вернула ошибку. Строка сегмента, которую не удалось разобрать, пропускается
+// и помещается в карантин. Функция возвращает количество воспроизведённых строк и ошибку.
+//
+// Параметры:
+//
+// max - наибольшее количество строк за вызов
+// fn - функция обработки строк (запись в БД)
+func (b *BufferT) Replay(max int, fn func(recs []RecordT) error) (int, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.records == 0 {
+		return 0, nil
+	}
+
+	recs := make([]RecordT, 0, max)
+	bad := make([]DeadT, 0)
+	seq, off := b.rdSeq, b.rdOff
+	size := int64(0)
+
+	for len(recs) < max {
+
+		f, err := os.Open(b.segPath(seq))
+		if err != nil {
+			return 0, fmt.Errorf("ошибка {%v} открытия сегмента воспроизведения", err)
+		}
+
+		_, err = f.Seek(off, io.SeekStart)
+		if err != nil {
+			f.Close()
+			return 0, fmt.Errorf("ошибка {%v} позиционирования в сегменте", err)
+		}
+
+		rd := bufio.NewReader(f)
+		for len(recs) < max {
+			line, err := rd.ReadBytes('\n')
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return 0, fmt.Errorf("ошибка {%v} чтения сегмента", err)
+			}
+
+			var r RecordT
+			err = json.Unmarshal(line, &r)
+			if err != nil {
+				bad = append(bad, DeadT{
+					Raw:    string(bytes.TrimSuffix(line, []byte{'\n'})),
+					Reason: fmt.Sprintf("ошибка {%v} разбора строки сегмента {%d}, смещение {%d}", err, seq, off),
+					Time:   time.Now(),
+				})
+			} else {
+				recs = append(recs, r)
+			}
+			off += int64(len(line))
+			size += int64(len(line))
+		}
+		f.Close()
+
+		// Сегмент прочитан полностью, переход к следующему
+		if len(recs) < max && seq < b.wrSeq {
+			seq, off = seq+1, 0
+			continue
+		}
+		break
+	}
+
+	if len(recs) == 0 && len(bad) == 0 {
+		return 0, nil
+	}
+
+	if len(recs) > 0 {
+		err := fn(recs)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Карантин неразобранных строк (после обработки, чтобы повтор не дублировал их)
+	if len(bad) > 0 {
+		var data bytes.Buffer
+		for _, d := range bad {
+			line, err := json.Marshal(d)
+			if err != nil {
+				return 0, fmt.Errorf("ошибка {%v} сериализации строки карантина", err)
+			}
+			data.Write(line)
+			data.WriteByte('\n')
+		}
+
+		b.deadMu.Lock()
+		err := b.writeDead(data.Bytes())
+		if err == nil {
+			b.dead += int64(len(bad))
+		}
+		b.deadMu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Сохранение позиции и удаление воспроизведённых сегментов
+	err := b.writeCursor(seq, off)
+	if err != nil {
+		return 0, err
+	}
+	for s := b.rdSeq; s < seq; s++ {
+		err = os.Remove(b.segPath(s))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("ошибка {%v} удаления воспроизведённого сегмента", err)
+		}
+	}
+
+	b.rdSeq, b.rdOff = seq, off
+	b.records -= int64(len(recs) + len(bad))
+	b.bytes -= size
+
+	return len(recs), nil
+}
+
+// Количество строк, ожидающих записи в БД. Возвращается количество.
+func (b *BufferT) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.records
+}
+
+// Снимок состояния буфера. Возвращается снимок.
+func (b *BufferT) Info() InfoT {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadMu.Lock()
+	defer b.deadMu.Unlock()
+	return InfoT{
+		Records: b.records,
+		Bytes:   b.bytes,
+		Dead:    b.dead,
+	}
+}
+
+// Переход к новому сегменту записи. Функция возвращает ошибку.
+func (b *BufferT) nextSegment() error {
+
+	err := b.wr.Close()
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} закрытия сегмента записи", err)
+	}
+	b.wrSeq++
+	b.wrSize = 0
+	b.wr, err = os.OpenFile(b.segPath(b.wrSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} создания сегмента записи", err)
+	}
+
+	return nil
+}
+
+// Путь к файлу сегмента.
+func (b *BufferT) segPath(seq uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d%s", seq, segExt))
+}
+
+// Номера сегментов в директории по возрастанию. Функция возвращает слайс номеров и ошибку.
+func (b *BufferT) segments() ([]uint64, error) {
+
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка {%v} чтения директории буфера", err)
+	}
+
+	segs := make([]uint64, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, seq)
+	}
+
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i] < segs[j]
+	})
+
+	return segs, nil
+}
+
+// Чтение позиции воспроизведения. Функция возвращает номер сегмента, смещение и ошибку.
+func (b *BufferT) readCursor() (seq uint64, off int64, err error) {
+
+	data, err := os.ReadFile(filepath.Join(b.dir, cursorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка {%v} чтения позиции буфера", err)
+	}
+
+	_, err = fmt.Sscanf(string(data), "%d %d", &seq, &off)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка {%v} разбора позиции буфера", err)
+	}
+
+	return seq, off, nil
+}
+
+// Сохранение позиции воспроизведения (через временный файл). Функция возвращает ошибку.
+func (b *BufferT) writeCursor(seq uint64, off int64) error {
+
+	path := filepath.Join(b.dir, cursorFile)
+	tmp := path + ".tmp"
+
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", seq, off)), 0o640)
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} записи позиции буфера", err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} сохранения позиции буфера", err)
+	}
+
+	return nil
+}
+
+// Дописывание данных в файл карантина. Функция возвращает ошибку.
+func (b *BufferT) writeDead(data []byte) error {
+
+	f, err := os.OpenFile(filepath.Join(b.dir, deadFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} открытия карантина", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} записи в карантин", err)
+	}
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} сброса карантина на диск", err)
+	}
+
+	return nil
+}
+
+// Отбрасывание незавершённой строки в конце сегмента записи. Функция возвращает ошибку.
+func (b *BufferT) repairTail() error {
+
+	path := b.segPath(b.wrSeq)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} чтения сегмента записи", err)
+	}
+
+	keep := bytes.LastIndexByte(data, '\n') + 1
+	if keep == len(data) {
+		return nil
+	}
+
+	err = os.Truncate(path, int64(keep))
+	if err != nil {
+		return fmt.Errorf("ошибка {%v} отбрасывания незавершённой записи сегмента", err)
+	}
+
+	return nil
+}
+
+// Подсчёт строк сегмента от смещения. Функция возвращает количество строк, их объём и ошибку.
+func (b *BufferT) count(seq uint64, off int64) (cnt int64, size int64, err error) {
+
+	data, err := os.ReadFile(b.segPath(seq))
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка {%v} чтения сегмента", err)
+	}
+	if off > int64(len(data)) {
+		return 0, 0, fmt.Errorf("позиция {%d} за пределами сегмента {%d}", off, seq)
+	}
+
+	data = data[off:]
+
+	return int64(bytes.Count(data, []byte{'\n'})), int64(len(data)), nil
+}
@@ -0,0 +1,243 @@
+package dbbuffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRecs(from, n int) []RecordT {
+
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	recs := make([]RecordT, 0, n)
+	for i := from; i < from+n; i++ {
+		recs = append(recs, RecordT{
+			Dev:       "Dev1",
+			Name:      fmt.Sprintf("tag%d", i),
+			Value:     fmt.Sprintf("%d", i),
+			Qual:      "192",
+			TimeStamp: ts.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return recs
+}
+
+func TestReplayInOrderAcrossSegments(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := Open(dir, 200) // малый сегмент - запись в несколько сегментов
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err = b.Append(testRecs(i*3, 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Len() != 30 {
+		t.Fatalf("ожидалось 30 строк, получено {%d}", b.Len())
+	}
+
+	// Ошибка обработки не сдвигает позицию
+	_, err = b.Replay(7, func(recs []RecordT) error { return errors.New("БД недоступна") })
+	if err == nil || b.Len() != 30 {
+		t.Fatalf("позиция сдвинута при ошибке обработки, строк {%d}", b.Len())
+	}
+
+	got := make([]RecordT, 0)
+	for b.Len() > 0 {
+		_, err = b.Replay(7, func(recs []RecordT) error {
+			got = append(got, recs...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := testRecs(0, 30)
+	for i := range want {
+		if got[i].Name != want[i].Name || !got[i].TimeStamp.Equal(want[i].TimeStamp) {
+			t.Fatalf("строка {%d}: ожидалось {%v}, получено {%v}", i, want[i], got[i])
+		}
+	}
+
+	// Воспроизведённые сегменты удалены, кроме сегмента записи
+	segs, err := b.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 1 {
+		t.Fatalf("ожидался 1 сегмент, осталось {%d}", len(segs))
+	}
+	if b.Info().Bytes != 0 {
+		t.Fatalf("ожидался нулевой объём, получено {%d}", b.Info().Bytes)
+	}
+}
+
+func TestReopenKeepsPositionAndDropsTornTail(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := Open(dir, SegmentMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Append(testRecs(0, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Replay(2, func(recs []RecordT) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	// Незавершённая запись при аварийном завершении
+	f, err := os.OpenFile(b.segPath(b.wrSeq), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"dev":"Dev1","na`)
+	f.Close()
+
+	b, err = Open(dir, SegmentMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if b.Len() != 3 {
+		t.Fatalf("ожидалось 3 строки после переоткрытия, получено {%d}", b.Len())
+	}
+
+	err = b.Append(testRecs(5, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	_, err = b.Replay(10, func(recs []RecordT) error {
+		for _, r := range recs {
+			names = append(names, r.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tag2", "tag3", "tag4", "tag5"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Fatalf("ожидалось {%v}, получено {%v}", want, names)
+	}
+}
+
+func TestQuarantineDuringReplay(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := Open(dir, SegmentMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Append(testRecs(0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Строка, отклонённая БД, помещается в карантин при воспроизведении, остальные воспроизводятся
+	n, err := b.Replay(10, func(recs []RecordT) error {
+		return b.Quarantine(recs[1:2], "value too long")
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("ожидалось 3 строки без ошибки, получено {%d}, {%v}", n, err)
+	}
+	if info := b.Info(); info.Records != 0 || info.Dead != 1 {
+		t.Fatalf("ожидался пустой буфер и 1 строка карантина, получено {%+v}", info)
+	}
+	b.Close()
+
+	// Карантин сохраняется при переоткрытии
+	b, err = Open(dir, SegmentMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if info := b.Info(); info.Records != 0 || info.Dead != 1 {
+		t.Fatalf("после переоткрытия ожидалась 1 строка карантина, получено {%+v}", info)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, deadFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d DeadT
+	err = json.Unmarshal(bytes.TrimSpace(data), &d)
+	if err != nil || d.Name != "tag1" || d.Reason != "value too long" {
+		t.Fatalf("неверная строка карантина {%s}: {%v}", data, err)
+	}
+}
+
+func TestReplaySkipsCorruptLine(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := Open(dir, SegmentMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	err = b.Append(testRecs(0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Повреждённая строка между записями (неполная запись, дописанная следующей)
+	_, err = b.wr.WriteString(`{"dev":"Dev1","na` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.records++
+
+	err = b.Append(testRecs(2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ошибка обработки: позиция не сдвигается, строка не помещается в карантин
+	_, err = b.Replay(10, func(recs []RecordT) error { return errors.New("БД недоступна") })
+	if err == nil || b.Info().Dead != 0 {
+		t.Fatalf("ожидалась ошибка без карантина, получено {%v}, {%+v}", err, b.Info())
+	}
+
+	var names []string
+	n, err := b.Replay(10, func(recs []RecordT) error {
+		for _, r := range recs {
+			names = append(names, r.Name)
+		}
+		return nil
+	})
+	if err != nil || n != 4 {
+		t.Fatalf("ожидалось 4 строки без ошибки, получено {%d}, {%v}", n, err)
+	}
+
+	want := []string{"tag0", "tag1", "tag2", "tag3"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Fatalf("ожидалось {%v}, получено {%v}", want, names)
+	}
+	if info := b.Info(); info.Records != 0 || info.Dead != 1 {
+		t.Fatalf("ожидался пустой буфер и 1 строка карантина, получено {%+v}", info)
+	}
+}
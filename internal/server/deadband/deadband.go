@@ -0,0 +1,197 @@
+package deadband
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Настройки архивирования тэга
+	ConfT struct {
+		Abs         float64       // абсолютная зона нечувствительности
+		Pct         float64       // зона нечувствительности в процентах от последнего архивного значения
+		MinInterval time.Duration // наименьший интервал между архивными строками
+		MaxInterval time.Duration // наибольший интервал между архивными строками (строка-пульс)
+		OnChange    bool          // архивирование только при изменении (Bool)
+	}
+
+	// Фильтр архивирования. Пропускает строку в архив, если значение вышло из зоны нечувствительности,
+	// изменилось качество или истёк наибольший интервал.
+	FilterT struct {
+		conf map[string]ConfT
+		last map[string]lastT
+	}
+
+	// Последняя архивная строка тэга
+	lastT struct {
+		value string
+		qual  string
+		ts    time.Time
+	}
+)
+
+// Разбор настроек архивирования тэга. Пустые значения означают отсутствие ограничения.
+// Функция возвращает настройки и ошибку.
+//
+// Параметры:
+//
+// abs - абсолютная зона нечувствительности
+// pct - зона нечувствительности, %
+// minMs - наименьший интервал архивирования, мс
+// maxMs - наибольший интервал архивирования, мс
+// onChange - архивирование только при изменении (true/false)
+func ParseConf(abs, pct, minMs, maxMs, onChange string) (conf ConfT, err error) {
+
+	conf.Abs, err = parseFloat(abs)
+	if err != nil {
+		return ConfT{}, fmt.Errorf("зона нечувствительности {%s}: %v", abs, err)
+	}
+
+	conf.Pct, err = parseFloat(pct)
+	if err != nil {
+		return ConfT{}, fmt.Errorf("зона нечувствительности в процентах {%s}: %v", pct, err)
+	}
+
+	minI, err := parseFloat(minMs)
+	if err != nil {
+		return ConfT{}, fmt.Errorf("наименьший интервал архивирования {%s}: %v", minMs, err)
+	}
+	conf.MinInterval = time.Duration(minI * float64(time.Millisecond))
+
+	maxI, err := parseFloat(maxMs)
+	if err != nil {
+		return ConfT{}, fmt.Errorf("наибольший интервал архивирования {%s}: %v", maxMs, err)
+	}
+	conf.MaxInterval = time.Duration(maxI * float64(time.Millisecond))
+
+	if conf.MaxInterval > 0 && conf.MinInterval > conf.MaxInterval {
+		return ConfT{}, fmt.Errorf("наименьший интервал архивирования {%s} больше наибольшего {%s}", minMs, maxMs)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(onChange)) {
+	case "", "false", "0":
+	case "true", "1":
+		conf.OnChange = true
+	default:
+		return ConfT{}, fmt.Errorf("признак архивирования по изменению {%s}: ожидается true или false", onChange)
+	}
+
+	return conf, nil
+}
+
+// Разбор неотрицательного числа. Пустая строка - 0. Функция возвращает число и ошибку.
+func parseFloat(s string) (float64, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("не число")
+	}
+	if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("ожидается неотрицательное число")
+	}
+
+	return f, nil
+}
+
+// Проверка наличия ограничений архивирования. Возвращает true, если архивируется каждый опрос.
+func (c ConfT) IsZero() bool {
+	return c == ConfT{}
+}
+
+// Создание фильтра. Возвращается указатель на фильтр.
+//
+// Параметры:
+//
+// conf - настройки архивирования по ключу тэга (Key)
+func New(conf map[string]ConfT) *FilterT {
+	return &FilterT{
+		conf: conf,
+		last: make(map[string]lastT),
+	}
+}
+
+// Ключ тэга. Возвращается ключ.
+//
+// Параметры:
+//
+// dev - наименование устройства
+// name - наименование тэга
+func Key(dev, name string) string {
+	return dev + "/" + name
+}
+
+// Проверка необходимости архивирования строки. Возвращает true, если строка записывается в архив.
+//
+// Параметры:
+//
+// key - ключ тэга
+// value - значение в виде строки архива
+// qual - качество в виде строки архива
+// ts - время получения значения
+func (f *FilterT) Pass(key, value, qual string, ts time.Time) bool {
+
+	conf, ok := f.conf[key]
+	if !ok || conf.IsZero() {
+		return true
+	}
+
+	last, ok := f.last[key]
+	if !ok || qual != last.qual || f.pass(conf, last, value, ts) {
+		f.last[key] = lastT{
+			value: value,
+			qual:  qual,
+			ts:    ts,
+		}
+		return true
+	}
+
+	return false
+}
+
+// Проверка интервалов и зоны нечувствительности относительно последней архивной строки.
+func (f *FilterT) pass(conf ConfT, last lastT, value string, ts time.Time) bool {
+
+	elapsed := ts.Sub(last.ts)
+
+	if conf.MinInterval > 0 && elapsed < conf.MinInterval {
+		return false
+	}
+
+	// строка-пульс: отличает отсутствие изменений от отсутствия данных
+	if conf.MaxInterval > 0 && elapsed >= conf.MaxInterval {
+		return true
+	}
+
+	if conf.OnChange {
+		return value != last.value
+	}
+
+	if conf.Abs == 0 && conf.Pct == 0 {
+		return true
+	}
+
+	cur, err1 := strconv.ParseFloat(value, 64)
+	prev, err2 := strconv.ParseFloat(last.value, 64)
+	if err1 != nil || err2 != nil || math.IsNaN(cur) || math.IsNaN(prev) || math.IsInf(cur, 0) || math.IsInf(prev, 0) {
+		return value != last.value
+	}
+
+	diff := math.Abs(cur - prev)
+
+	if conf.Abs > 0 && diff > conf.Abs {
+		return true
+	}
+	if conf.Pct > 0 && diff > math.Abs(prev)*conf.Pct/100 {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package deadband
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPass(t *testing.T) {
+
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sec := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Second) }
+
+	conf, err := ParseConf("0,5", "", "2000", "10000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := New(map[string]ConfT{
+		Key("Dev1", "T"): conf,
+		Key("Dev1", "B"): {OnChange: true},
+	})
+
+	steps := []struct {
+		key, value, qual string
+		ts               time.Time
+		want             bool
+	}{
+		{Key("Dev1", "T"), "10", "192", sec(0), true},    // первое значение
+		{Key("Dev1", "T"), "11", "192", sec(1), false},   // раньше наименьшего интервала
+		{Key("Dev1", "T"), "10.3", "192", sec(3), false}, // в зоне нечувствительности
+		{Key("Dev1", "T"), "10.6", "192", sec(4), true},  // вне зоны
+		{Key("Dev1", "T"), "10.6", "280", sec(5), true},  // изменилось качество
+		{Key("Dev1", "T"), "10.6", "280", sec(15), true}, // строка-пульс
+		{Key("Dev1", "B"), "1", "192", sec(0), true},
+		{Key("Dev1", "B"), "1", "192", sec(1), false},
+		{Key("Dev1", "B"), "0", "192", sec(2), true},
+		{Key("Dev1", "X"), "5", "192", sec(0), true}, // нет настроек - каждый опрос
+		{Key("Dev1", "X"), "5", "192", sec(0), true},
+	}
+
+	for i, s := range steps {
+		if got := f.Pass(s.key, s.value, s.qual, s.ts); got != s.want {
+			t.Fatalf("шаг {%d}: ожидалось {%v}, получено {%v}", i, s.want, got)
+		}
+	}
+}
+
+func TestParseConf_Error(t *testing.T) {
+
+	tests := [][5]string{
+		{"abc", "", "", "", ""},
+		{"", "-1", "", "", ""},
+		{"", "", "5000", "1000", ""},
+		{"", "", "", "", "yes"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseConf(tt[0], tt[1], tt[2], tt[3], tt[4]); err == nil {
+			t.Fatalf("ожидалась ошибка для {%v}", tt)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package diagnostics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"blackbox/internal/server/quality"
+)
+
+type (
+	// Счётчики обмена с устройством
+	CountersT struct {
+		Dev           string  `json:"dev"`           // наименование устройства
+		Requests      uint64  `json:"requests"`      // выполнено запросов
+		Successes     uint64  `json:"successes"`     // успешных запросов
+		Timeouts      uint64  `json:"timeouts"`      // нет ответа
+		CRCErrors     uint64  `json:"crcerrors"`     // ошибка контрольной суммы
+		Exceptions    uint64  `json:"exceptions"`    // исключения Modbus
+		DecodeErrors  uint64  `json:"decodeerrors"`  // ошибки преобразования ответа
+		CommErrors    uint64  `json:"commerrors"`    // прочие ошибки связи
+		Stale         uint64  `json:"stale"`         // пропущено опросов из-за отсутствия подключения
+		AvgResponseMs float64 `json:"avgresponsems"` // среднее время ответа, мс
+		LastQual      uint16  `json:"lastqual"`      // последний код качества
+		LastErr       string  `json:"lasterr"`       // последняя ошибка
+		LastErrTime   string  `json:"lasterrtime"`   // время последней ошибки
+	}
+
+	// Диагностика обмена по устройствам
+	StatT struct {
+		mu   sync.Mutex
+		devs map[string]*devT
+	}
+
+	devT struct {
+		cnt     CountersT
+		sumTime time.Duration
+	}
+)
+
+// Создание диагностики. Возвращается указатель на диагностику.
+func New() *StatT {
+	return &StatT{
+		devs: make(map[string]*devT),
+	}
+}
+
+// Учёт результата опроса.
+//
+// Параметры:
+//
+// dev - наименование устройства
+// qual - код качества результата
+// dur - время выполнения запроса (не учитывается для quality.Stale)
+// err - ошибка запроса (может быть nil)
+func (s *StatT) Add(dev string, qual uint16, dur time.Duration, err error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.devs[dev]
+	if !ok {
+		d = &devT{cnt: CountersT{Dev: dev}}
+		s.devs[dev] = d
+	}
+
+	d.cnt.LastQual = qual
+	if err != nil {
+		d.cnt.LastErr = err.Error()
+		d.cnt.LastErrTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	// Запрос не выполнялся
+	if qual == quality.Stale {
+		d.cnt.Stale++
+		return
+	}
+
+	d.cnt.Requests++
+	d.sumTime += dur
+
+	switch quality.Class(qual) {
+	case quality.ClassGood:
+		d.cnt.Successes++
+	case quality.ClassTimeout:
+		d.cnt.Timeouts++
+	case quality.ClassCRC:
+		d.cnt.CRCErrors++
+	case quality.ClassException:
+		d.cnt.Exceptions++
+	case quality.ClassDecode:
+		d.cnt.DecodeErrors++
+	default:
+		d.cnt.CommErrors++
+	}
+}
+
+// Снимок счётчиков всех устройств. Возвращается слайс, упорядоченный по наименованию устройства.
+func (s *StatT) Snapshot() []CountersT {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]CountersT, 0, len(s.devs))
+	for _, d := range s.devs {
+		c := d.cnt
+		if c.Requests > 0 {
+			c.AvgResponseMs = float64(d.sumTime.Microseconds()) / float64(c.Requests) / 1000
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Dev < res[j].Dev
+	})
+
+	return res
+}
@@ -0,0 +1,92 @@
+package diagnostics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"blackbox/internal/server/quality"
+)
+
+func TestAdd(t *testing.T) {
+
+	type addT struct {
+		qual uint16
+		dur  time.Duration
+		err  error
+	}
+
+	errComm := errors.New("connection reset")
+
+	tests := []struct {
+		name string
+		adds []addT
+		want CountersT
+	}{
+		{"успешные запросы", []addT{{quality.Good, 10 * time.Millisecond, nil}, {quality.Good, 20 * time.Millisecond, nil}},
+			CountersT{Requests: 2, Successes: 2, AvgResponseMs: 15, LastQual: quality.Good}},
+		{"таймаут", []addT{{quality.Timeout, 1500 * time.Millisecond, errComm}},
+			CountersT{Requests: 1, Timeouts: 1, AvgResponseMs: 1500, LastQual: quality.Timeout, LastErr: errComm.Error()}},
+		{"CRC", []addT{{quality.CRC, 4 * time.Millisecond, errComm}},
+			CountersT{Requests: 1, CRCErrors: 1, AvgResponseMs: 4, LastQual: quality.CRC, LastErr: errComm.Error()}},
+		{"исключение", []addT{{quality.Exception(2), 3 * time.Millisecond, errComm}},
+			CountersT{Requests: 1, Exceptions: 1, AvgResponseMs: 3, LastQual: quality.Exception(2), LastErr: errComm.Error()}},
+		{"преобразование", []addT{{quality.BadDecode, 2 * time.Millisecond, errComm}},
+			CountersT{Requests: 1, DecodeErrors: 1, AvgResponseMs: 2, LastQual: quality.BadDecode, LastErr: errComm.Error()}},
+		{"прочая ошибка связи", []addT{{quality.BadComm, 1 * time.Millisecond, errComm}},
+			CountersT{Requests: 1, CommErrors: 1, AvgResponseMs: 1, LastQual: quality.BadComm, LastErr: errComm.Error()}},
+		{"нет подключения", []addT{{quality.Stale, time.Second, errComm}, {quality.Stale, time.Second, nil}},
+			CountersT{Stale: 2, LastQual: quality.Stale, LastErr: errComm.Error()}},
+		{"смешанные", []addT{{quality.Timeout, 900 * time.Microsecond, errComm}, {quality.Stale, time.Second, nil},
+			{quality.Good, 100 * time.Microsecond, nil}},
+			CountersT{Requests: 2, Successes: 1, Timeouts: 1, Stale: 1, AvgResponseMs: 0.5, LastQual: quality.Good, LastErr: errComm.Error()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			for _, a := range tt.adds {
+				s.Add("Dev1", a.qual, a.dur, a.err)
+			}
+
+			snap := s.Snapshot()
+			if len(snap) != 1 {
+				t.Fatalf("ожидалось устройств {1}, получено {%d}", len(snap))
+			}
+			got := snap[0]
+			if (got.LastErrTime != "") != (tt.want.LastErr != "") {
+				t.Fatalf("время последней ошибки {%s} при ошибке {%s}", got.LastErrTime, tt.want.LastErr)
+			}
+			got.LastErrTime = ""
+			tt.want.Dev = "Dev1"
+			if got != tt.want {
+				t.Fatalf("ожидалось %+v, получено %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+
+	s := New()
+	if snap := s.Snapshot(); len(snap) != 0 {
+		t.Fatalf("ожидался пустой снимок, получено %+v", snap)
+	}
+
+	for _, dev := range []string{"Dev3", "Dev1", "Dev2", "Dev1"} {
+		s.Add(dev, quality.Good, time.Millisecond, nil)
+	}
+
+	snap := s.Snapshot()
+	for i, want := range []struct {
+		dev      string
+		requests uint64
+	}{{"Dev1", 2}, {"Dev2", 1}, {"Dev3", 1}} {
+		if i >= len(snap) || snap[i].Dev != want.dev || snap[i].Requests != want.requests {
+			t.Fatalf("ожидалось устройство {%s} с запросами {%d} на позиции {%d}, получено %+v", want.dev, want.requests, i, snap)
+		}
+	}
+	if len(snap) != 3 {
+		t.Fatalf("ожидалось устройств {3}, получено {%d}", len(snap))
+	}
+}
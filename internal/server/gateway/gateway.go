@@ -0,0 +1,519 @@
+package gateway
+
+import (
+	"blackbox/internal/server/codec"
+	"blackbox/internal/server/quality"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Состояния шлюза
+const (
+	StateOff       = "off"       // шлюз не настроен
+	StateListening = "listening" // порт открыт, запросы обслуживаются
+	StateFailed    = "failed"    // порт не открыт
+)
+
+const (
+	maxClients = 16      // наибольшее количество одновременных подключений клиентов
+	maxAge     = 0xFFFF  // возраст значения, которое не обновлялось (или старше), с
+	maxADU     = 260     // наибольший размер кадра Modbus
+	maxRegs    = 0x10000 // размер адресного пространства регистров
+)
+
+type (
+	// Настройки шлюза (вкладка Gateway файла импорта)
+	ConfT struct {
+		Address  string // адрес прослушивания ip:port
+		UnitID   byte   // адрес слейва шлюза
+		DataType string // тип значения в регистрах: Float или Double
+		Format   string // порядок байт значения
+	}
+
+	// Тэг, значение которого предоставляется шлюзом
+	TagT struct {
+		Dev  string // наименование устройства
+		Name string // наименование тэга
+	}
+
+	// Строка карты регистров: адреса тэга (с 0)
+	EntryT struct {
+		Dev     string
+		Name    string
+		Value   uint16 // первый регистр значения
+		Quality uint16 // регистр кода качества
+		Age     uint16 // регистр возраста значения, с
+		Bit     uint16 // дискретный вход (катушка) признака достоверности
+	}
+
+	// Шлюз Modbus-TCP. Предоставляет последние значения тэгов в регистрах хранения и входных регистрах
+	// (одинаковое содержимое), признак достоверности - в дискретных входах и катушках. Только чтение.
+	GatewayT struct {
+		conf   ConfT
+		regs   int // регистров значения
+		stride int // регистров тэга: значение, качество, возраст
+		index  map[TagT]int
+		tags   []TagT
+
+		mu      sync.Mutex
+		values  [][]uint16 // регистры значения по индексу тэга
+		quals   []uint16
+		updated []time.Time
+
+		state      string
+		lastErr    string
+		since      time.Time
+		addr       string
+		clients    int
+		requests   uint64
+		exceptions uint64
+	}
+
+	// Снимок состояния шлюза
+	InfoT struct {
+		State      string // состояние
+		Address    string // адрес прослушивания
+		Tags       int    // количество тэгов
+		Clients    int    // подключено клиентов
+		Requests   uint64 // обслужено запросов
+		Exceptions uint64 // ответов исключением
+		LastErr    string // последняя ошибка
+		Since      string // время перехода в текущее состояние
+	}
+)
+
+// Разбор настроек шлюза из строки вкладки Gateway. Функция возвращает настройки и ошибку.
+//
+// Параметры:
+//
+// address - IP адрес прослушивания (пусто - все интерфейсы)
+// port - порт
+// unitID - адрес слейва 1..247
+// dataType - тип значения: Float, Double (пусто - Float)
+// format - порядок байт значения (пусто - ABCD)
+func ParseConf(address, port, unitID, dataType, format string) (ConfT, error) {
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 {
+		return ConfT{}, fmt.Errorf("шлюз: порт {%s} вне диапазона 1..65535", port)
+	}
+	if address != "" && net.ParseIP(address) == nil {
+		return ConfT{}, fmt.Errorf("шлюз: адрес {%s} не IP адрес", address)
+	}
+
+	id, err := strconv.ParseUint(unitID, 10, 8)
+	if err != nil || id < 1 || id > 247 {
+		return ConfT{}, fmt.Errorf("шлюз: адрес слейва {%s} вне диапазона 1..247", unitID)
+	}
+
+	if dataType == "" {
+		dataType = "Float"
+	}
+	if dataType != "Float" && dataType != "Double" {
+		return ConfT{}, fmt.Errorf("шлюз: тип значения {%s}, ожидается Float или Double", dataType)
+	}
+
+	if format == "" {
+		format = "ABCD"
+	}
+	size, _ := codec.FormatSize(dataType)
+	if _, err := codec.ParseFormat(format, size); err != nil {
+		return ConfT{}, fmt.Errorf("шлюз: %v", err)
+	}
+
+	return ConfT{
+		Address:  net.JoinHostPort(address, port),
+		UnitID:   byte(id),
+		DataType: dataType,
+		Format:   format,
+	}, nil
+}
+
+// Создание шлюза. Карта регистров строится по порядку тэгов. Функция возвращает шлюз и ошибку,
+// если тэги не помещаются в адресное пространство Modbus.
+//
+// Параметры:
+//
+// conf - настройки шлюза
+// tags - тэги чтения
+func New(conf ConfT, tags []TagT) (*GatewayT, error) {
+
+	regs, err := codec.Regs(conf.DataType)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GatewayT{
+		conf:    conf,
+		regs:    regs,
+		stride:  regs + 2,
+		index:   make(map[TagT]int, len(tags)),
+		tags:    tags,
+		values:  make([][]uint16, len(tags)),
+		quals:   make([]uint16, len(tags)),
+		updated: make([]time.Time, len(tags)),
+		state:   StateFailed,
+		since:   time.Now(),
+	}
+
+	if len(tags)*g.stride > maxRegs {
+		return nil, fmt.Errorf("шлюз: тэгов {%d} не помещается в %d регистров", len(tags), maxRegs)
+	}
+
+	// значения до первого опроса: NaN, нет подключения
+	for i, t := range tags {
+		if _, ok := g.index[t]; ok {
+			return nil, fmt.Errorf("шлюз: тэг {%s/%s} повторяется", t.Dev, t.Name)
+		}
+		g.index[t] = i
+		g.values[i] = g.encode(math.NaN())
+		g.quals[i] = quality.BadNotConnected
+	}
+
+	return g, nil
+}
+
+// Карта регистров шлюза. Возвращаются строки карты в порядке тэгов.
+func (g *GatewayT) Map() []EntryT {
+
+	res := make([]EntryT, 0, len(g.tags))
+	for i, t := range g.tags {
+		base := uint16(i * g.stride)
+		res = append(res, EntryT{
+			Dev:     t.Dev,
+			Name:    t.Name,
+			Value:   base,
+			Quality: base + uint16(g.regs),
+			Age:     base + uint16(g.regs) + 1,
+			Bit:     uint16(i),
+		})
+	}
+
+	return res
+}
+
+// Обновление значения тэга. Значения тэгов, не входящих в карту, пропускаются.
+//
+// Параметры:
+//
+// dev - наименование устройства
+// name - наименование тэга
+// value - значение
+// qual - код качества
+// ts - момент получения значения
+func (g *GatewayT) Update(dev, name string, value interface{}, qual uint16, ts time.Time) {
+
+	if g == nil {
+		return
+	}
+
+	i, ok := g.index[TagT{Dev: dev, Name: name}]
+	if !ok {
+		return
+	}
+	regs := g.encode(toFloat(value))
+
+	g.mu.Lock()
+	g.values[i] = regs
+	g.quals[i] = qual
+	g.updated[i] = ts
+	g.mu.Unlock()
+}
+
+// Регистры значения в типе и формате шлюза. Возвращаются регистры.
+func (g *GatewayT) encode(v float64) []uint16 {
+
+	bitSize := 64
+	if g.conf.DataType == "Float" {
+		bitSize = 32
+	}
+
+	b, err := codec.Encode(strconv.FormatFloat(v, 'g', -1, bitSize), g.conf.DataType, g.conf.Format)
+	if err != nil {
+		// за пределами диапазона Float
+		b, _ = codec.Encode(strconv.FormatFloat(math.Copysign(math.Inf(1), v), 'g', -1, bitSize), g.conf.DataType, g.conf.Format)
+	}
+
+	return codec.Registers(b)
+}
+
+// Приведение значения тэга к числу. У строк - NaN. Возвращается число.
+func toFloat(value interface{}) float64 {
+
+	switch v := value.(type) {
+	case byte:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return math.NaN()
+	}
+}
+
+// Работа шлюза: открытие порта и обслуживание клиентов до завершения контекста. Функция возвращает
+// ошибку открытия порта.
+//
+// Параметры:
+//
+// ctx - контекст завершения
+func (g *GatewayT) Run(ctx context.Context) error {
+
+	ln, err := net.Listen("tcp", g.conf.Address)
+	if err != nil {
+		g.set(StateFailed, err)
+		return fmt.Errorf("шлюз: %v", err)
+	}
+	g.set(StateListening, nil)
+
+	g.mu.Lock()
+	g.addr = ln.Addr().String()
+	g.mu.Unlock()
+
+	var (
+		wg    sync.WaitGroup
+		muCon sync.Mutex
+		conns = make(map[net.Conn]struct{})
+	)
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+		muCon.Lock()
+		for c := range conns {
+			_ = c.Close()
+		}
+		muCon.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			g.set(StateFailed, err)
+			return fmt.Errorf("шлюз: %v", err)
+		}
+
+		muCon.Lock()
+		if len(conns) >= maxClients {
+			muCon.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		conns[conn] = struct{}{}
+		muCon.Unlock()
+
+		g.clientsAdd(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer g.clientsAdd(-1)
+
+			err := g.serve(conn)
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				g.mu.Lock()
+				g.lastErr = fmt.Sprintf("%s: %v", conn.RemoteAddr(), err)
+				g.mu.Unlock()
+			}
+
+			muCon.Lock()
+			delete(conns, conn)
+			muCon.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// Обслуживание подключения клиента кадрами Modbus-TCP. Возвращается ошибка потока.
+func (g *GatewayT) serve(rw io.ReadWriter) error {
+
+	head := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(rw, head); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(head[4:]))
+		if binary.BigEndian.Uint16(head[2:]) != 0 || length < 2 || length > maxADU-6 {
+			return fmt.Errorf("неверный заголовок кадра % x", head)
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(rw, pdu); err != nil {
+			return err
+		}
+
+		res := g.handle(head[6], pdu, time.Now())
+
+		adu := make([]byte, 0, 7+len(res))
+		adu = append(adu, head[:4]...)
+		adu = binary.BigEndian.AppendUint16(adu, uint16(1+len(res)))
+		adu = append(adu, head[6])
+		if _, err := rw.Write(append(adu, res...)); err != nil {
+			return err
+		}
+	}
+}
+
+// Обработка запроса. Возвращается PDU ответа.
+//
+// Параметры:
+//
+// unit - адрес слейва запроса
+// pdu - PDU запроса
+// now - текущее время (для возраста значений)
+func (g *GatewayT) handle(unit byte, pdu []byte, now time.Time) []byte {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.requests++
+	fn := pdu[0]
+
+	exception := func(code byte) []byte {
+		g.exceptions++
+		return []byte{fn | 0x80, code}
+	}
+
+	if unit != g.conf.UnitID {
+		return exception(modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+	}
+
+	switch fn {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs,
+		modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+	default:
+		// шлюз только для чтения
+		return exception(modbus.ExceptionCodeIllegalFunction)
+	}
+
+	if len(pdu) != 5 {
+		return exception(modbus.ExceptionCodeIllegalDataValue)
+	}
+	address := int(binary.BigEndian.Uint16(pdu[1:]))
+	quantity := int(binary.BigEndian.Uint16(pdu[3:]))
+
+	switch fn {
+
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		if quantity < 1 || quantity > 2000 {
+			return exception(modbus.ExceptionCodeIllegalDataValue)
+		}
+		if address+quantity > len(g.tags) {
+			return exception(modbus.ExceptionCodeIllegalDataAddress)
+		}
+		res := make([]byte, 2+(quantity+7)/8)
+		res[0], res[1] = fn, byte((quantity+7)/8)
+		for i := range quantity {
+			if quality.Class(g.quals[address+i]) == quality.ClassGood {
+				res[2+i/8] |= 1 << (i % 8)
+			}
+		}
+		return res
+
+	default:
+		if quantity < 1 || quantity > 125 {
+			return exception(modbus.ExceptionCodeIllegalDataValue)
+		}
+		if address+quantity > len(g.tags)*g.stride {
+			return exception(modbus.ExceptionCodeIllegalDataAddress)
+		}
+		res := []byte{fn, byte(2 * quantity)}
+		for a := address; a < address+quantity; a++ {
+			res = binary.BigEndian.AppendUint16(res, g.register(a, now))
+		}
+		return res
+	}
+}
+
+// Значение регистра карты. Вызывается под блокировкой. Возвращается значение.
+func (g *GatewayT) register(address int, now time.Time) uint16 {
+
+	i, off := address/g.stride, address%g.stride
+
+	switch {
+	case off < g.regs:
+		return g.values[i][off]
+	case off == g.regs:
+		return g.quals[i]
+	default:
+		if g.updated[i].IsZero() {
+			return maxAge
+		}
+		return uint16(min(max(now.Sub(g.updated[i])/time.Second, 0), maxAge))
+	}
+}
+
+// Изменение количества подключённых клиентов.
+func (g *GatewayT) clientsAdd(n int) {
+
+	g.mu.Lock()
+	g.clients += n
+	g.mu.Unlock()
+}
+
+// Установка состояния.
+func (g *GatewayT) set(state string, err error) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state != state {
+		g.since = time.Now()
+	}
+	g.state = state
+	if err != nil {
+		g.lastErr = err.Error()
+	}
+}
+
+// Снимок состояния. Возвращается снимок.
+func (g *GatewayT) Info() InfoT {
+
+	if g == nil {
+		return InfoT{State: StateOff}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	info := InfoT{
+		State:      g.state,
+		Address:    g.conf.Address,
+		Tags:       len(g.tags),
+		Clients:    g.clients,
+		Requests:   g.requests,
+		Exceptions: g.exceptions,
+		LastErr:    g.lastErr,
+		Since:      g.since.Format("2006-01-02 15:04:05"),
+	}
+	if g.addr != "" {
+		info.Address = g.addr
+	}
+
+	return info
+}
@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"blackbox/internal/server/quality"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+var testTags = []TagT{{"Dev1", "T1"}, {"Dev1", "T2"}, {"Dev2", "T1"}}
+
+func TestParseConf(t *testing.T) {
+
+	conf, err := ParseConf("", "1502", "3", "", "")
+	want := ConfT{Address: ":1502", UnitID: 3, DataType: "Float", Format: "ABCD"}
+	if err != nil || conf != want {
+		t.Fatalf("ожидалось {%+v}, получено {%+v}, %v", want, conf, err)
+	}
+
+	for _, c := range [][5]string{
+		{"", "0", "1", "", ""},
+		{"host", "502", "1", "", ""},
+		{"", "502", "248", "", ""},
+		{"", "502", "1", "Word", ""},
+		{"", "502", "1", "Double", "1_0_3_2"},
+	} {
+		if _, err := ParseConf(c[0], c[1], c[2], c[3], c[4]); err == nil {
+			t.Fatalf("%v: ожидалась ошибка", c)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+
+	g, err := New(ConfT{UnitID: 1, DataType: "Double", Format: "ABCD"}, testTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := g.Map()
+	if want := (EntryT{Dev: "Dev2", Name: "T1", Value: 12, Quality: 16, Age: 17, Bit: 2}); m[2] != want {
+		t.Fatalf("ожидалось {%+v}, получено {%+v}", want, m[2])
+	}
+
+	if _, err := New(ConfT{UnitID: 1, DataType: "Float", Format: "ABCD"}, []TagT{{"D", "T"}, {"D", "T"}}); err == nil {
+		t.Fatal("ожидалась ошибка повтора тэга")
+	}
+	if _, err := New(ConfT{UnitID: 1, DataType: "Float", Format: "ABCD"}, make([]TagT, 16385)); err == nil {
+		t.Fatal("ожидалась ошибка размера карты")
+	}
+}
+
+func TestHandle(t *testing.T) {
+
+	g, err := New(ConfT{UnitID: 1, DataType: "Float", Format: "CDAB"}, testTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	g.Update("Dev1", "T1", float64(1.5), quality.Good, now.Add(-3*time.Second))
+	g.Update("Dev1", "T2", int16(-2), quality.Timeout, now)
+	g.Update("Dev3", "T1", 1, quality.Good, now) // нет в карте
+
+	tests := []struct {
+		unit      byte
+		req, want []byte
+	}{
+		// 1.5 = 0x3FC00000 в формате CDAB, качество, возраст
+		{1, []byte{3, 0, 0, 0, 4}, []byte{3, 8, 0, 0, 0x3F, 0xC0, 0, 0xC0, 0, 3}},
+		{1, []byte{4, 0, 4, 0, 4}, []byte{4, 8, 0, 0, 0xC0, 0, 0x01, 0x18, 0, 0}},
+		// не обновлявшееся значение: NaN, нет подключения, возраст наибольший
+		{1, []byte{3, 0, 8, 0, 4}, []byte{3, 8, 0, 0, 0x7F, 0xC0, 0, 0x08, 0xFF, 0xFF}},
+		{1, []byte{2, 0, 0, 0, 3}, []byte{2, 1, 1}},
+		{1, []byte{3, 0, 11, 0, 2}, []byte{0x83, 2}},
+		{1, []byte{1, 0, 2, 0, 2}, []byte{0x81, 2}},
+		{1, []byte{3, 0, 0, 0, 126}, []byte{0x83, 3}},
+		{1, []byte{6, 0, 0, 0, 1}, []byte{0x86, 1}},
+		{2, []byte{3, 0, 0, 0, 1}, []byte{0x83, 0x0B}},
+	}
+
+	for _, tt := range tests {
+		got := g.handle(tt.unit, tt.req, now)
+		if !slices.Equal(got, tt.want) {
+			t.Fatalf("% x: ожидалось % x, получено % x", tt.req, tt.want, got)
+		}
+	}
+
+	if info := g.Info(); info.Requests != uint64(len(tests)) || info.Exceptions != 5 {
+		t.Fatalf("счётчики: %+v", info)
+	}
+}
+
+func TestToFloat(t *testing.T) {
+
+	for _, v := range []interface{}{byte(1), uint16(1), int16(1), uint32(1), int32(1), uint64(1), int64(1), float32(1), float64(1)} {
+		if toFloat(v) != 1 {
+			t.Fatalf("%T: ожидалось 1", v)
+		}
+	}
+	if !math.IsNaN(toFloat("text")) {
+		t.Fatal("строка: ожидалось NaN")
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	// свободный порт
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	_ = ln.Close()
+
+	g, err := New(ConfT{Address: address, UnitID: 1, DataType: "Float", Format: "ABCD"}, testTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Update("Dev2", "T1", uint16(7), quality.Good, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- g.Run(ctx) }()
+
+	h := modbus.NewTCPClientHandler(address)
+	h.SlaveId = 1
+	h.Timeout = time.Second
+	client := modbus.NewClient(h)
+
+	var res []byte
+	for range 50 {
+		res, err = client.ReadHoldingRegisters(8, 2)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil || !slices.Equal(res, []byte{0x40, 0xE0, 0, 0}) {
+		t.Fatalf("ожидалось 40 e0 00 00, получено % x, %v", res, err)
+	}
+
+	var exc *modbus.ModbusError
+	if _, err := client.WriteSingleRegister(0, 1); !errors.As(err, &exc) || exc.ExceptionCode != 1 {
+		t.Fatalf("ожидалось исключение 01, получено {%v}", err)
+	}
+
+	if info := g.Info(); info.State != StateListening || info.Clients != 1 {
+		t.Fatalf("состояние: %+v", info)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	_ = h.Close()
+
+	if info := (*GatewayT)(nil).Info(); info.State != StateOff {
+		t.Fatalf("ожидалось состояние off, получено %s", info.State)
+	}
+}
@@ -0,0 +1,304 @@
+package hashchain
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// Строка архива, участвующая в цепочке хэшей
+	RowT struct {
+		Id        int       // номер строки в БД
+		Dev       string    // наименование устройства
+		Name      string    // наименование переменной
+		Value     string    // значение в каноническом виде
+		Qual      string    // качество в каноническом виде
+		TimeStamp time.Time // временная метка
+		Hash      string    // хэш строки
+	}
+
+	// Результат проверки цепочки
+	ResultT struct {
+		DateStart       string `json:"datestart"`
+		DateEnd         string `json:"dateend"`
+		CntRows         int    `json:"cntrows"`
+		Legacy          int    `json:"legacy"` // строки без хэша, записанные до начала цепочки (не проверяются)
+		Ok              bool   `json:"ok"`
+		BrokenId        int    `json:"brokenid"`
+		BrokenTimeStamp string `json:"brokentimestamp"`
+		Reason          string `json:"reason"`
+	}
+)
+
+// Хэш предшествующий первой строке архива
+const Genesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Приведение значения переменной к каноническому виду. Возвращается строка.
+//
+// Строка передаётся в БД как есть, поэтому значение в БД и значение в хэше совпадают.
+//
+// Параметры:
+//
+// v - значение переменной
+func FormatValue(v interface{}) string {
+
+	var s string
+
+	switch val := v.(type) {
+	case float32:
+		s = formatFloat(float64(val), 32)
+	case float64:
+		s = formatFloat(val, 64)
+	case string:
+		s = val
+	default:
+		s = fmt.Sprintf("%d", val)
+	}
+
+	// NUMERIC не хранит знак нуля
+	if s == "-0" {
+		s = "0"
+	}
+
+	return s
+}
+
+// Приведение числа с плавающей точкой к виду, принимаемому NUMERIC. Возвращается строка.
+func formatFloat(f float64, bitSize int) string {
+
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, bitSize)
+}
+
+// Приведение временной метки к точности БД. Возвращается временная метка.
+//
+// Параметры:
+//
+// t - временная метка
+func TruncTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// Каноническое представление содержимого строки архива. Возвращается строка.
+//
+// Каждое поле предваряется длинной, чтобы исключить перенос символов между полями.
+//
+// Параметры:
+//
+// row - строка архива
+func Canonical(row RowT) string {
+
+	var b strings.Builder
+
+	for _, f := range []string{
+		row.Dev,
+		row.Name,
+		row.Value,
+		row.Qual,
+		TruncTime(row.TimeStamp).Format("2006-01-02T15:04:05.000000Z"),
+	} {
+		fmt.Fprintf(&b, "%d:%s;", len(f), f)
+	}
+
+	return b.String()
+}
+
+// Вычисление хэша строки архива. Возвращается хэш.
+//
+// Параметры:
+//
+// prev - хэш предыдущей строки
+// row - строка архива
+func CalcHash(prev string, row RowT) string {
+
+	s := fmt.Sprintf("%d:%s;", len(prev), prev) + Canonical(row)
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// Чтение хэша последней строки архива. Возвращается хэш и ошибка.
+//
+// Если архив пуст, возвращается Genesis.
+//
+// Параметры:
+//
+// db - указатель на БД
+func LastHashDB(db *sql.DB) (hash string, err error) {
+
+	if db == nil {
+		return "", errors.New("чтение последнего хэша -> нет указателя на БД")
+	}
+
+	q := fmt.Sprintf("SELECT COALESCE(hash, '') FROM %s.%s ORDER BY id DESC LIMIT 1",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_DATA"))
+
+	err = db.QueryRow(q).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Genesis, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("чтение последнего хэша -> ошибка: {%v}", err)
+	}
+
+	return hash, nil
+}
+
+// Проверка цепочки хэшей архива за период. Возвращается результат проверки и ошибка.
+//
+// Строки проверяются в порядке записи (по id), начиная с первой строки начальной даты
+// и заканчивая последней строкой конечной даты. Строки без хэша, записанные до первой строки цепочки
+// (архив до включения цепочки), разрывом не считаются и подсчитываются отдельно.
+//
+// Параметры:
+//
+// db - указатель на БД
+// dateStart - начальная дата (YYYY-MM-DD)
+// dateEnd - конечная дата (YYYY-MM-DD)
+func VerifyDB(db *sql.DB, dateStart, dateEnd string) (res ResultT, err error) {
+
+	// Проверка аргументов
+	if db == nil {
+		return ResultT{}, errors.New("проверка цепочки -> нет указателя на БД")
+	}
+	tStart, err := time.Parse("2006-01-02", dateStart)
+	if err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> начальная дата {%s} не в формате YYYY-MM-DD", dateStart)
+	}
+	tEnd, err := time.Parse("2006-01-02", dateEnd)
+	if err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> конечная дата {%s} не в формате YYYY-MM-DD", dateEnd)
+	}
+	if tEnd.Before(tStart) {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> конечная дата {%s} раньше начальной {%s}", dateEnd, dateStart)
+	}
+
+	res.DateStart = dateStart
+	res.DateEnd = dateEnd
+
+	schema := os.Getenv("TABLE_SCHEMA")
+	table := os.Getenv("TABLE_DATA")
+
+	// Границы проверяемого участка цепочки
+	var minId, maxId sql.NullInt64
+
+	q := fmt.Sprintf("SELECT MIN(id), MAX(id) FROM %s.%s WHERE date(timestamp) BETWEEN $1 AND $2", schema, table)
+
+	err = db.QueryRow(q, dateStart, dateEnd).Scan(&minId, &maxId)
+	if err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка определения границ: {%v}", err)
+	}
+
+	// Нет данных за период
+	if !minId.Valid {
+		res.Ok = true
+		return res, nil
+	}
+
+	// Начало цепочки: первая строка архива с хэшем. Строки ранее неё - архив до включения цепочки.
+	var chainId sql.NullInt64
+
+	q = fmt.Sprintf("SELECT MIN(id) FROM %s.%s WHERE hash IS NOT NULL AND hash <> ''", schema, table)
+
+	err = db.QueryRow(q).Scan(&chainId)
+	if err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка определения начала цепочки: {%v}", err)
+	}
+
+	if !chainId.Valid || chainId.Int64 > minId.Int64 {
+		q = fmt.Sprintf("SELECT COUNT(*) FROM %s.%s WHERE id BETWEEN $1 AND $2", schema, table)
+
+		last := maxId.Int64
+		if chainId.Valid && chainId.Int64-1 < last {
+			last = chainId.Int64 - 1
+		}
+
+		err = db.QueryRow(q, minId.Int64, last).Scan(&res.Legacy)
+		if err != nil {
+			return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка подсчёта строк до начала цепочки: {%v}", err)
+		}
+
+		// Весь участок до начала цепочки
+		if !chainId.Valid || chainId.Int64 > maxId.Int64 {
+			res.Ok = true
+			return res, nil
+		}
+		minId = chainId
+	}
+
+	// Хэш строки, предшествующей участку
+	prev := Genesis
+
+	q = fmt.Sprintf("SELECT COALESCE(hash, '') FROM %s.%s WHERE id < $1 ORDER BY id DESC LIMIT 1", schema, table)
+
+	err = db.QueryRow(q, minId.Int64).Scan(&prev)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка чтения предшествующего хэша: {%v}", err)
+	}
+
+	// Проход по строкам участка
+	q = fmt.Sprintf(`
+	SELECT id, dev, name, COALESCE(valuetext, value::text), qual::text, timestamp, COALESCE(hash, '')
+	FROM %s.%s
+	WHERE id BETWEEN $1 AND $2
+	ORDER BY id ASC
+	;`, schema, table)
+
+	rows, err := db.Query(q, minId.Int64, maxId.Int64)
+	if err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка запроса строк: {%v}", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var row RowT
+
+		err = rows.Scan(&row.Id, &row.Dev, &row.Name, &row.Value, &row.Qual, &row.TimeStamp, &row.Hash)
+		if err != nil {
+			return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка чтения строки: {%v}", err)
+		}
+		res.CntRows++
+
+		// Поиск первого разрыва
+		reason := ""
+		switch {
+		case row.Hash == "":
+			reason = "у строки нет хэша"
+		case row.Hash != CalcHash(prev, row):
+			reason = "хэш строки не соответствует содержимому или предыдущей строке"
+		}
+
+		if reason != "" {
+			res.Ok = false
+			res.BrokenId = row.Id
+			res.BrokenTimeStamp = row.TimeStamp.Format(time.RFC3339Nano)
+			res.Reason = reason
+			return res, nil
+		}
+
+		prev = row.Hash
+	}
+
+	if err = rows.Err(); err != nil {
+		return ResultT{}, fmt.Errorf("проверка цепочки -> ошибка сканера строк: {%v}", err)
+	}
+
+	res.Ok = true
+	return res, nil
+}
@@ -0,0 +1,125 @@
+package hashchain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatValue(t *testing.T) {
+
+	for _, tt := range []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"NaN float64", math.NaN(), "NaN"},
+		{"NaN float32", float32(math.NaN()), "NaN"},
+		{"+Inf", math.Inf(1), "Infinity"},
+		{"-Inf", float32(math.Inf(-1)), "-Infinity"},
+		{"-0 float64", math.Copysign(0, -1), "0"},
+		{"-0 float32", float32(math.Copysign(0, -1)), "0"},
+		{"float32 кратчайший вид", float32(0.1), "0.1"},
+		{"float64 из float32", float64(float32(0.1)), "0.10000000149011612"},
+		{"float64 без экспоненты", 1e21, "1000000000000000000000"},
+		{"float64 дробное", -12.5, "-12.5"},
+		{"int", 42, "42"},
+		{"int16 отрицательное", int16(-7), "-7"},
+		{"uint32", uint32(4294967295), "4294967295"},
+		{"строка", "abc", "abc"},
+		{"пустая строка", "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatValue(tt.v); got != tt.want {
+				t.Errorf("ожидалось %q, получено %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+
+	row := RowT{Dev: "Dev1", Name: "Temp", Value: "21.5", Qual: "1", TimeStamp: ts}
+	want := "4:Dev1;4:Temp;4:21.5;1:1;27:2024-05-01T10:00:00.123456Z;"
+	if got := Canonical(row); got != want {
+		t.Fatalf("ожидалось %q, получено %q", want, got)
+	}
+
+	// Перенос символов между полями меняет представление
+	for _, tt := range []struct {
+		name string
+		a, b RowT
+	}{
+		{"dev/name", RowT{Dev: "ab", Name: "c", TimeStamp: ts}, RowT{Dev: "a", Name: "bc", TimeStamp: ts}},
+		{"name/value", RowT{Name: "ab", Value: "c", TimeStamp: ts}, RowT{Name: "a", Value: "bc", TimeStamp: ts}},
+		{"value/qual", RowT{Value: "1;", Qual: "2", TimeStamp: ts}, RowT{Value: "1", Qual: ";2", TimeStamp: ts}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if Canonical(tt.a) == Canonical(tt.b) {
+				t.Errorf("совпали представления %q", Canonical(tt.a))
+			}
+		})
+	}
+
+	// Метки, различающиеся менее чем на микросекунду, дают одно представление
+	a := time.Date(2024, 5, 1, 13, 0, 0, 123456001, time.FixedZone("MSK", 3*60*60))
+	b := time.Date(2024, 5, 1, 10, 0, 0, 123456999, time.UTC)
+	if Canonical(RowT{TimeStamp: a}) != Canonical(RowT{TimeStamp: b}) {
+		t.Error("представления меток в пределах микросекунды различаются")
+	}
+}
+
+func TestCalcHash(t *testing.T) {
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	row := RowT{Dev: "Dev1", Name: "Temp", Value: "21.5", Qual: "1", TimeStamp: ts}
+
+	h := CalcHash(Genesis, row)
+	if len(h) != 64 {
+		t.Fatalf("ожидался хэш из 64 символов, получено %q", h)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		prev  string
+		row   RowT
+		equal bool
+	}{
+		{"повторный расчёт", Genesis, row, true},
+		{"номер и хэш строки не участвуют", Genesis, RowT{Id: 7, Dev: "Dev1", Name: "Temp", Value: "21.5", Qual: "1", TimeStamp: ts, Hash: "x"}, true},
+		{"другой предыдущий хэш", h, row, false},
+		{"пустой предыдущий хэш", "", row, false},
+		{"другое значение", Genesis, RowT{Dev: "Dev1", Name: "Temp", Value: "21.6", Qual: "1", TimeStamp: ts}, false},
+		{"другое время", Genesis, RowT{Dev: "Dev1", Name: "Temp", Value: "21.5", Qual: "1", TimeStamp: ts.Add(time.Microsecond)}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalcHash(tt.prev, tt.row); (got == h) != tt.equal {
+				t.Errorf("совпадение хэшей %v, ожидалось %v", got == h, tt.equal)
+			}
+		})
+	}
+}
+
+func TestTruncTime(t *testing.T) {
+
+	msk := time.FixedZone("MSK", 3*60*60)
+	want := time.Date(2024, 5, 1, 7, 0, 0, 123456000, time.UTC)
+
+	for _, tt := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"UTC с наносекундами", time.Date(2024, 5, 1, 7, 0, 0, 123456789, time.UTC)},
+		{"точно микросекунды", time.Date(2024, 5, 1, 7, 0, 0, 123456000, time.UTC)},
+		{"другой часовой пояс", time.Date(2024, 5, 1, 10, 0, 0, 123456999, msk)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncTime(tt.t)
+			if !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("ожидалось %v, получено %v", want, got)
+			}
+		})
+	}
+}
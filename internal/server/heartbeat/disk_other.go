@@ -0,0 +1,10 @@
+//go:build !unix
+
+package heartbeat
+
+import "errors"
+
+// Свободное место файловой системы, доступное процессу. На этой платформе не поддерживается.
+func FreeBytes(path string) (uint64, error) {
+	return 0, errors.New("проверка свободного места не поддерживается на этой платформе")
+}
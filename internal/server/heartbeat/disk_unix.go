@@ -0,0 +1,25 @@
+//go:build unix
+
+package heartbeat
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Свободное место файловой системы, доступное процессу. Функция возвращает количество байт и ошибку.
+//
+// Параметры:
+//
+// path - путь в файловой системе
+func FreeBytes(path string) (uint64, error) {
+
+	var st syscall.Statfs_t
+
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка {%v} чтения свободного места по пути {%s}", err, path)
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
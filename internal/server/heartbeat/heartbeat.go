@@ -0,0 +1,190 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Режимы сигнала активности
+const (
+	ModeToggle  = "toggle"  // чередование 0 и 1
+	ModeCounter = "counter" // счётчик 0..65535
+)
+
+// Состояния сигнала активности
+const (
+	StateOff     = "off"     // сигнал не настроен
+	StateActive  = "active"  // сигнал формируется
+	StateStopped = "stopped" // сигнал остановлен: архивирование неисправно
+)
+
+type (
+	// Тэг записи сигнала активности
+	TagT struct {
+		Dev string // наименование устройства
+		Tag string // наименование тэга записи
+	}
+
+	// Сигнал активности. Периодически записывает в тэги устройств чередующийся бит или счётчик,
+	// пока проверка исправности архивирования не вернёт причину неисправности.
+	HeartbeatT struct {
+		Tags   []TagT
+		Period time.Duration
+		Mode   string
+		Write  func(dev, tag, value string) error // запись значения тэга
+		Check  func() error                       // проверка исправности архивирования
+		Log    func(format string, v ...any)      // журнал смены состояния (может быть nil)
+
+		mu     sync.Mutex
+		state  string
+		reason string
+		value  uint16
+		since  time.Time
+	}
+
+	// Снимок состояния сигнала активности
+	InfoT struct {
+		State  string // состояние
+		Reason string // причина остановки
+		Value  string // последнее записанное значение
+		Since  string // время перехода в текущее состояние
+	}
+)
+
+// Разбор списка тэгов сигнала активности вида "Dev1/Tag1;Dev2/Tag2". Функция возвращает список и ошибку.
+//
+// Параметры:
+//
+// s - список тэгов
+func ParseTags(s string) ([]TagT, error) {
+
+	tags := make([]TagT, 0)
+
+	for _, el := range strings.Split(s, ";") {
+		el = strings.TrimSpace(el)
+		if el == "" {
+			continue
+		}
+
+		dev, tag, ok := strings.Cut(el, "/")
+		if !ok || dev == "" || tag == "" {
+			return nil, fmt.Errorf("тэг сигнала активности {%s} не в формате Устройство/Тэг", el)
+		}
+
+		tags = append(tags, TagT{Dev: dev, Tag: tag})
+	}
+
+	return tags, nil
+}
+
+// Формирование сигнала активности до завершения контекста.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+func (h *HeartbeatT) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(h.Period)
+	defer ticker.Stop()
+
+	// ошибки записи по тэгам, для журналирования только при изменении
+	wrErr := make(map[TagT]string)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// При неисправности архивирования сигнал замирает, что видит оборудование
+		err := h.Check()
+		if err != nil {
+			h.set(StateStopped, err.Error())
+			continue
+		}
+		h.set(StateActive, "")
+
+		value := h.next()
+
+		for _, t := range h.Tags {
+			msg := ""
+			err := h.Write(t.Dev, t.Tag, value)
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != wrErr[t] && h.Log != nil {
+				if msg != "" {
+					h.Log("сигнал активности -> ошибка записи в {%s/%s}: {%s}", t.Dev, t.Tag, msg)
+				} else {
+					h.Log("сигнал активности -> запись в {%s/%s} восстановлена", t.Dev, t.Tag)
+				}
+			}
+			wrErr[t] = msg
+		}
+	}
+}
+
+// Следующее значение сигнала. Возвращается значение в виде строки записи.
+func (h *HeartbeatT) next() string {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.Mode {
+	case ModeCounter:
+		h.value++
+	default:
+		h.value ^= 1
+	}
+
+	return strconv.Itoa(int(h.value))
+}
+
+// Установка состояния.
+func (h *HeartbeatT) set(state, reason string) {
+
+	h.mu.Lock()
+	changed := h.state != state || h.reason != reason
+	if h.state != state {
+		h.since = time.Now()
+	}
+	h.state = state
+	h.reason = reason
+	h.mu.Unlock()
+
+	if changed && h.Log != nil {
+		switch state {
+		case StateStopped:
+			h.Log("сигнал активности -> остановлен: {%s}", reason)
+		case StateActive:
+			h.Log("сигнал активности -> формируется")
+		}
+	}
+}
+
+// Снимок состояния. Возвращается снимок.
+func (h *HeartbeatT) Info() InfoT {
+
+	if h == nil {
+		return InfoT{State: StateOff}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	info := InfoT{
+		State:  h.state,
+		Reason: h.reason,
+		Value:  strconv.Itoa(int(h.value)),
+	}
+	if !h.since.IsZero() {
+		info.Since = h.since.Format("2006-01-02 15:04:05")
+	}
+
+	return info
+}
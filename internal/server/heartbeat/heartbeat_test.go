@@ -0,0 +1,80 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseTags(t *testing.T) {
+
+	tags, err := ParseTags("Dev1/HB; Dev2/Counter;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[1] != (TagT{Dev: "Dev2", Tag: "Counter"}) {
+		t.Fatalf("неверный разбор: %v", tags)
+	}
+
+	if _, err = ParseTags("Dev1"); err == nil {
+		t.Fatal("ожидалась ошибка для тэга без устройства")
+	}
+}
+
+func TestRun_StopsWhenUnhealthy(t *testing.T) {
+
+	var mu sync.Mutex
+	values := make([]string, 0)
+
+	var unhealthy atomic.Bool
+
+	h := &HeartbeatT{
+		Tags:   []TagT{{Dev: "Dev1", Tag: "HB"}},
+		Period: 5 * time.Millisecond,
+		Mode:   ModeToggle,
+		Write: func(dev, tag, value string) error {
+			mu.Lock()
+			values = append(values, value)
+			mu.Unlock()
+			return nil
+		},
+		Check: func() error {
+			if unhealthy.Load() {
+				return errors.New("запись архива остановлена")
+			}
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	unhealthy.Store(true)
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	n := len(values)
+	mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if n < 2 || values[0] != "1" || values[1] != "0" {
+		t.Fatalf("ожидалось чередование 1, 0, получено %v", values)
+	}
+	if len(values) != n {
+		t.Fatalf("сигнал не остановлен: записей до {%d}, после {%d}", n, len(values))
+	}
+	if info := h.Info(); info.State != StateStopped {
+		t.Fatalf("ожидалось состояние {%s}, получено {%s}", StateStopped, info.State)
+	}
+}
@@ -1,6 +1,10 @@
 package libre
 
 import (
+	"blackbox/internal/server/codec"
+	"blackbox/internal/server/deadband"
+	"blackbox/internal/server/gateway"
+	"blackbox/internal/server/scaling"
 	"errors"
 	"fmt"
 	"log"
@@ -18,6 +22,7 @@ type (
 		SheetMain_Header []SheetMain_Head
 		SheetMain_Dev    []SheetMain_Dev
 		SheetsDev        []Dev
+		Gateway          []SheetGateway
 		ConfDataReady    bool
 	}
 
@@ -27,6 +32,7 @@ type (
 		SheetMain_Header []SheetMain_Head
 		SheetMain_Dev    []SheetMain_Dev
 		SheetChan        []ChConf_Export
+		Gateway          []SheetGateway
 		ConfDataReady    bool
 	}
 
@@ -68,6 +74,15 @@ type (
 		Port    string
 	}
 
+	// Настройки шлюза Modbus-TCP (необязательная вкладка Gateway)
+	SheetGateway struct {
+		Address  string // IP адрес прослушивания (пусто - все интерфейсы)
+		Port     string // порт
+		UnitID   string // адрес слейва шлюза
+		DataType string // тип значения в регистрах: Float, Double
+		Format   string // порядок байт значения
+	}
+
 	Dev struct {
 		Name string           // наименование устройства
 		Conf []DevConf_Import // содержимое вкладки
@@ -82,6 +97,23 @@ type (
 		TimeScan string
 		FuncType string
 		Format   string
+
+		// Архивирование (необязательные колонки)
+		Deadband    string // абсолютная зона нечувствительности
+		DeadbandPct string // зона нечувствительности, %
+		MinArchive  string // наименьший интервал архивирования, мс
+		MaxArchive  string // наибольший интервал архивирования (строка-пульс), мс
+		OnChange    string // архивирование только при изменении (Bool): true/false
+
+		// Масштабирование (необязательные колонки)
+		RawMin string // нижняя граница исходного значения
+		RawMax string // верхняя граница исходного значения
+		EngMin string // нижняя граница инженерного значения
+		EngMax string // верхняя граница инженерного значения
+		Gain   string // коэффициент линейного преобразования
+		Offset string // смещение линейного преобразования
+		Clamp  string // ограничение инженерного значения диапазоном: true/false
+		Unit   string // единица измерения
 	}
 
 	ChConf_Export struct {
@@ -92,6 +124,23 @@ type (
 		TimeScan string
 		FuncType string
 		Format   string
+
+		// Архивирование (необязательные колонки)
+		Deadband    string // абсолютная зона нечувствительности
+		DeadbandPct string // зона нечувствительности, %
+		MinArchive  string // наименьший интервал архивирования, мс
+		MaxArchive  string // наибольший интервал архивирования (строка-пульс), мс
+		OnChange    string // архивирование только при изменении (Bool): true/false
+
+		// Масштабирование (необязательные колонки)
+		RawMin string // нижняя граница исходного значения
+		RawMax string // верхняя граница исходного значения
+		EngMin string // нижняя граница инженерного значения
+		EngMax string // верхняя граница инженерного значения
+		Gain   string // коэффициент линейного преобразования
+		Offset string // смещение линейного преобразования
+		Clamp  string // ограничение инженерного значения диапазоном: true/false
+		Unit   string // единица измерения
 	}
 
 	ChConfExt_Export struct {
@@ -103,23 +152,45 @@ type (
 		TimeScan   string
 		FuncType   string
 		Format     string
+
+		// Архивирование (необязательные колонки)
+		Deadband    string // абсолютная зона нечувствительности
+		DeadbandPct string // зона нечувствительности, %
+		MinArchive  string // наименьший интервал архивирования, мс
+		MaxArchive  string // наибольший интервал архивирования (строка-пульс), мс
+		OnChange    string // архивирование только при изменении (Bool): true/false
+
+		// Масштабирование (необязательные колонки)
+		RawMin string // нижняя граница исходного значения
+		RawMax string // верхняя граница исходного значения
+		EngMin string // нижняя граница инженерного значения
+		EngMax string // верхняя граница инженерного значения
+		Gain   string // коэффициент линейного преобразования
+		Offset string // смещение линейного преобразования
+		Clamp  string // ограничение инженерного значения диапазоном: true/false
+		Unit   string // единица измерения
 	}
 )
 
 var (
 	// список типов коннектов хоста
 	listConnType = map[string]bool{
-		"TCP": true,
-		"COM": false,
+		"TCP":     true,
+		"COM":     false,
+		"RTU-TCP": true,
+		"UDP":     true,
 	}
 
 	// список поддерживаемых функций протоколов
 	listFuncType = map[string]bool{
-		"ReadCoil":             true,
-		"ReadDiscreteInputs":   true,
-		"ReadHoldingRegisters": true,
-		"ReadInputRegisters":   true,
-		"WriteSingleRegister":  true,
+		"ReadCoil":               true,
+		"ReadDiscreteInputs":     true,
+		"ReadHoldingRegisters":   true,
+		"ReadInputRegisters":     true,
+		"WriteSingleRegister":    true,
+		"WriteMultipleRegisters": true,
+		"WriteSingleCoil":        true,
+		"WriteMultipleCoils":     true,
 	}
 
 	// список поддерживаемых типов данных
@@ -132,6 +203,15 @@ var (
 		"Float":    true,
 		"Int64":    true,
 		"Double":   true,
+		"UInt64":   true,
+		"UInt8Hi":  true,
+		"UInt8Lo":  true,
+		"Int8Hi":   true,
+		"Int8Lo":   true,
+		"BCD16":    true,
+		"BCD32":    true,
+		"Bit":      true,
+		"String":   true,
 	}
 
 	// список поддерживаемых протоколов
@@ -142,26 +222,30 @@ var (
 
 	// список типов данных с привязкой к функции
 	listDataTypeByFunc = map[string][]string{
-		"ReadCoil":             {"Bool"},
-		"ReadDiscreteInputs":   {"Bool"},
-		"ReadHoldingRegisters": {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double"},
-		"ReadInputRegisters":   {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double"},
-		"WriteSingleRegister":  {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double"},
-	}
-
-	// список типов данных с привязкой к количеству файт
-	listDataTypeByBytes = map[string]int{
-		"Bool":     2,
-		"Word":     2,
-		"ShortInt": 2,
-		"Integer":  4,
-		"DWord":    4,
-		"Float":    4,
-		"Int64":    8,
-		"Double":   8,
+		"ReadCoil":               {"Bool"},
+		"ReadDiscreteInputs":     {"Bool"},
+		"ReadHoldingRegisters":   {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double", "UInt64", "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo", "BCD16", "BCD32", "Bit", "String"},
+		"ReadInputRegisters":     {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double", "UInt64", "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo", "BCD16", "BCD32", "Bit", "String"},
+		"WriteSingleRegister":    {"Word", "ShortInt", "BCD16"},
+		"WriteMultipleRegisters": {"Word", "ShortInt", "Integer", "DWord", "Float", "Int64", "Double", "UInt64", "BCD16", "BCD32"},
+		"WriteSingleCoil":        {"Bool"},
+		"WriteMultipleCoils":     {"Bool"},
 	}
 )
 
+// Проверка дискретного типа данных, значение которого архивируется по изменению, а не по зоне
+// нечувствительности. Возвращается true для дискретного типа.
+//
+// Параметры:
+//
+// dataType - тип данных тэга
+func IsDiscreteType(dataType string) bool {
+
+	base, _, _ := codec.SplitType(dataType)
+
+	return base == "Bool" || base == "Bit" || base == "String"
+}
+
 // Открытие файла конфигурации. Возвращает ошибку
 //
 // Параметры:
@@ -213,6 +297,12 @@ func (e *ConfXLSX_Import) ReadImport() error {
 		return fmt.Errorf("ошибка чтения данных устройств: [%v]", err)
 	}
 
+	// Чтение вкладки шлюза
+	err = readGatewaySheet(e)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения вкладки шлюза: [%v]", err)
+	}
+
 	// Проверка данных импорта на корректность
 	err = checkImportData(e)
 	if err != nil {
@@ -244,13 +334,23 @@ func (e *ConfXLSX_Import) ShowImport() {
 	}
 	fmt.Println()
 
+	if len(e.Gateway) > 0 {
+		fmt.Println("[Настройки шлюза]")
+		for _, el := range e.Gateway {
+			fmt.Printf("Address: %s    Port: %s    UnitID: %s    DataType: %s    Format: %s\n",
+				el.Address, el.Port, el.UnitID, el.DataType, el.Format)
+		}
+		fmt.Println()
+	}
+
 	fmt.Println("[Настройки опроса]")
 	for _, el := range e.SheetsDev {
 		fmt.Printf("[%s]\n", el.Name)
 
 		for _, e := range el.Conf {
-			fmt.Printf("Address: %s    Name: %s    DataType: %s    Comment: %s    Timescan: %s    FuncType: %s    Format: %s\n",
-				e.Address, e.Name, e.DataType, e.Comment, e.TimeScan, e.FuncType, e.Format)
+			fmt.Printf("Address: %s    Name: %s    DataType: %s    Comment: %s    Timescan: %s    FuncType: %s    Format: %s    Deadband: %s    DeadbandPct: %s    MinArchive: %s    MaxArchive: %s    OnChange: %s    RawMin: %s    RawMax: %s    EngMin: %s    EngMax: %s    Gain: %s    Offset: %s    Clamp: %s    Unit: %s\n",
+				e.Address, e.Name, e.DataType, e.Comment, e.TimeScan, e.FuncType, e.Format, e.Deadband, e.DeadbandPct, e.MinArchive, e.MaxArchive, e.OnChange,
+				e.RawMin, e.RawMax, e.EngMin, e.EngMax, e.Gain, e.Offset, e.Clamp, e.Unit)
 		}
 	}
 }
@@ -318,7 +418,7 @@ func readMainSheet(e *ConfXLSX_Import) error {
 			var el SheetMain_Head
 
 			switch row[1] {
-			case "TCP":
+			case "TCP", "RTU-TCP", "UDP":
 				if row[0] != "" && row[2] != "" && row[3] != "" {
 					el.Host = row[0]
 					el.ConType = row[1]
@@ -443,6 +543,19 @@ func readDevSheet(e *ConfXLSX_Import) error {
 					dConf.TimeScan = row[4]
 					dConf.FuncType = row[5]
 					dConf.Format = row[6]
+					dConf.Deadband = cell(row, 7)
+					dConf.DeadbandPct = cell(row, 8)
+					dConf.MinArchive = cell(row, 9)
+					dConf.MaxArchive = cell(row, 10)
+					dConf.OnChange = cell(row, 11)
+					dConf.RawMin = cell(row, 12)
+					dConf.RawMax = cell(row, 13)
+					dConf.EngMin = cell(row, 14)
+					dConf.EngMax = cell(row, 15)
+					dConf.Gain = cell(row, 16)
+					dConf.Offset = cell(row, 17)
+					dConf.Clamp = cell(row, 18)
+					dConf.Unit = cell(row, 19)
 
 					device.Conf = append(device.Conf, dConf)
 				}
@@ -454,6 +567,77 @@ func readDevSheet(e *ConfXLSX_Import) error {
 	return nil
 }
 
+// Чтение необязательной вкладки шлюза Modbus-TCP. Вкладка содержит строку заголовка и строку настроек.
+// Возвращается ошибка.
+//
+// Параметры:
+//
+// *ConfXLSX_Import - указатель на данные импорта.
+func readGatewaySheet(e *ConfXLSX_Import) error {
+
+	idx, err := e.Ptr.GetSheetIndex("Gateway")
+	if err != nil {
+		return err
+	}
+	if idx < 0 {
+		return nil // шлюз не используется
+	}
+
+	rows, err := e.Ptr.GetRows("Gateway")
+	if err != nil {
+		return err
+	}
+
+	needFill := false
+	for _, row := range rows {
+
+		// пропуск пустой строки
+		if len(row) == 0 {
+			continue
+		}
+
+		// Обнаружение строки заголовка
+		if !needFill {
+			if len(row) >= 5 &&
+				row[0] == "Address:" &&
+				row[1] == "Port:" &&
+				row[2] == "UnitID:" &&
+				row[3] == "DataType:" &&
+				row[4] == "Format:" {
+				needFill = true
+			}
+			continue
+		}
+
+		e.Gateway = append(e.Gateway, SheetGateway{
+			Address:  cell(row, 0),
+			Port:     cell(row, 1),
+			UnitID:   cell(row, 2),
+			DataType: cell(row, 3),
+			Format:   cell(row, 4),
+		})
+	}
+
+	if !needFill {
+		return errors.New("нет строки заголовка: Address: Port: UnitID: DataType: Format:")
+	}
+
+	return nil
+}
+
+// Значение ячейки строки. Возвращается значение, или пустая строка если ячейки нет.
+//
+// Параметры:
+//
+// row - строка вкладки
+// i - индекс колонки
+func cell(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
 // Создание xlsx файла, конфигурации. Возвращается имя файла и ошибка.
 //
 // Параметры:
@@ -476,6 +660,13 @@ func (e *ConfXLSX_Export) CreateXlsxConfig(path, name, time, typ string) (nameFi
 		return "", err
 	}
 
+	if len(e.Gateway) > 0 {
+		_, err = file.NewSheet("Gateway") // добавление вкладки настроек и карты регистров шлюза
+		if err != nil {
+			return "", err
+		}
+	}
+
 	err = file.DeleteSheet("Sheet1") // удаление созданной по умолчанию вкладки
 	if err != nil {
 		return "", err
@@ -543,6 +734,33 @@ func checkImportData(e *ConfXLSX_Import) error {
 		return err
 	}
 
+	// Проверка настроек шлюза
+	err = checkConfGateway(e)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Проверка настроек шлюза. Возвращается ошибка.
+//
+// Параметры:
+//
+// *ConfXLSX_Import - указатель на данные импорта.
+func checkConfGateway(e *ConfXLSX_Import) error {
+
+	if len(e.Gateway) > 1 {
+		return fmt.Errorf("проверка настроек шлюза -> допускается одна строка настроек, указано {%d}", len(e.Gateway))
+	}
+
+	for _, gw := range e.Gateway {
+		_, err := gateway.ParseConf(gw.Address, gw.Port, gw.UnitID, gw.DataType, gw.Format)
+		if err != nil {
+			return fmt.Errorf("проверка настроек шлюза -> %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -564,7 +782,7 @@ func checkConfHost(e *ConfXLSX_Import) error {
 		}
 
 		switch host.ConType {
-		case "TCP":
+		case "TCP", "RTU-TCP", "UDP":
 			// проверка типа коннекта
 			listByte := strings.Split(host.Address, ".")
 			if len(listByte) != 4 {
@@ -582,8 +800,6 @@ func checkConfHost(e *ConfXLSX_Import) error {
 			if err != nil {
 				return fmt.Errorf("ошибка при проверке конфигурации хоста -> в номере порта не число: %v ", host.Port)
 			}
-			// успех
-			return nil
 
 		case "COM":
 
@@ -677,7 +893,11 @@ func checkConfChannels(e *ConfXLSX_Import) error {
 			}
 
 			// проверка указанного типа данных
-			_, ok = listDataType[tag.DataType]
+			baseType, _, err := codec.SplitType(tag.DataType)
+			if err != nil {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> ошибка в типе данных: {%v}, в строке {%v} ", err, tag)
+			}
+			_, ok = listDataType[baseType]
 			if !ok {
 				return fmt.Errorf("проверка конфигурации тэгов устройств ->  указан неизвестный тип данных: {%v} в строке {%v} ", tag.DataType, tag)
 			}
@@ -690,7 +910,7 @@ func checkConfChannels(e *ConfXLSX_Import) error {
 
 			var typeExist bool = false
 			for _, v := range sl {
-				if v == tag.DataType {
+				if v == baseType {
 					typeExist = typeExist || true
 				}
 			}
@@ -699,28 +919,34 @@ func checkConfChannels(e *ConfXLSX_Import) error {
 			}
 
 			// проверка формата данных тега
-			slFormat := strings.Split(tag.Format, "_")
-
-			valBytes, ok := listDataTypeByBytes[tag.DataType]
-			if !ok {
-				return fmt.Errorf("проверка конфигурации тэгов устройств ->  ошибка программы 2: {%v} ", tag.DataType)
+			size, err := codec.FormatSize(tag.DataType)
+			if err != nil {
+				return fmt.Errorf("проверка конфигурации тэгов устройств ->  ошибка программы 2: {%v} ", err)
+			}
+			_, err = codec.ParseFormat(tag.Format, size)
+			if err != nil {
+				return fmt.Errorf("проверка конфигурации тэгов устройств ->  нет соответствия в формате данных: {%v}, к типу данных: {%v}, в строке: {%v}", err, tag.DataType, tag)
 			}
 
-			if valBytes != len(slFormat) {
-				return fmt.Errorf("проверка конфигурации тэгов устройств ->  нет соответствия в формате данных: {%v}, к типу данных: {%v}, в строке: {%v}", tag.Format, tag.DataType, tag)
+			// проверка настроек архивирования
+			arch, err := deadband.ParseConf(tag.Deadband, tag.DeadbandPct, tag.MinArchive, tag.MaxArchive, tag.OnChange)
+			if err != nil {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> ошибка в настройках архивирования: {%v}, в строке {%v}", err, tag)
+			}
+			if IsDiscreteType(tag.DataType) && (arch.Abs > 0 || arch.Pct > 0) {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> зона нечувствительности не применяется к типам Bool, Bit и String, в строке {%v}", tag)
+			}
+			if !IsDiscreteType(tag.DataType) && arch.OnChange {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> архивирование по изменению применяется только к типам Bool, Bit и String, в строке {%v}", tag)
 			}
 
-			// проверка содержимого в формате типа данных
-			for _, v := range slFormat {
-				cntEl := 0
-				for _, vv := range slFormat {
-					if v == vv {
-						cntEl++
-					}
-				}
-				if cntEl > 1 {
-					return fmt.Errorf("проверка конфигурации тэгов устройств ->  ошибка в формате данных, повторяемость: {%s}, в строке {%v}", v, tag)
-				}
+			// проверка настроек масштабирования
+			scale, err := scaling.ParseConf(tag.RawMin, tag.RawMax, tag.EngMin, tag.EngMax, tag.Gain, tag.Offset, tag.Clamp, tag.Unit)
+			if err != nil {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> ошибка в настройках масштабирования: {%v}, в строке {%v}", err, tag)
+			}
+			if !scale.IsZero() && (IsDiscreteType(tag.DataType) || strings.HasPrefix(tag.FuncType, "Write")) {
+				return fmt.Errorf("проверка конфигурации тэгов устройств -> масштабирование применяется только к числовым тэгам чтения, в строке {%v}", tag)
 			}
 		}
 	}
@@ -10,7 +10,9 @@ import (
 type (
 	Connect struct {
 		Name          string
+		ConType       string // тип коннекта: COM, RTU-TCP (кадры RTU через TCP), UDP (Modbus/UDP)
 		Port          string
+		Address       string // сетевой адрес шлюза ip:порт (для RTU-TCP и UDP)
 		Client        modbus.Client
 		Provider      *modbus.RTUClientHandler
 		ParamsConn    Params
@@ -31,6 +33,10 @@ type (
 // Создание подключения. Функция возвращает ошибку.
 func (mb *Connect) Connect() error {
 
+	if mb.ConType == "RTU-TCP" || mb.ConType == "UDP" {
+		return mb.connectNet()
+	}
+
 	provider := modbus.NewRTUClientHandler(mb.Port) // COM-порт "/dev/ttyUSB0"
 	provider.BaudRate = mb.ParamsConn.BaudRate      // Скорость передачи
 	provider.DataBits = mb.ParamsConn.DataBits      // Количество бит данных
@@ -0,0 +1,201 @@
+package modbusrtumaster
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+const (
+	netTimeout = time.Second // таймаут ответа через сетевой шлюз
+	maxADU     = 260         // наибольший размер кадра Modbus
+)
+
+type (
+	// Обработчик запросов: упаковка кадров библиотеки и передача по сети
+	netHandler struct {
+		modbus.Packager
+		*netTransporter
+	}
+
+	// Передача кадров по сети. Подключение выполняется при первом запросе и после ошибки обмена.
+	netTransporter struct {
+		network string // tcp - кадры RTU в потоке TCP, udp - кадры Modbus-TCP в датаграммах
+		address string
+		timeout time.Duration
+
+		mu   sync.Mutex
+		conn net.Conn
+	}
+)
+
+// Создание подключения через сеть (RTU-TCP, UDP). Недоступный шлюз не прерывает запуск, подключение
+// выполняется при запросе. Функция возвращает ошибку.
+func (mb *Connect) connectNet() error {
+
+	if mb.Address == "" {
+		return fmt.Errorf("не указан сетевой адрес коннекта {%s}", mb.Name)
+	}
+
+	t := &netTransporter{
+		address: mb.Address,
+		timeout: netTimeout,
+	}
+
+	switch mb.ConType {
+	case "RTU-TCP":
+		p := modbus.NewRTUClientHandler("")
+		p.SlaveId = mb.SlaveAddr
+		t.network = "tcp"
+		mb.Client = modbus.NewClient(&netHandler{Packager: p, netTransporter: t})
+		mb.ChangeSlaveID = func(slaveId byte) {
+			p.SlaveId = slaveId
+		}
+
+	case "UDP":
+		p := modbus.NewTCPClientHandler("")
+		p.SlaveId = mb.SlaveAddr
+		t.network = "udp"
+		mb.Client = modbus.NewClient(&netHandler{Packager: p, netTransporter: t})
+		mb.ChangeSlaveID = func(slaveId byte) {
+			p.SlaveId = slaveId
+		}
+
+	default:
+		return fmt.Errorf("неподдерживаемый тип сетевого коннекта {%s}", mb.ConType)
+	}
+
+	mb.Close = func() error {
+		err := t.Close()
+		if err != nil {
+			return fmt.Errorf("ошибка {%v} при закрытии подключения {%s}: {%v}", err, mb.ConType, mb.Address)
+		}
+		return nil
+	}
+
+	mb.IsRun = true
+	return nil
+}
+
+// Передача запроса и приём ответа. При ошибке обмена подключение закрывается, чтобы опоздавший ответ
+// не был принят за ответ на следующий запрос. Возвращается ответ и ошибка.
+//
+// Параметры:
+//
+// aduRequest - кадр запроса
+func (t *netTransporter) Send(aduRequest []byte) (aduResponse []byte, err error) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		t.conn, err = net.DialTimeout(t.network, t.address, t.timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if err != nil {
+			_ = t.conn.Close()
+			t.conn = nil
+		}
+	}()
+
+	err = t.conn.SetDeadline(time.Now().Add(t.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.conn.Write(aduRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.network == "udp" {
+		return readDatagram(t.conn, aduRequest)
+	}
+	return readFrameRTU(t.conn)
+}
+
+// Закрытие подключения. Возвращается ошибка.
+func (t *netTransporter) Close() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+
+	return err
+}
+
+// Чтение кадра RTU из потока. Длина кадра определяется по функции и счётчику байт ответа.
+// Возвращается кадр и ошибка.
+func readFrameRTU(conn net.Conn) ([]byte, error) {
+
+	// адрес, функция, счётчик байт (или код исключения)
+	frame := make([]byte, 3, maxADU)
+	_, err := readFull(conn, frame)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	switch fn := frame[1]; {
+	case fn&0x80 != 0:
+		size = 5
+	case fn >= modbus.FuncCodeReadCoils && fn <= modbus.FuncCodeReadInputRegisters:
+		size = 3 + int(frame[2]) + 2
+	case fn == modbus.FuncCodeWriteSingleCoil || fn == modbus.FuncCodeWriteSingleRegister ||
+		fn == modbus.FuncCodeWriteMultipleCoils || fn == modbus.FuncCodeWriteMultipleRegisters:
+		size = 8
+	default:
+		return nil, fmt.Errorf("неподдерживаемая функция {%d} в ответе RTU", fn)
+	}
+
+	frame = frame[:size]
+	_, err = readFull(conn, frame[3:])
+	if err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// Чтение до заполнения буфера. Возвращается количество байт и ошибка.
+func readFull(conn net.Conn, b []byte) (n int, err error) {
+
+	for n < len(b) && err == nil {
+		var nn int
+		nn, err = conn.Read(b[n:])
+		n += nn
+	}
+	if n == len(b) {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Чтение датаграммы ответа с номером транзакции запроса. Датаграммы, опоздавшие на предыдущие запросы,
+// пропускаются. Возвращается кадр и ошибка.
+func readDatagram(conn net.Conn, aduRequest []byte) ([]byte, error) {
+
+	buf := make([]byte, maxADU)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && len(aduRequest) >= 2 && bytes.Equal(buf[:2], aduRequest[:2]) {
+			return buf[:n], nil
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package modbusrtumaster
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/goburrow/modbus"
+)
+
+// Ответ симулятора на чтение регистров: значение регистра равно его адресу.
+// Возвращается PDU ответа.
+func simPDU(pdu []byte) []byte {
+
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+
+	if pdu[0] != modbus.FuncCodeReadHoldingRegisters || address >= 100 {
+		return []byte{pdu[0] | 0x80, 2}
+	}
+
+	res := []byte{pdu[0], byte(2 * quantity)}
+	for i := range quantity {
+		res = binary.BigEndian.AppendUint16(res, address+i)
+	}
+
+	return res
+}
+
+// Симулятор шлюза RTU через TCP. Возвращается адрес.
+func simRTUoverTCP(t *testing.T) string {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 8)
+				for {
+					if _, err := readFull(conn, req); err != nil {
+						return
+					}
+					// ответ упаковывается тем же форматом кадра RTU
+					p := modbus.NewRTUClientHandler("")
+					p.SlaveId = req[0]
+					res := simPDU(req[1:6])
+					adu, _ := p.Encode(&modbus.ProtocolDataUnit{FunctionCode: res[0], Data: res[1:]})
+					_, _ = conn.Write(adu)
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// Симулятор Modbus/UDP. Перед ответом отправляется датаграмма с чужим номером транзакции.
+// Возвращается адрес.
+func simUDP(t *testing.T) string {
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	go func() {
+		buf := make([]byte, maxADU)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			res := simPDU(req[7:])
+
+			adu := slices.Clone(req[:7])
+			binary.BigEndian.PutUint16(adu[4:], uint16(1+len(res)))
+			adu = append(adu, res...)
+
+			stale := slices.Clone(adu)
+			stale[0] ^= 0xFF
+			_, _ = pc.WriteTo(stale, addr)
+			_, _ = pc.WriteTo(adu, addr)
+		}
+	}()
+
+	return pc.LocalAddr().String()
+}
+
+func TestConnectNet(t *testing.T) {
+
+	for conType, address := range map[string]string{
+		"RTU-TCP": simRTUoverTCP(t),
+		"UDP":     simUDP(t),
+	} {
+		mb := Connect{Name: "Host", ConType: conType, Address: address, SlaveAddr: 1}
+		if err := mb.Connect(); err != nil {
+			t.Fatalf("%s: %v", conType, err)
+		}
+
+		for _, slave := range []byte{1, 7} {
+			mb.ChangeSlaveID(slave)
+
+			res, err := mb.Client.ReadHoldingRegisters(10, 3)
+			if err != nil {
+				t.Fatalf("%s: слейв {%d}: %v", conType, slave, err)
+			}
+			if want := []byte{0, 10, 0, 11, 0, 12}; !slices.Equal(res, want) {
+				t.Fatalf("%s: ожидалось % x, получено % x", conType, want, res)
+			}
+		}
+
+		// исключение не прерывает подключение
+		var exc *modbus.ModbusError
+		if _, err := mb.Client.ReadHoldingRegisters(200, 1); !errors.As(err, &exc) || exc.ExceptionCode != 2 {
+			t.Fatalf("%s: ожидалось исключение 2, получено {%v}", conType, err)
+		}
+		if _, err := mb.Client.ReadHoldingRegisters(0, 1); err != nil {
+			t.Fatalf("%s: после исключения: %v", conType, err)
+		}
+
+		if err := mb.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConnectNet_Unavailable(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	_ = ln.Close()
+
+	// недоступный шлюз не прерывает создание подключения
+	mb := Connect{Name: "Host", ConType: "RTU-TCP", Address: address, SlaveAddr: 1}
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mb.Client.ReadHoldingRegisters(0, 1); err == nil {
+		t.Fatal("ожидалась ошибка подключения")
+	}
+}
@@ -1,13 +1,32 @@
 package modbustcpmaster
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"net"
+	"sync"
 	"time"
 
 	modbus "github.com/thinkgos/gomodbus/v2"
 )
 
+// Состояния подключения
+const (
+	StateConnected    = "connected"    // подключение активно
+	StateReconnecting = "reconnecting" // подключение потеряно, выполняется переподключение
+	StateFailed       = "failed"       // переподключение длительно неуспешно, попытки продолжаются
+)
+
+// Параметры переподключения
+const (
+	backoffMin   = 500 * time.Millisecond // пауза перед первой повторной попыткой
+	backoffMax   = 30 * time.Second       // наибольшая пауза между попытками
+	failAttempts = 5                      // количество неуспешных попыток до состояния failed
+	dialTimeout  = 5 * time.Second        // таймаут установки соединения
+)
+
 type (
 	Connect struct {
 		Name      string
@@ -18,55 +37,253 @@ type (
 		Client    modbus.Client
 		Close     func() error
 		IsRun     bool
+		Health    *HealthT // состояние подключения (общее для всех копий коннекта)
+	}
+
+	// Состояние подключения
+	HealthT struct {
+		mu         sync.Mutex
+		state      string
+		lastErr    string
+		reconnects int
+		since      time.Time
+		lost       chan struct{} // уведомление супервизора о потере подключения
+	}
+
+	// Снимок состояния подключения
+	HealthInfoT struct {
+		State      string // состояние
+		LastErr    string // последняя ошибка подключения
+		Reconnects int    // количество выполненных переподключений
+		Since      string // время перехода в текущее состояние
 	}
 )
 
 // Создание подключения. Функция возвращает ошибку.
+//
+// Клиент создаётся и при ошибке подключения, чтобы супервизор мог выполнить переподключение.
 func (mb *Connect) Connect() error {
 
+	if mb.Health == nil {
+		mb.Health = &HealthT{
+			state: StateReconnecting,
+			since: time.Now(),
+			lost:  make(chan struct{}, 1),
+		}
+	}
+
+	slave := mb.SlaveIP + ":" + mb.SlavePort
+
+	if mb.Client == nil {
+		// Переподключение выполняет супервизор, а не провайдер
+		provider := modbus.NewTCPClientProvider(slave, modbus.WithAutoReconnect(0))
+
+		// Функция закрытия подклчения
+		mb.Close = func() error {
+			err := provider.Close()
+			return err
+		}
+
+		// Создание клиента для подключения к серверу
+		mb.Client = modbus.NewClient(provider)
+
+		// Клиент создан и подлежит закрытию при завершении работы
+		mb.IsRun = true
+	}
+
+	err := mb.dial()
+	if err != nil {
+		mb.Health.set(StateReconnecting, err)
+		return err
+	}
+
+	mb.Health.set(StateConnected, nil)
+
+	return nil
+}
+
+// Установка соединения с проверкой доступности слейва с локального адреса хоста. Функция возвращает ошибку.
+func (mb *Connect) dial() error {
+
 	host := mb.HostIP + ":" + mb.HostPort
 	slave := mb.SlaveIP + ":" + mb.SlavePort
 
 	localAddr, err := net.ResolveTCPAddr("tcp", host)
 	if err != nil {
-		log.Fatalf("Ошибка ResolveTCPAddr при создании TCP соединения: %v", err)
+		return fmt.Errorf("ошибка ResolveTCPAddr при создании TCP соединения: %v", err)
 	}
 
 	// Dialer с указанием локального адреса
 	dialer := &net.Dialer{
 		LocalAddr: localAddr,
-		Timeout:   5 * time.Second,
+		Timeout:   dialTimeout,
 	}
 
-	// Установка TCP-соединение с использованием Dialer
+	// Проверка доступности слейва
 	conn, err := dialer.Dial("tcp", slave)
 	if err != nil {
-		log.Fatalf("Ошибка Dial при создании TCP соединения: %v", err)
+		return fmt.Errorf("ошибка Dial при создании TCP соединения: %v", err)
 	}
-	defer conn.Close()
+	conn.Close()
 
-	// Создаем  provider, но используем уже установленное соединение
-	provider := modbus.NewTCPClientProvider(slave)
+	// Подключение
+	_ = mb.Client.Close()
 
-	// Функция закрытия подклчения
-	mb.Close = func() error {
-		err := provider.Close()
+	err = mb.Client.Connect()
+	if err != nil {
 		return err
 	}
 
-	// Создание клиента для подключения к серверу
-	mb.Client = modbus.NewClient(provider)
+	return nil
+}
+
+// Фиксация потери подключения по ошибке запроса. Ошибки-исключения Modbus подключение не прерывают.
+//
+// Параметры:
+//
+// err - ошибка запроса
+func (mb *Connect) MarkLost(err error) {
 
-	// Подключение
-	err = mb.Client.Connect()
-	if err != nil {
-		return err
+	if err == nil || mb.Health == nil {
+		return
+	}
+
+	var exc *modbus.ExceptionError
+	if errors.As(err, &exc) {
+		return
 	}
 
-	// Установка признака активности
-	mb.IsRun = true
+	if mb.Health.State() != StateConnected {
+		return
+	}
 
-	return nil
+	mb.Health.set(StateReconnecting, err)
+
+	select {
+	case mb.Health.lost <- struct{}{}:
+	default:
+	}
+}
+
+// Проверка активности подключения. Возвращает true, если подключение активно.
+func (mb *Connect) IsConnected() bool {
+	return mb.Health != nil && mb.Health.State() == StateConnected
+}
+
+// Супервизор подключения. Выполняет переподключение с экспоненциальной паузой и разбросом, до завершения контекста.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+// onChange - функция уведомления о смене состояния (может быть nil)
+func (mb *Connect) Supervise(ctx context.Context, onChange func(info HealthInfoT)) {
+
+	if mb.Health == nil {
+		return
+	}
+
+	for {
+		// Ожидание потери подключения
+		if mb.Health.State() == StateConnected {
+			select {
+			case <-ctx.Done():
+				return
+			case <-mb.Health.lost:
+				if onChange != nil {
+					onChange(mb.Health.Info())
+				}
+			}
+		}
+
+		// Переподключение
+		for attempt := 0; ; attempt++ {
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff(attempt)):
+			}
+
+			err := mb.dial()
+			if err == nil {
+				mb.Health.reconnected()
+				if onChange != nil {
+					onChange(mb.Health.Info())
+				}
+				break
+			}
+
+			state := StateReconnecting
+			if attempt+1 >= failAttempts {
+				state = StateFailed
+			}
+			prev := mb.Health.State()
+			mb.Health.set(state, err)
+			if prev != state && onChange != nil {
+				onChange(mb.Health.Info())
+			}
+		}
+	}
+}
+
+// Пауза перед попыткой переподключения. Возвращается длительность паузы.
+//
+// Параметры:
+//
+// attempt - номер попытки, начиная с 0
+func backoff(attempt int) time.Duration {
+
+	d := backoffMin
+	for i := 0; i < attempt && d < backoffMax; i++ {
+		d *= 2
+	}
+	if d > backoffMax {
+		d = backoffMax
+	}
+
+	// разброс в пределах [d/2, d), чтобы переподключения разных коннектов не совпадали
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Текущее состояние. Возвращается состояние.
+func (h *HealthT) State() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// Снимок состояния. Возвращается снимок.
+func (h *HealthT) Info() HealthInfoT {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HealthInfoT{
+		State:      h.state,
+		LastErr:    h.lastErr,
+		Reconnects: h.reconnects,
+		Since:      h.since.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// Установка состояния.
+func (h *HealthT) set(state string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state != state {
+		h.since = time.Now()
+	}
+	h.state = state
+	if err != nil {
+		h.lastErr = err.Error()
+	}
+}
+
+// Фиксация успешного переподключения.
+func (h *HealthT) reconnected() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state = StateConnected
+	h.since = time.Now()
+	h.reconnects++
 }
 
 // Чтение данных. Функция возвращает результат чтения и ошибку.
@@ -0,0 +1,46 @@
+package modbustcpmaster
+
+import (
+	"errors"
+	"testing"
+
+	modbus "github.com/thinkgos/gomodbus/v2"
+)
+
+func Test_backoff(t *testing.T) {
+
+	for attempt := 0; attempt < 20; attempt++ {
+
+		d := backoff(attempt)
+
+		if d < backoffMin/2 || d >= backoffMax {
+			t.Errorf("попытка {%d}: пауза {%v} вне границ", attempt, d)
+		}
+	}
+}
+
+func Test_MarkLost(t *testing.T) {
+
+	mb := Connect{Name: "test"}
+	mb.Health = &HealthT{state: StateConnected, lost: make(chan struct{}, 1)}
+
+	// исключение Modbus не прерывает подключение
+	mb.MarkLost(&modbus.ExceptionError{ExceptionCode: modbus.ExceptionCodeIllegalDataAddress})
+	if !mb.IsConnected() {
+		t.Fatal("исключение Modbus привело к потере подключения")
+	}
+
+	// ошибка транспорта прерывает подключение
+	mb.MarkLost(errors.New("i/o timeout"))
+	if mb.IsConnected() {
+		t.Fatal("ошибка транспорта не привела к потере подключения")
+	}
+
+	info := mb.Health.Info()
+	if info.State != StateReconnecting || info.LastErr != "i/o timeout" {
+		t.Errorf("неожиданное состояние: {%v}", info)
+	}
+	if len(mb.Health.lost) != 1 {
+		t.Error("супервизор не уведомлён о потере подключения")
+	}
+}
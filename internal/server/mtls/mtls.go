@@ -0,0 +1,295 @@
+// Взаимная аутентификация TLS (mTLS) HTTPS сервера: проверка сертификатов клиентов по доверенным
+// удостоверяющим центрам и выпуск сертификатов локального удостоверяющего центра для пусконаладки.
+// Пользователь клиента - CommonName субъекта сертификата (имя пользователя в TABLE_USERS).
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type (
+	// Режим аутентификации клиентов
+	ModeT string
+
+	// Выпущенные файлы сертификатов
+	FilesT struct {
+		Cert string // сертификат
+		Key  string // закрытый ключ
+		New  bool   // выпущен сейчас (false - выпущен ранее)
+	}
+)
+
+const (
+	ModeOff       ModeT = "off"        // без сертификатов клиентов, по токену
+	ModeCert      ModeT = "cert"       // по сертификату клиента, без токена
+	ModeCertToken ModeT = "cert+token" // по сертификату клиента и токену его пользователя
+
+	CAName     = "ca"     // имя файлов удостоверяющего центра
+	ServerName = "server" // имя файлов сертификата сервера
+	clientPref = "client-"
+
+	caValidity   = 10 * 365 * 24 * time.Hour // срок действия сертификата удостоверяющего центра
+	certValidity = 3 * 365 * 24 * time.Hour  // срок действия сертификатов сервера и клиентов
+)
+
+// Ошибка: в запросе нет проверенного сертификата клиента
+var ErrNoCert = errors.New("нет проверенного сертификата клиента")
+
+// Разбор режима аутентификации клиентов. Пустая строка - off. Возвращается режим и ошибка.
+//
+// Параметры:
+//
+// s - режим
+func ParseMode(s string) (ModeT, error) {
+
+	m := ModeT(strings.ToLower(strings.TrimSpace(s)))
+	switch m {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeCert, ModeCertToken:
+		return m, nil
+	}
+
+	return "", fmt.Errorf("недопустимый режим аутентификации клиентов {%s}, допускается: %s, %s, %s", s, ModeOff, ModeCert, ModeCertToken)
+}
+
+// Настройки TLS HTTPS сервера. В режимах cert и cert+token сертификат клиента обязателен и проверяется
+// по удостоверяющим центрам файла caFile (PEM, один или несколько сертификатов). Возвращаются настройки и ошибка.
+//
+// Параметры:
+//
+// mode - режим аутентификации клиентов
+// caFile - файл доверенных удостоверяющих центров
+func ServerConfig(mode ModeT, caFile string) (*tls.Config, error) {
+
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if mode == ModeOff {
+		return conf, nil
+	}
+
+	if caFile == "" {
+		return nil, fmt.Errorf("для режима {%s} не задан файл удостоверяющих центров клиентов", mode)
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла удостоверяющих центров клиентов: {%v}", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("в файле {%s} нет сертификатов PEM", caFile)
+	}
+
+	conf.ClientCAs = pool
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return conf, nil
+}
+
+// Пользователь по проверенному сертификату клиента запроса. Возвращается имя пользователя и ошибка.
+//
+// Параметры:
+//
+// r - запрос
+func User(r *http.Request) (string, error) {
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", ErrNoCert
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return "", errors.New("в сертификате клиента нет CommonName")
+	}
+
+	return name, nil
+}
+
+// Выпуск сертификатов для пусконаладки в директории dir: удостоверяющий центр (ca.crt, ca.key),
+// сертификат сервера (server.crt, server.key) и сертификаты клиентов (client-<имя>.crt, client-<имя>.key).
+// Выпущенные ранее файлы не перезаписываются: новые сертификаты подписываются прежним удостоверяющим центром.
+// Возвращаются файлы удостоверяющего центра, сервера, клиентов и ошибка.
+//
+// Параметры:
+//
+// dir - директория сертификатов
+// hosts - IP и DNS имена сервера
+// clients - имена пользователей клиентов
+func Init(dir string, hosts, clients []string) (ca, server FilesT, cl []FilesT, err error) {
+
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return ca, server, nil, fmt.Errorf("ошибка создания директории сертификатов: {%v}", err)
+	}
+
+	// Удостоверяющий центр
+	ca = files(dir, CAName)
+	caCert, caKey, err := load(ca)
+	if errors.Is(err, os.ErrNotExist) {
+		tmpl := template("BlackBox CA", caValidity)
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+		caCert, caKey, err = issue(ca, tmpl, nil, nil)
+		ca.New = true
+	}
+	if err != nil {
+		return ca, server, nil, fmt.Errorf("удостоверяющий центр: %v", err)
+	}
+
+	// Сервер
+	server = files(dir, ServerName)
+	if !exists(server) {
+		tmpl := template("BlackBox server", certValidity)
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else if h != "" {
+				tmpl.DNSNames = append(tmpl.DNSNames, h)
+			}
+		}
+
+		_, _, err = issue(server, tmpl, caCert, caKey)
+		if err != nil {
+			return ca, server, nil, fmt.Errorf("сертификат сервера: %v", err)
+		}
+		server.New = true
+	}
+
+	// Клиенты
+	for _, name := range clients {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return ca, server, cl, fmt.Errorf("недопустимое имя пользователя клиента {%s}", name)
+		}
+
+		f := files(dir, clientPref+name)
+		if !exists(f) {
+			tmpl := template(name, certValidity)
+			tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+			_, _, err = issue(f, tmpl, caCert, caKey)
+			if err != nil {
+				return ca, server, cl, fmt.Errorf("сертификат клиента {%s}: %v", name, err)
+			}
+			f.New = true
+		}
+		cl = append(cl, f)
+	}
+
+	return ca, server, cl, nil
+}
+
+// Внутренняя функция. Имена файлов сертификата и ключа.
+func files(dir, name string) FilesT {
+	return FilesT{
+		Cert: filepath.Join(dir, name+".crt"),
+		Key:  filepath.Join(dir, name+".key"),
+	}
+}
+
+// Внутренняя функция. Проверка наличия файла сертификата.
+func exists(f FilesT) bool {
+	_, err := os.Stat(f.Cert)
+	return err == nil
+}
+
+// Внутренняя функция. Шаблон сертификата с субъектом cn.
+func template(cn string, validity time.Duration) *x509.Certificate {
+
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	now := time.Now()
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"BlackBox"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+// Внутренняя функция. Выпуск ключа и сертификата по шаблону с подписью удостоверяющего центра
+// (parent = nil - самоподписанный) и запись в файлы. Возвращается сертификат, ключ и ошибка.
+func issue(f FilesT, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = os.WriteFile(f.Key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = os.WriteFile(f.Cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// Внутренняя функция. Чтение сертификата и ключа удостоверяющего центра. Возвращается сертификат, ключ и ошибка.
+func load(f FilesT) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+
+	certPEM, err := os.ReadFile(f.Cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(f.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("ключ удостоверяющего центра не ECDSA")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
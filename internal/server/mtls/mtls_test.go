@@ -0,0 +1,138 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+
+	for s, want := range map[string]ModeT{"": ModeOff, "off": ModeOff, " CERT ": ModeCert, "cert+token": ModeCertToken} {
+		got, err := ParseMode(s)
+		if err != nil || got != want {
+			t.Fatalf("%q: ожидалось %q, получено %q, %v", s, want, got, err)
+		}
+	}
+
+	if _, err := ParseMode("token"); err == nil {
+		t.Fatal("ожидалась ошибка")
+	}
+}
+
+func TestInit(t *testing.T) {
+
+	dir := t.TempDir()
+
+	ca, srv, cl, err := Init(dir, []string{"127.0.0.1", "blackbox.local"}, []string{"operator"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ca.New || !srv.New || len(cl) != 1 || !cl[0].New {
+		t.Fatalf("ожидался выпуск всех сертификатов: %+v %+v %+v", ca, srv, cl)
+	}
+
+	caPEM, _ := os.ReadFile(ca.Cert)
+
+	// Повторный запуск: прежние файлы сохраняются, новый клиент подписывается прежним удостоверяющим центром
+	ca2, srv2, cl2, err := Init(dir, nil, []string{"operator", "engineer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca2.New || srv2.New || cl2[0].New || !cl2[1].New {
+		t.Fatalf("перезаписаны выпущенные ранее сертификаты: %+v %+v %+v", ca2, srv2, cl2)
+	}
+	if caPEM2, _ := os.ReadFile(ca.Cert); string(caPEM2) != string(caPEM) {
+		t.Fatal("удостоверяющий центр перевыпущен")
+	}
+	if filepath.Base(cl2[1].Cert) != "client-engineer.crt" {
+		t.Fatalf("неверное имя файла клиента: %s", cl2[1].Cert)
+	}
+
+	if _, _, _, err = Init(dir, nil, []string{"../x"}); err == nil {
+		t.Fatal("ожидалась ошибка имени клиента")
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+
+	dir := t.TempDir()
+	ca, srv, cl, err := Init(dir, []string{"127.0.0.1"}, []string{"operator"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ServerConfig(ModeCert, ""); err == nil {
+		t.Fatal("ожидалась ошибка без файла удостоверяющих центров")
+	}
+
+	conf, err := ServerConfig(ModeCertToken, ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvPair, err := tls.LoadX509KeyPair(srv.Cert, srv.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Certificates = []tls.Certificate{srvPair}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, err := User(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, name)
+	}))
+	ts.TLS = conf
+	ts.StartTLS()
+	defer ts.Close()
+
+	caPEM, _ := os.ReadFile(ca.Cert)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	// Клиент с сертификатом
+	clPair, err := tls.LoadX509KeyPair(cl[0].Cert, cl[0].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client(clPair).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "operator" {
+		t.Fatalf("ожидался пользователь operator, получено %d %q", res.StatusCode, body)
+	}
+
+	// Клиент без сертификата
+	if res, err = client().Get(ts.URL); err == nil {
+		res.Body.Close()
+		t.Fatal("соединение без сертификата клиента принято")
+	}
+
+	// Клиент с сертификатом другого удостоверяющего центра
+	_, _, other, err := Init(t.TempDir(), nil, []string{"operator"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPair, err := tls.LoadX509KeyPair(other[0].Cert, other[0].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err = client(otherPair).Get(ts.URL); err == nil {
+		res.Body.Close()
+		t.Fatal("соединение с сертификатом чужого удостоверяющего центра принято")
+	}
+}
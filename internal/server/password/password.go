@@ -0,0 +1,145 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Политика хэширования паролей (argon2id, RFC 9106). Общая для управления пользователями в терминале
+// и для входа на https сервере.
+const (
+	Time    = 3         // количество проходов
+	Memory  = 64 * 1024 // объём памяти, КиБ
+	Threads = 2         // степень параллельности
+	KeyLen  = 32        // длина хэша, байт
+	SaltLen = 16        // длина соли, байт
+
+	prefix    = "$argon2id$"
+	maxMemory = 1024 * 1024 // наибольший объём памяти хэша из БД, КиБ (защита от искажённой записи)
+	maxTime   = 16          // наибольшее количество проходов хэша из БД
+)
+
+var (
+	ErrEmpty  = errors.New("пустой пароль")
+	ErrFormat = errors.New("неизвестный формат хэша пароля")
+
+	// хэш для сравнения при отсутствии пользователя (одинаковое время проверки)
+	dummy, _ = Hash("dummy")
+)
+
+// Вычисление хэша пароля по действующей политике, с солью пользователя. Функция возвращает хэш в виде
+// $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хэш> (base64 без дополнения) и ошибку.
+//
+// Параметры:
+//
+// pwd - пароль
+func Hash(pwd string) (string, error) {
+
+	if pwd == "" {
+		return "", ErrEmpty
+	}
+
+	salt := make([]byte, SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("ошибка генерации соли: {%v}", err)
+	}
+
+	key := argon2.IDKey([]byte(pwd), salt, Time, Memory, Threads, KeyLen)
+
+	return encode(Time, Memory, Threads, salt, key), nil
+}
+
+// Проверка пароля по хэшу из БД. Поддерживается хэш argon2id с любыми параметрами и прежний хэш
+// SHA-256 без соли (64 шестнадцатеричных символа). Функция возвращает результат проверки, признак
+// необходимости пересчёта хэша по действующей политике (прежний формат или параметры) и ошибку
+// формата хэша.
+//
+// Параметры:
+//
+// pwd - пароль
+// encoded - хэш пароля из БД
+func Verify(pwd, encoded string) (ok bool, rehash bool, err error) {
+
+	if pwd == "" {
+		return false, false, ErrEmpty
+	}
+
+	// прежний формат: SHA-256 без соли
+	if len(encoded) == 2*sha256.Size && !strings.HasPrefix(encoded, "$") {
+		want, err := hex.DecodeString(encoded)
+		if err != nil {
+			return false, false, ErrFormat
+		}
+		got := sha256.Sum256([]byte(pwd))
+		return subtle.ConstantTimeCompare(got[:], want) == 1, true, nil
+	}
+
+	t, m, p, salt, want, err := decode(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	got := argon2.IDKey([]byte(pwd), salt, t, m, p, uint32(len(want)))
+	ok = subtle.ConstantTimeCompare(got, want) == 1
+	rehash = t != Time || m != Memory || p != Threads || len(salt) != SaltLen || len(want) != KeyLen
+
+	return ok, rehash, nil
+}
+
+// Проверка пароля пользователя, которого нет в БД. Занимает то же время, что и проверка по хэшу
+// действующей политики, чтобы по времени ответа нельзя было определить наличие пользователя.
+//
+// Параметры:
+//
+// pwd - пароль
+func VerifyDummy(pwd string) {
+	_, _, _ = Verify(pwd+"-", dummy)
+}
+
+// Хэш в текстовом виде. Возвращается хэш.
+func encode(t, m uint32, p uint8, salt, key []byte) string {
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", prefix, argon2.Version, m, t, p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// Разбор хэша argon2id. Возвращаются параметры, соль, хэш и ошибка.
+func decode(encoded string) (t, m uint32, p uint8, salt, key []byte, err error) {
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return 0, 0, 0, nil, nil, ErrFormat
+	}
+
+	var v int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &v); err != nil || v != argon2.Version {
+		return 0, 0, 0, nil, nil, fmt.Errorf("%w: версия {%s}", ErrFormat, parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return 0, 0, 0, nil, nil, fmt.Errorf("%w: параметры {%s}", ErrFormat, parts[3])
+	}
+	if t < 1 || t > maxTime || m < 8*uint32(p) || m > maxMemory || p < 1 {
+		return 0, 0, 0, nil, nil, fmt.Errorf("%w: параметры вне допустимых {%s}", ErrFormat, parts[3])
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < 8 {
+		return 0, 0, 0, nil, nil, fmt.Errorf("%w: соль", ErrFormat)
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < 16 {
+		return 0, 0, 0, nil, nil, fmt.Errorf("%w: хэш", ErrFormat)
+	}
+
+	return t, m, p, salt, key, nil
+}
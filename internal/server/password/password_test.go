@@ -0,0 +1,79 @@
+package password
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashVerify(t *testing.T) {
+
+	h1, err := Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := Hash("secret")
+
+	// соль пользователя: хэши одного пароля различаются
+	if h1 == h2 {
+		t.Fatal("ожидались различные хэши одного пароля")
+	}
+	if !strings.HasPrefix(h1, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Fatalf("префикс хэша: %s", h1)
+	}
+
+	for pwd, want := range map[string]bool{"secret": true, "Secret": false, "secret ": false} {
+		ok, rehash, err := Verify(pwd, h1)
+		if err != nil || ok != want || rehash {
+			t.Fatalf("%q: ожидалось %v, получено %v, пересчёт %v, %v", pwd, want, ok, rehash, err)
+		}
+	}
+
+	if _, err := Hash(""); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("ожидалась ошибка пустого пароля, получено %v", err)
+	}
+}
+
+func TestVerify_Legacy(t *testing.T) {
+
+	legacy := fmt.Sprintf("%x", sha256.Sum256([]byte("secret")))
+
+	ok, rehash, err := Verify("secret", legacy)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("ожидалось совпадение с пересчётом, получено %v %v %v", ok, rehash, err)
+	}
+	if ok, _, _ := Verify("other", legacy); ok {
+		t.Fatal("ожидалось несовпадение")
+	}
+}
+
+func TestVerify_Params(t *testing.T) {
+
+	// хэш с прежними параметрами проверяется и подлежит пересчёту
+	salt := []byte("0123456789abcdef")
+	old := encode(1, 8*1024, 1, salt, argon2.IDKey([]byte("secret"), salt, 1, 8*1024, 1, KeyLen))
+	if ok, rehash, err := Verify("secret", old); err != nil || !ok || !rehash {
+		t.Fatalf("прежние параметры: ожидалось совпадение с пересчётом, получено %v %v %v", ok, rehash, err)
+	}
+	if ok, _, _ := Verify("other", old); ok {
+		t.Fatal("прежние параметры: ожидалось несовпадение")
+	}
+
+	for _, bad := range []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+		"$argon2id$v=18$m=65536,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+		"$argon2id$v=19$m=4194304,t=3,p=2$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$!!$aGFzaGhhc2hoYXNoaGFzaA",
+		strings.Repeat("z", 64),
+	} {
+		if _, _, err := Verify("secret", bad); !errors.Is(err, ErrFormat) {
+			t.Fatalf("%q: ожидалась ошибка формата, получено %v", bad, err)
+		}
+	}
+}
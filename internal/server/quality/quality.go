@@ -0,0 +1,132 @@
+package quality
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	rtu "github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+	tcp "github.com/thinkgos/gomodbus/v2"
+)
+
+// Коды качества в стиле OPC DA.
+//
+// Младший байт - качество OPC (QQSSSSLL), старший байт - уточнение причины:
+// код исключения Modbus для BadDevice или причина ошибки связи для BadComm.
+const (
+	Good            uint16 = 0x00C0 // значение достоверно
+	BadDecode       uint16 = 0x0004 // ответ принят, но не преобразуется в значение (OPC: Bad, Configuration Error)
+	BadNotConnected uint16 = 0x0008 // нет подключения (OPC: Bad, Not Connected)
+	BadDevice       uint16 = 0x000C // исключение Modbus, код в старшем байте (OPC: Bad, Device Failure)
+	BadComm         uint16 = 0x0018 // ошибка связи (OPC: Bad, Comm Failure)
+	Stale           uint16 = 0x0044 // запрос не выполнялся, значение устарело (OPC: Uncertain, Last Usable Value)
+
+	Timeout = BadComm | 0x0100 // нет ответа за отведённое время
+	CRC     = BadComm | 0x0200 // ошибка контрольной суммы ответа
+)
+
+// Классы качества
+const (
+	ClassGood      = "good"
+	ClassTimeout   = "timeout"
+	ClassCRC       = "crc"
+	ClassException = "exception"
+	ClassDecode    = "decode"
+	ClassComm      = "comm"
+	ClassStale     = "stale"
+)
+
+// Код качества исключения Modbus. Возвращается код качества.
+//
+// Параметры:
+//
+// code - код исключения Modbus
+func Exception(code byte) uint16 {
+	return BadDevice | uint16(code)<<8
+}
+
+// Код исключения Modbus из кода качества. Возвращается код исключения, или 0 если качество не исключение.
+//
+// Параметры:
+//
+// q - код качества
+func ExceptionCode(q uint16) byte {
+	if q&0xFF != BadDevice {
+		return 0
+	}
+	return byte(q >> 8)
+}
+
+// Классификация ошибки запроса. Возвращается код качества.
+//
+// Параметры:
+//
+// err - ошибка запроса Modbus-TCP или Modbus-RTU
+func Classify(err error) uint16 {
+
+	if err == nil {
+		return Good
+	}
+
+	// Исключения Modbus
+	var excTCP *tcp.ExceptionError
+	if errors.As(err, &excTCP) {
+		return Exception(excTCP.ExceptionCode)
+	}
+	var excRTU *rtu.ModbusError
+	if errors.As(err, &excRTU) {
+		return Exception(excRTU.ExceptionCode)
+	}
+
+	// Таймауты
+	if errors.Is(err, serial.ErrTimeout) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return Timeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return Timeout
+	}
+
+	// Контрольная сумма RTU (библиотека не выделяет отдельный тип ошибки)
+	if strings.Contains(err.Error(), "crc") {
+		return CRC
+	}
+
+	return BadComm
+}
+
+// Класс качества. Возвращается класс.
+//
+// Параметры:
+//
+// q - код качества
+func Class(q uint16) string {
+
+	switch {
+	case q == Good:
+		return ClassGood
+	case q == Timeout:
+		return ClassTimeout
+	case q == CRC:
+		return ClassCRC
+	case q&0xFF == BadDevice:
+		return ClassException
+	case q == BadDecode:
+		return ClassDecode
+	case q == Stale:
+		return ClassStale
+	default:
+		return ClassComm
+	}
+}
+
+// Проверка достоверности значения. Возвращает true, если качество хорошее.
+//
+// Параметры:
+//
+// q - код качества
+func IsGood(q uint16) bool {
+	return q&0xC0 == 0xC0
+}
@@ -0,0 +1,49 @@
+package quality
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	rtu "github.com/goburrow/modbus"
+	"github.com/goburrow/serial"
+	tcp "github.com/thinkgos/gomodbus/v2"
+)
+
+func TestClassify(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		err   error
+		qual  uint16
+		class string
+	}{
+		{"нет ошибки", nil, Good, ClassGood},
+		{"исключение TCP", &tcp.ExceptionError{ExceptionCode: 2}, 0x020C, ClassException},
+		{"исключение RTU", fmt.Errorf("запрос: %w", &rtu.ModbusError{FunctionCode: 0x83, ExceptionCode: 4}), 0x040C, ClassException},
+		{"таймаут RTU", serial.ErrTimeout, Timeout, ClassTimeout},
+		{"таймаут TCP", fmt.Errorf("read: %w", os.ErrDeadlineExceeded), Timeout, ClassTimeout},
+		{"CRC", fmt.Errorf("modbus: response crc '1' does not match expected '2'"), CRC, ClassCRC},
+		{"прочая ошибка", errors.New("connection reset"), BadComm, ClassComm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := Classify(tt.err)
+			if q != tt.qual {
+				t.Fatalf("ожидалось качество {%#04x}, получено {%#04x}", tt.qual, q)
+			}
+			if c := Class(q); c != tt.class {
+				t.Fatalf("ожидался класс {%s}, получен {%s}", tt.class, c)
+			}
+		})
+	}
+
+	if code := ExceptionCode(Exception(11)); code != 11 {
+		t.Fatalf("ожидался код исключения {11}, получен {%d}", code)
+	}
+	if IsGood(Stale) || !IsGood(Good) {
+		t.Fatal("неверная проверка достоверности")
+	}
+}
@@ -0,0 +1,75 @@
+// Роли пользователей и права доступа к ручкам HTTPS сервера.
+package role
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	Viewer   = "viewer"   // просмотр состояния и архива
+	Engineer = "engineer" // просмотр, запись в устройства, конфигурация
+	Admin    = "admin"    // все права
+	Auditor  = "auditor"  // просмотр архива и журналов, без изменений
+
+	Default = Viewer // роль нового пользователя
+)
+
+type (
+	// Право доступа
+	PermT string
+)
+
+const (
+	PermStatus  PermT = "status"  // состояние сервера
+	PermArchive PermT = "archive" // чтение архива и проверка цепочки хэшей
+	PermLogs    PermT = "logs"    // чтение журналов
+	PermWrite   PermT = "write"   // запись значений в устройства
+	PermConfig  PermT = "config"  // изменение конфигурации
+	PermUsers   PermT = "users"   // управление пользователями
+)
+
+// Права ролей
+var perms = map[string][]PermT{
+	Viewer:   {PermStatus, PermArchive},
+	Engineer: {PermStatus, PermArchive, PermLogs, PermWrite, PermConfig},
+	Admin:    {PermStatus, PermArchive, PermLogs, PermWrite, PermConfig, PermUsers},
+	Auditor:  {PermStatus, PermArchive, PermLogs},
+}
+
+// Список ролей.
+func List() []string {
+	return []string{Viewer, Engineer, Admin, Auditor}
+}
+
+// Проверка и приведение имени роли. Возвращается роль и ошибка.
+//
+// Параметры:
+//
+// s - имя роли
+func Parse(s string) (string, error) {
+
+	r := strings.ToLower(strings.TrimSpace(s))
+	if _, ok := perms[r]; !ok {
+		return "", fmt.Errorf("неизвестная роль {%s}, допускается: %s", s, strings.Join(List(), ", "))
+	}
+
+	return r, nil
+}
+
+// Проверка права роли. Для неизвестной роли возвращается false.
+//
+// Параметры:
+//
+// r - роль
+// p - право доступа
+func Allowed(r string, p PermT) bool {
+
+	for _, v := range perms[r] {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,52 @@
+package role
+
+import "testing"
+
+func TestParse(t *testing.T) {
+
+	for s, want := range map[string]string{"viewer": Viewer, " Admin ": Admin, "AUDITOR": Auditor, "engineer": Engineer} {
+		got, err := Parse(s)
+		if err != nil || got != want {
+			t.Fatalf("%q: ожидалось %q, получено %q, %v", s, want, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "root", "operator"} {
+		if _, err := Parse(s); err == nil {
+			t.Fatalf("%q: ожидалась ошибка", s)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+
+	for _, tt := range []struct {
+		role string
+		perm PermT
+		want bool
+	}{
+		{Viewer, PermArchive, true},
+		{Viewer, PermWrite, false},
+		{Viewer, PermLogs, false},
+		{Engineer, PermWrite, true},
+		{Engineer, PermUsers, false},
+		{Admin, PermUsers, true},
+		{Auditor, PermArchive, true},
+		{Auditor, PermLogs, true},
+		{Auditor, PermWrite, false},
+		{Auditor, PermConfig, false},
+		{Auditor, PermUsers, false},
+		{"", PermStatus, false},
+	} {
+		if got := Allowed(tt.role, tt.perm); got != tt.want {
+			t.Fatalf("%s/%s: ожидалось %v, получено %v", tt.role, tt.perm, tt.want, got)
+		}
+	}
+
+	// у каждой роли есть просмотр состояния
+	for _, r := range List() {
+		if !Allowed(r, PermStatus) {
+			t.Fatalf("%s: нет права %s", r, PermStatus)
+		}
+	}
+}
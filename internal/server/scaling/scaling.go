@@ -0,0 +1,164 @@
+package scaling
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Масштабирование значения тэга в инженерные единицы
+	ConfT struct {
+		RawMin, RawMax float64 // диапазон исходного значения
+		EngMin, EngMax float64 // диапазон инженерного значения
+		Gain, Offset   float64 // линейное преобразование: значение * Gain + Offset
+		Clamp          bool    // ограничение инженерного значения диапазоном EngMin..EngMax
+		Unit           string  // единица измерения
+
+		ranged bool // задано преобразование по диапазонам
+		linear bool // задано линейное преобразование
+	}
+)
+
+// Разбор настроек масштабирования тэга. Пустые значения означают отсутствие преобразования.
+// Диапазоны задаются все четыре, либо не задаются; диапазоны и линейное преобразование не применяются вместе.
+// Функция возвращает настройки и ошибку.
+//
+// Параметры:
+//
+// rawMin, rawMax - диапазон исходного значения
+// engMin, engMax - диапазон инженерного значения
+// gain, offset - коэффициент и смещение линейного преобразования
+// clamp - ограничение диапазоном инженерного значения (true/false)
+// unit - единица измерения
+func ParseConf(rawMin, rawMax, engMin, engMax, gain, offset, clamp, unit string) (conf ConfT, err error) {
+
+	conf.Unit = strings.TrimSpace(unit)
+
+	// Диапазоны
+	rng := []string{rawMin, rawMax, engMin, engMax}
+	set := 0
+	for _, v := range rng {
+		if strings.TrimSpace(v) != "" {
+			set++
+		}
+	}
+	switch set {
+	case 0:
+	case len(rng):
+		for i, dst := range []*float64{&conf.RawMin, &conf.RawMax, &conf.EngMin, &conf.EngMax} {
+			*dst, err = parseFloat(rng[i])
+			if err != nil {
+				return ConfT{}, fmt.Errorf("диапазон масштабирования {%s}: %v", rng[i], err)
+			}
+		}
+		if conf.RawMin == conf.RawMax {
+			return ConfT{}, fmt.Errorf("диапазон исходного значения {%s..%s} нулевой", rawMin, rawMax)
+		}
+		conf.ranged = true
+	default:
+		return ConfT{}, fmt.Errorf("диапазоны масштабирования заданы не полностью: {%s..%s} -> {%s..%s}", rawMin, rawMax, engMin, engMax)
+	}
+
+	// Линейное преобразование
+	conf.Gain = 1
+	if strings.TrimSpace(gain) != "" {
+		conf.Gain, err = parseFloat(gain)
+		if err != nil {
+			return ConfT{}, fmt.Errorf("коэффициент масштабирования {%s}: %v", gain, err)
+		}
+		conf.linear = true
+	}
+	if strings.TrimSpace(offset) != "" {
+		conf.Offset, err = parseFloat(offset)
+		if err != nil {
+			return ConfT{}, fmt.Errorf("смещение масштабирования {%s}: %v", offset, err)
+		}
+		conf.linear = true
+	}
+	if conf.ranged && conf.linear {
+		return ConfT{}, fmt.Errorf("диапазоны и линейное преобразование масштабирования заданы одновременно")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(clamp)) {
+	case "", "false", "0":
+	case "true", "1":
+		if !conf.ranged {
+			return ConfT{}, fmt.Errorf("ограничение значения требует диапазонов масштабирования")
+		}
+		conf.Clamp = true
+	default:
+		return ConfT{}, fmt.Errorf("признак ограничения значения {%s}: ожидается true или false", clamp)
+	}
+
+	return conf, nil
+}
+
+// Разбор числа. Функция возвращает число и ошибку.
+func parseFloat(s string) (float64, error) {
+
+	f, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("не число")
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("ожидается конечное число")
+	}
+
+	return f, nil
+}
+
+// Проверка наличия преобразования. Возвращает true, если значение архивируется без изменений.
+func (c ConfT) IsZero() bool {
+	return !c.ranged && !c.linear
+}
+
+// Масштабирование значения. Числовое значение приводится к float64 и преобразуется, значение без
+// преобразования возвращается без изменений. Функция возвращает значение и ошибку.
+//
+// Параметры:
+//
+// value - значение в исходном типе тэга
+func (c ConfT) Apply(value interface{}) (interface{}, error) {
+
+	if c.IsZero() {
+		return value, nil
+	}
+
+	var raw float64
+
+	switch v := value.(type) {
+	case uint16:
+		raw = float64(v)
+	case int16:
+		raw = float64(v)
+	case uint32:
+		raw = float64(v)
+	case int32:
+		raw = float64(v)
+	case int64:
+		raw = float64(v)
+	case uint64:
+		raw = float64(v)
+	case float32:
+		raw = float64(v)
+	case float64:
+		raw = v
+	default:
+		return nil, fmt.Errorf("масштабирование не применяется к значению {%v} типа %T", value, value)
+	}
+
+	if !c.ranged {
+		return raw*c.Gain + c.Offset, nil
+	}
+
+	eng := c.EngMin + (raw-c.RawMin)*(c.EngMax-c.EngMin)/(c.RawMax-c.RawMin)
+
+	if c.Clamp {
+		eng = max(eng, min(c.EngMin, c.EngMax))
+		eng = min(eng, max(c.EngMin, c.EngMax))
+	}
+
+	return eng, nil
+}
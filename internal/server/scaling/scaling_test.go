@@ -0,0 +1,68 @@
+package scaling
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+
+	// 4-20 мА как 0..27648 -> 0..16 бар
+	rng, err := ParseConf("0", "27648", "0", "16", "", "", "true", "бар")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lin, err := ParseConf("", "", "", "", "0,1", "-40", "", "°C")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	none, err := ParseConf("", "", "", "", "", "", "", "м3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		conf  ConfT
+		value interface{}
+		want  interface{}
+	}{
+		{rng, uint16(13824), 8.0},
+		{rng, int16(-100), 0.0}, // ограничение снизу
+		{rng, float32(30000), 16.0},
+		{lin, int16(650), 25.0},
+		{none, uint16(7), uint16(7)},
+	}
+
+	for i, tt := range tests {
+		got, err := tt.conf.Apply(tt.value)
+		if err != nil {
+			t.Fatalf("шаг {%d}: %v", i, err)
+		}
+		if got != tt.want {
+			t.Fatalf("шаг {%d}: ожидалось {%v}, получено {%v}", i, tt.want, got)
+		}
+	}
+
+	if _, err = rng.Apply(byte(1)); err == nil {
+		t.Fatal("ожидалась ошибка масштабирования Bool")
+	}
+}
+
+func TestParseConf_Error(t *testing.T) {
+
+	tests := [][8]string{
+		{"0", "100", "", "", "", "", "", ""},     // диапазоны не полностью
+		{"5", "5", "0", "1", "", "", "", ""},     // нулевой диапазон
+		{"0", "10", "0", "1", "2", "", "", ""},   // диапазоны вместе с линейным
+		{"", "", "", "", "abc", "", "", ""},      // не число
+		{"", "", "", "", "2", "", "true", ""},    // ограничение без диапазонов
+		{"0", "10", "0", "1", "", "", "yes", ""}, // признак ограничения
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseConf(tt[0], tt[1], tt[2], tt[3], tt[4], tt[5], tt[6], tt[7]); err == nil {
+			t.Fatalf("ожидалась ошибка для {%v}", tt)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const reportEvery = time.Minute // наименьший интервал уведомлений о перегрузке группы
+
+type (
+	// Группа опроса
+	GroupT struct {
+		Period time.Duration // период опроса
+		Offset time.Duration // смещение фазы от запуска планировщика
+	}
+
+	// Планировщик опроса коннекта. Сроки циклов группы отсчитываются от запуска (без накопления
+	// дрейфа). Цикл, не начатый до срока следующего, пропускается и учитывается как перегрузка.
+	WheelT struct {
+		name      string
+		onOverrun func(info InfoT) // уведомление о перегрузке группы (может быть nil)
+
+		mu     sync.Mutex
+		groups []groupT
+	}
+
+	// Состояние группы опроса
+	groupT struct {
+		GroupT
+		due      time.Time // срок следующего цикла
+		cycles   uint64
+		overruns uint64
+		skipped  uint64
+		lastLate time.Duration
+		maxLate  time.Duration
+		reported time.Time // время последнего уведомления о перегрузке
+	}
+
+	// Снимок состояния группы опроса
+	InfoT struct {
+		Name       string  // наименование планировщика
+		PeriodMs   int64   // период опроса, мс
+		OffsetMs   int64   // смещение фазы, мс
+		Cycles     uint64  // выполнено циклов
+		Overruns   uint64  // случаев перегрузки
+		Skipped    uint64  // пропущено циклов
+		LastLateMs float64 // запаздывание последнего цикла, мс
+		MaxLateMs  float64 // наибольшее запаздывание цикла, мс
+	}
+
+	// Набор планировщиков, для отображения состояния
+	SetT struct {
+		mu     sync.Mutex
+		wheels map[string]*WheelT
+	}
+)
+
+// Создание планировщика. Возвращается указатель на планировщик.
+//
+// Параметры:
+//
+// name - наименование
+// groups - группы опроса, индекс группы передаётся в функцию запуска цикла
+// onOverrun - уведомление о перегрузке группы, не чаще раза в минуту (может быть nil)
+func New(name string, groups []GroupT, onOverrun func(info InfoT)) *WheelT {
+
+	w := &WheelT{
+		name:      name,
+		onOverrun: onOverrun,
+		groups:    make([]groupT, 0, len(groups)),
+	}
+	for _, g := range groups {
+		w.groups = append(w.groups, groupT{GroupT: g})
+	}
+
+	return w
+}
+
+// Выполнение циклов групп до завершения контекста.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+// fire - запуск цикла группы i; должен вернуть true, если цикл начат до срока deadline
+func (w *WheelT) Run(ctx context.Context, fire func(i int, deadline time.Time) bool) {
+
+	if len(w.groups) == 0 {
+		<-ctx.Done()
+		return
+	}
+
+	start := time.Now()
+	w.mu.Lock()
+	for i := range w.groups {
+		w.groups[i].due = start.Add(w.groups[i].Offset)
+	}
+	w.mu.Unlock()
+
+	for {
+		i, due := w.next()
+
+		// ожидание срока цикла
+		if d := time.Until(due); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		due = w.catchUp(i, time.Now())
+
+		sent := fire(i, due.Add(w.groups[i].Period))
+
+		w.done(i, sent, time.Now())
+	}
+}
+
+// Группа с ближайшим сроком цикла. Возвращается индекс группы и срок.
+func (w *WheelT) next() (int, time.Time) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := 0
+	for i := range w.groups {
+		if w.groups[i].due.Before(w.groups[n].due) {
+			n = i
+		}
+	}
+
+	return n, w.groups[n].due
+}
+
+// Пропуск циклов, сроки которых истекли полностью (пока выполнялись другие циклы).
+// Возвращается срок текущего цикла.
+func (w *WheelT) catchUp(i int, now time.Time) time.Time {
+
+	w.mu.Lock()
+	g := &w.groups[i]
+
+	missed := now.Sub(g.due) / g.Period
+	if missed > 0 {
+		g.due = g.due.Add(missed * g.Period)
+		g.skipped += uint64(missed)
+		g.overruns++
+	}
+	due := g.due
+	info, report := w.report(g, missed > 0, now)
+	w.mu.Unlock()
+
+	if report {
+		w.onOverrun(info)
+	}
+
+	return due
+}
+
+// Учёт результата запуска цикла и расчёт срока следующего.
+func (w *WheelT) done(i int, sent bool, now time.Time) {
+
+	w.mu.Lock()
+	g := &w.groups[i]
+
+	if sent {
+		g.cycles++
+		g.lastLate = now.Sub(g.due)
+		g.maxLate = max(g.maxLate, g.lastLate)
+	} else {
+		// предыдущий цикл не завершён до срока следующего
+		g.skipped++
+		g.overruns++
+	}
+	g.due = g.due.Add(g.Period)
+	info, report := w.report(g, !sent, now)
+	w.mu.Unlock()
+
+	if report {
+		w.onOverrun(info)
+	}
+}
+
+// Проверка необходимости уведомления о перегрузке. Вызывается под блокировкой.
+func (w *WheelT) report(g *groupT, overrun bool, now time.Time) (InfoT, bool) {
+
+	if !overrun || w.onOverrun == nil || now.Sub(g.reported) < reportEvery {
+		return InfoT{}, false
+	}
+	g.reported = now
+
+	return w.info(g), true
+}
+
+// Снимок состояния группы. Вызывается под блокировкой.
+func (w *WheelT) info(g *groupT) InfoT {
+	return InfoT{
+		Name:       w.name,
+		PeriodMs:   g.Period.Milliseconds(),
+		OffsetMs:   g.Offset.Milliseconds(),
+		Cycles:     g.cycles,
+		Overruns:   g.overruns,
+		Skipped:    g.skipped,
+		LastLateMs: float64(g.lastLate.Microseconds()) / 1000,
+		MaxLateMs:  float64(g.maxLate.Microseconds()) / 1000,
+	}
+}
+
+// Снимок состояния групп планировщика. Возвращаются снимки по группам.
+func (w *WheelT) Info() []InfoT {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info := make([]InfoT, 0, len(w.groups))
+	for i := range w.groups {
+		info = append(info, w.info(&w.groups[i]))
+	}
+
+	return info
+}
+
+// Создание набора планировщиков. Возвращается указатель на набор.
+func NewSet() *SetT {
+	return &SetT{
+		wheels: make(map[string]*WheelT),
+	}
+}
+
+// Добавление планировщика в набор. Планировщик с тем же наименованием (после перезапуска) заменяется.
+//
+// Параметры:
+//
+// w - планировщик
+func (s *SetT) Put(w *WheelT) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wheels[w.name] = w
+}
+
+// Снимок состояния групп всех планировщиков, по наименованию. Возвращаются снимки.
+func (s *SetT) Info() []InfoT {
+
+	s.mu.Lock()
+	wheels := make([]*WheelT, 0, len(s.wheels))
+	for _, w := range s.wheels {
+		wheels = append(wheels, w)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(wheels, func(a, b *WheelT) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	info := make([]InfoT, 0)
+	for _, w := range wheels {
+		info = append(info, w.Info()...)
+	}
+
+	return info
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun_Cycles(t *testing.T) {
+
+	var fast, slow atomic.Int32
+
+	w := New("Queue:Host:COM", []GroupT{
+		{Period: 10 * time.Millisecond},
+		{Period: 50 * time.Millisecond, Offset: 5 * time.Millisecond},
+	}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 205*time.Millisecond)
+	defer cancel()
+
+	w.Run(ctx, func(i int, deadline time.Time) bool {
+		if i == 0 {
+			fast.Add(1)
+		} else {
+			slow.Add(1)
+		}
+		return true
+	})
+
+	// сроки отсчитываются от запуска: 0, 10 ... 200 мс и 5, 55 ... 155 мс
+	if n := fast.Load(); n < 17 || n > 21 {
+		t.Fatalf("ожидалось 21 цикл группы 10 мс, получено {%d}", n)
+	}
+	if n := slow.Load(); n < 3 || n > 5 {
+		t.Fatalf("ожидалось 5 циклов группы 50 мс, получено {%d}", n)
+	}
+
+	for _, g := range w.Info() {
+		if g.Skipped != 0 {
+			t.Fatalf("неожиданный пропуск циклов: %+v", g)
+		}
+	}
+}
+
+func TestOverrun(t *testing.T) {
+
+	var reports atomic.Int32
+
+	w := New("Queue:Host:COM", []GroupT{{Period: 10 * time.Millisecond}}, func(info InfoT) {
+		reports.Add(1)
+	})
+
+	ms := func(n int) time.Time { return time.Unix(0, 0).Add(time.Duration(n) * time.Millisecond) }
+	w.groups[0].due = ms(0)
+
+	// цикл 0 мс начат с запаздыванием 35 мс
+	w.done(0, true, ms(35))
+
+	// циклы 10 и 20 мс пропускаются, текущий - 30 мс
+	if due := w.catchUp(0, ms(35)); !due.Equal(ms(30)) {
+		t.Fatalf("ожидался срок 30 мс, получено {%v}", due.Sub(ms(0)))
+	}
+
+	// драйвер не принял цикл 30 мс до срока следующего
+	w.done(0, false, ms(40))
+
+	info := w.Info()[0]
+	if info.Cycles != 1 || info.Overruns != 2 || info.Skipped != 3 || info.MaxLateMs != 35 {
+		t.Fatalf("ожидалось циклов {1}, перегрузок {2}, пропусков {3}, запаздывание {35}, получено %+v", info)
+	}
+	if !w.groups[0].due.Equal(ms(40)) {
+		t.Fatalf("ожидался срок следующего цикла 40 мс, получено {%v}", w.groups[0].due.Sub(ms(0)))
+	}
+	if reports.Load() != 1 {
+		t.Fatalf("ожидалось одно уведомление о перегрузке за минуту, получено {%d}", reports.Load())
+	}
+}
+
+func TestSet_Info(t *testing.T) {
+
+	s := NewSet()
+	s.Put(New("B", []GroupT{{Period: time.Second}}, nil))
+	s.Put(New("A", []GroupT{{Period: time.Second}, {Period: 2 * time.Second}}, nil))
+	s.Put(New("B", []GroupT{{Period: 3 * time.Second}}, nil))
+
+	info := s.Info()
+	if len(info) != 3 || info[0].Name != "A" || info[2].Name != "B" || info[2].PeriodMs != 3000 {
+		t.Fatalf("неверный снимок набора: %+v", info)
+	}
+}
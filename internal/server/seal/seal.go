@@ -0,0 +1,441 @@
+package seal
+
+import (
+	hashchain "blackbox/internal/server/hashChain"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type (
+	// Печать архива за дату
+	SealT struct {
+		Date      string `json:"date"`      // дата архива (YYYY-MM-DD)
+		CntRows   int    `json:"cntrows"`   // количество строк архива за дату
+		Digest    string `json:"digest"`    // дайджест строк архива
+		Signature string `json:"signature"` // подпись (base64)
+		PublicKey string `json:"publickey"` // открытый ключ устройства (PEM)
+		TimeStamp string `json:"timestamp"` // время создания печати
+	}
+)
+
+// Ошибка при отсутствии печати за дату
+var ErrNoSeal = errors.New("печать за указанную дату отсутствует")
+
+// Генерация ключевой пары устройства и сохранение её в PEM файлы. Возвращается признак
+// создания нового ключа и ошибка.
+//
+// Если файл закрытого ключа уже существует, ключ не перезаписывается: он проверяется и,
+// при отсутствии файла открытого ключа, открытый ключ восстанавливается из закрытого.
+//
+// Параметры:
+//
+// pathPriv - путь к файлу закрытого ключа
+// pathPub - путь к файлу открытого ключа
+func GenerateKeyFiles(pathPriv, pathPub string) (created bool, err error) {
+
+	if pathPriv == "" || pathPub == "" {
+		return false, fmt.Errorf("генерация ключа -> не указан путь к файлам ключей: закрытый{%s} открытый{%s}", pathPriv, pathPub)
+	}
+
+	// Ключ уже создан
+	_, err = os.Stat(pathPriv)
+	if err == nil {
+		priv, err := LoadPrivateKey(pathPriv)
+		if err != nil {
+			return false, fmt.Errorf("генерация ключа -> существующий ключ: %v", err)
+		}
+
+		_, err = os.Stat(pathPub)
+		if err == nil {
+			return false, nil
+		}
+
+		return false, writePublicKey(pathPub, priv.Public().(ed25519.PublicKey))
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return false, fmt.Errorf("генерация ключа -> ошибка: {%v}", err)
+	}
+
+	bPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return false, fmt.Errorf("генерация ключа -> ошибка кодирования закрытого ключа: {%v}", err)
+	}
+
+	err = os.WriteFile(pathPriv, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: bPriv}), 0600)
+	if err != nil {
+		return false, fmt.Errorf("генерация ключа -> ошибка записи файла {%s}: {%v}", pathPriv, err)
+	}
+
+	return true, writePublicKey(pathPub, pub)
+}
+
+// Внутренняя функция. Запись открытого ключа в PEM файл. Возвращается ошибка.
+func writePublicKey(path string, pub ed25519.PublicKey) error {
+
+	bPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("генерация ключа -> ошибка кодирования открытого ключа: {%v}", err)
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bPub}), 0644)
+	if err != nil {
+		return fmt.Errorf("генерация ключа -> ошибка записи файла {%s}: {%v}", path, err)
+	}
+
+	return nil
+}
+
+// Чтение закрытого ключа из PEM файла. Возвращается ключ и ошибка.
+//
+// Параметры:
+//
+// path - путь к файлу закрытого ключа
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("чтение закрытого ключа -> ошибка чтения файла {%s}: {%v}", path, err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("чтение закрытого ключа -> файл {%s} не содержит PEM блока PRIVATE KEY", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("чтение закрытого ключа -> ошибка разбора: {%v}", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("чтение закрытого ключа -> ключ в файле {%s} не Ed25519", path)
+	}
+
+	return priv, nil
+}
+
+// Разбор открытого ключа из PEM. Возвращается ключ и ошибка.
+//
+// Параметры:
+//
+// b - содержимое PEM
+func ParsePublicKey(b []byte) (ed25519.PublicKey, error) {
+
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("разбор открытого ключа -> нет PEM блока PUBLIC KEY")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("разбор открытого ключа -> ошибка: {%v}", err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("разбор открытого ключа -> ключ не Ed25519")
+	}
+
+	return pub, nil
+}
+
+// Чтение открытого ключа из PEM файла. Возвращается ключ и ошибка.
+//
+// Параметры:
+//
+// path - путь к файлу открытого ключа
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("чтение открытого ключа -> ошибка чтения файла {%s}: {%v}", path, err)
+	}
+
+	return ParsePublicKey(b)
+}
+
+// Вычисление дайджеста строк архива за дату. Возвращается дайджест.
+//
+// Строки должны быть упорядочены по временной метке и id.
+//
+// Параметры:
+//
+// rows - строки архива
+func Digest(rows []hashchain.RowT) string {
+
+	h := sha256.New()
+	for _, row := range rows {
+		h.Write([]byte(hashchain.Canonical(row)))
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// Формирование подписываемого сообщения печати. Возвращается сообщение.
+//
+// Параметры:
+//
+// date - дата архива
+// cntRows - количество строк
+// digest - дайджест строк
+func message(date string, cntRows int, digest string) []byte {
+	return []byte(fmt.Sprintf("blackbox-seal;%s;%d;%s", date, cntRows, digest))
+}
+
+// Создание печати за дату. Возвращается печать.
+//
+// Параметры:
+//
+// priv - закрытый ключ устройства
+// date - дата архива
+// rows - строки архива за дату
+func Sign(priv ed25519.PrivateKey, date string, rows []hashchain.RowT) (SealT, error) {
+
+	bPub, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return SealT{}, fmt.Errorf("создание печати -> ошибка кодирования открытого ключа: {%v}", err)
+	}
+
+	s := SealT{
+		Date:      date,
+		CntRows:   len(rows),
+		Digest:    Digest(rows),
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: bPub})),
+		TimeStamp: time.Now().Format(time.RFC3339),
+	}
+	s.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, message(s.Date, s.CntRows, s.Digest)))
+
+	return s, nil
+}
+
+// Проверка печати по строкам архива и открытому ключу. Возвращается ошибка, если печать не подтверждена.
+//
+// Параметры:
+//
+// pub - открытый ключ устройства (из доверенного источника, а не из печати)
+// s - печать
+// rows - строки архива за дату
+func Verify(pub ed25519.PublicKey, s SealT, rows []hashchain.RowT) error {
+
+	if len(rows) != s.CntRows {
+		return fmt.Errorf("количество строк {%d} не совпадает с печатью {%d}", len(rows), s.CntRows)
+	}
+
+	digest := Digest(rows)
+	if digest != s.Digest {
+		return fmt.Errorf("дайджест строк {%s} не совпадает с печатью {%s}", digest, s.Digest)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("ошибка декодирования подписи: {%v}", err)
+	}
+
+	if !ed25519.Verify(pub, message(s.Date, s.CntRows, s.Digest), sig) {
+		return errors.New("подпись печати не соответствует открытому ключу")
+	}
+
+	return nil
+}
+
+// Чтение строк архива за дату в каноническом порядке. Возвращаются строки и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// date - дата архива (YYYY-MM-DD)
+func RowsByDateDB(db *sql.DB, date string) (rows []hashchain.RowT, err error) {
+
+	if db == nil {
+		return nil, errors.New("чтение строк для печати -> нет указателя на БД")
+	}
+	_, err = time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, fmt.Errorf("чтение строк для печати -> дата {%s} не в формате YYYY-MM-DD", date)
+	}
+
+	q := fmt.Sprintf(`
+	SELECT id, dev, name, COALESCE(valuetext, value::text), qual::text, timestamp, COALESCE(hash, '')
+	FROM %s.%s
+	WHERE date(timestamp) = $1
+	ORDER BY timestamp ASC, id ASC
+	;`, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"))
+
+	qRows, err := db.Query(q, date)
+	if err != nil {
+		return nil, fmt.Errorf("чтение строк для печати -> ошибка запроса: {%v}", err)
+	}
+	defer qRows.Close()
+
+	rows = make([]hashchain.RowT, 0)
+
+	for qRows.Next() {
+
+		var row hashchain.RowT
+
+		err = qRows.Scan(&row.Id, &row.Dev, &row.Name, &row.Value, &row.Qual, &row.TimeStamp, &row.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("чтение строк для печати -> ошибка чтения строки: {%v}", err)
+		}
+		rows = append(rows, row)
+	}
+
+	if err = qRows.Err(); err != nil {
+		return nil, fmt.Errorf("чтение строк для печати -> ошибка сканера строк: {%v}", err)
+	}
+
+	return rows, nil
+}
+
+// Запись печати в БД. Возвращается ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// s - печать
+func SaveDB(db *sql.DB, s SealT) error {
+
+	if db == nil {
+		return errors.New("запись печати -> нет указателя на БД")
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s.%s (date, cntrows, digest, signature, publickey) VALUES ($1, $2, $3, $4, $5)",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_SEALS"))
+
+	_, err := db.Exec(q, s.Date, s.CntRows, s.Digest, s.Signature, s.PublicKey)
+	if err != nil {
+		return fmt.Errorf("запись печати за {%s} -> ошибка: {%v}", s.Date, err)
+	}
+
+	return nil
+}
+
+// Чтение печати из БД по дате. Возвращается печать и ошибка.
+//
+// Если печати нет, возвращается ErrNoSeal.
+//
+// Параметры:
+//
+// db - указатель на БД
+// date - дата архива (YYYY-MM-DD)
+func ReadDB(db *sql.DB, date string) (s SealT, err error) {
+
+	if db == nil {
+		return SealT{}, errors.New("чтение печати -> нет указателя на БД")
+	}
+
+	q := fmt.Sprintf("SELECT to_char(date, 'YYYY-MM-DD'), cntrows, digest, signature, publickey, timestamp FROM %s.%s WHERE date = $1",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_SEALS"))
+
+	var ts time.Time
+
+	err = db.QueryRow(q, date).Scan(&s.Date, &s.CntRows, &s.Digest, &s.Signature, &s.PublicKey, &ts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SealT{}, ErrNoSeal
+	}
+	if err != nil {
+		return SealT{}, fmt.Errorf("чтение печати за {%s} -> ошибка: {%v}", date, err)
+	}
+	s.TimeStamp = ts.Format(time.RFC3339)
+
+	return s, nil
+}
+
+// Создание печатей за прошедшие даты, у которых печати ещё нет. Возвращаются даты созданных печатей и ошибка.
+//
+// Дата запечатывается не ранее чем через grace после её окончания. Даты строк и граница считаются в БД,
+// в часовом поясе сеанса БД, как и при выборке строк за дату (RowsByDateDB) и выгрузке архива.
+//
+// Параметры:
+//
+// db - указатель на БД
+// priv - закрытый ключ устройства
+// grace - запас после полуночи, до которого прошедшие сутки не запечатываются
+func SealPendingDB(db *sql.DB, priv ed25519.PrivateKey, grace time.Duration) (dates []string, err error) {
+
+	if db == nil {
+		return nil, errors.New("создание печатей -> нет указателя на БД")
+	}
+
+	schema := os.Getenv("TABLE_SCHEMA")
+
+	q := fmt.Sprintf(`
+	SELECT DISTINCT to_char(date(d.timestamp), 'YYYY-MM-DD')
+	FROM %s.%s d
+	WHERE date(d.timestamp) < date(NOW() - make_interval(secs => $1))
+	  AND NOT EXISTS (SELECT 1 FROM %s.%s s WHERE s.date = date(d.timestamp))
+	ORDER BY 1
+	;`, schema, os.Getenv("TABLE_DATA"), schema, os.Getenv("TABLE_SEALS"))
+
+	qRows, err := db.Query(q, grace.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("создание печатей -> ошибка поиска дат: {%v}", err)
+	}
+
+	pending := make([]string, 0)
+	for qRows.Next() {
+		var d string
+		err = qRows.Scan(&d)
+		if err != nil {
+			qRows.Close()
+			return nil, fmt.Errorf("создание печатей -> ошибка чтения даты: {%v}", err)
+		}
+		pending = append(pending, d)
+	}
+	err = qRows.Err()
+	qRows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("создание печатей -> ошибка сканера дат: {%v}", err)
+	}
+
+	for _, d := range pending {
+
+		rows, err := RowsByDateDB(db, d)
+		if err != nil {
+			return dates, err
+		}
+
+		s, err := Sign(priv, d, rows)
+		if err != nil {
+			return dates, err
+		}
+
+		err = SaveDB(db, s)
+		if err != nil {
+			return dates, err
+		}
+		dates = append(dates, d)
+	}
+
+	return dates, nil
+}
+
+// Приведение временной метки из выгрузки архива к виду строки архива. Возвращается временная метка и ошибка.
+//
+// Параметры:
+//
+// ts - временная метка в формате RFC3339
+func ParseTimeStamp(ts string) (time.Time, error) {
+
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(ts))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("временная метка {%s} не в формате RFC3339: {%v}", ts, err)
+	}
+
+	return hashchain.TruncTime(t), nil
+}
@@ -0,0 +1,122 @@
+package seal
+
+import (
+	hashchain "blackbox/internal/server/hashChain"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRows() []hashchain.RowT {
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC)
+
+	return []hashchain.RowT{
+		{Dev: "Dev1", Name: "Temp", Value: "21.5", Qual: "1", TimeStamp: ts},
+		{Dev: "Dev1", Name: "Press", Value: "101325", Qual: "1", TimeStamp: ts.Add(time.Second)},
+	}
+}
+
+func Test_SignVerify_Success(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Sign(priv, "2024-05-01", testRows())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Verify(pub, s, testRows())
+	if err != nil {
+		t.Errorf("ожидалось подтверждение печати, получено: %v", err)
+	}
+}
+
+func Test_SignVerify_Error(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Sign(priv, "2024-05-01", testRows())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := testRows()
+	changed[1].Value = "101326"
+
+	tests := []struct {
+		name string
+		pub  ed25519.PublicKey
+		rows []hashchain.RowT
+	}{
+		{name: "изменено значение", pub: pub, rows: changed},
+		{name: "удалена строка", pub: pub, rows: testRows()[:1]},
+		{name: "чужой ключ", pub: otherPub, rows: testRows()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Verify(tt.pub, s, tt.rows) == nil {
+				t.Error("ожидалась ошибка проверки печати")
+			}
+		})
+	}
+}
+
+func Test_ParseTimeStamp(t *testing.T) {
+
+	rows := testRows()
+
+	ts, err := ParseTimeStamp("2024-05-01T13:00:00.123456+03:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ts.Equal(rows[0].TimeStamp) {
+		t.Errorf("ожидалось {%v}, получено {%v}", rows[0].TimeStamp, ts)
+	}
+}
+
+func Test_GenerateKeyFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	pathPriv, pathPub := filepath.Join(dir, "seal.key"), filepath.Join(dir, "seal.pub")
+
+	created, err := GenerateKeyFiles(pathPriv, pathPub)
+	if err != nil || !created {
+		t.Fatalf("ожидалось создание ключа, получено: %v %v", created, err)
+	}
+	priv, err := LoadPrivateKey(pathPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Повторный вызов: ключ сохраняется, утерянный открытый ключ восстанавливается
+	os.Remove(pathPub)
+
+	created, err = GenerateKeyFiles(pathPriv, pathPub)
+	if err != nil || created {
+		t.Fatalf("ожидалось сохранение ключа, получено: %v %v", created, err)
+	}
+	priv2, err := LoadPrivateKey(pathPriv)
+	if err != nil || !priv2.Equal(priv) {
+		t.Fatalf("ключ перезаписан: %v", err)
+	}
+	pub, err := LoadPublicKey(pathPub)
+	if err != nil || !pub.Equal(priv.Public()) {
+		t.Fatalf("открытый ключ не восстановлен: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package security
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// События безопасности
+const (
+	EventLoginFailed  = "login-failed"    // неудачная попытка входа
+	EventLoginLocked  = "login-locked"    // попытка входа при блокировке
+	EventLockout      = "lockout"         // установлена блокировка входа
+	EventLockoutClear = "lockout-cleared" // блокировка снята администратором
+	EventTokenMisuse  = "token-misuse"    // токен неизвестной, истёкшей или отозванной сессии, чужое имя
+	EventAccessDenied = "access-denied"   // у роли нет права ручки
+	EventCertRejected = "cert-rejected"   // сертификат клиента не сопоставлен пользователю или не соответствует сессии
+)
+
+const (
+	nameMaxSize   = 50  // наибольшая длина имени пользователя события
+	detailMaxSize = 500 // наибольшая длина описания события
+)
+
+type (
+	// Событие безопасности
+	EventT struct {
+		Id        int       `json:"id"`
+		TimeStamp time.Time `json:"timestamp"`
+		Event     string    `json:"event"`
+		Name      string    `json:"name"`   // имя пользователя (из запроса)
+		IP        string    `json:"ip"`     // IP клиента
+		Detail    string    `json:"detail"` // описание
+	}
+)
+
+// Запись события безопасности. Возвращается ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// event - событие
+// name - имя пользователя
+// ip - IP клиента
+// detail - описание
+func Event(db *sql.DB, event, name, ip, detail string) error {
+
+	if db == nil {
+		return errors.New("нет указателя на БД")
+	}
+
+	// имя пользователя из запроса может быть любой длины
+	if r := []rune(name); len(r) > nameMaxSize {
+		name = string(r[:nameMaxSize])
+	}
+	if r := []rune(detail); len(r) > detailMaxSize {
+		detail = string(r[:detailMaxSize])
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (event, username, ip, detail) VALUES ($1, $2, $3, $4)", eventTable())
+
+	_, err := db.Exec(q, event, name, ip, detail)
+	if err != nil {
+		return fmt.Errorf("ошибка: {%v} при записи события безопасности {%s}", err, event)
+	}
+
+	return nil
+}
+
+// Чтение событий безопасности за период дат (включительно), новые первыми. Возвращается список и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// dateStart - начальная дата YYYY-MM-DD
+// dateEnd - конечная дата YYYY-MM-DD
+// limit - наибольшее количество событий
+func Events(db *sql.DB, dateStart, dateEnd string, limit int) ([]EventT, error) {
+
+	if db == nil {
+		return nil, errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`SELECT id, timestamp, event, username, ip, detail FROM %s
+	WHERE date(timestamp) BETWEEN $1 AND $2
+	ORDER BY id DESC LIMIT $3`, eventTable())
+
+	rows, err := db.Query(q, dateStart, dateEnd, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка: {%v} при чтении событий безопасности", err)
+	}
+	defer rows.Close()
+
+	res := make([]EventT, 0)
+	for rows.Next() {
+		var e EventT
+		err = rows.Scan(&e.Id, &e.TimeStamp, &e.Event, &e.Name, &e.IP, &e.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: {%v} при чтении строки события безопасности", err)
+		}
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+// Внутренняя функция. Имя таблицы событий со схемой.
+func eventTable() string {
+	return os.Getenv("TABLE_SCHEMA") + "." + os.Getenv("TABLE_SECURITY")
+}
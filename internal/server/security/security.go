@@ -0,0 +1,337 @@
+// Защита входа пользователей HTTPS сервера от подбора пароля: счётчики неудачных попыток входа по
+// пользователю и по IP, нарастающая задержка ответа и временная блокировка. Счётчики и блокировки
+// хранятся в БД, так что администратор может снять блокировку из командной строки.
+package security
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	KindUser = "user" // счётчик по имени пользователя
+	KindIP   = "ip"   // счётчик по IP клиента
+
+	DefMaxUser = 5                      // неудачных попыток до блокировки пользователя
+	DefMaxIP   = 20                     // неудачных попыток до блокировки IP
+	DefWindow  = 15 * time.Minute       // через это время без неудач счётчик сбрасывается
+	DefLock    = 15 * time.Minute       // время блокировки
+	DefDelay   = 500 * time.Millisecond // задержка ответа после второй неудачи подряд, удваивается
+	maxDelay   = 10 * time.Second       // наибольшая задержка ответа
+)
+
+type (
+	// Настройки защиты входа. Нулевые поля - значения по умолчанию.
+	ConfT struct {
+		MaxUser int           // неудачных попыток до блокировки пользователя
+		MaxIP   int           // неудачных попыток до блокировки IP
+		Window  time.Duration // через это время без неудач счётчик сбрасывается
+		Lock    time.Duration // время блокировки
+		Delay   time.Duration // начальная задержка ответа (отрицательная - без задержки)
+	}
+
+	// Счётчик неудачных попыток входа
+	LockT struct {
+		Kind        string    `json:"kind"`        // user или ip
+		Subject     string    `json:"subject"`     // имя пользователя или IP
+		Failures    int       `json:"failures"`    // неудачных попыток подряд
+		LastFail    time.Time `json:"lastFail"`    // время последней неудачи
+		LockedUntil time.Time `json:"lockedUntil"` // окончание блокировки (нулевое - нет блокировки)
+	}
+
+	// Результат учёта попытки входа
+	FailT struct {
+		Failures    int           // наибольший из счётчиков пользователя и IP
+		Delay       time.Duration // задержка ответа
+		Locked      []LockT       // блокировки, установленные этой попыткой
+		LockedUntil time.Time     // окончание блокировки (нулевое - нет блокировки)
+	}
+)
+
+// Ошибка: блокировки нет
+var ErrNoLock = errors.New("блокировки нет")
+
+// Разбор настроек защиты входа. Пустая строка - значение по умолчанию. Возвращаются настройки и ошибка.
+//
+// Параметры:
+//
+// maxUser - неудачных попыток до блокировки пользователя
+// maxIP - неудачных попыток до блокировки IP
+// windowMin - время сброса счётчика, мин
+// lockMin - время блокировки, мин
+// delayMs - начальная задержка ответа, мс (0 - без задержки)
+func ParseConf(maxUser, maxIP, windowMin, lockMin, delayMs string) (ConfT, error) {
+
+	conf := ConfT{
+		MaxUser: DefMaxUser,
+		MaxIP:   DefMaxIP,
+		Window:  DefWindow,
+		Lock:    DefLock,
+		Delay:   DefDelay,
+	}
+
+	for _, el := range []struct {
+		name string
+		val  string
+		min  int
+		set  func(int)
+	}{
+		{"неудачных попыток пользователя", maxUser, 1, func(v int) { conf.MaxUser = v }},
+		{"неудачных попыток IP", maxIP, 1, func(v int) { conf.MaxIP = v }},
+		{"времени сброса счётчика", windowMin, 1, func(v int) { conf.Window = time.Duration(v) * time.Minute }},
+		{"времени блокировки", lockMin, 1, func(v int) { conf.Lock = time.Duration(v) * time.Minute }},
+		{"задержки ответа", delayMs, 0, func(v int) { conf.Delay = noDelay(time.Duration(v) * time.Millisecond) }},
+	} {
+		if el.val == "" {
+			continue
+		}
+		v, err := strconv.Atoi(el.val)
+		if err != nil || v < el.min {
+			return ConfT{}, fmt.Errorf("недопустимое значение %s {%s}", el.name, el.val)
+		}
+		el.set(v)
+	}
+
+	return conf, nil
+}
+
+// Задержка ответа после неудачной попытки: первая неудача - без задержки, далее начальная задержка
+// удваивается с каждой неудачей. Возвращается задержка.
+//
+// Параметры:
+//
+// failures - неудачных попыток подряд
+func (c ConfT) DelayFor(failures int) time.Duration {
+
+	c = c.norm()
+	if c.Delay <= 0 || failures < 2 {
+		return 0
+	}
+
+	d := c.Delay
+	for i := 2; i < failures && d < maxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, maxDelay)
+}
+
+// Учёт попытки входа до проверки пароля. Попытка атомарно засчитывается в счётчики пользователя
+// (в том числе неизвестного) и IP, так что параллельные попытки не проходят порог. Попытка сверх порога
+// устанавливает блокировку; при блокировке (новой или действующей) пароль не проверяется.
+// Успешный вход возвращает попытку функцией Success. Возвращается результат учёта и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// conf - настройки защиты
+// name - имя пользователя
+// ip - IP клиента
+func Attempt(db *sql.DB, conf ConfT, name, ip string) (res FailT, err error) {
+
+	if db == nil {
+		return FailT{}, errors.New("нет указателя на БД")
+	}
+	conf = conf.norm()
+
+	counters := []struct {
+		kind    string
+		subject string
+		max     int
+	}{
+		{KindIP, ip, conf.MaxIP},
+		{KindUser, name, conf.MaxUser},
+	}
+
+	for _, c := range counters {
+		if c.subject == "" {
+			continue
+		}
+
+		// Действующая блокировка счётчик не изменяет
+		q := fmt.Sprintf(`INSERT INTO %s AS t (kind, subject, failures, lastfail) VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (kind, subject) DO UPDATE SET
+			failures = CASE WHEN t.lockeduntil > NOW() THEN t.failures
+				WHEN t.lastfail < NOW() - make_interval(secs => $3) THEN 1 ELSE t.failures + 1 END,
+			lastfail = CASE WHEN t.lockeduntil > NOW() THEN t.lastfail ELSE NOW() END
+		RETURNING failures, COALESCE(lockeduntil, 'epoch')`, lockTable())
+
+		var n int
+		var until time.Time
+		err = db.QueryRow(q, c.kind, c.subject, conf.Window.Seconds()).Scan(&n, &until)
+		if err != nil {
+			return FailT{}, fmt.Errorf("ошибка: {%v} при учёте попытки входа {%s/%s}", err, c.kind, c.subject)
+		}
+
+		if until.After(time.Now()) {
+			if until.After(res.LockedUntil) {
+				res.LockedUntil = until
+			}
+			continue
+		}
+		res.Failures = max(res.Failures, n)
+
+		if n <= c.max {
+			continue
+		}
+
+		// Блокировка. Счётчик начинается заново после её окончания.
+		q = fmt.Sprintf(`UPDATE %s SET failures = 0, lockeduntil = NOW() + make_interval(secs => $3)
+		WHERE kind = $1 AND subject = $2
+		RETURNING lastfail, lockeduntil`, lockTable())
+
+		lock := LockT{Kind: c.kind, Subject: c.subject, Failures: n - 1}
+		err = db.QueryRow(q, c.kind, c.subject, conf.Lock.Seconds()).Scan(&lock.LastFail, &lock.LockedUntil)
+		if err != nil {
+			return FailT{}, fmt.Errorf("ошибка: {%v} при блокировке входа {%s/%s}", err, c.kind, c.subject)
+		}
+		res.Locked = append(res.Locked, lock)
+		if lock.LockedUntil.After(res.LockedUntil) {
+			res.LockedUntil = lock.LockedUntil
+		}
+	}
+
+	res.Delay = conf.DelayFor(res.Failures)
+
+	return res, nil
+}
+
+// Сброс счётчика пользователя после успешного входа и возврат попытки в счётчик IP.
+// Действующие блокировки сохраняются. Возвращается ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// name - имя пользователя
+// ip - IP клиента
+func Success(db *sql.DB, name, ip string) error {
+
+	if db == nil {
+		return errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`DELETE FROM %s WHERE kind = $1 AND subject = $2
+	AND (lockeduntil IS NULL OR lockeduntil <= NOW())`, lockTable())
+
+	_, err := db.Exec(q, KindUser, name)
+	if err != nil {
+		return fmt.Errorf("ошибка: {%v} при сбросе счётчика неудачных попыток входа пользователя {%s}", err, name)
+	}
+
+	q = fmt.Sprintf(`UPDATE %s SET failures = GREATEST(failures - 1, 0) WHERE kind = $1 AND subject = $2
+	AND (lockeduntil IS NULL OR lockeduntil <= NOW())`, lockTable())
+
+	_, err = db.Exec(q, KindIP, ip)
+	if err != nil {
+		return fmt.Errorf("ошибка: {%v} при учёте успешного входа с {%s}", err, ip)
+	}
+
+	return nil
+}
+
+// Список действующих блокировок и счётчиков неудачных попыток входа. Возвращается список и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+func Lockouts(db *sql.DB) ([]LockT, error) {
+
+	if db == nil {
+		return nil, errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`SELECT kind, subject, failures, lastfail, COALESCE(lockeduntil, 'epoch') FROM %s
+	WHERE lockeduntil > NOW() OR failures > 0
+	ORDER BY lockeduntil DESC NULLS LAST, lastfail DESC`, lockTable())
+
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка: {%v} при чтении блокировок входа", err)
+	}
+	defer rows.Close()
+
+	res := make([]LockT, 0)
+	for rows.Next() {
+		var l LockT
+		err = rows.Scan(&l.Kind, &l.Subject, &l.Failures, &l.LastFail, &l.LockedUntil)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: {%v} при чтении строки блокировки входа", err)
+		}
+		if !l.LockedUntil.After(time.Now()) {
+			l.LockedUntil = time.Time{}
+		}
+		res = append(res, l)
+	}
+
+	return res, rows.Err()
+}
+
+// Снятие блокировки и сброс счётчика неудачных попыток входа. Возвращается ошибка (ErrNoLock - нет такого счётчика).
+//
+// Параметры:
+//
+// db - указатель на БД
+// kind - user или ip
+// subject - имя пользователя или IP
+func Clear(db *sql.DB, kind, subject string) error {
+
+	if db == nil {
+		return errors.New("нет указателя на БД")
+	}
+	if kind != KindUser && kind != KindIP {
+		return fmt.Errorf("недопустимый вид блокировки {%s}, допускается: %s, %s", kind, KindUser, KindIP)
+	}
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE kind = $1 AND subject = $2", lockTable())
+
+	res, err := db.Exec(q, kind, subject)
+	if err != nil {
+		return fmt.Errorf("ошибка: {%v} при снятии блокировки входа {%s/%s}", err, kind, subject)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoLock
+	}
+
+	return nil
+}
+
+// Внутренняя функция. Значения по умолчанию для нулевых полей настроек.
+func (c ConfT) norm() ConfT {
+
+	if c.MaxUser <= 0 {
+		c.MaxUser = DefMaxUser
+	}
+	if c.MaxIP <= 0 {
+		c.MaxIP = DefMaxIP
+	}
+	if c.Window <= 0 {
+		c.Window = DefWindow
+	}
+	if c.Lock <= 0 {
+		c.Lock = DefLock
+	}
+	if c.Delay == 0 {
+		c.Delay = DefDelay
+	}
+
+	return c
+}
+
+// Внутренняя функция. Нулевая задержка ответа в настройках - отрицательная (нулевое поле - по умолчанию).
+func noDelay(d time.Duration) time.Duration {
+
+	if d == 0 {
+		return -1
+	}
+
+	return d
+}
+
+// Внутренняя функция. Имя таблицы счётчиков со схемой.
+func lockTable() string {
+	return os.Getenv("TABLE_SCHEMA") + "." + os.Getenv("TABLE_LOCKOUTS")
+}
@@ -0,0 +1,60 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseConf(t *testing.T) {
+
+	conf, err := ParseConf("", "", "", "", "")
+	if err != nil || conf != (ConfT{DefMaxUser, DefMaxIP, DefWindow, DefLock, DefDelay}) {
+		t.Fatalf("по умолчанию: %+v, %v", conf, err)
+	}
+
+	conf, err = ParseConf("3", "10", "5", "30", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MaxUser != 3 || conf.MaxIP != 10 || conf.Window != 5*time.Minute || conf.Lock != 30*time.Minute {
+		t.Fatalf("настройки: %+v", conf)
+	}
+	if d := conf.DelayFor(5); d != 0 {
+		t.Fatalf("задержка 0 задана явно, получено %v", d)
+	}
+
+	for _, args := range [][5]string{
+		{"0", "", "", "", ""},
+		{"", "x", "", "", ""},
+		{"", "", "-1", "", ""},
+		{"", "", "", "0", ""},
+		{"", "", "", "", "-5"},
+	} {
+		if _, err := ParseConf(args[0], args[1], args[2], args[3], args[4]); err == nil {
+			t.Fatalf("%v: ожидалась ошибка", args)
+		}
+	}
+}
+
+func TestDelayFor(t *testing.T) {
+
+	conf := ConfT{Delay: 100 * time.Millisecond}
+
+	for failures, want := range map[int]time.Duration{
+		0:  0,
+		1:  0,
+		2:  100 * time.Millisecond,
+		3:  200 * time.Millisecond,
+		5:  800 * time.Millisecond,
+		50: maxDelay,
+	} {
+		if got := conf.DelayFor(failures); got != want {
+			t.Fatalf("%d: ожидалось %v, получено %v", failures, want, got)
+		}
+	}
+
+	// нулевые настройки - задержка по умолчанию
+	if got := (ConfT{}).DelayFor(2); got != DefDelay {
+		t.Fatalf("по умолчанию: ожидалось %v, получено %v", DefDelay, got)
+	}
+}
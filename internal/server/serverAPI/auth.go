@@ -0,0 +1,503 @@
+package serverAPI
+
+import (
+	loger "blackbox/internal/server/loger"
+	"blackbox/internal/server/mtls"
+	"blackbox/internal/server/role"
+	"blackbox/internal/server/security"
+	"blackbox/internal/server/session"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Наибольшее количество событий безопасности в ответе
+const maxEvents = 1000
+
+type (
+	// Ключ контекста запроса для пользователя, сессия которого проверена
+	userCtxKeyT struct{}
+
+	// Ключ контекста запроса для пользователя проверенного сертификата клиента
+	certCtxKeyT struct{}
+
+	// Пользователь проверенного сертификата клиента
+	certUserT struct {
+		name string // имя пользователя (CommonName сертификата)
+		only bool   // режим cert: токен сессии не обязателен
+	}
+)
+
+// Проверка сертификата клиента HTTPS сервера (mTLS). Сертификат проверен при установке соединения, функция
+// сопоставляет его пользователю TABLE_USERS по CommonName. Клиент, сертификат которого не сопоставлен пользователю,
+// получает ответ 403. Пользователь сертификата передаётся дальше в контексте запроса. В режиме off обёртка
+// не меняет обработку. Возвращается обёртка обработчика.
+//
+// Параметры:
+//
+// db - указатель на БД
+// lgr - логеры
+// mode - режим аутентификации клиентов
+func ClientCert(db *sql.DB, lgr loger.Log_Object, mode mtls.ModeT) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		if mode == mtls.ModeOff {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			prefix := "https-cert " + r.URL.Path
+
+			name, err := mtls.User(r)
+			if err != nil {
+				lgr.W.Printf("%s -> отказ клиенту {%s}: %v", prefix, clientIP(r), err)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			_, err = readRoleUserDB(name, db)
+			if err != nil {
+				lgr.W.Printf("%s -> сертификат клиента {%s} не сопоставлен пользователю: %v", prefix, name, err)
+				securityEvent(db, lgr, security.EventCertRejected, name, clientIP(r), prefix+": нет такого пользователя")
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			cu := certUserT{name: name, only: mode == mtls.ModeCert}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), certCtxKeyT{}, cu)))
+		})
+	}
+}
+
+// Проверка доступа к ручке HTTPS сервера: сессия пользователя и право его роли. Пользователь, роль которого
+// не имеет права, получает ответ 403. Пользователь проверенной сессии передаётся обработчику в контексте запроса.
+// Возвращается обёртка обработчика.
+//
+// Параметры:
+//
+// db - указатель на БД
+// lgr - логеры
+// perm - право доступа ручки
+func Access(db *sql.DB, lgr loger.Log_Object, perm role.PermT) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			prefix := "https-access " + r.URL.Path
+
+			user, ok := checkSession(w, r, db, lgr, prefix)
+			if !ok {
+				return
+			}
+
+			userRole, err := readRoleUserDB(user, db)
+			if err != nil {
+				lgr.E.Printf("%s -> ошибка при чтении роли пользователя {%s}: {%v}", prefix, user, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if !role.Allowed(userRole, perm) {
+				lgr.W.Printf("%s -> отказ пользователю {%s}: у роли {%s} нет права {%s}", prefix, user, userRole, perm)
+				securityEvent(db, lgr, security.EventAccessDenied, user, clientIP(r),
+					fmt.Sprintf("%s: у роли {%s} нет права {%s}", r.URL.Path, userRole, perm))
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userCtxKeyT{}, user)))
+		})
+	}
+}
+
+// Проверка сессии пользователя по токену заголовка authorization. Общая для обработчиков HTTPS сервера.
+// При отказе ответ клиенту формируется функцией. Возвращается имя пользователя сессии и признак успеха.
+//
+// Параметры:
+//
+// w - ответ
+// r - запрос
+// db - указатель на БД
+// lgr - логеры
+// prefix - обработчик, для логов
+// name - имя пользователя из запроса (пусто - имя не сверяется)
+func authorize(w http.ResponseWriter, r *http.Request, db *sql.DB, lgr loger.Log_Object, prefix, name string) (string, bool) {
+
+	// Сессия проверена при проверке доступа к ручке
+	user, ok := r.Context().Value(userCtxKeyT{}).(string)
+	if !ok {
+		user, ok = checkSession(w, r, db, lgr, prefix)
+		if !ok {
+			return "", false
+		}
+	}
+
+	if name != "" && name != user {
+		lgr.W.Printf("%s -> имя пользователя {%s} не соответствует сессии пользователя {%s}", prefix, name, user)
+		securityEvent(db, lgr, security.EventTokenMisuse, name, clientIP(r),
+			fmt.Sprintf("%s: токен сессии пользователя {%s}", prefix, user))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return "", false
+	}
+
+	return user, true
+}
+
+// Внутренняя функция. Проверка сессии по токену запроса. В режиме cert запрос без токена принимается от пользователя
+// сертификата клиента; токен, если он есть, и в режимах cert и cert+token должен принадлежать этому пользователю.
+// При отказе ответ клиенту формируется функцией. Возвращается имя пользователя сессии и признак успеха.
+func checkSession(w http.ResponseWriter, r *http.Request, db *sql.DB, lgr loger.Log_Object, prefix string) (string, bool) {
+
+	token := session.TokenFromHeader(r.Header.Get("authorization"))
+
+	cu, cert := r.Context().Value(certCtxKeyT{}).(certUserT)
+	if cert && cu.only && token == "" {
+		return cu.name, true
+	}
+
+	user, err := session.Check(db, token, clientIP(r))
+
+	switch {
+	case errors.Is(err, session.ErrNoToken):
+		lgr.W.Printf("%s -> в принятом запросе нет токена", prefix)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return "", false
+
+	case errors.Is(err, session.ErrInvalid):
+		lgr.W.Printf("%s -> сессия по принятому токену не найдена, истекла или отозвана", prefix)
+		securityEvent(db, lgr, security.EventTokenMisuse, "", clientIP(r), prefix+": "+err.Error())
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return "", false
+
+	case err != nil:
+		lgr.E.Printf("%s -> ошибка при проверке сессии: {%v}", prefix, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return "", false
+	}
+
+	if cert && !certMatch(w, r, db, lgr, prefix, cu, user) {
+		return "", false
+	}
+
+	return user, true
+}
+
+// Внутренняя функция. Сверка пользователя с пользователем сертификата клиента (при его наличии).
+// При несовпадении клиенту передаётся ответ 403. Возвращается признак совпадения.
+func certMatch(w http.ResponseWriter, r *http.Request, db *sql.DB, lgr loger.Log_Object, prefix string, cu certUserT, name string) bool {
+
+	if name == cu.name {
+		return true
+	}
+
+	lgr.W.Printf("%s -> пользователь {%s} не соответствует сертификату клиента {%s}", prefix, name, cu.name)
+	securityEvent(db, lgr, security.EventCertRejected, name, clientIP(r),
+		fmt.Sprintf("%s: сертификат пользователя {%s}", prefix, cu.name))
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+	return false
+}
+
+// Внутренняя функция. Сверка пользователя сессии запроса с пользователем сертификата клиента. Без сертификата
+// (режим off) сверка не выполняется. При отказе ответ клиенту формируется функцией. Возвращается признак успеха.
+func certSession(w http.ResponseWriter, r *http.Request, db *sql.DB, lgr loger.Log_Object, prefix string) bool {
+
+	if _, cert := r.Context().Value(certCtxKeyT{}).(certUserT); !cert {
+		return true
+	}
+
+	_, ok := checkSession(w, r, db, lgr, prefix)
+
+	return ok
+}
+
+// Внутренняя функция. Чтение роли пользователя. Возвращается роль и ошибка.
+func readRoleUserDB(name string, db *sql.DB) (userRole string, err error) {
+
+	q := fmt.Sprintf("SELECT role FROM %s.%s WHERE name = $1",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"))
+
+	err = db.QueryRow(q, name).Scan(&userRole)
+	if err != nil {
+		return "", fmt.Errorf("ошибка: {%v} при чтении роли пользователя: {%s}", err, name)
+	}
+
+	return userRole, nil
+}
+
+// Обработчик выхода пользователя: отзыв сессии по токену запроса.
+func (el *SessionUserT) HandlHttpsLogout(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		el.Lgr.W.Printf("https-logout -> принят запрос с методом:{%s}, а нужен:{%s}", r.Method, http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Токен должен принадлежать пользователю сертификата клиента
+	if !certSession(w, r, el.DB, el.Lgr, "https-logout") {
+		return
+	}
+
+	name, err := session.Revoke(el.DB, session.TokenFromHeader(r.Header.Get("authorization")))
+	if !el.sessionErr(w, "https-logout", err) {
+		return
+	}
+
+	el.Lgr.I.Printf("https-logout -> пользователь {%s} завершил сессию", name)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Обработчик продления сессии: токен запроса отзывается, передаётся новый токен.
+func (el *SessionUserT) HandlHttpsRefresh(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		el.Lgr.W.Printf("https-refresh -> принят запрос с методом:{%s}, а нужен:{%s}", r.Method, http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Токен должен принадлежать пользователю сертификата клиента
+	if !certSession(w, r, el.DB, el.Lgr, "https-refresh") {
+		return
+	}
+
+	name, token, expires, err := session.Refresh(el.DB, session.TokenFromHeader(r.Header.Get("authorization")), clientIP(r), el.TTL)
+	if !el.sessionErr(w, "https-refresh", err) {
+		return
+	}
+
+	dataTx, err := json.Marshal(TokenT{Token: token, Expires: expires.Format(time.RFC3339)})
+	if err != nil {
+		el.Lgr.E.Printf("https-refresh -> ошибка {%v} сериализации токена", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	el.Lgr.I.Printf("https-refresh -> сессия пользователя {%s} продлена до {%s}", name, expires.Format("2006-01-02 15:04:05"))
+	w.Header().Set("Content-Type", "application-json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dataTx)
+}
+
+// Внутренняя функция. Ответ клиенту по ошибке операции с сессией. Возвращается true при отсутствии ошибки.
+func (el *SessionUserT) sessionErr(w http.ResponseWriter, prefix string, err error) bool {
+
+	switch {
+	case err == nil:
+		return true
+
+	case errors.Is(err, session.ErrNoToken):
+		el.Lgr.W.Printf("%s -> в принятом запросе нет токена", prefix)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+	case errors.Is(err, session.ErrInvalid):
+		el.Lgr.W.Printf("%s -> сессия по принятому токену не найдена, истекла или отозвана", prefix)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+	default:
+		el.Lgr.E.Printf("%s -> ошибка: {%v}", prefix, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	return false
+}
+
+// Обработчик запроса списка блокировок и счётчиков неудачных попыток входа.
+func (el *SecurityT) HandlHttpsLockouts(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := authorize(w, r, el.DB, el.Lgr, "https-lockouts", "")
+	if !ok {
+		return
+	}
+
+	list, err := security.Lockouts(el.DB)
+	if err != nil {
+		el.Lgr.E.Printf("https-lockouts -> %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bTx, err := json.Marshal(list)
+	if err != nil {
+		el.Lgr.W.Println("https-lockouts -> ошибка сериализации списка блокировок")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	el.Lgr.I.Printf("https-lockouts -> пользователь {%s} запросил блокировки входа", user)
+	w.Header().Set("Content-Type", "application-json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
+// Обработчик запроса снятия блокировки входа пользователя или IP.
+func (el *SecurityT) HandlHttpsLockoutClear(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := authorize(w, r, el.DB, el.Lgr, "https-lockout-clear", "")
+	if !ok {
+		return
+	}
+
+	bytesBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		el.Lgr.W.Println("https-lockout-clear -> ошибка чтения тела запроса")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var reqBody LockKeyT
+	err = json.Unmarshal(bytesBody, &reqBody)
+	if err != nil || reqBody.Subject == "" {
+		el.Lgr.W.Println("https-lockout-clear -> в принятом запросе нет вида и субъекта блокировки")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	err = security.Clear(el.DB, reqBody.Kind, reqBody.Subject)
+	if errors.Is(err, security.ErrNoLock) {
+		el.Lgr.W.Printf("https-lockout-clear -> блокировки {%s/%s} нет", reqBody.Kind, reqBody.Subject)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		el.Lgr.W.Printf("https-lockout-clear -> %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	detail := fmt.Sprintf("%s {%s}: снята пользователем {%s}", reqBody.Kind, reqBody.Subject, user)
+	securityEvent(el.DB, el.Lgr, security.EventLockoutClear, user, clientIP(r), detail)
+
+	el.Lgr.I.Printf("https-lockout-clear -> блокировка входа %s", detail)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Обработчик запроса событий безопасности за период дат.
+func (el *SecurityT) HandlHttpsEvents(w http.ResponseWriter, r *http.Request) {
+
+	bytesBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		el.Lgr.W.Println("https-events -> ошибка чтения тела запроса")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var reqBody DateRangeNameT
+	err = json.Unmarshal(bytesBody, &reqBody)
+	if err != nil {
+		el.Lgr.W.Println("https-events -> ошибка при десериализации тела запроса")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authorize(w, r, el.DB, el.Lgr, "https-events", reqBody.Name)
+	if !ok {
+		return
+	}
+
+	for _, d := range []string{reqBody.DateStart, reqBody.DateEnd} {
+		if _, err = time.Parse("2006-01-02", d); err != nil {
+			el.Lgr.W.Printf("https-events -> в принятом запросе, дата {%s} не в формате YYYY-MM-DD", d)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := security.Events(el.DB, reqBody.DateStart, reqBody.DateEnd, maxEvents)
+	if err != nil {
+		el.Lgr.E.Printf("https-events -> %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bTx, err := json.Marshal(list)
+	if err != nil {
+		el.Lgr.W.Println("https-events -> ошибка сериализации событий")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	el.Lgr.I.Printf("https-events -> пользователь {%s} запросил события безопасности с {%s} по {%s}", user, reqBody.DateStart, reqBody.DateEnd)
+	w.Header().Set("Content-Type", "application-json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
+// Внутренняя функция. Учёт попытки входа до проверки пароля: счётчики, блокировка и события безопасности.
+// При блокировке отправляется ответ 429. Возвращается результат учёта и признак продолжения входа.
+func (el *LoginUserT) loginAttempt(w http.ResponseWriter, name, ip string) (security.FailT, bool) {
+
+	res, err := security.Attempt(el.DB, el.Guard, name, ip)
+	if err != nil {
+		el.Lgr.E.Printf("https-registration -> %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return res, false
+	}
+
+	for _, l := range res.Locked {
+		detail := fmt.Sprintf("%s {%s} заблокирован до %s после %d неудачных попыток входа",
+			l.Kind, l.Subject, l.LockedUntil.Format(time.RFC3339), l.Failures)
+		el.Lgr.W.Printf("https-registration -> %s", detail)
+		securityEvent(el.DB, el.Lgr, security.EventLockout, name, ip, detail)
+	}
+
+	if !res.LockedUntil.IsZero() {
+		el.Lgr.W.Printf("https-registration -> вход пользователя {%s} с {%s} заблокирован до {%s}", name, ip, res.LockedUntil.Format("2006-01-02 15:04:05"))
+		securityEvent(el.DB, el.Lgr, security.EventLoginLocked, name, ip, "блокировка до "+res.LockedUntil.Format(time.RFC3339))
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(res.LockedUntil).Seconds())+1))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return res, false
+	}
+
+	return res, true
+}
+
+// Внутренняя функция. Неудачная попытка входа (уже учтённая loginAttempt): событие безопасности,
+// нарастающая задержка и ответ 403, одинаковый для неизвестного пользователя и неверного пароля.
+func (el *LoginUserT) loginFailed(w http.ResponseWriter, r *http.Request, res security.FailT, name, ip, reason string) {
+
+	securityEvent(el.DB, el.Lgr, security.EventLoginFailed, name, ip, reason)
+
+	// Нарастающая задержка ответа. Обрыв соединения клиентом завершает ожидание.
+	if res.Delay > 0 {
+		t := time.NewTimer(res.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+		}
+	}
+
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+// Внутренняя функция. Запись события безопасности. Ошибка записи фиксируется в логе.
+func securityEvent(db *sql.DB, lgr loger.Log_Object, event, name, ip, detail string) {
+
+	err := security.Event(db, event, name, ip, detail)
+	if err != nil {
+		lgr.W.Printf("событие безопасности {%s} пользователя {%s} с {%s}: %s -> не записано: %v", event, name, ip, detail, err)
+	}
+}
+
+// Внутренняя функция. IP клиента запроса.
+func clientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -1,8 +1,13 @@
 package serverAPI
 
 import (
+	"blackbox/internal/server/diagnostics"
+	hashchain "blackbox/internal/server/hashChain"
 	loger "blackbox/internal/server/loger"
-	"crypto/sha256"
+	"blackbox/internal/server/password"
+	"blackbox/internal/server/seal"
+	"blackbox/internal/server/security"
+	"blackbox/internal/server/session"
 	"errors"
 	"fmt"
 	"os"
@@ -35,7 +40,8 @@ type (
 
 	// Для токена
 	TokenT struct {
-		Token string `json:"token"`
+		Token   string `json:"token"`
+		Expires string `json:"expires"` // окончание сессии, RFC3339
 	}
 
 	// Для передачи состояния сервера
@@ -43,6 +49,12 @@ type (
 		TimeStart string
 		MbRTU     []InfoModbusRTUT
 		MbTCP     []InfoModbusTCPT
+		Workers   []InfoWorkerT
+		Poll      []InfoPollT
+		Buffer    InfoBufferT
+		Writer    InfoWriterT
+		Heartbeat InfoHeartbeatT
+		Gateway   InfoGatewayT
 		SizeF     SizeFilesT
 		DB        *sql.DB
 		Lgr       loger.Log_Object
@@ -53,6 +65,12 @@ type (
 		TimeStart string           `json:"timeStart"`
 		MbRTU     []InfoModbusRTUT `json:"mbRTU"`
 		MbTCP     []InfoModbusTCPT `json:"mbTCP"`
+		Workers   []InfoWorkerT    `json:"workers"`
+		Poll      []InfoPollT      `json:"poll"`
+		Buffer    InfoBufferT      `json:"buffer"`
+		Writer    InfoWriterT      `json:"writer"`
+		Heartbeat InfoHeartbeatT   `json:"heartbeat"`
+		Gateway   InfoGatewayT     `json:"gateway"`
 		SizeF     SizeFilesT       `json:"sizeFiles"`
 	}
 	InfoModbusRTUT struct {
@@ -66,8 +84,60 @@ type (
 		}
 	}
 	InfoModbusTCPT struct {
-		ConName string
-		Con     string
+		ConName    string
+		Con        string
+		State      string // состояние подключения: connected, reconnecting, failed
+		LastErr    string // последняя ошибка подключения
+		Reconnects int    // количество переподключений
+		Since      string // время перехода в текущее состояние
+	}
+	InfoWorkerT struct {
+		Name        string // наименование рабочей Go рутины
+		State       string // состояние: running, restarting, stopped
+		Restarts    int    // количество перезапусков
+		LastErr     string // причина последнего сбоя
+		LastErrTime string // время последнего сбоя
+		Since       string // время перехода в текущее состояние
+	}
+	InfoPollT struct {
+		Name       string  // наименование очереди опроса
+		PeriodMs   int64   // период опроса группы, мс
+		OffsetMs   int64   // смещение фазы группы, мс
+		Cycles     uint64  // выполнено циклов
+		Overruns   uint64  // случаев перегрузки
+		Skipped    uint64  // пропущено циклов
+		LastLateMs float64 // запаздывание последнего цикла, мс
+		MaxLateMs  float64 // наибольшее запаздывание цикла, мс
+	}
+	InfoBufferT struct {
+		Records int64 // строк архива в буфере, ожидающих записи в БД
+		Bytes   int64 // объём буфера, байт
+		Dead    int64 // строк архива в карантине (отклонены БД)
+	}
+	InfoWriterT struct {
+		Rows        uint64  // записано строк архива
+		Batches     uint64  // записано пачек
+		AvgBatch    float64 // средний размер пачки, строк
+		AvgFlushMs  float64 // среднее время записи пачки, мс
+		LastFlushMs float64 // время записи последней пачки, мс
+		LastFlush   string  // время записи последней пачки
+		RowsPerSec  float64 // скорость записи за последнюю минуту, строк/с
+	}
+	InfoHeartbeatT struct {
+		State  string // состояние сигнала активности: off, active, stopped
+		Reason string // причина остановки
+		Value  string // последнее записанное значение
+		Since  string // время перехода в текущее состояние
+	}
+	InfoGatewayT struct {
+		State      string // состояние шлюза Modbus-TCP: off, listening, failed
+		Address    string // адрес прослушивания
+		Tags       int    // количество тэгов
+		Clients    int    // подключено клиентов
+		Requests   uint64 // обслужено запросов
+		Exceptions uint64 // ответов исключением
+		LastErr    string // последняя ошибка
+		Since      string // время перехода в текущее состояние
 	}
 	SizeFilesT struct {
 		I int64
@@ -90,16 +160,40 @@ type (
 		Data      []DataElT `json:"datadb"`
 	}
 	DataElT struct {
+		Dev       string
 		Name      string
 		Value     string
 		Qual      string
 		TimeStamp string
+		Hash      string
+		Unit      string // единица измерения тэга
 	}
 
 	// Для регистрации пользователя на https сервере
 	LoginUserT struct {
+		DB    *sql.DB
+		Lgr   loger.Log_Object
+		TTL   time.Duration  // время жизни сессии (0 - по умолчанию)
+		Guard security.ConfT // защита входа от подбора пароля
+	}
+
+	// Для просмотра и снятия блокировок входа, просмотра событий безопасности
+	SecurityT struct {
+		DB  *sql.DB
+		Lgr loger.Log_Object
+	}
+
+	// Счётчик неудачных попыток входа для снятия блокировки
+	LockKeyT struct {
+		Kind    string `json:"kind"`    // user или ip
+		Subject string `json:"subject"` // имя пользователя или IP
+	}
+
+	// Для выхода пользователя и продления сессии
+	SessionUserT struct {
 		DB  *sql.DB
 		Lgr loger.Log_Object
+		TTL time.Duration // время жизни сессии (0 - по умолчанию)
 	}
 
 	// Для получения количества строк БД по дате
@@ -125,8 +219,56 @@ type (
 		NumbReq int       `json:"numbreq"`
 		Data    []DataElT `json:"data"`
 	}
+
+	// Для периода дат и имени
+	DateRangeNameT struct {
+		DateStart string `json:"datestart"`
+		DateEnd   string `json:"dateend"`
+		Name      string `json:"name"`
+	}
+
+	// Для проверки цепочки хэшей архива
+	VerifyChainT struct {
+		DB  *sql.DB
+		Lgr loger.Log_Object
+	}
+
+	// Для получения печати архива за дату
+	SealByDateT struct {
+		DB  *sql.DB
+		Lgr loger.Log_Object
+	}
+
+	// Для предоставления диагностики обмена с устройствами
+	DiagnosticsT struct {
+		Lgr      loger.Log_Object
+		Snapshot func() []diagnostics.CountersT // снимок счётчиков обмена
+	}
+
+	// Для записи значения тэга в устройство
+	WriteTagT struct {
+		DB    *sql.DB
+		Lgr   loger.Log_Object
+		Write func(dev, tag, value string) error // выполнение записи драйвером устройства
+	}
+
+	// Тело запроса записи значения тэга
+	WriteReqT struct {
+		Name  string `json:"name"`
+		Dev   string `json:"dev"`
+		Tag   string `json:"tag"`
+		Value string `json:"value"`
+	}
+
+	// Результат записи значения тэга
+	WriteResT struct {
+		Result string `json:"result"`
+	}
 )
 
+// Ошибка в запросе записи: нет такого тэга записи или значение не соответствует типу
+var ErrWriteReq = errors.New("ошибка в запросе записи")
+
 // Обработчик запроса на предоставление состояния Go рутин
 func (el *StatusServerT) HandlHttpsStatusSrv(w http.ResponseWriter, r *http.Request) {
 
@@ -149,14 +291,6 @@ func (el *StatusServerT) HandlHttpsStatusSrv(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Чтение заголовков звпроса
-	token := r.Header.Get("authorization")
-	if token == "" {
-		el.Lgr.W.Println("https-status -> нет токена, в запросе")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
 	// Чтение тела запроса
 	var rxBody NameT
 
@@ -180,17 +314,8 @@ func (el *StatusServerT) HandlHttpsStatusSrv(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Проверка, что принятое имя и его токен соответствуют
-	tokenDB, err := ReadUserTokenByNameDB(rxBody.Name, el.DB)
-	if err != nil {
-		el.Lgr.W.Printf("https-status -> ошибка при получении токена, по имени пользователя {%v}", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	if token != tokenDB {
-		el.Lgr.W.Println("https-status -> принятый токен и токен из БД не соответствуют")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "https-status", rxBody.Name); !ok {
 		return
 	}
 
@@ -200,6 +325,12 @@ func (el *StatusServerT) HandlHttpsStatusSrv(w http.ResponseWriter, r *http.Requ
 	statusServer.TimeStart = el.TimeStart
 	statusServer.MbRTU = el.MbRTU
 	statusServer.MbTCP = el.MbTCP
+	statusServer.Workers = el.Workers
+	statusServer.Poll = el.Poll
+	statusServer.Buffer = el.Buffer
+	statusServer.Writer = el.Writer
+	statusServer.Heartbeat = el.Heartbeat
+	statusServer.Gateway = el.Gateway
 	statusServer.SizeF = el.SizeF
 
 	// Проверка содержимого ответа
@@ -320,6 +451,12 @@ func (el *StatusServerT) HandlHttpStatusSrv(w http.ResponseWriter, r *http.Reque
 	statusServer.TimeStart = el.TimeStart
 	statusServer.MbRTU = el.MbRTU
 	statusServer.MbTCP = el.MbTCP
+	statusServer.Workers = el.Workers
+	statusServer.Poll = el.Poll
+	statusServer.Buffer = el.Buffer
+	statusServer.Writer = el.Writer
+	statusServer.Heartbeat = el.Heartbeat
+	statusServer.Gateway = el.Gateway
 	statusServer.SizeF = el.SizeF
 
 	// Проверка содержимого ответа
@@ -418,14 +555,6 @@ func (el *DataDBCallT) HandlHttpsExpDataDB(w http.ResponseWriter, r *http.Reques
 
 	w.Header().Set("Content-Type", "application/json")
 
-	// Чтение заголовка
-	token := r.Header.Get("authorization")
-	if token == "" {
-		el.Lgr.W.Println("https-dataDB -> нет токена")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
 	// Чтение параметров запроса
 	qPrm := r.URL.Query()
 	name := qPrm.Get("name")
@@ -435,17 +564,8 @@ func (el *DataDBCallT) HandlHttpsExpDataDB(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Проверка, что принятое имя и его токен соответствуют
-	tokenDB, err := ReadUserTokenByNameDB(name, el.DB)
-	if err != nil {
-		el.Lgr.W.Printf("https-dataDB -> ошибка при получении токена, по имени пользователя {%v}", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	if token != tokenDB {
-		el.Lgr.W.Println("https-dataDB -> принятый токен и токен из БД не соответствуют")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "https-dataDB", name); !ok {
 		return
 	}
 
@@ -568,6 +688,7 @@ func (el *LoginUserT) HandlHttpsRegistration(w http.ResponseWriter, r *http.Requ
 
 	rxUsrName := slStr[0]
 	rxUsrPsw := slStr[1]
+	ip := clientIP(r)
 
 	if rxUsrName == "" {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -578,38 +699,72 @@ func (el *LoginUserT) HandlHttpsRegistration(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Вход только пользователем сертификата клиента
+	if cu, cert := r.Context().Value(certCtxKeyT{}).(certUserT); cert && !certMatch(w, r, el.DB, el.Lgr, "https-registration", cu, rxUsrName) {
+		return
+	}
+
+	// Учёт попытки и проверка блокировки входа пользователя и IP
+	attempt, ok := el.loginAttempt(w, rxUsrName, ip)
+	if !ok {
+		return
+	}
+
 	// Чтение из БД хэша пароля пользователя
 	dbPswHash, err := readPswUserDB(rxUsrName, el.DB)
 	if err != nil {
+		// время ответа не зависит от наличия пользователя
+		password.VerifyDummy(rxUsrPsw)
 		el.Lgr.W.Printf("https-registration -> попытка подключения пользователя {%s}, такого пользователя в БД нет\n", rxUsrName)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		el.loginFailed(w, r, attempt, rxUsrName, ip, "нет такого пользователя")
 		return
 	}
 
-	// Проверка соответствия хэшей
-	calcHash := fmt.Sprintf("%x", sha256.Sum256([]byte(rxUsrPsw)))
-
-	if dbPswHash != calcHash {
-		el.Lgr.W.Printf("https-registration -> принят запрос пользователя {%s} с не верным паролем", rxUsrName)
+	// Проверка пароля по хэшу
+	ok, rehash, err := password.Verify(rxUsrPsw, dbPswHash)
+	if err != nil {
+		el.Lgr.E.Printf("https-registration -> ошибка {%v} проверки пароля пользователя {%s}", err, rxUsrName)
 		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
+	if !ok {
+		el.Lgr.W.Printf("https-registration -> принят запрос пользователя {%s} с не верным паролем", rxUsrName)
+		el.loginFailed(w, r, attempt, rxUsrName, ip, "неверный пароль")
+		return
+	}
 
-	// Вычисление токена
-	var dataToken TokenT
-	dataToken.Token = generateToken(rxUsrName, rxUsrPsw)
+	// Сброс счётчика неудачных попыток входа пользователя
+	err = security.Success(el.DB, rxUsrName, ip)
+	if err != nil {
+		el.Lgr.W.Printf("https-registration -> %v", err)
+	}
+
+	// Пересчёт хэша прежнего формата (или параметров) по действующей политике. Ошибка не мешает входу.
+	if rehash {
+		err = upgradePswUserDB(rxUsrName, rxUsrPsw, dbPswHash, el.DB)
+		if err != nil {
+			el.Lgr.W.Printf("https-registration -> ошибка {%v} при обновлении хэша пароля пользователя {%s}", err, rxUsrName)
+		} else {
+			el.Lgr.I.Printf("https-registration -> хэш пароля пользователя {%s} обновлён", rxUsrName)
+		}
+	}
 
-	// Сохрание токена в БД
-	err = saveTokenUserDB(rxUsrName, dataToken.Token, el.DB)
+	// Создание сессии. Сессии пользователя с других устройств сохраняются.
+	token, expires, err := session.Create(el.DB, rxUsrName, ip, el.TTL)
 	if err != nil {
-		el.Lgr.E.Printf("https-registration -> ошибка {%v} при сохранении в БД хэша пароля для пользователя {%s}\n", err, rxUsrName)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		el.Lgr.E.Printf("https-registration -> ошибка {%v} при создании сессии пользователя {%s}\n", err, rxUsrName)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
+	dataToken := TokenT{
+		Token:   token,
+		Expires: expires.Format(time.RFC3339),
+	}
+
 	dataTx, err := json.Marshal(dataToken)
 	if err != nil {
-		el.Lgr.E.Printf("https-registration -> ошибка {%v} сериализации данных {%v}", err, dataToken)
+		el.Lgr.E.Printf("https-registration -> ошибка {%v} сериализации токена", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -631,14 +786,6 @@ func (el *CntStrByDateT) HandlHttpsCntStrByDate(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Чтение заголовка
-	token := r.Header.Get("authorization")
-	if token == "" {
-		el.Lgr.W.Println("https-cntstr -> в принятом запросе нет токена")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
 	// Тело запроса
 	bytesBody, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -674,17 +821,8 @@ func (el *CntStrByDateT) HandlHttpsCntStrByDate(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Проверка, что принятое имя и его токен соответствуют
-	tokenDB, err := ReadUserTokenByNameDB(reqBoddy.Name, el.DB)
-	if err != nil {
-		el.Lgr.W.Printf("https-cntstr -> ошибка получения токена, по имени пользователя:{%s} {%v}", reqBoddy.Name, err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	if token != tokenDB {
-		el.Lgr.W.Println("https-cntstr -> принятый токен и токен из БД не соответствуют")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "https-cntstr", reqBoddy.Name); !ok {
 		return
 	}
 
@@ -720,6 +858,257 @@ func (el *CntStrByDateT) HandlHttpsCntStrByDate(w http.ResponseWriter, r *http.R
 	w.Write(bTx)
 }
 
+// Обработка запроса на проверку цепочки хэшей архива за период.
+func (el *VerifyChainT) HandlHttpsVerifyChain(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		el.Lgr.W.Printf("https-verify -> принят запрос с методом:{%s}, а нужен:{%s}", r.Method, http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Тело запроса
+	bytesBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		el.Lgr.W.Println("https-verify -> ошибка чтения тела запроса")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err = r.Body.Close()
+		if err != nil {
+			el.Lgr.W.Println("https-verify -> ошибка закрытия потока чтения тела ответа при завершении работы обработчика")
+		}
+	}()
+
+	var reqBody DateRangeNameT
+	err = json.Unmarshal(bytesBody, &reqBody)
+	if err != nil {
+		el.Lgr.W.Println("https-verify -> ошибка при десериализации тела запроса")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка данных тела запроса
+	_, err = time.Parse("2006-01-02", reqBody.DateStart)
+	if err != nil {
+		el.Lgr.W.Printf("https-verify -> в принятом запросе, начальная дата {%s} не в формате YYYY-MM-DD", reqBody.DateStart)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	_, err = time.Parse("2006-01-02", reqBody.DateEnd)
+	if err != nil {
+		el.Lgr.W.Printf("https-verify -> в принятом запросе, конечная дата {%s} не в формате YYYY-MM-DD", reqBody.DateEnd)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if reqBody.Name == "" {
+		el.Lgr.W.Println("https-verify -> в принятом запросе нет данных имени")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "https-verify", reqBody.Name); !ok {
+		return
+	}
+
+	// Проверка цепочки
+	res, err := hashchain.VerifyDB(el.DB, reqBody.DateStart, reqBody.DateEnd)
+	if err != nil {
+		el.Lgr.E.Printf("https-verify -> ошибка при проверке цепочки хэшей: {%v}", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bTx, err := json.Marshal(res)
+	if err != nil {
+		el.Lgr.W.Println("https-verify -> ошибка сериализации результата проверки")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application-json")
+
+	if res.Ok {
+		el.Lgr.I.Printf("https-verify -> проверка цепочки с {%s} по {%s}: строк {%d}, до начала цепочки {%d}, нарушений нет", res.DateStart, res.DateEnd, res.CntRows, res.Legacy)
+	} else {
+		el.Lgr.W.Printf("https-verify -> проверка цепочки с {%s} по {%s}: разрыв в строке id:{%d} {%s}", res.DateStart, res.DateEnd, res.BrokenId, res.Reason)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
+// Обработка запроса на печать архива по дате.
+func (el *SealByDateT) HandlHttpSeal(w http.ResponseWriter, r *http.Request) {
+
+	// Проверка входных данных
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Чтение параметров запроса
+	qP := r.URL.Query()
+
+	dateSeal := qP.Get("date")
+	if dateSeal == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка корректности даты
+	_, err := time.Parse("2006-01-02", dateSeal)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Чтение печати
+	s, err := seal.ReadDB(el.DB, dateSeal)
+	if errors.Is(err, seal.ErrNoSeal) {
+		el.Lgr.W.Printf("клиент http -> запрошена печать архива на {%s}, которой нет", dateSeal)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		el.Lgr.E.Printf("клиент http -> ошибка чтения печати архива: {%v}", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Подготовка ответа
+	bTx, err := json.Marshal(s)
+	if err != nil {
+		el.Lgr.W.Println("http-seal -> ошибка сериализации печати")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Ответ
+	el.Lgr.I.Printf("клиент http -> выполнен запрос печати архива на {%s}", dateSeal)
+	w.Header().Set("Content-Type", "application-json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
+// Обработчик HTTP запроса диагностики обмена с устройствами.
+func (el *DiagnosticsT) HandlHttpDiagnostics(w http.ResponseWriter, r *http.Request) {
+
+	// Проверка входных данных
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if el.Snapshot == nil {
+		el.Lgr.E.Println("http-diagnostics -> отсутствует источник диагностики")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Подготовка ответа
+	bTx, err := json.Marshal(el.Snapshot())
+	if err != nil {
+		el.Lgr.W.Println("http-diagnostics -> ошибка сериализации диагностики")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Ответ
+	el.Lgr.I.Println("клиент http -> выполнен запрос диагностики обмена")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
+// Обработка запроса на запись значения тэга в устройство.
+func (el *WriteTagT) HandlHttpsWriteTag(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		el.Lgr.W.Printf("https-write -> принят запрос с методом:{%s}, а нужен:{%s}", r.Method, http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Тело запроса
+	bytesBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		el.Lgr.W.Println("https-write -> ошибка чтения тела запроса")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		err = r.Body.Close()
+		if err != nil {
+			el.Lgr.W.Println("https-write -> ошибка закрытия потока чтения тела ответа при завершении работы обработчика")
+		}
+	}()
+
+	var reqBody WriteReqT
+	err = json.Unmarshal(bytesBody, &reqBody)
+	if err != nil {
+		el.Lgr.W.Println("https-write -> ошибка при десериализации тела запроса")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка данных тела запроса
+	if reqBody.Name == "" || reqBody.Dev == "" || reqBody.Tag == "" || reqBody.Value == "" {
+		el.Lgr.W.Printf("https-write -> в принятом запросе не заполнены поля: {%v}", reqBody)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "https-write", reqBody.Name); !ok {
+		return
+	}
+
+	if el.Write == nil {
+		el.Lgr.E.Println("https-write -> нет функции записи в устройства")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Запись и фиксация в журнале
+	errWr := el.Write(reqBody.Dev, reqBody.Tag, reqBody.Value)
+
+	result := "ok"
+	if errWr != nil {
+		result = errWr.Error()
+	}
+
+	err = saveWriteAuditDB(el.DB, reqBody, result)
+	if err != nil {
+		el.Lgr.E.Printf("https-write -> ошибка записи в журнал: {%v}, запрос {%v}, результат {%s}", err, reqBody, result)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if errWr != nil {
+		el.Lgr.W.Printf("https-write -> пользователь {%s}, устройство {%s}, тэг {%s}, значение {%s} -> ошибка: {%v}", reqBody.Name, reqBody.Dev, reqBody.Tag, reqBody.Value, errWr)
+		if errors.Is(errWr, ErrWriteReq) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bTx, err := json.Marshal(WriteResT{Result: result})
+	if err != nil {
+		el.Lgr.W.Println("https-write -> ошибка сериализации результата записи")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	el.Lgr.I.Printf("https-write -> пользователь {%s}, устройство {%s}, тэг {%s}, записано значение {%s}", reqBody.Name, reqBody.Dev, reqBody.Tag, reqBody.Value)
+	w.Header().Set("Content-Type", "application-json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bTx)
+}
+
 // Обработка запроса на количество строк в БД по дате.
 func (el *CntStrByDateT) HandlHttpCntStrByDate(w http.ResponseWriter, r *http.Request) {
 
@@ -786,14 +1175,6 @@ func (el *PartDataT) HandlHttpsPartDataDB(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Чтение заголовков
-	token := r.Header.Get("authorization")
-	if token == "" {
-		el.Lgr.W.Println("hdlr-partdatadb -> нет токена")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
 	// Тело запроса
 	var reqBody DateNameT
 
@@ -887,17 +1268,8 @@ func (el *PartDataT) HandlHttpsPartDataDB(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Проверка, что принятое имя и его токен соответствуют
-	tokenDB, err := ReadUserTokenByNameDB(reqBody.Name, el.DB)
-	if err != nil {
-		el.Lgr.W.Printf("hdlr-partdatadb -> ошибка при получении токена, по имени пользователя {%v}", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	if token != tokenDB {
-		el.Lgr.W.Println("hdlr-partdatadb -> принятый токен и токен из БД не соответствуют")
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	// Проверка сессии пользователя
+	if _, ok := authorize(w, r, el.DB, el.Lgr, "hdlr-partdatadb", reqBody.Name); !ok {
 		return
 	}
 
@@ -1049,66 +1421,29 @@ func readPswUserDB(name string, db *sql.DB) (psw string, err error) {
 	return psw, nil
 }
 
-// Получение токена по имени пользователя. Возвращается токен и ошибка.
+// Замена хэша пароля пользователя хэшем по действующей политике. Хэш заменяется, только если в БД
+// остался проверенный хэш (пароль не изменён за время проверки). Возвращается ошибка.
 //
 // Параметры:
 //
 // name - имя пользователя
+// pwd - проверенный пароль
+// oldHash - проверенный хэш из БД
 // db - указатель на БД
-func ReadUserTokenByNameDB(name string, db *sql.DB) (token string, err error) {
+func upgradePswUserDB(name, pwd, oldHash string, db *sql.DB) error {
 
-	// Проверка принятых данных
-	if name == "" {
-		return "", errors.New("ошибка: при порлучении токена - нет имени пользователя")
-	}
-	if db == nil {
-		return "", errors.New("ошибка: нет указател на БД")
-	}
-
-	q := fmt.Sprintf("SELECT token FROM %s.%s WHERE name = $1",
-		os.Getenv("TABLE_SCHEMA"),
-		os.Getenv("TABLE_USERS"))
-
-	err = db.QueryRow(q, name).Scan(&token)
+	hash, err := password.Hash(pwd)
 	if err != nil {
-		return "", errors.New("ошибка: при порлучении токена, по имени пользователя")
+		return err
 	}
 
-	return token, nil
-}
-
-// Генерация токена. Возвращается токен
-//
-// Параметры:
-//
-// name - имя пользователя
-// pwd - пароль пользователя
-func generateToken(name, pwd string) string {
-
-	timestamp := time.Now().Unix()
-
-	data := fmt.Sprintf("%s:%s:%d", name, pwd, timestamp)
-
-	token := fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
-
-	return token
-}
-
-// Запись в БД токена пользователя. Возвращется ошибка.
-//
-// Парметры:
-// name - имя пользователя
-// token - токен
-func saveTokenUserDB(name, token string, db *sql.DB) error {
-
-	q := fmt.Sprintf("UPDATE %s.%s SET token = $1 WHERE name = $2",
+	q := fmt.Sprintf("UPDATE %s.%s SET password = $1 WHERE name = $2 AND password = $3",
 		os.Getenv("TABLE_SCHEMA"),
-		os.Getenv("TABLE_USERS"),
-	)
+		os.Getenv("TABLE_USERS"))
 
-	_, err := db.Exec(q, token, name)
+	_, err = db.Exec(q, hash, name, oldHash)
 	if err != nil {
-		return fmt.Errorf("ошибка {%v} при обновлении пароля у пользователя: {%s}", err, name)
+		return fmt.Errorf("ошибка: {%v} при обновлении хэша пароля пользователя: {%s}", err, name)
 	}
 
 	return nil
@@ -1140,6 +1475,31 @@ func readCntStrDataDB(data *DataDBCallT) error {
 	return nil
 }
 
+// Функция фиксирует в журнале запись значения тэга пользователем. Возвращается ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// req - запрос записи
+// result - результат записи
+func saveWriteAuditDB(db *sql.DB, req WriteReqT, result string) error {
+
+	if db == nil {
+		return errors.New("журнал записи -> нет указателя на БД")
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s.%s (username, dev, name, value, result) VALUES ($1, $2, $3, $4, $5)",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_WRITES"))
+
+	_, err := db.Exec(q, req.Name, req.Dev, req.Tag, req.Value, result)
+	if err != nil {
+		return fmt.Errorf("журнал записи -> ошибка: {%v}", err)
+	}
+
+	return nil
+}
+
 // Функция выполняет чтение из БД архивных данных, по начальной дате. Возвращается ошибка.
 //
 // Параметры:
@@ -1165,15 +1525,16 @@ func readPartDataDBReq(db *sql.DB, date string, limit, offset int) (rdData []Dat
 		return nil, fmt.Errorf("запрос данных -> значение offset:{%d} меньше 0", offset)
 	}
 
-	// Подготовка запроса
+	// Подготовка запроса. Единица измерения берётся из настроек тэга.
 	q := fmt.Sprintf(`
-	 SELECT name, value, qual, timestamp
-     FROM %s.%s
-     WHERE date(timestamp) = '%v'
-	 ORDER By timestamp ASC
-	 LIMIT %d OFFSET %d
+	 SELECT d.dev, d.name, COALESCE(d.valuetext, d.value::text), d.qual, d.timestamp, COALESCE(d.hash, ''),
+	        COALESCE((SELECT t.unit FROM %[1]s.%[3]s t WHERE t.device = d.dev AND t.comment = d.name AND t.unit <> '' LIMIT 1), '')
+     FROM %[1]s.%[2]s d
+     WHERE date(d.timestamp) = '%[4]v'
+	 ORDER By d.timestamp ASC, d.id ASC
+	 LIMIT %[5]d OFFSET %[6]d
 	 ;              
-	`, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"), date, limit, offset)
+	`, os.Getenv("TABLE_SCHEMA"), os.Getenv("TABLE_DATA"), os.Getenv("TABLE_TAGS"), date, limit, offset)
 
 	// Запрос
 	rows, err := db.Query(q)
@@ -1189,7 +1550,7 @@ func readPartDataDBReq(db *sql.DB, date string, limit, offset int) (rdData []Dat
 	for rows.Next() {
 		var str DataElT
 
-		err = rows.Scan(&str.Name, &str.Value, &str.Qual, &str.TimeStamp)
+		err = rows.Scan(&str.Dev, &str.Name, &str.Value, &str.Qual, &str.TimeStamp, &str.Hash, &str.Unit)
 		if err != nil {
 			return nil, err
 		}
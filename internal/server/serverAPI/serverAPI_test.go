@@ -2,6 +2,9 @@ package serverAPI
 
 import (
 	loger "blackbox/internal/server/loger"
+	"blackbox/internal/server/mtls"
+	"blackbox/internal/server/role"
+	"blackbox/internal/server/session"
 	"bytes"
 	"database/sql"
 	"encoding/json"
@@ -73,12 +76,14 @@ func Test_HandlHttpsRegistration_Success(t *testing.T) {
 	err = json.Unmarshal(byteRx, &dataRx)
 	require.NoErrorf(t, err, "ошибка десериализации тела ответа: {%v}", err)
 
-	// Чтение токена из БД
-	tokenDB, err := ReadUserTokenByNameDB(userName, db)
-	require.NoErrorf(t, err, "ошибка при чтении токена из БД по имени пользователя: {%v}", err)
+	// Проверка сессии по принятому токену
+	name, err := session.Check(db, dataRx.Token, "")
+	require.NoErrorf(t, err, "ошибка при проверке сессии по принятому токену: {%v}", err)
+
+	assert.Equalf(t, userName, name, "сессия не того пользователя. ожидался {%s}, а принят {%s}", userName, name)
 
-	// Проверка соответствия токенов
-	assert.Equalf(t, tokenDB, dataRx.Token, "токены не равны. в БД {%s}, а принят {%s}", tokenDB, dataRx.Token)
+	_, err = time.Parse(time.RFC3339, dataRx.Expires)
+	assert.NoErrorf(t, err, "время окончания сессии {%s} не в формате RFC3339", dataRx.Expires)
 }
 
 // Регистрация пользователя на сервере (Ошибки)
@@ -125,6 +130,20 @@ func Test_HandlHttpsRegistration_Error(t *testing.T) {
 			pwd:        "",
 			wantErr:    400,
 		},
+		{
+			testName:   "неизвестный пользователь",
+			methodHttp: "POST",
+			user:       userName + "-unknown",
+			pwd:        userPassw,
+			wantErr:    403,
+		},
+		{
+			testName:   "неверный пароль",
+			methodHttp: "POST",
+			user:       userName,
+			pwd:        userPassw + "-wrong",
+			wantErr:    403,
+		},
 	}
 
 	for _, tt := range dataTest {
@@ -218,7 +237,7 @@ func Test_HandlHttpsStatusSrv_Success(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/status", reqBody)
 
 	// Чтение токена из БД
-	userToken, err := ReadUserTokenByNameDB(userName, db)
+	userToken, err := loginUserToken(userName, userPassw, db, lger)
 	require.NoErrorf(t, err, "ошибка при чтении токена из БД: {%v}", err)
 
 	req.Header.Set("authorization", userToken)
@@ -277,7 +296,7 @@ func Test_HandlHttpsStatusSrv_Error(t *testing.T) {
 	}()
 
 	// Чтение токена из БД
-	userToken, err := ReadUserTokenByNameDB(userName, db)
+	userToken, err := loginUserToken(userName, userPassw, db, lger)
 	require.NoErrorf(t, err, "ошибка при чтении токена из БД: {%v}", err)
 
 	// Набор данных для тестов
@@ -1006,7 +1025,7 @@ func Test_HandlHttpsCntStrByDate_Success(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/cntstr", reqBody)
 
 	// Чтение токена из БД
-	userToken, err := ReadUserTokenByNameDB(userName, db)
+	userToken, err := loginUserToken(userName, userPassw, db, lger)
 	require.NoErrorf(t, err, "ошибка при чтении токена из БД: {%v}", err)
 
 	req.Header.Set("authorization", userToken)
@@ -1132,7 +1151,7 @@ func Test_HandlHttpsCntStrByDate_Error(t *testing.T) {
 			req := httptest.NewRequest(tt.httpMethod, "/cntstr", reqBody)
 
 			// Чтение токена из БД
-			userToken, err := ReadUserTokenByNameDB(userName, db)
+			userToken, err := loginUserToken(userName, userPassw, db, lger)
 			require.NoErrorf(t, err, "ошибка чтения токена из БД: {%v}", err)
 
 			if tt.useToken == "false" {
@@ -1204,7 +1223,7 @@ func Test_HandlHttpsPartDataDB_Success(t *testing.T) {
 	res := httptest.NewRecorder()
 
 	// Чтение токена из БД
-	userToken, err := ReadUserTokenByNameDB(userName, db)
+	userToken, err := loginUserToken(userName, userPassw, db, lger)
 	require.NoErrorf(t, err, "ошибка при чтении токена из БД: {%v}", err)
 
 	req.Header.Set("authorization", userToken)
@@ -1398,7 +1417,7 @@ func Test_HandlHttpsPartDataDB_Error(t *testing.T) {
 			res := httptest.NewRecorder()
 
 			// Добавление токена
-			userToken, err := ReadUserTokenByNameDB(tt.user, db)
+			userToken, err := loginUserToken(tt.user, userPassw, db, lger)
 
 			if tt.useToken == "true" && err == nil {
 				req.Header.Set("authorization", userToken)
@@ -1415,6 +1434,60 @@ func Test_HandlHttpsPartDataDB_Error(t *testing.T) {
 	}
 }
 
+// Проверка доступа к ручке без токена (Ошибки). Обработчик не вызывается.
+func Test_Access_NoToken(t *testing.T) {
+
+	lger := loger.Log_Object{
+		I: log.New(io.Discard, "", 0),
+		W: log.New(io.Discard, "", 0),
+		E: log.New(io.Discard, "", 0),
+	}
+
+	called := false
+	h := Access(nil, lger, role.PermArchive)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/cntstr", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	assert.Equalf(t, http.StatusBadRequest, res.Code, "ожидался код {%d}, а принят {%d}", http.StatusBadRequest, res.Code)
+	assert.False(t, called, "обработчик вызван без проверки сессии")
+}
+
+// Проверка сертификата клиента: режим off не меняет обработку, без сертификата отказ 401.
+func Test_ClientCert(t *testing.T) {
+
+	lger := loger.Log_Object{
+		I: log.New(io.Discard, "", 0),
+		W: log.New(io.Discard, "", 0),
+		E: log.New(io.Discard, "", 0),
+	}
+
+	for _, tt := range []struct {
+		mode   mtls.ModeT
+		code   int
+		called bool
+	}{
+		{mtls.ModeOff, http.StatusOK, true},
+		{mtls.ModeCert, http.StatusUnauthorized, false},
+		{mtls.ModeCertToken, http.StatusUnauthorized, false},
+	} {
+		called := false
+		h := ClientCert(nil, lger, tt.mode)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/status", nil)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		assert.Equalf(t, tt.code, res.Code, "%s: ожидался код {%d}, а принят {%d}", tt.mode, tt.code, res.Code)
+		assert.Equalf(t, tt.called, called, "%s: вызов обработчика", tt.mode)
+	}
+}
+
 // =====================================================
 // ====                Тесты HTTP                   ====
 // =====================================================
@@ -2551,6 +2624,35 @@ func Test_HandlHttpPartDataDB_Error(t *testing.T) {
 // ====          Вспомогательные функции            ====
 // =====================================================
 
+// Вход пользователя на сервер. Возвращается токен сессии и ошибка.
+//
+// Параметры:
+//
+// name - имя пользователя
+// psw - пароль пользователя
+// db - указатель на БД
+// lgr - логеры
+func loginUserToken(name, psw string, db *sql.DB, lgr loger.Log_Object) (token string, err error) {
+
+	req := httptest.NewRequest(http.MethodPost, "/registration", bytes.NewBufferString(name+" "+psw))
+	res := httptest.NewRecorder()
+
+	user := LoginUserT{DB: db, Lgr: lgr}
+	user.HandlHttpsRegistration(res, req)
+
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("вход пользователя {%s} -> код ответа {%d}", name, res.Code)
+	}
+
+	var dataRx TokenT
+	err = json.Unmarshal(res.Body.Bytes(), &dataRx)
+	if err != nil {
+		return "", err
+	}
+
+	return dataRx.Token, nil
+}
+
 // Подключение к логерам и БД. Возвращается указатель на БД и ошибка.
 //
 // Параметры:
@@ -0,0 +1,326 @@
+// Сессии пользователей HTTPS сервера. Пользователь может иметь несколько сессий одновременно
+// (по одной на устройство). Сессия ограничена временем жизни, продлевается заменой токена и
+// отзывается пользователем (выход) или администратором. В БД хранится только хэш токена.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTTL = 12 * time.Hour // время жизни сессии по умолчанию
+	tokenLen   = 32             // длина токена, байт
+)
+
+type (
+	// Сессия пользователя
+	SessionT struct {
+		Id       int
+		Name     string    // имя пользователя
+		Created  time.Time // время входа
+		Expires  time.Time // время окончания сессии
+		LastUsed time.Time // время последнего запроса
+		LastIP   string    // IP последнего запроса
+		Revoked  bool      // сессия отозвана
+	}
+)
+
+var (
+	// Ошибка: в запросе нет токена
+	ErrNoToken = errors.New("нет токена")
+
+	// Ошибка: сессии нет, она истекла или отозвана
+	ErrInvalid = errors.New("сессия не найдена, истекла или отозвана")
+)
+
+// Разбор времени жизни сессии в минутах. Для пустой строки возвращается время по умолчанию.
+// Возвращается время жизни и ошибка.
+//
+// Параметры:
+//
+// s - время жизни, мин
+func ParseTTL(s string) (time.Duration, error) {
+
+	if s == "" {
+		return DefaultTTL, nil
+	}
+
+	m, err := strconv.Atoi(s)
+	if err != nil || m <= 0 {
+		return 0, fmt.Errorf("недопустимое время жизни сессии {%s}", s)
+	}
+
+	return time.Duration(m) * time.Minute, nil
+}
+
+// Токен из заголовка authorization. Допускается схема Bearer. Возвращается токен.
+//
+// Параметры:
+//
+// h - значение заголовка
+func TokenFromHeader(h string) string {
+
+	h = strings.TrimSpace(h)
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		h = strings.TrimSpace(h[7:])
+	}
+
+	return h
+}
+
+// Создание сессии пользователя. Истёкшие сессии пользователя удаляются.
+// Возвращается токен, время окончания сессии и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// name - имя пользователя
+// ip - IP клиента
+// ttl - время жизни сессии
+func Create(db *sql.DB, name, ip string, ttl time.Duration) (token string, expires time.Time, err error) {
+
+	if db == nil {
+		return "", time.Time{}, errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf("DELETE FROM %s WHERE name = $1 AND expires < NOW()", table())
+	_, err = db.Exec(q, name)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка: {%v} при удалении истёкших сессий пользователя: {%s}", err, name)
+	}
+
+	return insert(db, name, ip, ttl)
+}
+
+// Проверка сессии по токену с фиксацией времени и IP запроса. Возвращается имя пользователя и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// token - токен сессии
+// ip - IP клиента
+func Check(db *sql.DB, token, ip string) (name string, err error) {
+
+	if token == "" {
+		return "", ErrNoToken
+	}
+	if db == nil {
+		return "", errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`UPDATE %s SET lastused = NOW(), lastip = $2
+	WHERE tokenhash = $1 AND NOT revoked AND expires > NOW()
+	RETURNING name`, table())
+
+	err = db.QueryRow(q, digest(token), ip).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка: {%v} при проверке сессии", err)
+	}
+
+	return name, nil
+}
+
+// Продление сессии: действующий токен отзывается, выдаётся новый с полным временем жизни.
+// Возвращается имя пользователя, новый токен, время окончания сессии и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// token - действующий токен
+// ip - IP клиента
+// ttl - время жизни сессии
+func Refresh(db *sql.DB, token, ip string, ttl time.Duration) (name, fresh string, expires time.Time, err error) {
+
+	if token == "" {
+		return "", "", time.Time{}, ErrNoToken
+	}
+	if db == nil {
+		return "", "", time.Time{}, errors.New("нет указателя на БД")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("ошибка: {%v} при открытии транзакции", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	q := fmt.Sprintf(`UPDATE %s SET revoked = true
+	WHERE tokenhash = $1 AND NOT revoked AND expires > NOW()
+	RETURNING name`, table())
+
+	err = tx.QueryRow(q, digest(token)).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", time.Time{}, ErrInvalid
+	}
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("ошибка: {%v} при отзыве продлеваемой сессии", err)
+	}
+
+	fresh, expires, err = insert(tx, name, ip, ttl)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("ошибка: {%v} при завершении транзакции", err)
+	}
+
+	return name, fresh, expires, nil
+}
+
+// Отзыв сессии по токену (выход пользователя). Возвращается имя пользователя и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// token - токен сессии
+func Revoke(db *sql.DB, token string) (name string, err error) {
+
+	if token == "" {
+		return "", ErrNoToken
+	}
+	if db == nil {
+		return "", errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`UPDATE %s SET revoked = true
+	WHERE tokenhash = $1 AND NOT revoked AND expires > NOW()
+	RETURNING name`, table())
+
+	err = db.QueryRow(q, digest(token)).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalid
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка: {%v} при отзыве сессии", err)
+	}
+
+	return name, nil
+}
+
+// Отзыв действующих сессий пользователя. Для id = 0 отзываются все сессии пользователя.
+// Возвращается количество отозванных сессий и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// name - имя пользователя
+// id - id сессии
+func RevokeUser(db *sql.DB, name string, id int) (n int64, err error) {
+
+	if db == nil {
+		return 0, errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`UPDATE %s SET revoked = true
+	WHERE name = $1 AND ($2 = 0 OR id = $2) AND NOT revoked AND expires > NOW()`, table())
+
+	res, err := db.Exec(q, name, id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка: {%v} при отзыве сессий пользователя: {%s}", err, name)
+	}
+
+	return res.RowsAffected()
+}
+
+// Список сессий пользователя, не истёкших на момент запроса. Возвращается список и ошибка.
+//
+// Параметры:
+//
+// db - указатель на БД
+// name - имя пользователя
+func List(db *sql.DB, name string) ([]SessionT, error) {
+
+	if db == nil {
+		return nil, errors.New("нет указателя на БД")
+	}
+
+	q := fmt.Sprintf(`SELECT id, name, created, expires, lastused, lastip, revoked
+	FROM %s WHERE name = $1 AND expires > NOW() ORDER BY id`, table())
+
+	rows, err := db.Query(q, name)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка: {%v} при чтении сессий пользователя: {%s}", err, name)
+	}
+	defer rows.Close()
+
+	res := make([]SessionT, 0)
+	for rows.Next() {
+		var s SessionT
+		err = rows.Scan(&s.Id, &s.Name, &s.Created, &s.Expires, &s.LastUsed, &s.LastIP, &s.Revoked)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка: {%v} при чтении строки сессии", err)
+		}
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
+
+// Выполнение запроса к БД или в транзакции
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Внутренняя функция. Добавление сессии с новым токеном.
+// Возвращается токен, время окончания сессии и ошибка.
+func insert(db execer, name, ip string, ttl time.Duration) (token string, expires time.Time, err error) {
+
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	token, err = newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires = time.Now().Add(ttl)
+
+	q := fmt.Sprintf("INSERT INTO %s (name, tokenhash, expires, lastip) VALUES ($1, $2, $3, $4)", table())
+
+	_, err = db.Exec(q, name, digest(token), expires, ip)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка: {%v} при создании сессии пользователя: {%s}", err, name)
+	}
+
+	return token, expires, nil
+}
+
+// Внутренняя функция. Генерация случайного токена. Возвращается токен и ошибка.
+func newToken() (string, error) {
+
+	b := make([]byte, tokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("ошибка: {%v} при генерации токена", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Внутренняя функция. Хэш токена для хранения в БД.
+func digest(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Внутренняя функция. Имя таблицы сессий со схемой.
+func table() string {
+	return os.Getenv("TABLE_SCHEMA") + "." + os.Getenv("TABLE_SESSIONS")
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+
+	for s, want := range map[string]time.Duration{"": DefaultTTL, "30": 30 * time.Minute, "1440": 24 * time.Hour} {
+		got, err := ParseTTL(s)
+		if err != nil || got != want {
+			t.Fatalf("%q: ожидалось %v, получено %v, %v", s, want, got, err)
+		}
+	}
+
+	for _, s := range []string{"0", "-5", "12h", "x"} {
+		if _, err := ParseTTL(s); err == nil {
+			t.Fatalf("%q: ожидалась ошибка", s)
+		}
+	}
+}
+
+func TestTokenFromHeader(t *testing.T) {
+
+	for h, want := range map[string]string{
+		"abc":          "abc",
+		"Bearer abc":   "abc",
+		"bearer  abc ": "abc",
+		"":             "",
+		"Bearer":       "Bearer",
+	} {
+		if got := TokenFromHeader(h); got != want {
+			t.Fatalf("%q: ожидалось %q, получено %q", h, want, got)
+		}
+	}
+}
+
+func TestNewToken(t *testing.T) {
+
+	t1, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, _ := newToken()
+
+	if len(t1) != 2*tokenLen || t1 == t2 {
+		t.Fatalf("ожидались различные токены длиной %d: %s %s", 2*tokenLen, t1, t2)
+	}
+
+	// в БД хранится хэш, а не токен
+	if d := digest(t1); len(d) != 64 || d == t1 || d != digest(t1) {
+		t.Fatalf("хэш токена: %s", d)
+	}
+}
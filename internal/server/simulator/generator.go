@@ -0,0 +1,110 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPeriod = time.Minute // период ramp и sine по умолчанию
+
+type (
+	// Генератор значения тэга
+	GenT struct {
+		Kind     string        // ramp, sine, random, const
+		Min, Max float64       // диапазон значения (у const - значение в Min)
+		Period   time.Duration // период ramp и sine
+	}
+)
+
+// Разбор описания генератора вида kind[:min:max[:period]] или const:value. Незаданный диапазон
+// берётся из значения по умолчанию. Функция возвращает генератор и ошибку.
+//
+// Параметры:
+//
+// spec - описание генератора
+// def - генератор со значениями по умолчанию (диапазон тэга)
+func ParseGen(spec string, def GenT) (gen GenT, err error) {
+
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+
+	gen = def
+	gen.Kind = strings.ToLower(parts[0])
+	if gen.Period == 0 {
+		gen.Period = defaultPeriod
+	}
+
+	num := func(s string) (float64, error) {
+		f, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", ".", 1), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("генератор {%s}: {%s} не число", spec, s)
+		}
+		return f, nil
+	}
+
+	switch gen.Kind {
+
+	case "const":
+		if len(parts) > 2 {
+			return GenT{}, fmt.Errorf("генератор {%s}: ожидается const:значение", spec)
+		}
+		if len(parts) == 2 {
+			gen.Min, err = num(parts[1])
+			if err != nil {
+				return GenT{}, err
+			}
+		}
+		gen.Max = gen.Min
+
+	case "ramp", "sine", "random":
+		switch len(parts) {
+		case 1:
+		case 3, 4:
+			gen.Min, err = num(parts[1])
+			if err != nil {
+				return GenT{}, err
+			}
+			gen.Max, err = num(parts[2])
+			if err != nil {
+				return GenT{}, err
+			}
+			if len(parts) == 4 {
+				gen.Period, err = time.ParseDuration(parts[3])
+				if err != nil || gen.Period <= 0 {
+					return GenT{}, fmt.Errorf("генератор {%s}: период {%s} не длительность", spec, parts[3])
+				}
+			}
+		default:
+			return GenT{}, fmt.Errorf("генератор {%s}: ожидается %s:min:max[:period]", spec, gen.Kind)
+		}
+
+	default:
+		return GenT{}, fmt.Errorf("генератор {%s}: неизвестный вид, ожидается ramp, sine, random или const", spec)
+	}
+
+	return gen, nil
+}
+
+// Значение генератора. Возвращается значение.
+//
+// Параметры:
+//
+// elapsed - время от запуска симулятора
+func (g GenT) Value(elapsed time.Duration) float64 {
+
+	phase := float64(elapsed%g.Period) / float64(g.Period)
+
+	switch g.Kind {
+	case "ramp":
+		return g.Min + (g.Max-g.Min)*phase
+	case "sine":
+		return g.Min + (g.Max-g.Min)*(1+math.Sin(2*math.Pi*phase))/2
+	case "random":
+		return g.Min + (g.Max-g.Min)*rand.Float64()
+	default:
+		return g.Min
+	}
+}
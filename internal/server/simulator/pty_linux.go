@@ -0,0 +1,78 @@
+//go:build linux
+
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+type (
+	// Ведущая сторона pty со ссылкой на ведомую
+	ptyT struct {
+		*os.File
+		link string
+	}
+)
+
+// Открытие пары pty. Ведомая сторона доступна по пути COM порта конфигурации (символьная ссылка),
+// ведущая обслуживается симулятором кадрами Modbus-RTU. Возвращается pty и ошибка.
+func (sim *SimT) openPTY(ep *endpointT) (io.Closer, error) {
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(master.Fd())
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("разблокировка pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("номер pty: %v", err)
+	}
+	slave := "/dev/pts/" + strconv.Itoa(n)
+
+	// заменяется только ссылка, оставшаяся от предыдущего запуска
+	if fi, err := os.Lstat(ep.Address); err == nil {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			_ = master.Close()
+			return nil, fmt.Errorf("путь {%s} занят и не является ссылкой", ep.Address)
+		}
+		_ = os.Remove(ep.Address)
+	}
+	if err = os.Symlink(slave, ep.Address); err != nil {
+		_ = master.Close()
+		return nil, err
+	}
+	ep.Addr = ep.Address + " -> " + slave
+
+	p := &ptyT{File: master, link: ep.Address}
+
+	go func() {
+		err := sim.serveRTU(ep, p)
+		if err != nil && !errors.Is(err, os.ErrClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Printf("симулятор: %s: %v", ep.Name, err)
+		}
+	}()
+
+	return p, nil
+}
+
+// Закрытие pty с удалением ссылки. Возвращается ошибка.
+func (p *ptyT) Close() error {
+
+	_ = os.Remove(p.link)
+
+	return p.File.Close()
+}
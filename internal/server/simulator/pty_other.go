@@ -0,0 +1,13 @@
+//go:build !linux
+
+package simulator
+
+import (
+	"errors"
+	"io"
+)
+
+// Открытие пары pty поддерживается только в Linux. Возвращается ошибка.
+func (sim *SimT) openPTY(ep *endpointT) (io.Closer, error) {
+	return nil, errors.New("симуляция COM порта через pty поддерживается только в Linux")
+}
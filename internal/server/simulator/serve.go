@@ -0,0 +1,261 @@
+package simulator
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+const maxADU = 260 // наибольший размер кадра Modbus
+
+// Запуск симулятора: открытие портов всех точек подключения и обновление значений генераторов.
+// Порты открываются до возврата из функции, обслуживание завершается по отмене контекста.
+// Возвращается ошибка открытия порта.
+//
+// Параметры:
+//
+// ctx - контекст завершения
+func (sim *SimT) Start(ctx context.Context) error {
+
+	sim.start = time.Now()
+
+	closers := make([]io.Closer, 0, len(sim.endpoints))
+	closeAll := func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	}
+
+	for _, ep := range sim.endpoints {
+
+		var (
+			c   io.Closer
+			err error
+		)
+
+		switch ep.ConType {
+		case "TCP":
+			c, err = sim.listenTCP(ep, sim.serveMBAP)
+		case "RTU-TCP":
+			c, err = sim.listenTCP(ep, sim.serveRTU)
+		case "UDP":
+			c, err = sim.listenUDP(ep)
+		case "COM":
+			c, err = sim.openPTY(ep)
+		}
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("точка подключения {%s}: %v", ep.Name, err)
+		}
+		closers = append(closers, c)
+
+		log.Printf("симулятор: %s %s слейвов: %d", ep.ConType, ep.Addr, len(ep.slaves))
+	}
+
+	go func() {
+		<-ctx.Done()
+		closeAll()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(sim.conf.Tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := sim.update(now); err != nil {
+					log.Printf("симулятор: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Адреса точек подключения после запуска в порядке конфигурации. Возвращается список адресов.
+func (sim *SimT) Addrs() []string {
+
+	res := make([]string, 0, len(sim.endpoints))
+	for _, ep := range sim.endpoints {
+		res = append(res, ep.Addr)
+	}
+
+	return res
+}
+
+// Открытие TCP порта. Каждое подключение обслуживается отдельной рутиной. Возвращается порт и ошибка.
+func (sim *SimT) listenTCP(ep *endpointT, serve func(*endpointT, io.ReadWriter) error) (io.Closer, error) {
+
+	ln, err := net.Listen("tcp", ep.Address)
+	if err != nil {
+		return nil, err
+	}
+	ep.Addr = ln.Addr().String()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := serve(ep, conn); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+					log.Printf("симулятор: %s %s: %v", ep.Name, conn.RemoteAddr(), err)
+				}
+			}()
+		}
+	}()
+
+	return ln, nil
+}
+
+// Обслуживание потока кадров Modbus-TCP (MBAP). Возвращается ошибка потока.
+func (sim *SimT) serveMBAP(ep *endpointT, rw io.ReadWriter) error {
+
+	head := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(rw, head); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(head[4:]))
+		if length < 2 || length > maxADU-6 {
+			return fmt.Errorf("длина кадра {%d} вне диапазона", length)
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(rw, pdu); err != nil {
+			return err
+		}
+
+		res, ok := sim.handle(ep, head[6], pdu)
+		if !ok {
+			continue
+		}
+		if _, err := rw.Write(mbap(head, res)); err != nil {
+			return err
+		}
+	}
+}
+
+// Кадр Modbus-TCP ответа с заголовком запроса. Возвращается кадр.
+func mbap(head []byte, pdu []byte) []byte {
+
+	adu := make([]byte, 0, 7+len(pdu))
+	adu = append(adu, head[:4]...)
+	adu = binary.BigEndian.AppendUint16(adu, uint16(1+len(pdu)))
+	adu = append(adu, head[6])
+
+	return append(adu, pdu...)
+}
+
+// Обслуживание потока кадров Modbus-RTU. Кадры с ошибкой контрольной суммы пропускаются.
+// Возвращается ошибка потока.
+func (sim *SimT) serveRTU(ep *endpointT, rw io.ReadWriter) error {
+
+	for {
+		adu, err := readRequestRTU(rw)
+		if err != nil {
+			return err
+		}
+		if crc16(adu) != 0 {
+			continue
+		}
+
+		res, ok := sim.handle(ep, adu[0], adu[1:len(adu)-2])
+		if !ok {
+			continue
+		}
+		frame := append([]byte{adu[0]}, res...)
+		frame = binary.LittleEndian.AppendUint16(frame, crc16(frame))
+		if _, err := rw.Write(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// Чтение кадра запроса Modbus-RTU. Длина кадра определяется функцией. Возвращается кадр и ошибка.
+func readRequestRTU(r io.Reader) ([]byte, error) {
+
+	// адрес, функция, адрес регистра, количество (значение)
+	adu := make([]byte, 6, maxADU)
+	if _, err := io.ReadFull(r, adu); err != nil {
+		return nil, err
+	}
+
+	size := 8
+	switch adu[1] {
+	case modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters:
+		// количество байт данных
+		adu = adu[:7]
+		if _, err := io.ReadFull(r, adu[6:]); err != nil {
+			return nil, err
+		}
+		size = 7 + int(adu[6]) + 2
+	}
+
+	n := len(adu)
+	adu = adu[:size]
+	if _, err := io.ReadFull(r, adu[n:]); err != nil {
+		return nil, err
+	}
+
+	return adu, nil
+}
+
+// Открытие UDP порта. Каждая датаграмма - кадр Modbus-TCP (MBAP). Возвращается порт и ошибка.
+func (sim *SimT) listenUDP(ep *endpointT) (io.Closer, error) {
+
+	pc, err := net.ListenPacket("udp", ep.Address)
+	if err != nil {
+		return nil, err
+	}
+	ep.Addr = pc.LocalAddr().String()
+
+	go func() {
+		buf := make([]byte, maxADU)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 8 || int(binary.BigEndian.Uint16(buf[4:])) != n-6 {
+				continue
+			}
+			res, ok := sim.handle(ep, buf[6], append([]byte{}, buf[7:n]...))
+			if !ok {
+				continue
+			}
+			_, _ = pc.WriteTo(mbap(buf[:7], res), addr)
+		}
+	}()
+
+	return pc, nil
+}
+
+// Контрольная сумма CRC16 Modbus. Для кадра с контрольной суммой возвращается 0.
+func crc16(data []byte) uint16 {
+
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
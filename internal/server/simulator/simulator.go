@@ -0,0 +1,519 @@
+package simulator
+
+import (
+	"blackbox/internal/server/codec"
+	"blackbox/internal/server/libre"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Таблицы данных слейва
+const (
+	tabCoils = iota
+	tabDiscrete
+	tabHolding
+	tabInput
+	tabCount
+)
+
+type (
+	// Настройки симулятора
+	ConfT struct {
+		Gen          string            // генератор тэгов по умолчанию
+		Tags         map[string]string // генераторы тэгов по ключу "устройство/тэг"
+		Faults       map[string]string // постоянная неисправность устройства: timeout или exception
+		TimeoutPct   float64           // вероятность отсутствия ответа на запрос, %
+		ExceptionPct float64           // вероятность ответа исключением 04, %
+		ListenAny    bool              // прослушивание портов конфигурации на всех интерфейсах
+		ComPath      string            // префикс пути COM порта, по которому создаётся ссылка на pty
+		Tick         time.Duration     // период обновления значений генераторов
+	}
+
+	// Симулятор слейвов конфигурации
+	SimT struct {
+		conf  ConfT
+		start time.Time
+
+		mu        sync.Mutex
+		endpoints []*endpointT
+		tags      []*tagT
+	}
+
+	// Точка подключения: порт TCP/UDP или COM порт со слейвами
+	endpointT struct {
+		Name    string // наименование для журнала
+		ConType string // TCP, RTU-TCP, UDP, COM
+		Address string // адрес прослушивания или путь COM порта
+		Addr    string // фактический адрес после запуска
+		slaves  map[byte]*slaveT
+	}
+
+	// Слейв: значения таблиц по адресам (у дискретов 0 или 1)
+	slaveT struct {
+		Device string
+		fault  string
+		tables [tabCount]map[uint16]uint16
+	}
+
+	// Тэг с генератором значения
+	tagT struct {
+		key      string
+		slave    *slaveT
+		table    int
+		address  uint16
+		dataType string
+		format   string
+		gen      *GenT // nil у тэгов записи: значение задаёт мастер
+	}
+)
+
+// Создание симулятора по конфигурации импорта. Каждому устройству создаётся слейв с тэгами
+// конфигурации. Функция возвращает симулятор и ошибку.
+//
+// Параметры:
+//
+// cnf - конфигурация импорта
+// conf - настройки симулятора
+func New(cnf libre.ConfXLSX_Import, conf ConfT) (*SimT, error) {
+
+	if conf.Tick <= 0 {
+		conf.Tick = 100 * time.Millisecond
+	}
+
+	sim := &SimT{conf: conf}
+
+	hosts := make(map[string]libre.SheetMain_Head)
+	for _, h := range cnf.SheetMain_Header {
+		hosts[h.Host] = h
+	}
+
+	// Слейвы устройств по точкам подключения
+	slaves := make(map[string]*slaveT)
+	rtu := make(map[string]bool) // устройства драйвера Modbus-RTU (формат тэгов - codec.RTUFormat)
+	for _, d := range cnf.SheetMain_Dev {
+
+		h, ok := hosts[d.Host]
+		if !ok {
+			return nil, fmt.Errorf("у устройства {%s} не найден хост {%s}", d.Device, d.Host)
+		}
+
+		ep, err := sim.endpoint(h, d)
+		if err != nil {
+			return nil, err
+		}
+		rtu[d.Device] = h.ConType != "TCP"
+
+		id, err := strconv.Atoi(d.Address)
+		if err != nil || id < 0 || id > 247 {
+			return nil, fmt.Errorf("у устройства {%s} сетевой адрес {%s} вне диапазона 0..247", d.Device, d.Address)
+		}
+		if s, ok := ep.slaves[byte(id)]; ok {
+			slaves[d.Device] = s
+			continue
+		}
+
+		s := &slaveT{Device: d.Device, fault: conf.Faults[d.Device]}
+		for i := range s.tables {
+			s.tables[i] = make(map[uint16]uint16)
+		}
+		ep.slaves[byte(id)] = s
+		slaves[d.Device] = s
+	}
+
+	// Тэги устройств
+	for _, dev := range cnf.SheetsDev {
+		for _, ch := range dev.Conf {
+			if rtu[dev.Name] {
+				ch.Format = codec.RTUFormat(ch.Format)
+			}
+			tag, err := sim.newTag(slaves[dev.Name], dev.Name, ch)
+			if err != nil {
+				return nil, fmt.Errorf("тэг {%s} устройства {%s}: %v", ch.Comment, dev.Name, err)
+			}
+			sim.tags = append(sim.tags, tag)
+		}
+	}
+
+	return sim, nil
+}
+
+// Точка подключения устройства. Создаётся при первом обращении. Возвращается точка подключения и ошибка.
+func (sim *SimT) endpoint(h libre.SheetMain_Head, d libre.SheetMain_Dev) (*endpointT, error) {
+
+	ep := &endpointT{ConType: h.ConType, slaves: make(map[byte]*slaveT)}
+
+	switch h.ConType {
+	case "TCP":
+		ep.Name = h.Host + "@" + d.IP + "/" + d.Port
+		ep.Address = net.JoinHostPort(d.IP, d.Port)
+		if sim.conf.ListenAny {
+			ep.Address = net.JoinHostPort("", d.Port)
+		}
+	case "RTU-TCP", "UDP":
+		ep.Name = h.Host
+		ep.Address = net.JoinHostPort(h.Address, h.Port)
+		if sim.conf.ListenAny {
+			ep.Address = net.JoinHostPort("", h.Port)
+		}
+	case "COM":
+		ep.Name = h.Host
+		ep.Address = sim.conf.ComPath + h.Port
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип коннекта {%s} хоста {%s}", h.ConType, h.Host)
+	}
+
+	for _, e := range sim.endpoints {
+		if e.ConType == ep.ConType && e.Address == ep.Address {
+			return e, nil
+		}
+	}
+	sim.endpoints = append(sim.endpoints, ep)
+
+	return ep, nil
+}
+
+// Создание тэга слейва. Адреса тэга добавляются в таблицу слейва. Возвращается тэг и ошибка.
+func (sim *SimT) newTag(s *slaveT, device string, ch libre.DevConf_Import) (*tagT, error) {
+
+	if s == nil {
+		return nil, fmt.Errorf("устройство не описано на главной вкладке")
+	}
+
+	tag := &tagT{
+		key:      device + "/" + ch.Comment,
+		slave:    s,
+		dataType: ch.DataType,
+		format:   ch.Format,
+	}
+
+	switch ch.FuncType {
+	case "ReadCoil", "WriteSingleCoil", "WriteMultipleCoils":
+		tag.table = tabCoils
+	case "ReadDiscreteInputs":
+		tag.table = tabDiscrete
+	case "ReadHoldingRegisters", "WriteSingleRegister", "WriteMultipleRegisters":
+		tag.table = tabHolding
+	case "ReadInputRegisters":
+		tag.table = tabInput
+	default:
+		return nil, fmt.Errorf("неподдерживаемая функция {%s}", ch.FuncType)
+	}
+
+	address, err := strconv.ParseUint(ch.Address, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("адрес {%s} не число 0..65535", ch.Address)
+	}
+	tag.address = uint16(address)
+
+	regs, err := codec.Regs(ch.DataType)
+	if err != nil {
+		return nil, err
+	}
+	for i := range regs {
+		s.tables[tag.table][tag.address+uint16(i)] = 0
+	}
+
+	// значение тэга записи задаёт мастер
+	if strings.HasPrefix(ch.FuncType, "Write") {
+		return tag, nil
+	}
+
+	// диапазон по умолчанию: дискрет 0..1, исходный диапазон масштабирования, либо 0..100
+	def := GenT{Min: 0, Max: 100}
+	if libre.IsDiscreteType(ch.DataType) && !strings.HasPrefix(ch.DataType, "String") {
+		def.Max = 1
+	}
+	rawMin, err1 := strconv.ParseFloat(strings.Replace(ch.RawMin, ",", ".", 1), 64)
+	rawMax, err2 := strconv.ParseFloat(strings.Replace(ch.RawMax, ",", ".", 1), 64)
+	if err1 == nil && err2 == nil {
+		def.Min, def.Max = rawMin, rawMax
+	}
+
+	spec := sim.conf.Gen
+	if v, ok := sim.conf.Tags[tag.key]; ok {
+		spec = v
+	}
+	if spec == "" {
+		spec = "sine"
+	}
+
+	gen, err := ParseGen(spec, def)
+	if err != nil {
+		return nil, err
+	}
+	tag.gen = &gen
+
+	return tag, sim.set(tag, gen.Value(0))
+}
+
+// Обновление значений тэгов по генераторам.
+//
+// Параметры:
+//
+// now - текущее время
+func (sim *SimT) update(now time.Time) error {
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	for _, tag := range sim.tags {
+		if tag.gen == nil {
+			continue
+		}
+		err := sim.set(tag, tag.gen.Value(now.Sub(sim.start)))
+		if err != nil {
+			return fmt.Errorf("тэг {%s}: %v", tag.key, err)
+		}
+	}
+
+	return nil
+}
+
+// Запись значения генератора в таблицу слейва по типу и формату тэга. Значение ограничивается
+// диапазоном типа. Вызывается под блокировкой. Возвращается ошибка.
+func (sim *SimT) set(tag *tagT, v float64) error {
+
+	tab := tag.slave.tables[tag.table]
+	base, param, err := codec.SplitType(tag.dataType)
+	if err != nil {
+		return err
+	}
+
+	// регистр, выраженный значением Word в формате тэга
+	word := func() (uint16, error) {
+		w, err := codec.Decode(codec.Bytes([]uint16{tab[tag.address]}), "Word", tag.format)
+		if err != nil {
+			return 0, err
+		}
+		return w.(uint16), nil
+	}
+	setWord := func(reg uint16, w uint16) error {
+		b, err := codec.Encode(strconv.FormatUint(uint64(w), 10), "Word", tag.format)
+		if err != nil {
+			return err
+		}
+		tab[reg] = codec.Registers(b)[0]
+		return nil
+	}
+
+	switch base {
+
+	case "Bool":
+		tab[tag.address] = 0
+		if v >= 0.5 {
+			tab[tag.address] = 1
+		}
+		return nil
+
+	case "Bit", "UInt8Hi", "UInt8Lo", "Int8Hi", "Int8Lo":
+		w, err := word()
+		if err != nil {
+			return err
+		}
+		switch base {
+		case "Bit":
+			w &^= 1 << param
+			if v >= 0.5 {
+				w |= 1 << param
+			}
+		case "UInt8Hi":
+			w = w&0x00FF | uint16(clamp(v, 0, math.MaxUint8))<<8
+		case "UInt8Lo":
+			w = w&0xFF00 | uint16(clamp(v, 0, math.MaxUint8))
+		case "Int8Hi":
+			w = w&0x00FF | uint16(uint8(int8(clamp(v, math.MinInt8, math.MaxInt8))))<<8
+		case "Int8Lo":
+			w = w&0xFF00 | uint16(uint8(int8(clamp(v, math.MinInt8, math.MaxInt8))))
+		}
+		return setWord(tag.address, w)
+
+	case "String":
+		// значение генератора текстом, дополненное нулевыми байтами
+		text := make([]byte, 2*param)
+		copy(text, strconv.FormatFloat(math.Round(v), 'f', -1, 64))
+		for i := range param {
+			err = setWord(tag.address+uint16(i), uint16(text[2*i])<<8|uint16(text[2*i+1]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var s string
+	switch base {
+	case "Word":
+		s = strconv.FormatFloat(clamp(v, 0, math.MaxUint16), 'f', 0, 64)
+	case "ShortInt":
+		s = strconv.FormatFloat(clamp(v, math.MinInt16, math.MaxInt16), 'f', 0, 64)
+	case "Integer":
+		s = strconv.FormatFloat(clamp(v, math.MinInt32, math.MaxInt32), 'f', 0, 64)
+	case "DWord":
+		s = strconv.FormatFloat(clamp(v, 0, math.MaxUint32), 'f', 0, 64)
+	case "Int64":
+		s = strconv.FormatInt(int64(clamp(v, math.MinInt64, 1<<62)), 10)
+	case "UInt64":
+		s = strconv.FormatUint(uint64(clamp(v, 0, 1<<63)), 10)
+	case "BCD16":
+		s = strconv.FormatFloat(clamp(v, 0, 9999), 'f', 0, 64)
+	case "BCD32":
+		s = strconv.FormatFloat(clamp(v, 0, 99999999), 'f', 0, 64)
+	case "Float":
+		s = strconv.FormatFloat(v, 'g', -1, 32)
+	default:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	b, err := codec.Encode(s, tag.dataType, tag.format)
+	if err != nil {
+		return err
+	}
+	for i, r := range codec.Registers(b) {
+		tab[tag.address+uint16(i)] = r
+	}
+
+	return nil
+}
+
+// Ограничение значения диапазоном с округлением до целого. Возвращается значение.
+func clamp(v, lo, hi float64) float64 {
+	return max(lo, min(hi, math.Round(v)))
+}
+
+// Обработка запроса слейву. Возвращается PDU ответа и признак ответа (false - слейв не отвечает).
+//
+// Параметры:
+//
+// ep - точка подключения
+// slave - адрес слейва
+// pdu - PDU запроса
+func (sim *SimT) handle(ep *endpointT, slave byte, pdu []byte) ([]byte, bool) {
+
+	s, ok := ep.slaves[slave]
+	if !ok || len(pdu) == 0 {
+		return nil, false
+	}
+	fn := pdu[0]
+
+	// Внесение неисправностей
+	switch {
+	case s.fault == "timeout" || rand.Float64()*100 < sim.conf.TimeoutPct:
+		return nil, false
+	case s.fault == "exception" || rand.Float64()*100 < sim.conf.ExceptionPct:
+		return exception(fn, modbus.ExceptionCodeServerDeviceFailure), true
+	}
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if len(pdu) < 5 {
+		return exception(fn, modbus.ExceptionCodeIllegalDataValue), true
+	}
+	address := binary.BigEndian.Uint16(pdu[1:])
+	value := binary.BigEndian.Uint16(pdu[3:])
+
+	// Наличие адресов в таблице
+	exist := func(tab int, quantity uint16) bool {
+		for i := range quantity {
+			if _, ok := s.tables[tab][address+i]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch fn {
+
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		tab := tabCoils
+		if fn == modbus.FuncCodeReadDiscreteInputs {
+			tab = tabDiscrete
+		}
+		if value < 1 || value > 2000 {
+			return exception(fn, modbus.ExceptionCodeIllegalDataValue), true
+		}
+		if !exist(tab, value) {
+			return exception(fn, modbus.ExceptionCodeIllegalDataAddress), true
+		}
+		res := make([]byte, 2+(value+7)/8)
+		res[0], res[1] = fn, byte((value+7)/8)
+		for i := range value {
+			if s.tables[tab][address+i] != 0 {
+				res[2+i/8] |= 1 << (i % 8)
+			}
+		}
+		return res, true
+
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		tab := tabHolding
+		if fn == modbus.FuncCodeReadInputRegisters {
+			tab = tabInput
+		}
+		if value < 1 || value > 125 {
+			return exception(fn, modbus.ExceptionCodeIllegalDataValue), true
+		}
+		if !exist(tab, value) {
+			return exception(fn, modbus.ExceptionCodeIllegalDataAddress), true
+		}
+		res := []byte{fn, byte(2 * value)}
+		for i := range value {
+			res = binary.BigEndian.AppendUint16(res, s.tables[tab][address+i])
+		}
+		return res, true
+
+	case modbus.FuncCodeWriteSingleCoil:
+		if value != 0xFF00 && value != 0x0000 {
+			return exception(fn, modbus.ExceptionCodeIllegalDataValue), true
+		}
+		if !exist(tabCoils, 1) {
+			return exception(fn, modbus.ExceptionCodeIllegalDataAddress), true
+		}
+		s.tables[tabCoils][address] = value >> 15
+		return pdu[:5], true
+
+	case modbus.FuncCodeWriteSingleRegister:
+		if !exist(tabHolding, 1) {
+			return exception(fn, modbus.ExceptionCodeIllegalDataAddress), true
+		}
+		s.tables[tabHolding][address] = value
+		return pdu[:5], true
+
+	case modbus.FuncCodeWriteMultipleCoils, modbus.FuncCodeWriteMultipleRegisters:
+		tab, size := tabCoils, int(value+7)/8
+		if fn == modbus.FuncCodeWriteMultipleRegisters {
+			tab, size = tabHolding, 2*int(value)
+		}
+		if value < 1 || len(pdu) < 6 || int(pdu[5]) != size || len(pdu) < 6+size {
+			return exception(fn, modbus.ExceptionCodeIllegalDataValue), true
+		}
+		if !exist(tab, value) {
+			return exception(fn, modbus.ExceptionCodeIllegalDataAddress), true
+		}
+		data := pdu[6:]
+		for i := range value {
+			if tab == tabCoils {
+				s.tables[tab][address+i] = uint16(data[i/8]>>(i%8)) & 1
+			} else {
+				s.tables[tab][address+i] = binary.BigEndian.Uint16(data[2*i:])
+			}
+		}
+		return pdu[:5], true
+
+	default:
+		return exception(fn, modbus.ExceptionCodeIllegalFunction), true
+	}
+}
+
+// PDU исключения. Возвращается PDU.
+func exception(fn byte, code byte) []byte {
+	return []byte{fn | 0x80, code}
+}
@@ -0,0 +1,206 @@
+package simulator
+
+import (
+	"blackbox/internal/server/codec"
+	"blackbox/internal/server/libre"
+	modbusrtumaster "blackbox/internal/server/modbusRTUmaster"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/goburrow/modbus"
+)
+
+// Конфигурация: хосты TCP, RTU-TCP и UDP на свободных портах
+func testConf() libre.ConfXLSX_Import {
+
+	tags := []libre.DevConf_Import{
+		{Address: "0", Comment: "Word", DataType: "Word", FuncType: "ReadHoldingRegisters", Format: "1_0"},
+		{Address: "2", Comment: "Float", DataType: "Float", FuncType: "ReadHoldingRegisters", Format: "CDAB"},
+		{Address: "4", Comment: "Bit", DataType: "Bit.3", FuncType: "ReadInputRegisters", Format: "1_0"},
+		{Address: "5", Comment: "Text", DataType: "String.2", FuncType: "ReadInputRegisters", Format: "1_0"},
+		{Address: "0", Comment: "Coil", DataType: "Bool", FuncType: "ReadCoil", Format: "1_0"},
+		{Address: "10", Comment: "Set", DataType: "Word", FuncType: "WriteSingleRegister", Format: "1_0"},
+		{Address: "20", Comment: "Ramp", DataType: "Word", FuncType: "ReadHoldingRegisters", Format: "1_0", RawMin: "0", RawMax: "10"},
+	}
+
+	// те же тэги в формате Modbus-RTU (номера байт от старшего байта значения)
+	rtuTags := slices.Clone(tags)
+	for i := range rtuTags {
+		rtuTags[i].Format = codec.RTUFormat(rtuTags[i].Format)
+	}
+
+	return libre.ConfXLSX_Import{
+		SheetMain_Header: []libre.SheetMain_Head{
+			{Host: "Eth", ConType: "TCP"},
+			{Host: "Gw", ConType: "RTU-TCP", Address: "127.0.0.1", Port: "0"},
+			{Host: "Udp", ConType: "UDP", Address: "127.0.0.1", Port: "0"},
+		},
+		SheetMain_Dev: []libre.SheetMain_Dev{
+			{Device: "D1", Host: "Eth", Address: "1", IP: "127.0.0.1", Port: "0"},
+			{Device: "D2", Host: "Gw", Address: "7"},
+			{Device: "D3", Host: "Udp", Address: "1"},
+			{Device: "D4", Host: "Udp", Address: "2"},
+		},
+		SheetsDev: []libre.Dev{
+			{Name: "D1", Conf: tags}, {Name: "D2", Conf: rtuTags}, {Name: "D3", Conf: rtuTags}, {Name: "D4", Conf: rtuTags},
+		},
+	}
+}
+
+func testSim(t *testing.T) *SimT {
+
+	sim, err := New(testConf(), ConfT{
+		Gen:    "const:12",
+		Tags:   map[string]string{"D1/Float": "const:1.5", "D2/Float": "const:1.5", "D3/Float": "const:1.5", "D1/Ramp": "ramp"},
+		Faults: map[string]string{"D4": "timeout"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sim
+}
+
+func TestParseGen(t *testing.T) {
+
+	def := GenT{Min: 0, Max: 10}
+
+	for spec, want := range map[string]GenT{
+		"ramp":          {Kind: "ramp", Min: 0, Max: 10, Period: defaultPeriod},
+		"Sine:-5:5:10s": {Kind: "sine", Min: -5, Max: 5, Period: 10 * time.Second},
+		"random:1,5:2":  {Kind: "random", Min: 1.5, Max: 2, Period: defaultPeriod},
+		"const:3":       {Kind: "const", Min: 3, Max: 3, Period: defaultPeriod},
+		"const":         {Kind: "const", Min: 0, Max: 0, Period: defaultPeriod},
+	} {
+		got, err := ParseGen(spec, def)
+		if err != nil || got != want {
+			t.Fatalf("%s: ожидалось {%+v}, получено {%+v}, %v", spec, want, got, err)
+		}
+	}
+
+	for _, spec := range []string{"", "saw", "ramp:1", "ramp:a:2", "sine:0:1:0s", "const:1:2"} {
+		if _, err := ParseGen(spec, def); err == nil {
+			t.Fatalf("%s: ожидалась ошибка", spec)
+		}
+	}
+
+	g := GenT{Kind: "ramp", Min: 0, Max: 10, Period: 10 * time.Second}
+	if v := g.Value(12 * time.Second); v != 2 {
+		t.Fatalf("ramp: ожидалось 2, получено %v", v)
+	}
+	g.Kind = "sine"
+	if v := g.Value(0); v != 5 {
+		t.Fatalf("sine: ожидалось 5, получено %v", v)
+	}
+}
+
+func TestHandle(t *testing.T) {
+
+	sim := testSim(t)
+	ep := sim.endpoints[0]
+
+	tests := []struct {
+		req, want []byte
+	}{
+		{[]byte{3, 0, 0, 0, 1}, []byte{3, 2, 0, 12}},
+		{[]byte{3, 0, 2, 0, 2}, []byte{3, 4, 0, 0, 0x3F, 0xC0}},     // 1.5 в формате CDAB
+		{[]byte{4, 0, 4, 0, 3}, []byte{4, 6, 0, 8, '1', '2', 0, 0}}, // бит 3 и строка
+		{[]byte{1, 0, 0, 0, 1}, []byte{1, 1, 1}},
+		{[]byte{6, 0, 10, 0, 77}, []byte{6, 0, 10, 0, 77}},
+		{[]byte{3, 0, 10, 0, 1}, []byte{3, 2, 0, 77}},
+		{[]byte{16, 0, 10, 0, 1, 2, 0, 5}, []byte{16, 0, 10, 0, 1}},
+		{[]byte{3, 0, 10, 0, 1}, []byte{3, 2, 0, 5}},
+		{[]byte{3, 0, 100, 0, 1}, []byte{0x83, 2}}, // нет адреса
+		{[]byte{3, 0, 0, 0, 2}, []byte{0x83, 2}},   // часть диапазона вне таблицы
+		{[]byte{3, 0, 0, 0, 0}, []byte{0x83, 3}},
+		{[]byte{16, 0, 10, 0, 1, 3, 0, 5}, []byte{0x90, 3}},
+		{[]byte{0x2B, 0, 0, 0, 0}, []byte{0xAB, 1}},
+	}
+
+	for _, tt := range tests {
+		got, ok := sim.handle(ep, 1, tt.req)
+		if !ok || !slices.Equal(got, tt.want) {
+			t.Fatalf("% x: ожидалось % x, получено % x", tt.req, tt.want, got)
+		}
+	}
+
+	// неизвестный слейв не отвечает
+	if _, ok := sim.handle(ep, 9, []byte{3, 0, 0, 0, 1}); ok {
+		t.Fatal("ожидалось отсутствие ответа")
+	}
+
+	// исключение 04 по вероятности неисправности
+	sim.conf.ExceptionPct = 100
+	if got, _ := sim.handle(ep, 1, []byte{3, 0, 0, 0, 1}); !slices.Equal(got, []byte{0x83, 4}) {
+		t.Fatalf("ожидалось исключение 04, получено % x", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+
+	sim := testSim(t)
+	tab := sim.endpoints[0].slaves[1].tables[tabHolding]
+
+	for elapsed, want := range map[time.Duration]uint16{0: 0, 30 * time.Second: 5, 54 * time.Second: 9} {
+		if err := sim.update(sim.start.Add(elapsed)); err != nil {
+			t.Fatal(err)
+		}
+		v, _ := codec.Decode(codec.Bytes([]uint16{tab[20]}), "Word", "1_0")
+		if v != want {
+			t.Fatalf("ramp %v: ожидалось %d, получено %v", elapsed, want, v)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+
+	sim := testSim(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := sim.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	addrs := sim.Addrs()
+
+	tcp := modbus.NewTCPClientHandler(addrs[0])
+	tcp.SlaveId = 1
+	tcp.Timeout = time.Second
+	defer tcp.Close()
+
+	rtu := modbusrtumaster.Connect{Name: "Gw", ConType: "RTU-TCP", Address: addrs[1], SlaveAddr: 7}
+	udp := modbusrtumaster.Connect{Name: "Udp", ConType: "UDP", Address: addrs[2], SlaveAddr: 1}
+	for _, c := range []*modbusrtumaster.Connect{&rtu, &udp} {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	for name, client := range map[string]modbus.Client{
+		"TCP":     modbus.NewClient(tcp),
+		"RTU-TCP": rtu.Client,
+		"UDP":     udp.Client,
+	} {
+		res, err := client.ReadHoldingRegisters(0, 1)
+		if err != nil || !slices.Equal(res, []byte{0, 12}) {
+			t.Fatalf("%s: ожидалось 00 0c, получено % x, %v", name, res, err)
+		}
+		if _, err := client.WriteMultipleRegisters(10, 1, []byte{0, 3}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var exc *modbus.ModbusError
+		if _, err := client.ReadInputRegisters(50, 1); !errors.As(err, &exc) || exc.ExceptionCode != 2 {
+			t.Fatalf("%s: ожидалось исключение 02, получено {%v}", name, err)
+		}
+	}
+
+	// устройство с неисправностью timeout не отвечает
+	udp.ChangeSlaveID(2)
+	if _, err := udp.Client.ReadHoldingRegisters(0, 1); err == nil {
+		t.Fatal("ожидалась ошибка таймаута")
+	}
+}
@@ -0,0 +1,215 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Состояния рабочей Go рутины
+const (
+	StateRunning    = "running"    // выполняется
+	StateRestarting = "restarting" // завершилась с ошибкой, ожидает перезапуска
+	StateStopped    = "stopped"    // завершена по контексту
+)
+
+// Параметры перезапуска
+const (
+	backoffMin = 1 * time.Second  // пауза перед первым перезапуском
+	backoffMax = 60 * time.Second // наибольшая пауза между перезапусками
+	stableRun  = 5 * time.Minute  // работа без сбоя, после которой пауза сбрасывается до наименьшей
+)
+
+type (
+	// Функция рабочей Go рутины. Возвращает nil при завершении по контексту, иначе - причину сбоя.
+	WorkFunc func(ctx context.Context) error
+
+	// Супервизор рабочих Go рутин
+	SupervisorT struct {
+		mu       sync.Mutex
+		workers  map[string]*workerT
+		onChange func(info HealthInfoT) // уведомление о смене состояния (может быть nil)
+	}
+
+	workerT struct {
+		state       string
+		restarts    int
+		lastErr     string
+		lastErrTime time.Time
+		since       time.Time
+	}
+
+	// Снимок состояния рабочей Go рутины
+	HealthInfoT struct {
+		Name        string // наименование
+		State       string // состояние
+		Restarts    int    // количество перезапусков
+		LastErr     string // причина последнего сбоя
+		LastErrTime string // время последнего сбоя
+		Since       string // время перехода в текущее состояние
+	}
+)
+
+// Создание супервизора. Возвращается указатель на супервизор.
+//
+// Параметры:
+//
+// onChange - функция уведомления о смене состояния рабочей Go рутины (может быть nil)
+func New(onChange func(info HealthInfoT)) *SupervisorT {
+	return &SupervisorT{
+		workers:  make(map[string]*workerT),
+		onChange: onChange,
+	}
+}
+
+// Запуск рабочей Go рутины под надзором. При сбое (ошибка или паника) рутина перезапускается
+// с экспоненциальной паузой, до завершения контекста.
+//
+// Параметры:
+//
+// ctx - контекст завершения работы
+// wg - учёт Go
+// name - уникальное наименование рабочей Go рутины
+// work - функция рабочей Go рутины
+func (s *SupervisorT) Go(ctx context.Context, wg *sync.WaitGroup, name string, work WorkFunc) {
+
+	s.set(name, StateRunning, nil, false)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for attempt := 0; ; attempt++ {
+
+			tStart := time.Now()
+			err := run(ctx, work)
+
+			if ctx.Err() != nil {
+				s.set(name, StateStopped, err, false)
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("завершение без отмены контекста")
+			}
+			s.set(name, StateRestarting, err, false)
+
+			// после продолжительной работы без сбоя пауза начинается с наименьшей
+			if time.Since(tStart) >= stableRun {
+				attempt = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				s.set(name, StateStopped, nil, false)
+				return
+			case <-time.After(backoff(attempt)):
+			}
+
+			s.set(name, StateRunning, nil, true)
+		}
+	}()
+}
+
+// Выполнение функции рабочей Go рутины с перехватом паники. Возвращается ошибка.
+func run(ctx context.Context, work WorkFunc) (err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return work(ctx)
+}
+
+// Пауза перед перезапуском. Возвращается длительность паузы.
+//
+// Параметры:
+//
+// attempt - номер попытки, начиная с 0
+func backoff(attempt int) time.Duration {
+
+	d := backoffMin
+	for i := 0; i < attempt && d < backoffMax; i++ {
+		d *= 2
+	}
+	if d > backoffMax {
+		d = backoffMax
+	}
+
+	// разброс в пределах [d/2, d), чтобы перезапуски разных рутин не совпадали
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Установка состояния рабочей Go рутины.
+func (s *SupervisorT) set(name, state string, err error, restart bool) {
+
+	s.mu.Lock()
+
+	w, ok := s.workers[name]
+	if !ok {
+		w = &workerT{}
+		s.workers[name] = w
+	}
+
+	changed := w.state != state
+	if changed {
+		w.state = state
+		w.since = time.Now()
+	}
+	if err != nil {
+		w.lastErr = err.Error()
+		w.lastErrTime = time.Now()
+	}
+	if restart {
+		w.restarts++
+	}
+
+	info := w.info(name)
+
+	s.mu.Unlock()
+
+	if changed && s.onChange != nil {
+		s.onChange(info)
+	}
+}
+
+// Снимок состояния.
+func (w *workerT) info(name string) HealthInfoT {
+
+	info := HealthInfoT{
+		Name:     name,
+		State:    w.state,
+		Restarts: w.restarts,
+		LastErr:  w.lastErr,
+		Since:    w.since.Format("2006-01-02 15:04:05"),
+	}
+	if !w.lastErrTime.IsZero() {
+		info.LastErrTime = w.lastErrTime.Format("2006-01-02 15:04:05")
+	}
+
+	return info
+}
+
+// Снимок состояния всех рабочих Go рутин. Возвращается слайс, упорядоченный по наименованию.
+func (s *SupervisorT) Health() []HealthInfoT {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]HealthInfoT, 0, len(s.workers))
+	for name, w := range s.workers {
+		res = append(res, w.info(name))
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
@@ -0,0 +1,83 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+
+	for attempt := 0; attempt < 10; attempt++ {
+		d := backoff(attempt)
+		if d < backoffMin/2 || d >= backoffMax {
+			t.Fatalf("попытка {%d}: пауза {%v} вне пределов", attempt, d)
+		}
+	}
+}
+
+func TestGo_RestartAfterCrash(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+
+	var calls atomic.Int32
+	done := make(chan struct{})
+
+	s := New(nil)
+	s.Go(ctx, &wg, "worker", func(ctx context.Context) error {
+		switch calls.Add(1) {
+		case 1:
+			panic("сбой")
+		default:
+			close(done)
+			<-ctx.Done()
+			return nil
+		}
+	})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("рабочая Go рутина не перезапущена")
+	}
+
+	h := s.Health()
+	if len(h) != 1 || h[0].State != StateRunning || h[0].Restarts != 1 {
+		t.Fatalf("неверное состояние после перезапуска: %+v", h)
+	}
+	if !strings.Contains(h[0].LastErr, "сбой") {
+		t.Fatalf("не зафиксирована причина сбоя: {%s}", h[0].LastErr)
+	}
+
+	cancel()
+	wg.Wait()
+
+	if h = s.Health(); h[0].State != StateStopped {
+		t.Fatalf("ожидалось состояние {%s}, получено {%s}", StateStopped, h[0].State)
+	}
+}
+
+func TestGo_StopWhileRestarting(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+
+	s := New(nil)
+	s.Go(ctx, &wg, "worker", func(ctx context.Context) error {
+		return errors.New("ошибка")
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	h := s.Health()
+	if h[0].State != StateStopped || h[0].LastErr != "ошибка" {
+		t.Fatalf("неверное состояние: %+v", h[0])
+	}
+}
@@ -0,0 +1,91 @@
+package throughput
+
+import (
+	"sync"
+	"time"
+)
+
+const window = 60 // окно расчёта скорости записи, с
+
+type (
+	// Учёт пропускной способности записи архива
+	MeterT struct {
+		mu        sync.Mutex
+		rows      uint64
+		batches   uint64
+		sumFlush  time.Duration
+		lastFlush time.Duration
+		lastTime  time.Time
+		buckets   [window]uint64 // строки по секундам окна
+		bucketSec [window]int64  // секунда, к которой относится ячейка окна
+	}
+
+	// Снимок пропускной способности
+	InfoT struct {
+		Rows        uint64  // записано строк
+		Batches     uint64  // записано пачек
+		AvgBatch    float64 // средний размер пачки, строк
+		AvgFlushMs  float64 // среднее время записи пачки, мс
+		LastFlushMs float64 // время записи последней пачки, мс
+		LastFlush   string  // время записи последней пачки
+		RowsPerSec  float64 // скорость записи за последнюю минуту, строк/с
+	}
+)
+
+// Учёт записанной пачки.
+//
+// Параметры:
+//
+// rows - количество строк в пачке
+// dur - время записи пачки
+func (m *MeterT) Add(rows int, dur time.Duration) {
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rows += uint64(rows)
+	m.batches++
+	m.sumFlush += dur
+	m.lastFlush = dur
+	m.lastTime = now
+
+	sec := now.Unix()
+	i := sec % window
+	if m.bucketSec[i] != sec {
+		m.bucketSec[i] = sec
+		m.buckets[i] = 0
+	}
+	m.buckets[i] += uint64(rows)
+}
+
+// Снимок пропускной способности. Возвращается снимок.
+func (m *MeterT) Info() InfoT {
+
+	now := time.Now().Unix()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := InfoT{
+		Rows:        m.rows,
+		Batches:     m.batches,
+		LastFlushMs: float64(m.lastFlush.Microseconds()) / 1000,
+	}
+	if m.batches > 0 {
+		info.AvgBatch = float64(m.rows) / float64(m.batches)
+		info.AvgFlushMs = float64(m.sumFlush.Microseconds()) / float64(m.batches) / 1000
+		info.LastFlush = m.lastTime.Format("2006-01-02 15:04:05")
+	}
+
+	var sum uint64
+	for i := range m.buckets {
+		if now-m.bucketSec[i] < window {
+			sum += m.buckets[i]
+		}
+	}
+	info.RowsPerSec = float64(sum) / window
+
+	return info
+}
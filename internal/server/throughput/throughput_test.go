@@ -0,0 +1,67 @@
+package throughput
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInfo(t *testing.T) {
+
+	type addT struct {
+		rows int
+		dur  time.Duration
+	}
+
+	tests := []struct {
+		name string
+		adds []addT
+		want InfoT
+	}{
+		{"нет записей", nil, InfoT{}},
+		{"одна пачка", []addT{{600, 30 * time.Millisecond}},
+			InfoT{Rows: 600, Batches: 1, AvgBatch: 600, AvgFlushMs: 30, LastFlushMs: 30, RowsPerSec: 10}},
+		{"несколько пачек", []addT{{100, 10 * time.Millisecond}, {200, 40 * time.Millisecond}, {300, 1500 * time.Microsecond}},
+			InfoT{Rows: 600, Batches: 3, AvgBatch: 200, AvgFlushMs: 17.166666666666668, LastFlushMs: 1.5, RowsPerSec: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m MeterT
+			for _, a := range tt.adds {
+				m.Add(a.rows, a.dur)
+			}
+
+			got := m.Info()
+			if (got.LastFlush != "") != (tt.want.Batches > 0) {
+				t.Fatalf("время последней пачки {%s} при пачках {%d}", got.LastFlush, tt.want.Batches)
+			}
+			got.LastFlush = ""
+			if got != tt.want {
+				t.Fatalf("ожидалось %+v, получено %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInfo_Window(t *testing.T) {
+
+	var m MeterT
+	m.Add(120, time.Millisecond)
+
+	// Строки старше окна не учитываются в скорости, но остаются в итогах
+	now := time.Now().Unix()
+	for i := range m.bucketSec {
+		if m.bucketSec[i] != 0 {
+			m.bucketSec[i] = now - window
+		}
+	}
+	m.Add(60, time.Millisecond)
+
+	info := m.Info()
+	if info.Rows != 180 || info.Batches != 2 {
+		t.Fatalf("ожидалось строк {180} и пачек {2}, получено {%d} и {%d}", info.Rows, info.Batches)
+	}
+	if info.RowsPerSec != 1 {
+		t.Fatalf("ожидалась скорость {1} строк/с, получено {%v}", info.RowsPerSec)
+	}
+}
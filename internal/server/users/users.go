@@ -1,7 +1,10 @@
 package users
 
 import (
-	"crypto/sha256"
+	"blackbox/internal/server/password"
+	"blackbox/internal/server/role"
+	"blackbox/internal/server/security"
+	"blackbox/internal/server/session"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -21,7 +24,7 @@ type (
 		Id       int
 		Name     string
 		Password string
-		Token    string
+		Role     string
 	}
 )
 
@@ -33,7 +36,12 @@ func (el *UsersT) MenuActionsUsers() {
 	fmt.Println("3. Удаление пользователя")
 	fmt.Println("4. Изменение имени пользователя")
 	fmt.Println("5. Изменение пароля пользователя")
-	fmt.Println("6. Завершение работы")
+	fmt.Println("6. Просмотр сессий пользователя")
+	fmt.Println("7. Отзыв сессий пользователя")
+	fmt.Println("8. Изменение роли пользователя")
+	fmt.Println("9. Просмотр блокировок входа")
+	fmt.Println("10. Снятие блокировки входа")
+	fmt.Println("11. Завершение работы")
 	fmt.Print("Введите номер -> ")
 }
 
@@ -55,7 +63,7 @@ func (el *UsersT) ReadTerminal() (pwd string, err error) {
 func (el *UsersT) ReqDataUsersDB() error {
 
 	// Чтение конфигурации хоста
-	q := fmt.Sprintf("SELECT id, name, password, token FROM %s.%s",
+	q := fmt.Sprintf("SELECT id, name, password, role FROM %s.%s",
 		os.Getenv("TABLE_SCHEMA"),
 		os.Getenv("TABLE_USERS"))
 
@@ -71,7 +79,7 @@ func (el *UsersT) ReqDataUsersDB() error {
 
 		var str UserT
 
-		err = rows.Scan(&str.Id, &str.Name, &str.Password, &str.Token)
+		err = rows.Scan(&str.Id, &str.Name, &str.Password, &str.Role)
 		if err != nil {
 			return fmt.Errorf("ошибка при чтении очередной строки ответа, при запросе данных пользователей: {%v}", err)
 		}
@@ -91,18 +99,17 @@ func (el *UsersT) ShowDataUsers() {
 	fmt.Println()
 	fmt.Printf("Количество пользователей: %d\n", len(el.Users))
 	for _, v := range el.Users {
-		fmt.Printf("id:%d  name:%s  password:%s  token:%s\n", v.Id, v.Name, v.Password, v.Token)
+		fmt.Printf("id:%d  name:%s  role:%s  password:%s\n", v.Id, v.Name, v.Role, v.Password)
 	}
 }
 
-// Функция вычисляет хэш пароля. Возвращает ошибку.
-func (el *UsersT) CalcHashPassword(password string) (hash string, err error) {
+// Функция вычисляет хэш пароля по политике хэширования паролей (argon2id с солью). Возвращает ошибку.
+func (el *UsersT) CalcHashPassword(pwd string) (hash string, err error) {
 
-	if password == "" {
+	if pwd == "" {
 		return "", errors.New("при генерации хэш пароля, принят пустой пароль")
 	}
-	hash = fmt.Sprintf("%x", sha256.Sum256([]byte(password)))
-	return hash, nil
+	return password.Hash(pwd)
 }
 
 // Функция добавляет пользователя в БД. Возвращается ошибка.
@@ -111,23 +118,28 @@ func (el *UsersT) CalcHashPassword(password string) (hash string, err error) {
 //
 // name - имя пользователя
 // hashPwd  - хэш пароля пользователя
-func (el *UsersT) AddUserDB(name, hashPwd string) error {
+// userRole - роль пользователя
+func (el *UsersT) AddUserDB(name, hashPwd, userRole string) error {
 
 	// Проверка входных данных
 	if name == "" || hashPwd == "" {
 		return fmt.Errorf("ошибка входных данных при добавлении пользователя в БД. имя:{%s} хэш:{%s}", name, hashPwd)
 	}
+	userRole, err := role.Parse(userRole)
+	if err != nil {
+		return err
+	}
 	if el.DB == nil {
 		return errors.New("пустой указатель на БД при добавлении пользователя")
 	}
 
 	// Добавление пользователя
-	q := fmt.Sprintf("INSERT INTO %s.%s (name, password, token) VALUES ($1, $2, $3)",
+	q := fmt.Sprintf("INSERT INTO %s.%s (name, password, role) VALUES ($1, $2, $3)",
 		os.Getenv("TABLE_SCHEMA"),
 		os.Getenv("TABLE_USERS"),
 	)
 
-	_, err := el.DB.Exec(q, name, hashPwd, "")
+	_, err = el.DB.Exec(q, name, hashPwd, userRole)
 	if err != nil {
 		return fmt.Errorf("ошибка {%v} при добавлении пользователя {%v} в БД", err, name)
 	}
@@ -196,6 +208,39 @@ func (el *UsersT) ChgUserNameDB(id int, name string) error {
 	return nil
 }
 
+// Функция изменяет роль пользователя в БД. Возвращается ошибка.
+//
+// Параметры:
+//
+// id - номер пользователя в БД
+// userRole - роль пользователя
+func (el *UsersT) ChgUserRoleDB(id int, userRole string) error {
+
+	// Проверка входных данных
+	if id < 1 {
+		return fmt.Errorf("ошибка в значении id {%d}, при изменении роли пользователя в БД", id)
+	}
+	userRole, err := role.Parse(userRole)
+	if err != nil {
+		return err
+	}
+	if el.DB == nil {
+		return errors.New("пустой указатель на БД при изменении роли пользователя в БД")
+	}
+
+	// Выполнение запроса
+	q := fmt.Sprintf("UPDATE %s.%s SET role = $1 WHERE id = $2",
+		os.Getenv("TABLE_SCHEMA"),
+		os.Getenv("TABLE_USERS"))
+
+	_, err = el.DB.Exec(q, userRole, id)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении роли пользователя по id={%d}, на роль {%s}: {%v}", id, userRole, err)
+	}
+
+	return nil
+}
+
 // Функция изменяет имя пользователя в БД. Возвращается ошибка.
 //
 // Параметры:
@@ -278,6 +323,88 @@ func (el *UsersT) UserPasswordByIdDB(id int) (name string, err error) {
 	return name, nil
 }
 
+// Функция выводит в терминал действующие сессии пользователя. Возвращается ошибка.
+//
+// Параметры:
+//
+// name - имя пользователя
+func (el *UsersT) ShowSessionsDB(name string) error {
+
+	list, err := session.List(el.DB, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Сессий пользователя {%s}: %d\n", name, len(list))
+	for _, v := range list {
+		state := "действует"
+		if v.Revoked {
+			state = "отозвана"
+		}
+		fmt.Printf("id:%d  вход:%s  до:%s  запрос:%s  ip:%s  %s\n", v.Id,
+			v.Created.Format("2006-01-02 15:04:05"),
+			v.Expires.Format("2006-01-02 15:04:05"),
+			v.LastUsed.Format("2006-01-02 15:04:05"),
+			v.LastIP, state)
+	}
+
+	return nil
+}
+
+// Функция отзывает сессии пользователя. Возвращает количество отозванных сессий и ошибку.
+//
+// Параметры:
+//
+// name - имя пользователя
+// id - id сессии (0 - все сессии пользователя)
+func (el *UsersT) RevokeSessionsDB(name string, id int) (n int64, err error) {
+
+	if id < 0 {
+		return 0, fmt.Errorf("ошибка в значении id сессии {%d}", id)
+	}
+
+	return session.RevokeUser(el.DB, name, id)
+}
+
+// Функция выводит в терминал блокировки и счётчики неудачных попыток входа. Возвращается ошибка.
+func (el *UsersT) ShowLockoutsDB() error {
+
+	list, err := security.Lockouts(el.DB)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Блокировок и счётчиков неудачных попыток входа: %d\n", len(list))
+	for _, v := range list {
+		state := "не заблокирован"
+		if !v.LockedUntil.IsZero() {
+			state = "заблокирован до " + v.LockedUntil.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%s:%s  неудач:%d  последняя:%s  %s\n", v.Kind, v.Subject, v.Failures,
+			v.LastFail.Format("2006-01-02 15:04:05"), state)
+	}
+
+	return nil
+}
+
+// Функция снимает блокировку входа и сбрасывает счётчик неудачных попыток. Возвращает ошибку.
+//
+// Параметры:
+//
+// kind - user или ip
+// subject - имя пользователя или IP
+func (el *UsersT) ClearLockoutDB(kind, subject string) error {
+
+	err := security.Clear(el.DB, kind, subject)
+	if err != nil {
+		return err
+	}
+
+	return security.Event(el.DB, security.EventLockoutClear, "", "", fmt.Sprintf("%s {%s}: снята из командной строки", kind, subject))
+}
+
 // Функция запрашивает повторение меню. Возвращает true/false для повторения и ошибку.
 func (el *UsersT) RepeatMenu() (b bool, err error) {
 